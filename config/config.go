@@ -4,6 +4,7 @@ package config
 import (
 	"fmt"
 	"log"
+	"regexp"
 	"strings"
 	"time"
 
@@ -17,15 +18,18 @@ var DB *gorm.DB
 
 // Config holds all configuration for the application
 type Config struct {
-	Server   ServerConfig   `mapstructure:"server"`
-	Database DatabaseConfig `mapstructure:"database"`
-	Elastic  ElasticConfig  `mapstructure:"elastic"`
-	Redis    RedisConfig    `mapstructure:"redis"`
-	Logging  LoggingConfig  `mapstructure:"logging"`
-	Security SecurityConfig `mapstructure:"security"`
-	Locking  LockingConfig  `mapstructure:"locking"`
-	Caching  CachingConfig  `mapstructure:"caching"`
-	Spamhaus SpamhausConfig `mapstructure:"spamhaus"`
+	Server     ServerConfig     `mapstructure:"server"`
+	Database   DatabaseConfig   `mapstructure:"database"`
+	Elastic    ElasticConfig    `mapstructure:"elastic"`
+	Search     SearchConfig     `mapstructure:"search"`
+	Redis      RedisConfig      `mapstructure:"redis"`
+	Logging    LoggingConfig    `mapstructure:"logging"`
+	Security   SecurityConfig   `mapstructure:"security"`
+	Locking    LockingConfig    `mapstructure:"locking"`
+	Caching    CachingConfig    `mapstructure:"caching"`
+	Spamhaus   SpamhausConfig   `mapstructure:"spamhaus"`
+	Filtering  FilteringConfig  `mapstructure:"filtering"`
+	Escalation EscalationConfig `mapstructure:"escalation"`
 }
 
 // ServerConfig holds server-related configuration
@@ -57,11 +61,22 @@ type DatabaseConfig struct {
 
 // ElasticConfig holds Elasticsearch-related configuration
 type ElasticConfig struct {
-	Hosts    []string      `mapstructure:"hosts"`
-	Username string        `mapstructure:"username"`
-	Password string        `mapstructure:"password"`
-	Timeout  time.Duration `mapstructure:"timeout"`
-	Index    string        `mapstructure:"index"`
+	Hosts                  []string      `mapstructure:"hosts"`
+	Username               string        `mapstructure:"username"`
+	Password               string        `mapstructure:"password"`
+	APIKey                 string        `mapstructure:"api_key"` // Overrides username/password
+	CACert                 string        `mapstructure:"ca_cert"` // Path to a PEM file, verifies clusters with a private CA
+	CertificateFingerprint string        `mapstructure:"certificate_fingerprint"`
+	Timeout                time.Duration `mapstructure:"timeout"`
+	Index                  string        `mapstructure:"index"` // Prefix of all index names, e.g. "staging" -> "staging-ip-addresses"
+}
+
+// SearchConfig selects where the searchable copies of the rules are kept
+type SearchConfig struct {
+	Backend           string        `mapstructure:"backend"`             // "elasticsearch" or "memory" (in-process, no cluster needed)
+	BulkSize          int           `mapstructure:"bulk_size"`           // Documents per _bulk request of full and incremental syncs
+	BulkFlushInterval time.Duration `mapstructure:"bulk_flush_interval"` // Incomplete batches are sent after this time
+	BulkConcurrency   int           `mapstructure:"bulk_concurrency"`    // _bulk requests in flight at the same time
 }
 
 // RedisConfig holds Redis-related configuration
@@ -124,9 +139,105 @@ type SpamhausConfig struct {
 	ImportURL         string        `mapstructure:"import_url"`
 }
 
+// FilteringConfig holds filter pipeline configuration
+type FilteringConfig struct {
+	// ResolutionStrategy decides between conflicting verdicts:
+	// "first-match-by-priority", "deny-overrides" or "allow-overrides"
+	ResolutionStrategy string `mapstructure:"resolution_strategy"`
+	BatchWorkers       int    `mapstructure:"batch_workers"`   // Concurrent evaluations per batch request
+	BatchMaxItems      int    `mapstructure:"batch_max_items"` // Maximum number of items per batch request
+
+	RuleJanitorInterval time.Duration `mapstructure:"rule_janitor_interval"` // How often expired rules are removed
+	RuleReloadInterval  time.Duration `mapstructure:"rule_reload_interval"`  // How often the rules are reloaded from MySQL to pick up changes of other instances
+	ExpiredRuleAction   string        `mapstructure:"expired_rule_action"`   // "delete" or "archive" (copy to archived_rules, then delete)
+
+	// FailurePolicy decides what a filter error (e.g. an unreachable Redis) means for the request:
+	// "fail-open", "fail-closed" or "mysql-fallback"; FailurePolicies overrides it per filter name
+	FailurePolicy   string            `mapstructure:"failure_policy"`
+	FailurePolicies map[string]string `mapstructure:"failure_policies"`
+
+	ExpressionTimeout time.Duration `mapstructure:"expression_timeout"` // Time budget of the expression rules per request
+
+	EmailNormalization EmailNormalizationConfig `mapstructure:"email_normalization"`
+}
+
+// EmailNormalizationConfig controls how email addresses are canonicalized before filtering
+type EmailNormalizationConfig struct {
+	Enabled         bool                  `mapstructure:"enabled"`           // Disabled: addresses are only lower-cased
+	DefaultCaseFold bool                  `mapstructure:"default_case_fold"` // Lower-case the local part of addresses without a provider
+	Providers       []EmailProviderConfig `mapstructure:"providers"`         // Replaces the built-in providers when set
+}
+
+// EmailProviderConfig describes the alias rules of one mail provider
+type EmailProviderConfig struct {
+	Name                 string   `mapstructure:"name"`
+	Domains              []string `mapstructure:"domains"`               // Domains (Unicode or punycode) served by the provider
+	CanonicalDomain      string   `mapstructure:"canonical_domain"`      // Optional: all domains are rewritten to this one
+	StripDots            bool     `mapstructure:"strip_dots"`            // Dots in the local part are ignored by the provider
+	SubaddressSeparators []string `mapstructure:"subaddress_separators"` // Everything from the first separator on is dropped
+	CaseFold             bool     `mapstructure:"case_fold"`             // Lower-case the local part
+}
+
+// DefaultEmailProviders are the providers used unless filtering.email_normalization.providers is set
+var DefaultEmailProviders = []EmailProviderConfig{
+	{Name: "gmail", Domains: []string{"gmail.com", "googlemail.com"}, CanonicalDomain: "gmail.com", StripDots: true, SubaddressSeparators: []string{"+"}, CaseFold: true},
+	{Name: "gmail-country", Domains: gmailCountryDomains, StripDots: true, CaseFold: true},
+	{Name: "outlook", Domains: []string{"outlook.com", "hotmail.com", "live.com", "msn.com"}, SubaddressSeparators: []string{"+"}, CaseFold: true},
+	{Name: "yahoo", Domains: []string{"yahoo.com", "ymail.com", "rocketmail.com"}, SubaddressSeparators: []string{"-"}, CaseFold: true},
+	{Name: "proton", Domains: []string{"proton.me", "protonmail.com", "protonmail.ch", "pm.me"}, CanonicalDomain: "proton.me", StripDots: true, SubaddressSeparators: []string{"+"}, CaseFold: true},
+	{Name: "icloud", Domains: []string{"icloud.com", "me.com", "mac.com"}, CanonicalDomain: "icloud.com", SubaddressSeparators: []string{"+"}, CaseFold: true},
+}
+
+// gmailCountryDomains are the country domains of Gmail. Dots are ignored there too, but the
+// domain is kept: t.e.s.t@gmail.de normalizes to test@gmail.de.
+var gmailCountryDomains = []string{
+	"gmail.de", "gmail.co.uk", "gmail.fr", "gmail.it", "gmail.es", "gmail.nl", "gmail.se", "gmail.no", "gmail.dk", "gmail.fi",
+	"gmail.pl", "gmail.cz", "gmail.hu", "gmail.ro", "gmail.bg", "gmail.hr", "gmail.si", "gmail.sk", "gmail.lt", "gmail.lv",
+	"gmail.ee", "gmail.pt", "gmail.gr", "gmail.at", "gmail.ch", "gmail.be", "gmail.lu", "gmail.ie", "gmail.mt", "gmail.cy",
+	"gmail.is", "gmail.li", "gmail.mc", "gmail.ad", "gmail.va", "gmail.sm", "gmail.by", "gmail.md", "gmail.ua", "gmail.ge",
+	"gmail.am", "gmail.az", "gmail.kz", "gmail.kg", "gmail.tj", "gmail.tm", "gmail.uz", "gmail.mn", "gmail.kr", "gmail.jp",
+	"gmail.cn", "gmail.hk", "gmail.tw", "gmail.sg", "gmail.my", "gmail.th", "gmail.vn", "gmail.ph", "gmail.id", "gmail.in",
+	"gmail.pk", "gmail.bd", "gmail.lk", "gmail.np", "gmail.mm", "gmail.kh", "gmail.la", "gmail.br", "gmail.ar", "gmail.cl",
+	"gmail.co", "gmail.pe", "gmail.ve", "gmail.ec", "gmail.bo", "gmail.py", "gmail.uy", "gmail.gy", "gmail.sr", "gmail.gf",
+	"gmail.mx", "gmail.ca", "gmail.us", "gmail.au", "gmail.nz", "gmail.fj", "gmail.pg", "gmail.sb", "gmail.vu", "gmail.nc",
+	"gmail.pf", "gmail.ws", "gmail.to", "gmail.ck", "gmail.nu", "gmail.tk", "gmail.wf", "gmail.as", "gmail.gu", "gmail.mp",
+	"gmail.pr", "gmail.vi", "gmail.um", "gmail.af", "gmail.ir", "gmail.iq", "gmail.sa", "gmail.ae", "gmail.om", "gmail.qa",
+	"gmail.bh", "gmail.kw", "gmail.ye", "gmail.jo", "gmail.lb", "gmail.sy", "gmail.il", "gmail.ps", "gmail.eg", "gmail.ly",
+	"gmail.tn", "gmail.dz", "gmail.ma", "gmail.mr", "gmail.sn", "gmail.gm", "gmail.gw", "gmail.gn", "gmail.sl", "gmail.lr",
+	"gmail.ci", "gmail.gh", "gmail.tg", "gmail.bj", "gmail.ne", "gmail.bf", "gmail.ml", "gmail.cf", "gmail.cm", "gmail.td",
+	"gmail.cg", "gmail.ga", "gmail.gq", "gmail.st", "gmail.ao", "gmail.cd", "gmail.zr", "gmail.rw", "gmail.bi", "gmail.mw",
+	"gmail.zm", "gmail.zw", "gmail.na", "gmail.bw", "gmail.ls", "gmail.sz", "gmail.ke", "gmail.tz", "gmail.ug", "gmail.et",
+	"gmail.so", "gmail.dj", "gmail.km", "gmail.mg", "gmail.mu", "gmail.sc", "gmail.re", "gmail.yt",
+}
+
+// EscalationConfig controls the automatic bans of repeat offenders
+type EscalationConfig struct {
+	Enabled  bool               `mapstructure:"enabled"`
+	Interval time.Duration      `mapstructure:"interval"` // How often the traffic log is scanned
+	Policies []EscalationPolicy `mapstructure:"policies"`
+}
+
+// EscalationPolicy bans a value of one field once it was denied more than Threshold times within Window
+type EscalationPolicy struct {
+	Name         string          `mapstructure:"name"`
+	Field        string          `mapstructure:"field"`         // "ip", "email" or "username"
+	Threshold    int             `mapstructure:"threshold"`     // Denials within the window that trigger a ban
+	Window       time.Duration   `mapstructure:"window"`        // Sliding window the denials are counted in
+	BanDurations []time.Duration `mapstructure:"ban_durations"` // Ban length for the 1st, 2nd, ... offense; the last one repeats
+	ResetAfter   time.Duration   `mapstructure:"reset_after"`   // Offenses are forgotten after this long without a ban
+}
+
+// DefaultEscalationPolicies are the policies used unless escalation.policies is set
+var DefaultEscalationPolicies = []EscalationPolicy{
+	{Name: "ip-repeat-offender", Field: "ip", Threshold: 20, Window: 10 * time.Minute, BanDurations: []time.Duration{time.Hour, 6 * time.Hour, 24 * time.Hour, 7 * 24 * time.Hour}, ResetAfter: 30 * 24 * time.Hour},
+}
+
 // Global config instance
 var AppConfig *Config
 
+// validIndexPrefix accepts empty or lowercase Elasticsearch index name prefixes
+var validIndexPrefix = regexp.MustCompile(`^([a-z0-9][a-z0-9._-]{0,99})?$`)
+
 // InitConfig initializes the configuration using Viper
 func InitConfig() {
 	viper.SetConfigName("config")
@@ -196,7 +307,16 @@ func setDefaults() {
 	viper.SetDefault("elastic.username", "")
 	viper.SetDefault("elastic.password", "")
 	viper.SetDefault("elastic.timeout", "30s")
-	viper.SetDefault("elastic.index", "firewall")
+	viper.SetDefault("elastic.api_key", "")
+	viper.SetDefault("elastic.ca_cert", "")
+	viper.SetDefault("elastic.certificate_fingerprint", "")
+	viper.SetDefault("elastic.index", "")
+
+	// Rule index defaults
+	viper.SetDefault("search.backend", "elasticsearch")
+	viper.SetDefault("search.bulk_size", 1000)
+	viper.SetDefault("search.bulk_flush_interval", "1s")
+	viper.SetDefault("search.bulk_concurrency", 4)
 
 	// Redis defaults
 	viper.SetDefault("redis.host", "localhost")
@@ -245,6 +365,24 @@ func setDefaults() {
 	viper.SetDefault("spamhaus.import_schedule", "0 0 * * *") // Daily at midnight (cron format)
 	viper.SetDefault("spamhaus.import_lock_ttl", "30m")
 	viper.SetDefault("spamhaus.import_url", "https://www.spamhaus.org/drop/asndrop.json")
+
+	// Filtering defaults
+	viper.SetDefault("filtering.resolution_strategy", "allow-overrides") // Whitelisted wins, then denied
+	viper.SetDefault("filtering.batch_workers", 8)
+	viper.SetDefault("filtering.batch_max_items", 1000)
+	viper.SetDefault("filtering.rule_janitor_interval", "1m")
+	viper.SetDefault("filtering.rule_reload_interval", "30s")
+	viper.SetDefault("filtering.expired_rule_action", "delete")
+	viper.SetDefault("filtering.failure_policy", "fail-open") // Errors never block requests
+	viper.SetDefault("filtering.expression_timeout", "10ms")
+	viper.SetDefault("filtering.email_normalization.enabled", true)
+	viper.SetDefault("filtering.email_normalization.default_case_fold", true)
+	viper.SetDefault("filtering.email_normalization.providers", DefaultEmailProviders)
+
+	// Escalation defaults
+	viper.SetDefault("escalation.enabled", false)
+	viper.SetDefault("escalation.interval", "1m")
+	viper.SetDefault("escalation.policies", DefaultEscalationPolicies)
 }
 
 // validateConfig validates the configuration
@@ -268,6 +406,26 @@ func validateConfig(config *Config) error {
 		return fmt.Errorf("max idle connections cannot be greater than max open connections")
 	}
 
+	// Validate search configuration
+	if config.Search.Backend != "elasticsearch" && config.Search.Backend != "memory" {
+		return fmt.Errorf("invalid search backend: %s", config.Search.Backend)
+	}
+	if config.Search.BulkSize < 1 {
+		return fmt.Errorf("invalid search bulk size: %d", config.Search.BulkSize)
+	}
+	if config.Search.BulkFlushInterval <= 0 {
+		return fmt.Errorf("invalid search bulk flush interval: %v", config.Search.BulkFlushInterval)
+	}
+	if config.Search.BulkConcurrency < 1 {
+		return fmt.Errorf("invalid search bulk concurrency: %d", config.Search.BulkConcurrency)
+	}
+	if config.Search.Backend == "elasticsearch" && len(config.Elastic.Hosts) == 0 {
+		return fmt.Errorf("at least one elasticsearch host is required")
+	}
+	if !validIndexPrefix.MatchString(config.Elastic.Index) {
+		return fmt.Errorf("invalid elasticsearch index prefix: %s", config.Elastic.Index)
+	}
+
 	// Validate logging configuration
 	validLogLevels := map[string]bool{"debug": true, "info": true, "warn": true, "error": true}
 	if !validLogLevels[config.Logging.Level] {
@@ -279,6 +437,66 @@ func validateConfig(config *Config) error {
 		return fmt.Errorf("invalid rate limit: %d", config.Security.RateLimit)
 	}
 
+	// Validate filtering configuration
+	validStrategies := map[string]bool{"first-match-by-priority": true, "deny-overrides": true, "allow-overrides": true}
+	if !validStrategies[config.Filtering.ResolutionStrategy] {
+		return fmt.Errorf("invalid resolution strategy: %s", config.Filtering.ResolutionStrategy)
+	}
+	if config.Filtering.BatchWorkers < 1 {
+		return fmt.Errorf("invalid batch workers: %d", config.Filtering.BatchWorkers)
+	}
+	if config.Filtering.BatchMaxItems < 1 {
+		return fmt.Errorf("invalid batch max items: %d", config.Filtering.BatchMaxItems)
+	}
+	if config.Filtering.RuleJanitorInterval <= 0 {
+		return fmt.Errorf("invalid rule janitor interval: %v", config.Filtering.RuleJanitorInterval)
+	}
+	if config.Filtering.RuleReloadInterval <= 0 {
+		return fmt.Errorf("invalid rule reload interval: %v", config.Filtering.RuleReloadInterval)
+	}
+	if config.Filtering.ExpiredRuleAction != "delete" && config.Filtering.ExpiredRuleAction != "archive" {
+		return fmt.Errorf("invalid expired rule action: %s", config.Filtering.ExpiredRuleAction)
+	}
+	validFailurePolicies := map[string]bool{"fail-open": true, "fail-closed": true, "mysql-fallback": true}
+	if !validFailurePolicies[config.Filtering.FailurePolicy] {
+		return fmt.Errorf("invalid failure policy: %s", config.Filtering.FailurePolicy)
+	}
+	for filter, policy := range config.Filtering.FailurePolicies {
+		if !validFailurePolicies[policy] {
+			return fmt.Errorf("invalid failure policy for filter %s: %s", filter, policy)
+		}
+	}
+	if config.Filtering.ExpressionTimeout <= 0 {
+		return fmt.Errorf("invalid expression timeout: %v", config.Filtering.ExpressionTimeout)
+	}
+	if config.Escalation.Interval <= 0 {
+		return fmt.Errorf("invalid escalation interval: %v", config.Escalation.Interval)
+	}
+	validEscalationFields := map[string]bool{"ip": true, "email": true, "username": true}
+	for _, policy := range config.Escalation.Policies {
+		if policy.Name == "" || !validEscalationFields[policy.Field] {
+			return fmt.Errorf("invalid escalation policy %q: name and field (ip, email, username) are required", policy.Name)
+		}
+		if policy.Threshold < 1 || policy.Window <= 0 || len(policy.BanDurations) == 0 {
+			return fmt.Errorf("invalid escalation policy %q: threshold, window and ban_durations are required", policy.Name)
+		}
+		for _, duration := range policy.BanDurations {
+			if duration <= 0 {
+				return fmt.Errorf("invalid escalation policy %q: ban durations must be positive", policy.Name)
+			}
+		}
+	}
+	for _, provider := range config.Filtering.EmailNormalization.Providers {
+		if provider.Name == "" || len(provider.Domains) == 0 {
+			return fmt.Errorf("invalid email provider %q: name and domains are required", provider.Name)
+		}
+		for _, separator := range provider.SubaddressSeparators {
+			if separator == "" {
+				return fmt.Errorf("invalid email provider %q: empty subaddress separator", provider.Name)
+			}
+		}
+	}
+
 	return nil
 }
 
@@ -2,30 +2,69 @@
 package config
 
 import (
-	"github.com/elastic/go-elasticsearch/v8"
+	"crypto/tls"
+	"fmt"
 	"log"
 	"net/http"
+	"os"
 	"time"
+
+	"github.com/elastic/go-elasticsearch/v8"
 )
 
 var ESClient *elasticsearch.Client
 
-// InitElasticsearch initializes and returns the Elasticsearch client
-func InitElasticsearch() {
-	cfg := elasticsearch.Config{
-		Addresses: []string{
-			"http://localhost:9200",
-		},
-		Transport: &http.Transport{
-			ResponseHeaderTimeout: 2 * time.Second,
-		},
+// InitElasticsearch initializes the Elasticsearch client from the elastic configuration
+func InitElasticsearch() error {
+	elastic := ElasticConfig{Hosts: []string{"http://localhost:9200"}, Timeout: 30 * time.Second}
+	if AppConfig != nil {
+		elastic = AppConfig.Elastic
 	}
 
+	cfg, err := elastic.clientConfig()
+	if err != nil {
+		return err
+	}
 	es, err := elasticsearch.NewClient(cfg)
 	if err != nil {
-		log.Fatalf("Error creating the Elasticsearch client: %s", err)
+		return fmt.Errorf("error creating the Elasticsearch client: %w", err)
 	}
 
 	ESClient = es
-	log.Println("ES connected successfully")
+	log.Printf("Elasticsearch client created for %v (index prefix %q)", elastic.Hosts, elastic.Index)
+	return nil
+}
+
+// clientConfig builds the client configuration; certificates are always verified,
+// against the system roots or the configured CA certificate/fingerprint
+func (c *ElasticConfig) clientConfig() (elasticsearch.Config, error) {
+	timeout := c.Timeout
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+
+	// The default transport keeps its proxy, dial and idle connection settings
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.ResponseHeaderTimeout = timeout
+	if transport.TLSClientConfig == nil {
+		transport.TLSClientConfig = &tls.Config{}
+	}
+	transport.TLSClientConfig.MinVersion = tls.VersionTLS12
+
+	cfg := elasticsearch.Config{
+		Addresses:              c.Hosts,
+		Username:               c.Username,
+		Password:               c.Password,
+		APIKey:                 c.APIKey,
+		CertificateFingerprint: c.CertificateFingerprint,
+		Transport:              transport,
+	}
+	if c.CACert != "" {
+		caCert, err := os.ReadFile(c.CACert)
+		if err != nil {
+			return cfg, fmt.Errorf("failed to read Elasticsearch CA certificate: %w", err)
+		}
+		cfg.CACert = caCert
+	}
+	return cfg, nil
 }
@@ -354,6 +354,44 @@ func GetTrafficLogStats(db *gorm.DB) gin.HandlerFunc {
 	}
 }
 
+// GetMonitorRuleStats returns how many requests each monitor rule matched and would have blocked
+func GetMonitorRuleStats(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		period := c.DefaultQuery("period", "24h")
+		limit, _ := strconv.Atoi(c.DefaultQuery("limit", "100"))
+
+		var startTime, endTime time.Time
+		endTime = time.Now()
+
+		switch period {
+		case "1h":
+			startTime = endTime.Add(-1 * time.Hour)
+		case "24h":
+			startTime = endTime.Add(-24 * time.Hour)
+		case "7d":
+			startTime = endTime.Add(-7 * 24 * time.Hour)
+		case "30d":
+			startTime = endTime.Add(-30 * 24 * time.Hour)
+		default:
+			startTime = endTime.Add(-24 * time.Hour)
+		}
+
+		trafficLogging := services.NewTrafficLoggingService(db)
+		analytics := services.NewAnalyticsService(db, trafficLogging)
+
+		rules, err := analytics.GetMonitorRuleStats(startTime, endTime, limit)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch monitor rule stats"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"period": period,
+			"rules":  rules,
+		})
+	}
+}
+
 // CleanupOldLogs cleans up old traffic logs
 func CleanupOldLogs(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
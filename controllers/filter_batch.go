@@ -0,0 +1,155 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"firewall/config"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// BatchFilterItem is the result of one item of a batch request
+type BatchFilterItem struct {
+	Index  int         `json:"index"`
+	Status int         `json:"status"`           // HTTP status the single endpoint would have returned
+	Result interface{} `json:"result,omitempty"` // FilterResult, or FilterDecision in explain mode
+	Error  string      `json:"error,omitempty"`
+}
+
+// batchLimits returns the worker pool size and the maximum batch size
+func batchLimits() (workers, maxItems int) {
+	workers, maxItems = 8, 1000
+	if config.AppConfig != nil {
+		if config.AppConfig.Filtering.BatchWorkers > 0 {
+			workers = config.AppConfig.Filtering.BatchWorkers
+		}
+		if config.AppConfig.Filtering.BatchMaxItems > 0 {
+			maxItems = config.AppConfig.Filtering.BatchMaxItems
+		}
+	}
+	return workers, maxItems
+}
+
+// isStreamRequested checks the stream query parameter and the Accept header
+func isStreamRequested(c *gin.Context) bool {
+	stream := c.Query("stream")
+	return stream == "true" || stream == "1" || strings.Contains(c.GetHeader("Accept"), "application/x-ndjson")
+}
+
+// FilterBatchHandler evaluates an array of filter inputs (same fields as POST /api/filter) with a bounded worker pool.
+// Results are returned in input order with per-item errors; with stream=true (or Accept: application/x-ndjson)
+// they are written as NDJSON as soon as all preceding items are done.
+func FilterBatchHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var items []json.RawMessage
+		if err := c.ShouldBindJSON(&items); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input format, expected an array of filter requests", "details": err.Error()})
+			return
+		}
+
+		workers, maxItems := batchLimits()
+		if len(items) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Batch is empty"})
+			return
+		}
+		if len(items) > maxItems {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("Batch too large (max %d items)", maxItems)})
+			return
+		}
+		if workers > len(items) {
+			workers = len(items)
+		}
+
+		ctx := c.Request.Context()
+		metadata := filterRequestMetadata(c)
+		explain := isExplainRequested(c, nil)
+
+		// One buffered channel per item lets the writer consume results in order
+		done := make([]chan BatchFilterItem, len(items))
+		for i := range done {
+			done[i] = make(chan BatchFilterItem, 1)
+		}
+
+		jobs := make(chan int)
+		var wg sync.WaitGroup
+		for w := 0; w < workers; w++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := range jobs {
+					done[i] <- evaluateBatchItem(ctx, db, i, items[i], explain, metadata)
+				}
+			}()
+		}
+		go func() {
+			defer close(jobs)
+			for i := range items {
+				select {
+				case jobs <- i:
+				case <-ctx.Done():
+					// Client went away, fail the remaining items
+					for ; i < len(items); i++ {
+						done[i] <- BatchFilterItem{Index: i, Status: http.StatusServiceUnavailable, Error: "request cancelled"}
+					}
+					return
+				}
+			}
+		}()
+		defer wg.Wait()
+
+		if isStreamRequested(c) {
+			c.Header("Content-Type", "application/x-ndjson")
+			c.Status(http.StatusOK)
+			encoder := json.NewEncoder(c.Writer)
+			for i := range done {
+				if err := encoder.Encode(<-done[i]); err != nil {
+					// Drain the remaining items so the workers can finish
+					for j := i + 1; j < len(done); j++ {
+						<-done[j]
+					}
+					return
+				}
+				c.Writer.Flush()
+			}
+			return
+		}
+
+		results := make([]BatchFilterItem, len(items))
+		for i := range done {
+			results[i] = <-done[i]
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"results": results,
+			"total":   len(results),
+		})
+	}
+}
+
+// evaluateBatchItem decodes and evaluates one batch item; explain applies to the whole batch,
+// an item can also request it with its own explain field
+func evaluateBatchItem(ctx context.Context, db *gorm.DB, index int, raw json.RawMessage, explain bool, metadata map[string]string) BatchFilterItem {
+	var input map[string]interface{}
+	if err := json.Unmarshal(raw, &input); err != nil || input == nil {
+		return BatchFilterItem{Index: index, Status: http.StatusBadRequest, Error: "Invalid input format"}
+	}
+
+	// explain is an option, not a filter field
+	explain = explain || isExplainField(input)
+	delete(input, "explain")
+
+	outcome := evaluateFilterRequest(ctx, db, input, metadata)
+	if outcome.status != http.StatusOK {
+		return BatchFilterItem{Index: index, Status: outcome.status, Error: outcome.err}
+	}
+
+	item := BatchFilterItem{Index: index, Status: http.StatusOK, Result: outcome.decision.FilterResult}
+	if explain {
+		item.Result = outcome.decision
+	}
+	return item
+}
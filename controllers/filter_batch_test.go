@@ -0,0 +1,100 @@
+package controllers
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"firewall/config"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func init() {
+	// The filter cache needs the configuration
+	config.InitConfig()
+}
+
+func newBatchRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/api/filter/batch", FilterBatchHandler(nil))
+	return router
+}
+
+func TestFilterBatchHandler(t *testing.T) {
+	router := newBatchRouter()
+	body := `[
+		{"ip": "192.168.1.10", "country": "DE", "asn": "AS64500"},
+		{"email": "nobody@example.com"},
+		"not an object",
+		{"ip": "not-an-ip"},
+		{"ip": "192.168.1.11", "country": "DE", "asn": "AS64500", "explain": true}
+	]`
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/api/filter/batch", strings.NewReader(body))
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response struct {
+		Results []struct {
+			Index  int                    `json:"index"`
+			Status int                    `json:"status"`
+			Result map[string]interface{} `json:"result"`
+			Error  string                 `json:"error"`
+		} `json:"results"`
+		Total int `json:"total"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, 5, response.Total)
+
+	// Results keep the input order and report per-item errors
+	for i, item := range response.Results {
+		assert.Equal(t, i, item.Index)
+	}
+	assert.Equal(t, http.StatusOK, response.Results[0].Status)
+	assert.Equal(t, "allowed", response.Results[0].Result["result"])
+	assert.Nil(t, response.Results[0].Result["trace"])
+	assert.Equal(t, "IP address is required", response.Results[1].Error)
+	assert.Equal(t, http.StatusBadRequest, response.Results[2].Status)
+	assert.Equal(t, "Invalid IP address format", response.Results[3].Error)
+	assert.NotNil(t, response.Results[4].Result["trace"])
+}
+
+func TestFilterBatchHandler_Stream(t *testing.T) {
+	router := newBatchRouter()
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/api/filter/batch?stream=true", strings.NewReader(`[{"ip": "192.168.1.20", "country": "DE", "asn": "AS64500"}, {"ip": "bad"}]`))
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/x-ndjson", w.Header().Get("Content-Type"))
+
+	var items []BatchFilterItem
+	scanner := bufio.NewScanner(w.Body)
+	for scanner.Scan() {
+		var item BatchFilterItem
+		assert.NoError(t, json.Unmarshal(scanner.Bytes(), &item))
+		items = append(items, item)
+	}
+	assert.Len(t, items, 2)
+	assert.Equal(t, 0, items[0].Index)
+	assert.Equal(t, http.StatusBadRequest, items[1].Status)
+}
+
+func TestFilterBatchHandler_InvalidBody(t *testing.T) {
+	router := newBatchRouter()
+
+	for _, body := range []string{`{"ip": "192.168.1.1"}`, `[]`} {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/api/filter/batch", strings.NewReader(body))
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code, body)
+	}
+}
@@ -2,12 +2,10 @@ package controllers
 
 import (
 	"context"
-	"firewall/config"
 	"firewall/services"
 	"net/http"
 	"time"
 
-	"github.com/elastic/go-elasticsearch/v8/esapi"
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 )
@@ -65,43 +63,30 @@ func HealthCheckHandler(db *gorm.DB) gin.HandlerFunc {
 		}
 		health.Services["database"] = dbHealth
 
-		// Check Elasticsearch
-		esStart := time.Now()
-		var esHealth ServiceHealth
-		es := config.ESClient
-		if es == nil {
-			esHealth = ServiceHealth{
+		// Check the rule index
+		indexStart := time.Now()
+		var indexHealth ServiceHealth
+		index := services.GetRuleIndex()
+		if err := index.Ping(context.Background()); err != nil {
+			indexHealth = ServiceHealth{
 				Status:  "unhealthy",
-				Message: "Elasticsearch client not initialized",
+				Message: "Rule index ping failed: " + err.Error(),
+			}
+			health.Status = "unhealthy"
+		} else if err := services.MappingStatus(context.Background()); err != nil {
+			// Fixed by rebuilding the index, see POST /api/sync/reindex/{index}
+			indexHealth = ServiceHealth{
+				Status:  "unhealthy",
+				Message: "Rule index mapping mismatch: " + err.Error(),
 			}
 			health.Status = "unhealthy"
 		} else {
-			// Ping Elasticsearch
-			req := esapi.PingRequest{}
-			res, err := req.Do(context.Background(), es)
-			if err != nil {
-				esHealth = ServiceHealth{
-					Status:  "unhealthy",
-					Message: "Elasticsearch ping failed: " + err.Error(),
-				}
-				health.Status = "unhealthy"
-			} else {
-				defer res.Body.Close()
-				if res.IsError() {
-					esHealth = ServiceHealth{
-						Status:  "unhealthy",
-						Message: "Elasticsearch returned error: " + res.String(),
-					}
-					health.Status = "unhealthy"
-				} else {
-					esHealth = ServiceHealth{
-						Status:       "healthy",
-						ResponseTime: time.Since(esStart).Milliseconds(),
-					}
-				}
+			indexHealth = ServiceHealth{
+				Status:       "healthy",
+				ResponseTime: time.Since(indexStart).Milliseconds(),
 			}
 		}
-		health.Services["elasticsearch"] = esHealth
+		health.Services[index.Backend()] = indexHealth
 
 		// Check Cache
 		cacheStart := time.Now()
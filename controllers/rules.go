@@ -21,6 +21,7 @@ import (
 	"firewall/config"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
 	"github.com/shirou/gopsutil/v3/cpu"
 	"github.com/shirou/gopsutil/v3/disk"
 	"github.com/shirou/gopsutil/v3/mem"
@@ -96,8 +97,10 @@ func SystemStatsHandler(db *gorm.DB) gin.HandlerFunc {
 			"db_health":      dbHealth,
 			"db_connections": dbStats,
 			"es_health":      esHealth,
+			"search_backend": services.GetRuleIndex().Backend(),
 			"request_count":  requestCount,
 			"error_count":    errorCount,
+			"degraded":       services.DegradedDecisionStats(),
 			"go_routines":    runtime.NumGoroutine(),
 			"pid":            pid,
 			"cache_stats": func() map[string]interface{} {
@@ -150,6 +153,10 @@ func CreateIPAddress(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
+		// Store one form per address, so ::ffff:192.0.2.1 and 192.0.2.1 are the same rule
+		ip.Address = utils.CanonicalIP(ip.Address)
+		setIPRangeFlag(&ip)
+
 		// Check for conflicts with existing entries
 		var existingIPs []models.IP
 		if err := db.Find(&existingIPs).Error; err != nil {
@@ -163,7 +170,7 @@ func CreateIPAddress(db *gorm.DB) gin.HandlerFunc {
 		existingStatuses := make(map[string]string)
 
 		for _, existing := range existingIPs {
-			if existing.IsCIDR {
+			if existing.IsCIDR || existing.IsRange {
 				existingCIDRs = append(existingCIDRs, existing.Address)
 				existingStatuses[existing.Address] = existing.Status
 			} else {
@@ -176,7 +183,7 @@ func CreateIPAddress(db *gorm.DB) gin.HandlerFunc {
 		var conflicts []utils.ConflictInfo
 		var err error
 
-		if ip.IsCIDR {
+		if ip.IsCIDR || ip.IsRange {
 			// New entry is a CIDR range - check for conflicts
 			conflicts, err = utils.CheckCIDRConflicts(ip.Address, existingIPAddresses, existingCIDRs, existingStatuses, ip.Status)
 		} else {
@@ -242,6 +249,15 @@ func CreateIPAddress(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
+		// Validate the validity window and resolve the TTL
+		if validityValidation := applyRuleValidity(&ip.RuleValidity); !validityValidation.IsValid {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Validation failed",
+				"details": validityValidation.Errors,
+			})
+			return
+		}
+
 		// Save to MySQL first
 		if err := db.Create(&ip).Error; err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save IP address"})
@@ -251,8 +267,24 @@ func CreateIPAddress(db *gorm.DB) gin.HandlerFunc {
 		// Publish event for async processing
 		services.PublishEvent("ip", "created", ip)
 
-		c.JSON(http.StatusOK, ip)
+		c.JSON(http.StatusOK, withRangeCIDRs(ip))
+	}
+}
+
+// setIPRangeFlag marks start-end ranges; a range is never a CIDR block
+func setIPRangeFlag(ip *models.IP) {
+	ip.IsRange = utils.IsRangeNotation(ip.Address)
+	if ip.IsRange {
+		ip.IsCIDR = false
+	}
+}
+
+// withRangeCIDRs adds the minimal CIDR decomposition of a range to the response
+func withRangeCIDRs(ip models.IP) models.IP {
+	if ip.IsRange {
+		ip.CIDRs, _ = utils.RangeCIDRs(ip.Address)
 	}
+	return ip
 }
 
 // GetIPAddresses listet alle IP-Adressen mit Paginierung, Filterung und Sortierung
@@ -351,11 +383,14 @@ func GetIPAddresses(db *gorm.DB) gin.HandlerFunc {
 		}
 		if typeFilter != "" {
 			if typeFilter == "single" {
-				conditions = append(conditions, "is_c_id_r = ?")
-				args = append(args, false)
+				conditions = append(conditions, "is_c_id_r = ? AND is_range = ?")
+				args = append(args, false, false)
 			} else if typeFilter == "cidr" {
 				conditions = append(conditions, "is_c_id_r = ?")
 				args = append(args, true)
+			} else if typeFilter == "range" {
+				conditions = append(conditions, "is_range = ?")
+				args = append(args, true)
 			}
 		}
 		if search != "" {
@@ -398,7 +433,7 @@ func GetIPAddresses(db *gorm.DB) gin.HandlerFunc {
 		if len(results) > 0 {
 			total = results[0].TotalCount
 			for _, result := range results {
-				ips = append(ips, result.IP)
+				ips = append(ips, withRangeCIDRs(result.IP))
 			}
 		}
 
@@ -412,23 +447,27 @@ func GetIPAddresses(db *gorm.DB) gin.HandlerFunc {
 // Count-Stats für IPs
 func GetIPStats(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		var total, allowed, denied, whitelisted, single, cidr int64
+		var total, allowed, denied, whitelisted, monitor, single, cidr, ipRange int64
 		db.Model(&models.IP{}).Count(&total)
 		db.Model(&models.IP{}).Where("status = ?", "allowed").Count(&allowed)
 		db.Model(&models.IP{}).Where("status = ?", "denied").Count(&denied)
 		db.Model(&models.IP{}).Where("status = ?", "whitelisted").Count(&whitelisted)
+		db.Model(&models.IP{}).Where("status = ?", "monitor").Count(&monitor)
 
 		// Use the correct column name for CIDR
-		db.Raw("SELECT COUNT(*) FROM ips WHERE is_c_id_r = 0").Scan(&single)
+		db.Raw("SELECT COUNT(*) FROM ips WHERE is_c_id_r = 0 AND is_range = 0").Scan(&single)
 		db.Raw("SELECT COUNT(*) FROM ips WHERE is_c_id_r = 1").Scan(&cidr)
+		db.Raw("SELECT COUNT(*) FROM ips WHERE is_range = 1").Scan(&ipRange)
 
 		c.JSON(http.StatusOK, gin.H{
 			"total":       total,
 			"allowed":     allowed,
 			"denied":      denied,
 			"whitelisted": whitelisted,
+			"monitor":     monitor,
 			"single":      single,
 			"cidr":        cidr,
+			"range":       ipRange,
 		})
 	}
 }
@@ -454,10 +493,12 @@ func UpdateIPAddress(db *gorm.DB) gin.HandlerFunc {
 		}
 
 		var input models.IP
-		if err := c.ShouldBindJSON(&input); err != nil {
+		update := ruleUpdate{}
+		if err := update.bind(c, &input); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input format", "details": err.Error()})
 			return
 		}
+		update.keepOmitted(&input.Priority, &input.RuleValidity, ip.Priority, ip.RuleValidity)
 
 		// Comprehensive validation
 		ipValidation := validation.ValidateIP(input.Address)
@@ -475,6 +516,10 @@ func UpdateIPAddress(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
+		// Store one form per address, so ::ffff:192.0.2.1 and 192.0.2.1 are the same rule
+		input.Address = utils.CanonicalIP(input.Address)
+		setIPRangeFlag(&input)
+
 		// Check for conflicts with existing entries (excluding current record)
 		var existingIPs []models.IP
 		if err := db.Where("id != ?", id).Find(&existingIPs).Error; err != nil {
@@ -488,7 +533,7 @@ func UpdateIPAddress(db *gorm.DB) gin.HandlerFunc {
 		existingStatuses := make(map[string]string)
 
 		for _, existing := range existingIPs {
-			if existing.IsCIDR {
+			if existing.IsCIDR || existing.IsRange {
 				existingCIDRs = append(existingCIDRs, existing.Address)
 				existingStatuses[existing.Address] = existing.Status
 			} else {
@@ -501,7 +546,7 @@ func UpdateIPAddress(db *gorm.DB) gin.HandlerFunc {
 		var conflicts []utils.ConflictInfo
 		var err error
 
-		if input.IsCIDR {
+		if input.IsCIDR || input.IsRange {
 			// New entry is a CIDR range - check for conflicts
 			conflicts, err = utils.CheckCIDRConflicts(input.Address, existingIPAddresses, existingCIDRs, existingStatuses, input.Status)
 		} else {
@@ -556,9 +601,16 @@ func UpdateIPAddress(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
+		if validityValidation := applyRuleValidity(&input.RuleValidity); !validityValidation.IsValid {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Validation failed", "details": validityValidation.Errors})
+			return
+		}
 		ip.Address = input.Address
 		ip.Status = input.Status
+		ip.Priority = input.Priority
+		ip.RuleValidity = input.RuleValidity
 		ip.IsCIDR = input.IsCIDR
+		ip.IsRange = input.IsRange
 
 		if err := db.Save(&ip).Error; err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update IP address"})
@@ -566,7 +618,7 @@ func UpdateIPAddress(db *gorm.DB) gin.HandlerFunc {
 		}
 
 		services.PublishEvent("ip", "updated", ip)
-		c.JSON(http.StatusOK, ip)
+		c.JSON(http.StatusOK, withRangeCIDRs(ip))
 	}
 }
 
@@ -625,6 +677,15 @@ func CreateEmail(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
+		// Validate the validity window and resolve the TTL
+		if validityValidation := applyRuleValidity(&email.RuleValidity); !validityValidation.IsValid {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Validation failed",
+				"details": validityValidation.Errors,
+			})
+			return
+		}
+
 		// Save to MySQL first
 		if err := db.Create(&email).Error; err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save email"})
@@ -749,16 +810,18 @@ func GetEmails(db *gorm.DB) gin.HandlerFunc {
 // Count-Stats für Emails
 func GetEmailStats(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		var total, allowed, denied, whitelisted int64
+		var total, allowed, denied, whitelisted, monitor int64
 		db.Model(&models.Email{}).Count(&total)
 		db.Model(&models.Email{}).Where("status = ?", "allowed").Count(&allowed)
 		db.Model(&models.Email{}).Where("status = ?", "denied").Count(&denied)
 		db.Model(&models.Email{}).Where("status = ?", "whitelisted").Count(&whitelisted)
+		db.Model(&models.Email{}).Where("status = ?", "monitor").Count(&monitor)
 		c.JSON(http.StatusOK, gin.H{
 			"total":       total,
 			"allowed":     allowed,
 			"denied":      denied,
 			"whitelisted": whitelisted,
+			"monitor":     monitor,
 		})
 	}
 }
@@ -773,12 +836,20 @@ func UpdateEmail(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 		var input models.Email
-		if err := c.ShouldBindJSON(&input); err != nil {
+		update := ruleUpdate{}
+		if err := update.bind(c, &input); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
+		update.keepOmitted(&input.Priority, &input.RuleValidity, email.Priority, email.RuleValidity)
+		if validityValidation := applyRuleValidity(&input.RuleValidity); !validityValidation.IsValid {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Validation failed", "details": validityValidation.Errors})
+			return
+		}
 		email.Address = input.Address
 		email.Status = input.Status
+		email.Priority = input.Priority
+		email.RuleValidity = input.RuleValidity
 		email.IsRegex = input.IsRegex
 		if err := db.Save(&email).Error; err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update email"})
@@ -802,6 +873,223 @@ func DeleteEmail(db *gorm.DB) gin.HandlerFunc {
 	}
 }
 
+// normalizeEmailDomainRule lower-cases a domain rule and removes a trailing dot
+func normalizeEmailDomainRule(domain string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(domain)), ".")
+}
+
+// CreateEmailDomain adds a new email domain rule
+// @Summary      Create email domain rule
+// @Description  Creates a rule for an email domain ("example.com"), a domain and its subdomains ("*.example.com") or a TLD ("*.xyz")
+// @Tags         email
+// @Accept       json
+// @Produce      json
+// @Param        domain  body      models.EmailDomainRule  true  "Email domain rule"
+// @Success      200 {object}  models.EmailDomainRule
+// @Failure      400 {object}  map[string]string
+// @Failure      409 {object}  map[string]string
+// @Failure      500 {object}  map[string]string
+// @Router       /email-domain [post]
+func CreateEmailDomain(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var rule models.EmailDomainRule
+		if err := c.ShouldBindJSON(&rule); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input format", "details": err.Error()})
+			return
+		}
+		rule.Domain = normalizeEmailDomainRule(rule.Domain)
+
+		// Comprehensive validation
+		domainValidation := validation.ValidateEmailDomain(rule.Domain)
+		statusValidation := validation.ValidateStatus(rule.Status)
+
+		if !domainValidation.IsValid || !statusValidation.IsValid {
+			errors := []validation.ValidationError{}
+			errors = append(errors, domainValidation.Errors...)
+			errors = append(errors, statusValidation.Errors...)
+
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Validation failed",
+				"details": errors,
+			})
+			return
+		}
+
+		// Check if domain already exists
+		var existing models.EmailDomainRule
+		if err := db.Where("domain = ?", rule.Domain).First(&existing).Error; err == nil {
+			c.JSON(http.StatusConflict, gin.H{"error": "Email domain rule already exists", "domain": rule.Domain})
+			return
+		}
+
+		// Validate the validity window and resolve the TTL
+		if validityValidation := applyRuleValidity(&rule.RuleValidity); !validityValidation.IsValid {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Validation failed",
+				"details": validityValidation.Errors,
+			})
+			return
+		}
+
+		// Save to MySQL first
+		if err := db.Create(&rule).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save email domain rule"})
+			return
+		}
+
+		// Publish event for async processing
+		services.PublishEvent("email_domain", "created", rule)
+
+		c.JSON(http.StatusOK, rule)
+	}
+}
+
+// GetEmailDomains lists email domain rules with pagination, filtering and sorting
+// @Summary      List email domain rules
+// @Description  Returns paginated, filtered and sorted email domain rules
+// @Tags         email
+// @Produce      json
+// @Param        page     query     int     false  "Page (starting at 1)"
+// @Param        limit    query     int     false  "Items per page"
+// @Param        status   query     string  false  "Status filter (allowed, denied, whitelisted, monitor)"
+// @Param        search   query     string  false  "Search in domain"
+// @Param        orderBy  query     string  false  "Sort field (id, domain, status, priority)"
+// @Param        order    query     string  false  "asc or desc"
+// @Success      200 {object} map[string]interface{}
+// @Router       /email-domains [get]
+func GetEmailDomains(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		page := c.DefaultQuery("page", "1")
+		limit := c.DefaultQuery("limit", "10")
+		status := c.Query("status")
+		search := c.Query("search")
+		orderBy := c.DefaultQuery("orderBy", "id")
+		order := c.DefaultQuery("order", "desc")
+
+		pageNum := 1
+		limitNum := 10
+		fmt.Sscanf(page, "%d", &pageNum)
+		fmt.Sscanf(limit, "%d", &limitNum)
+		if pageNum < 1 {
+			pageNum = 1
+		}
+		if limitNum < 1 {
+			limitNum = 10
+		}
+
+		query := db.Model(&models.EmailDomainRule{})
+		if status != "" {
+			query = query.Where("status = ?", status)
+		}
+		if search != "" {
+			query = query.Where("domain LIKE ?", "%"+search+"%")
+		}
+
+		// Validate orderBy and order
+		switch orderBy {
+		case "id", "domain", "status", "priority":
+		default:
+			orderBy = "id"
+		}
+		if order != "asc" && order != "desc" {
+			order = "desc"
+		}
+
+		var total int64
+		if err := query.Count(&total).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count email domain rules"})
+			return
+		}
+
+		var rules []models.EmailDomainRule
+		if err := query.Order(orderBy + " " + order).Limit(limitNum).Offset((pageNum - 1) * limitNum).Find(&rules).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch email domain rules"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"items": rules,
+			"total": total,
+		})
+	}
+}
+
+// UpdateEmailDomain updates an email domain rule
+func UpdateEmailDomain(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var rule models.EmailDomainRule
+		id := c.Param("id")
+		if err := db.First(&rule, id).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Rule not found"})
+			return
+		}
+		var input models.EmailDomainRule
+		update := ruleUpdate{}
+		if err := update.bind(c, &input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		update.keepOmitted(&input.Priority, &input.RuleValidity, rule.Priority, rule.RuleValidity)
+		input.Domain = normalizeEmailDomainRule(input.Domain)
+
+		domainValidation := validation.ValidateEmailDomain(input.Domain)
+		if !domainValidation.IsValid {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Validation failed",
+				"details": domainValidation.Errors,
+			})
+			return
+		}
+
+		if validityValidation := applyRuleValidity(&input.RuleValidity); !validityValidation.IsValid {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Validation failed", "details": validityValidation.Errors})
+			return
+		}
+		rule.Domain = input.Domain
+		rule.Status = input.Status
+		rule.Priority = input.Priority
+		rule.RuleValidity = input.RuleValidity
+		if err := db.Save(&rule).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update email domain rule"})
+			return
+		}
+		services.PublishEvent("email_domain", "updated", rule)
+		c.JSON(http.StatusOK, rule)
+	}
+}
+
+// DeleteEmailDomain deletes an email domain rule
+func DeleteEmailDomain(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("id")
+		if err := db.Delete(&models.EmailDomainRule{}, id).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete email domain rule"})
+			return
+		}
+		services.PublishEvent("email_domain", "deleted", models.EmailDomainRule{ID: parseUint(id)})
+		c.JSON(http.StatusOK, gin.H{"message": "Email domain rule deleted"})
+	}
+}
+
+// Count-Stats für EmailDomainRules
+func GetEmailDomainStats(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var total, allowed, denied, whitelisted, monitor int64
+		db.Model(&models.EmailDomainRule{}).Count(&total)
+		db.Model(&models.EmailDomainRule{}).Where("status = ?", "allowed").Count(&allowed)
+		db.Model(&models.EmailDomainRule{}).Where("status = ?", "denied").Count(&denied)
+		db.Model(&models.EmailDomainRule{}).Where("status = ?", "whitelisted").Count(&whitelisted)
+		db.Model(&models.EmailDomainRule{}).Where("status = ?", "monitor").Count(&monitor)
+		c.JSON(http.StatusOK, gin.H{
+			"total":       total,
+			"allowed":     allowed,
+			"denied":      denied,
+			"whitelisted": whitelisted,
+			"monitor":     monitor,
+		})
+	}
+}
+
 // CreateUserAgent fügt einen neuen User-Agent hinzu
 // @Summary      Neuen User-Agent anlegen
 // @Description  Legt einen neuen User-Agent mit Status an
@@ -844,6 +1132,15 @@ func CreateUserAgent(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
+		// Validate the validity window and resolve the TTL
+		if validityValidation := applyRuleValidity(&userAgent.RuleValidity); !validityValidation.IsValid {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Validation failed",
+				"details": validityValidation.Errors,
+			})
+			return
+		}
+
 		// Save to MySQL first
 		if err := db.Create(&userAgent).Error; err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save user agent"})
@@ -968,16 +1265,18 @@ func GetUserAgents(db *gorm.DB) gin.HandlerFunc {
 // Count-Stats für UserAgents
 func GetUserAgentStats(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		var total, allowed, denied, whitelisted int64
+		var total, allowed, denied, whitelisted, monitor int64
 		db.Model(&models.UserAgent{}).Count(&total)
 		db.Model(&models.UserAgent{}).Where("status = ?", "allowed").Count(&allowed)
 		db.Model(&models.UserAgent{}).Where("status = ?", "denied").Count(&denied)
 		db.Model(&models.UserAgent{}).Where("status = ?", "whitelisted").Count(&whitelisted)
+		db.Model(&models.UserAgent{}).Where("status = ?", "monitor").Count(&monitor)
 		c.JSON(http.StatusOK, gin.H{
 			"total":       total,
 			"allowed":     allowed,
 			"denied":      denied,
 			"whitelisted": whitelisted,
+			"monitor":     monitor,
 		})
 	}
 }
@@ -992,12 +1291,20 @@ func UpdateUserAgent(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 		var input models.UserAgent
-		if err := c.ShouldBindJSON(&input); err != nil {
+		update := ruleUpdate{}
+		if err := update.bind(c, &input); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
+		update.keepOmitted(&input.Priority, &input.RuleValidity, userAgent.Priority, userAgent.RuleValidity)
+		if validityValidation := applyRuleValidity(&input.RuleValidity); !validityValidation.IsValid {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Validation failed", "details": validityValidation.Errors})
+			return
+		}
 		userAgent.UserAgent = input.UserAgent
 		userAgent.Status = input.Status
+		userAgent.Priority = input.Priority
+		userAgent.RuleValidity = input.RuleValidity
 		userAgent.IsRegex = input.IsRegex
 		if err := db.Save(&userAgent).Error; err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user agent"})
@@ -1065,6 +1372,15 @@ func CreateCountry(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
+		// Validate the validity window and resolve the TTL
+		if validityValidation := applyRuleValidity(&country.RuleValidity); !validityValidation.IsValid {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Validation failed",
+				"details": validityValidation.Errors,
+			})
+			return
+		}
+
 		// Save to MySQL first
 		if err := db.Create(&country).Error; err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save country"})
@@ -1191,16 +1507,18 @@ func GetCountries(db *gorm.DB) gin.HandlerFunc {
 // Count-Stats für Countries
 func GetCountryStats(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		var total, allowed, denied, whitelisted int64
+		var total, allowed, denied, whitelisted, monitor int64
 		db.Model(&models.Country{}).Count(&total)
 		db.Model(&models.Country{}).Where("status = ?", "allowed").Count(&allowed)
 		db.Model(&models.Country{}).Where("status = ?", "denied").Count(&denied)
 		db.Model(&models.Country{}).Where("status = ?", "whitelisted").Count(&whitelisted)
+		db.Model(&models.Country{}).Where("status = ?", "monitor").Count(&monitor)
 		c.JSON(http.StatusOK, gin.H{
 			"total":       total,
 			"allowed":     allowed,
 			"denied":      denied,
 			"whitelisted": whitelisted,
+			"monitor":     monitor,
 		})
 	}
 }
@@ -1215,12 +1533,20 @@ func UpdateCountry(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 		var input models.Country
-		if err := c.ShouldBindJSON(&input); err != nil {
+		update := ruleUpdate{}
+		if err := update.bind(c, &input); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
+		update.keepOmitted(&input.Priority, &input.RuleValidity, country.Priority, country.RuleValidity)
+		if validityValidation := applyRuleValidity(&input.RuleValidity); !validityValidation.IsValid {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Validation failed", "details": validityValidation.Errors})
+			return
+		}
 		country.Code = input.Code
 		country.Status = input.Status
+		country.Priority = input.Priority
+		country.RuleValidity = input.RuleValidity
 		if err := db.Save(&country).Error; err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update country"})
 			return
@@ -1285,6 +1611,15 @@ func CreateCharsetRule(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
+		// Validate the validity window and resolve the TTL
+		if validityValidation := applyRuleValidity(&charset.RuleValidity); !validityValidation.IsValid {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Validation failed",
+				"details": validityValidation.Errors,
+			})
+			return
+		}
+
 		// Save to MySQL first
 		if err := db.Create(&charset).Error; err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save charset rule"})
@@ -1416,12 +1751,20 @@ func UpdateCharsetRule(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 		var input models.CharsetRule
-		if err := c.ShouldBindJSON(&input); err != nil {
+		update := ruleUpdate{}
+		if err := update.bind(c, &input); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
+		update.keepOmitted(&input.Priority, &input.RuleValidity, rule.Priority, rule.RuleValidity)
+		if validityValidation := applyRuleValidity(&input.RuleValidity); !validityValidation.IsValid {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Validation failed", "details": validityValidation.Errors})
+			return
+		}
 		rule.Charset = input.Charset
 		rule.Status = input.Status
+		rule.Priority = input.Priority
+		rule.RuleValidity = input.RuleValidity
 		if err := db.Save(&rule).Error; err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update charset rule"})
 			return
@@ -1447,6 +1790,62 @@ func DeleteCharsetRule(db *gorm.DB) gin.HandlerFunc {
 	}
 }
 
+// ruleUpdate holds the top-level keys of an update request body. The forms do not send every
+// field, so the priority and validity window keep their stored values when left out.
+type ruleUpdate map[string]json.RawMessage
+
+// bind binds the request body into input and records which keys it contains
+func (u *ruleUpdate) bind(c *gin.Context, input interface{}) error {
+	if err := c.ShouldBindBodyWith(input, binding.JSON); err != nil {
+		return err
+	}
+	body, _ := c.Get(gin.BodyBytesKey)
+	return json.Unmarshal(body.([]byte), u)
+}
+
+// has reports whether the request sets key; like encoding/json it ignores the case
+func (u ruleUpdate) has(key string) bool {
+	for k := range u {
+		if strings.EqualFold(k, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// keepOmitted copies the stored priority and validity window into the input where the request
+// leaves them out; a ttl replaces the stored expiry
+func (u ruleUpdate) keepOmitted(priority *int, validity *models.RuleValidity, storedPriority int, stored models.RuleValidity) {
+	if !u.has("priority") {
+		*priority = storedPriority
+	}
+	if !u.has("valid_from") {
+		validity.ValidFrom = stored.ValidFrom
+	}
+	if !u.has("expires_at") && !u.has("ttl") {
+		validity.ExpiresAt = stored.ExpiresAt
+	}
+}
+
+// applyRuleValidity validates the validity window of a rule and turns a ttl into
+// expires_at, counted from valid_from or from now
+func applyRuleValidity(v *models.RuleValidity) *validation.ValidationResult {
+	result := validation.ValidateRuleValidity(v.TTL, v.ValidFrom, v.ExpiresAt)
+	if !result.IsValid || v.TTL == "" {
+		return result
+	}
+
+	ttl, _ := time.ParseDuration(v.TTL)
+	start := time.Now()
+	if v.ValidFrom != nil {
+		start = *v.ValidFrom
+	}
+	expiresAt := start.Add(ttl)
+	v.ExpiresAt = &expiresAt
+	v.TTL = ""
+	return result
+}
+
 // Hilfsfunktion für DeleteCharsetRule
 func parseUint(s string) uint {
 	u, _ := strconv.ParseUint(s, 10, 64)
@@ -1529,6 +1928,15 @@ func CreateUsernameRule(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
+		// Validate the validity window and resolve the TTL
+		if validityValidation := applyRuleValidity(&username.RuleValidity); !validityValidation.IsValid {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Validation failed",
+				"details": validityValidation.Errors,
+			})
+			return
+		}
+
 		// Save to MySQL first
 		if err := db.Create(&username).Error; err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save username rule"})
@@ -1660,12 +2068,20 @@ func UpdateUsernameRule(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 		var input models.UsernameRule
-		if err := c.ShouldBindJSON(&input); err != nil {
+		update := ruleUpdate{}
+		if err := update.bind(c, &input); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
+		update.keepOmitted(&input.Priority, &input.RuleValidity, rule.Priority, rule.RuleValidity)
+		if validityValidation := applyRuleValidity(&input.RuleValidity); !validityValidation.IsValid {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Validation failed", "details": validityValidation.Errors})
+			return
+		}
 		rule.Username = input.Username
 		rule.Status = input.Status
+		rule.Priority = input.Priority
+		rule.RuleValidity = input.RuleValidity
 		rule.IsRegex = input.IsRegex
 		if err := db.Save(&rule).Error; err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update username rule"})
@@ -1694,16 +2110,18 @@ func DeleteUsernameRule(db *gorm.DB) gin.HandlerFunc {
 // Count-Stats für CharsetRules
 func GetCharsetStats(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		var total, allowed, denied, whitelisted int64
+		var total, allowed, denied, whitelisted, monitor int64
 		db.Model(&models.CharsetRule{}).Count(&total)
 		db.Model(&models.CharsetRule{}).Where("status = ?", "allowed").Count(&allowed)
 		db.Model(&models.CharsetRule{}).Where("status = ?", "denied").Count(&denied)
 		db.Model(&models.CharsetRule{}).Where("status = ?", "whitelisted").Count(&whitelisted)
+		db.Model(&models.CharsetRule{}).Where("status = ?", "monitor").Count(&monitor)
 		c.JSON(http.StatusOK, gin.H{
 			"total":       total,
 			"allowed":     allowed,
 			"denied":      denied,
 			"whitelisted": whitelisted,
+			"monitor":     monitor,
 		})
 	}
 }
@@ -1711,215 +2129,1736 @@ func GetCharsetStats(db *gorm.DB) gin.HandlerFunc {
 // Count-Stats für UsernameRules
 func GetUsernameStats(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		var total, allowed, denied, whitelisted int64
+		var total, allowed, denied, whitelisted, monitor int64
 		db.Model(&models.UsernameRule{}).Count(&total)
 		db.Model(&models.UsernameRule{}).Where("status = ?", "allowed").Count(&allowed)
 		db.Model(&models.UsernameRule{}).Where("status = ?", "denied").Count(&denied)
 		db.Model(&models.UsernameRule{}).Where("status = ?", "whitelisted").Count(&whitelisted)
+		db.Model(&models.UsernameRule{}).Where("status = ?", "monitor").Count(&monitor)
 		c.JSON(http.StatusOK, gin.H{
 			"total":       total,
 			"allowed":     allowed,
 			"denied":      denied,
 			"whitelisted": whitelisted,
+			"monitor":     monitor,
 		})
 	}
 }
 
-// RecreateIPIndex löscht und erstellt den IP-Index neu
-// @Summary      IP-Index neu erstellen
-// @Description  Löscht den IP-Index und erstellt ihn mit allen Daten aus der Datenbank neu
-// @Tags         ip
+// CreateContentRule adds a new content rule
+// @Summary      Create content rule
+// @Description  Creates a keyword, phrase or regex rule for the content field
+// @Tags         content
+// @Accept       json
 // @Produce      json
-// @Success      200 {object} map[string]string
-// @Failure      500 {object} map[string]string
-// @Router       /ip/recreate-index [post]
-func RecreateIPIndex(db *gorm.DB) gin.HandlerFunc {
+// @Param        content  body      models.ContentRule  true  "Content rule"
+// @Success      200 {object}  models.ContentRule
+// @Failure      400 {object}  map[string]string
+// @Failure      409 {object}  map[string]string
+// @Failure      500 {object}  map[string]string
+// @Router       /content-rule [post]
+func CreateContentRule(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// Delete existing index
-		if err := services.DeleteIPIndex(); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete IP index: " + err.Error()})
+		var rule models.ContentRule
+		if err := c.ShouldBindJSON(&rule); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input format", "details": err.Error()})
 			return
 		}
+		if rule.MatchType == "" {
+			rule.MatchType = "keyword"
+		}
+
+		// Comprehensive validation
+		patternValidation := validation.ValidateContentRule(rule.Pattern, rule.MatchType)
+		statusValidation := validation.ValidateStatus(rule.Status)
+
+		if !patternValidation.IsValid || !statusValidation.IsValid {
+			errors := []validation.ValidationError{}
+			errors = append(errors, patternValidation.Errors...)
+			errors = append(errors, statusValidation.Errors...)
 
-		// Recreate index with all data
-		if err := services.SyncAllIPs(); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to recreate IP index: " + err.Error()})
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Validation failed",
+				"details": errors,
+			})
 			return
 		}
 
-		// Count records indexed
-		var recordCount int64
-		db.Model(&models.IP{}).Count(&recordCount)
-
-		c.JSON(http.StatusOK, gin.H{
-			"message":         "IP index recreated successfully",
-			"records_indexed": recordCount,
-		})
-	}
-}
+		// Check if pattern already exists
+		var existing models.ContentRule
+		if err := db.Where("pattern = ?", rule.Pattern).First(&existing).Error; err == nil {
+			c.JSON(http.StatusConflict, gin.H{"error": "Content rule already exists", "pattern": rule.Pattern})
+			return
+		}
 
-// RecreateEmailIndex löscht und erstellt den Email-Index neu
-// @Summary      Email-Index neu erstellen
-// @Description  Löscht den Email-Index und erstellt ihn mit allen Daten aus der Datenbank neu
-// @Tags         emails
-// @Produce      json
-// @Success      200 {object} map[string]string
-// @Failure      500 {object} map[string]string
-// @Router       /emails/recreate-index [post]
-func RecreateEmailIndex(db *gorm.DB) gin.HandlerFunc {
-	return func(c *gin.Context) {
-		// Delete existing index
-		if err := services.DeleteEmailIndex(); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete email index: " + err.Error()})
+		// Validate the validity window and resolve the TTL
+		if validityValidation := applyRuleValidity(&rule.RuleValidity); !validityValidation.IsValid {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Validation failed",
+				"details": validityValidation.Errors,
+			})
 			return
 		}
 
-		// Recreate index with all data
-		if err := services.SyncAllEmails(); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to recreate email index: " + err.Error()})
+		// Save to MySQL first
+		if err := db.Create(&rule).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save content rule"})
 			return
 		}
 
-		// Count records indexed
-		var recordCount int64
-		db.Model(&models.Email{}).Count(&recordCount)
+		// Publish event for async processing
+		services.PublishEvent("content", "created", rule)
+
+		c.JSON(http.StatusOK, rule)
+	}
+}
+
+// GetContentRules lists content rules with pagination, filtering and sorting
+// @Summary      List content rules
+// @Description  Returns paginated, filtered and sorted content rules
+// @Tags         content
+// @Produce      json
+// @Param        page       query     int     false  "Page (starting at 1)"
+// @Param        limit      query     int     false  "Items per page"
+// @Param        status     query     string  false  "Status filter (allowed, denied, whitelisted, monitor)"
+// @Param        matchType  query     string  false  "Match type filter (keyword, phrase, regex)"
+// @Param        search     query     string  false  "Search in pattern"
+// @Param        orderBy    query     string  false  "Sort field (id, pattern, match_type, status, priority)"
+// @Param        order      query     string  false  "asc or desc"
+// @Success      200 {object} map[string]interface{}
+// @Router       /content-rules [get]
+func GetContentRules(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		page := c.DefaultQuery("page", "1")
+		limit := c.DefaultQuery("limit", "10")
+		status := c.Query("status")
+		matchType := c.Query("matchType")
+		search := c.Query("search")
+		orderBy := c.DefaultQuery("orderBy", "id")
+		order := c.DefaultQuery("order", "desc")
+
+		pageNum := 1
+		limitNum := 10
+		fmt.Sscanf(page, "%d", &pageNum)
+		fmt.Sscanf(limit, "%d", &limitNum)
+		if pageNum < 1 {
+			pageNum = 1
+		}
+		if limitNum < 1 {
+			limitNum = 10
+		}
+
+		query := db.Model(&models.ContentRule{})
+		if status != "" {
+			query = query.Where("status = ?", status)
+		}
+		if matchType != "" {
+			query = query.Where("match_type = ?", matchType)
+		}
+		if search != "" {
+			query = query.Where("pattern LIKE ?", "%"+search+"%")
+		}
+
+		// Validate orderBy and order
+		switch orderBy {
+		case "id", "pattern", "match_type", "status", "priority":
+		default:
+			orderBy = "id"
+		}
+		if order != "asc" && order != "desc" {
+			order = "desc"
+		}
+
+		var total int64
+		if err := query.Count(&total).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count content rules"})
+			return
+		}
+
+		var rules []models.ContentRule
+		if err := query.Order(orderBy + " " + order).Limit(limitNum).Offset((pageNum - 1) * limitNum).Find(&rules).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch content rules"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"items": rules,
+			"total": total,
+		})
+	}
+}
+
+// UpdateContentRule updates a content rule
+func UpdateContentRule(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var rule models.ContentRule
+		id := c.Param("id")
+		if err := db.First(&rule, id).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Rule not found"})
+			return
+		}
+		var input models.ContentRule
+		update := ruleUpdate{}
+		if err := update.bind(c, &input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		update.keepOmitted(&input.Priority, &input.RuleValidity, rule.Priority, rule.RuleValidity)
+		if input.MatchType == "" {
+			input.MatchType = rule.MatchType
+		}
+
+		patternValidation := validation.ValidateContentRule(input.Pattern, input.MatchType)
+		if !patternValidation.IsValid {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Validation failed",
+				"details": patternValidation.Errors,
+			})
+			return
+		}
+
+		if validityValidation := applyRuleValidity(&input.RuleValidity); !validityValidation.IsValid {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Validation failed", "details": validityValidation.Errors})
+			return
+		}
+		rule.Pattern = input.Pattern
+		rule.MatchType = input.MatchType
+		rule.Status = input.Status
+		rule.Priority = input.Priority
+		rule.RuleValidity = input.RuleValidity
+		if err := db.Save(&rule).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update content rule"})
+			return
+		}
+		services.PublishEvent("content", "updated", rule)
+		c.JSON(http.StatusOK, rule)
+	}
+}
+
+// DeleteContentRule deletes a content rule
+func DeleteContentRule(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("id")
+		if err := db.Delete(&models.ContentRule{}, id).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete content rule"})
+			return
+		}
+		services.PublishEvent("content", "deleted", models.ContentRule{ID: parseUint(id)})
+		c.JSON(http.StatusOK, gin.H{"message": "Content rule deleted"})
+	}
+}
+
+// Count-Stats für ContentRules
+func GetContentRuleStats(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var total, allowed, denied, whitelisted, monitor int64
+		db.Model(&models.ContentRule{}).Count(&total)
+		db.Model(&models.ContentRule{}).Where("status = ?", "allowed").Count(&allowed)
+		db.Model(&models.ContentRule{}).Where("status = ?", "denied").Count(&denied)
+		db.Model(&models.ContentRule{}).Where("status = ?", "whitelisted").Count(&whitelisted)
+		db.Model(&models.ContentRule{}).Where("status = ?", "monitor").Count(&monitor)
+		c.JSON(http.StatusOK, gin.H{
+			"total":       total,
+			"allowed":     allowed,
+			"denied":      denied,
+			"whitelisted": whitelisted,
+			"monitor":     monitor,
+		})
+	}
+}
+
+// normalizeVelocityFields trims the spaces around the comma-separated key fields ("ip, action" -> "ip,action")
+func normalizeVelocityFields(rule *models.VelocityRule) {
+	fields := strings.Split(rule.KeyFields, ",")
+	for i := range fields {
+		fields[i] = strings.TrimSpace(fields[i])
+	}
+	rule.KeyFields = strings.Join(fields, ",")
+	rule.DistinctField = strings.TrimSpace(rule.DistinctField)
+}
+
+// CreateVelocityRule adds a new velocity rule
+// @Summary      Create velocity rule
+// @Description  Creates a rule that denies a key (a field or field pair) seen more than threshold times within a sliding window
+// @Tags         velocity
+// @Accept       json
+// @Produce      json
+// @Param        velocity  body      models.VelocityRule  true  "Velocity rule"
+// @Success      200 {object}  models.VelocityRule
+// @Failure      400 {object}  map[string]string
+// @Failure      409 {object}  map[string]string
+// @Failure      500 {object}  map[string]string
+// @Router       /velocity-rule [post]
+func CreateVelocityRule(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var rule models.VelocityRule
+		if err := c.ShouldBindJSON(&rule); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input format", "details": err.Error()})
+			return
+		}
+		normalizeVelocityFields(&rule)
+
+		// Comprehensive validation
+		velocityValidation := validation.ValidateVelocityRule(rule.KeyFields, rule.DistinctField, rule.Window)
+		if !velocityValidation.IsValid {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Validation failed",
+				"details": velocityValidation.Errors,
+			})
+			return
+		}
+
+		// Check if name already exists
+		var existing models.VelocityRule
+		if err := db.Where("name = ?", rule.Name).First(&existing).Error; err == nil {
+			c.JSON(http.StatusConflict, gin.H{"error": "Velocity rule already exists", "name": rule.Name})
+			return
+		}
+
+		// Validate the validity window and resolve the TTL
+		if validityValidation := applyRuleValidity(&rule.RuleValidity); !validityValidation.IsValid {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Validation failed",
+				"details": validityValidation.Errors,
+			})
+			return
+		}
+
+		// Save to MySQL first
+		if err := db.Create(&rule).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save velocity rule"})
+			return
+		}
+
+		// Publish event for async processing
+		services.PublishEvent("velocity", "created", rule)
+
+		c.JSON(http.StatusOK, rule)
+	}
+}
+
+// GetVelocityRules lists velocity rules with pagination, filtering and sorting
+// @Summary      List velocity rules
+// @Description  Returns paginated, filtered and sorted velocity rules
+// @Tags         velocity
+// @Produce      json
+// @Param        page     query     int     false  "Page (starting at 1)"
+// @Param        limit    query     int     false  "Items per page"
+// @Param        status   query     string  false  "Status filter (denied, monitor)"
+// @Param        search   query     string  false  "Search in name and key fields"
+// @Param        orderBy  query     string  false  "Sort field (id, name, key_fields, threshold, status, priority)"
+// @Param        order    query     string  false  "asc or desc"
+// @Success      200 {object} map[string]interface{}
+// @Router       /velocity-rules [get]
+func GetVelocityRules(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		page := c.DefaultQuery("page", "1")
+		limit := c.DefaultQuery("limit", "10")
+		status := c.Query("status")
+		search := c.Query("search")
+		orderBy := c.DefaultQuery("orderBy", "id")
+		order := c.DefaultQuery("order", "desc")
+
+		pageNum := 1
+		limitNum := 10
+		fmt.Sscanf(page, "%d", &pageNum)
+		fmt.Sscanf(limit, "%d", &limitNum)
+		if pageNum < 1 {
+			pageNum = 1
+		}
+		if limitNum < 1 {
+			limitNum = 10
+		}
+
+		query := db.Model(&models.VelocityRule{})
+		if status != "" {
+			query = query.Where("status = ?", status)
+		}
+		if search != "" {
+			query = query.Where("name LIKE ? OR key_fields LIKE ?", "%"+search+"%", "%"+search+"%")
+		}
+
+		// Validate orderBy and order
+		switch orderBy {
+		case "id", "name", "key_fields", "threshold", "status", "priority":
+		default:
+			orderBy = "id"
+		}
+		if order != "asc" && order != "desc" {
+			order = "desc"
+		}
+
+		var total int64
+		if err := query.Count(&total).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count velocity rules"})
+			return
+		}
+
+		var rules []models.VelocityRule
+		if err := query.Order(orderBy + " " + order).Limit(limitNum).Offset((pageNum - 1) * limitNum).Find(&rules).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch velocity rules"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"items": rules,
+			"total": total,
+		})
+	}
+}
+
+// UpdateVelocityRule updates a velocity rule
+func UpdateVelocityRule(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var rule models.VelocityRule
+		id := c.Param("id")
+		if err := db.First(&rule, id).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Rule not found"})
+			return
+		}
+		var input models.VelocityRule
+		update := ruleUpdate{}
+		if err := update.bind(c, &input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		update.keepOmitted(&input.Priority, &input.RuleValidity, rule.Priority, rule.RuleValidity)
+		normalizeVelocityFields(&input)
+
+		velocityValidation := validation.ValidateVelocityRule(input.KeyFields, input.DistinctField, input.Window)
+		if !velocityValidation.IsValid {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Validation failed",
+				"details": velocityValidation.Errors,
+			})
+			return
+		}
+
+		if validityValidation := applyRuleValidity(&input.RuleValidity); !validityValidation.IsValid {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Validation failed", "details": validityValidation.Errors})
+			return
+		}
+		rule.Name = input.Name
+		rule.KeyFields = input.KeyFields
+		rule.DistinctField = input.DistinctField
+		rule.Threshold = input.Threshold
+		rule.Window = input.Window
+		rule.Status = input.Status
+		rule.Priority = input.Priority
+		rule.RuleValidity = input.RuleValidity
+		if err := db.Save(&rule).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update velocity rule"})
+			return
+		}
+		services.PublishEvent("velocity", "updated", rule)
+		c.JSON(http.StatusOK, rule)
+	}
+}
+
+// DeleteVelocityRule deletes a velocity rule
+func DeleteVelocityRule(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("id")
+		if err := db.Delete(&models.VelocityRule{}, id).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete velocity rule"})
+			return
+		}
+		services.PublishEvent("velocity", "deleted", models.VelocityRule{ID: parseUint(id)})
+		c.JSON(http.StatusOK, gin.H{"message": "Velocity rule deleted"})
+	}
+}
+
+// GetVelocityRuleStats returns the number of velocity rules per status
+func GetVelocityRuleStats(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var total, denied, monitor int64
+		db.Model(&models.VelocityRule{}).Count(&total)
+		db.Model(&models.VelocityRule{}).Where("status = ?", "denied").Count(&denied)
+		db.Model(&models.VelocityRule{}).Where("status = ?", "monitor").Count(&monitor)
+		c.JSON(http.StatusOK, gin.H{
+			"total":   total,
+			"denied":  denied,
+			"monitor": monitor,
+		})
+	}
+}
+
+// validateCompositeRule normalizes the operator and field names of a composite rule and validates its conditions
+func validateCompositeRule(rule *models.CompositeRule) []validation.ValidationError {
+	rule.Operator = strings.ToLower(strings.TrimSpace(rule.Operator))
+	if rule.Operator == "" {
+		rule.Operator = "and"
+	}
+
+	var errors []validation.ValidationError
+	if len(rule.Conditions) > 20 {
+		errors = append(errors, validation.ValidationError{Field: "conditions", Message: "Too many conditions (max 20)"})
+	}
+	for i := range rule.Conditions {
+		cond := &rule.Conditions[i]
+		cond.Field = strings.TrimSpace(cond.Field)
+		for _, err := range validation.ValidateCompositeCondition(cond.Field, cond.Match, cond.Value, cond.Values).Errors {
+			err.Field = fmt.Sprintf("conditions[%d].%s", i, err.Field)
+			errors = append(errors, err)
+		}
+	}
+	return errors
+}
+
+// CreateCompositeRule adds a new composite rule
+// @Summary      Create composite rule
+// @Description  Creates a rule with several field conditions (exact, regex, cidr, in) joined by AND or OR
+// @Tags         composite
+// @Accept       json
+// @Produce      json
+// @Param        composite  body      models.CompositeRule  true  "Composite rule"
+// @Success      200 {object}  models.CompositeRule
+// @Failure      400 {object}  map[string]string
+// @Failure      409 {object}  map[string]string
+// @Failure      500 {object}  map[string]string
+// @Router       /composite-rules [post]
+func CreateCompositeRule(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var rule models.CompositeRule
+		if err := c.ShouldBindJSON(&rule); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input format", "details": err.Error()})
+			return
+		}
+
+		// Comprehensive validation
+		if errors := validateCompositeRule(&rule); len(errors) > 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Validation failed",
+				"details": errors,
+			})
+			return
+		}
+
+		// Check if name already exists
+		var existing models.CompositeRule
+		if err := db.Where("name = ?", rule.Name).First(&existing).Error; err == nil {
+			c.JSON(http.StatusConflict, gin.H{"error": "Composite rule already exists", "name": rule.Name})
+			return
+		}
+
+		// Validate the validity window and resolve the TTL
+		if validityValidation := applyRuleValidity(&rule.RuleValidity); !validityValidation.IsValid {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Validation failed",
+				"details": validityValidation.Errors,
+			})
+			return
+		}
+
+		// Save to MySQL first
+		if err := db.Create(&rule).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save composite rule"})
+			return
+		}
+
+		// Publish event for async processing
+		services.PublishEvent("composite", "created", rule)
+
+		c.JSON(http.StatusOK, rule)
+	}
+}
+
+// GetCompositeRules lists composite rules with pagination, filtering and sorting
+// @Summary      List composite rules
+// @Description  Returns paginated, filtered and sorted composite rules
+// @Tags         composite
+// @Produce      json
+// @Param        page     query     int     false  "Page (starting at 1)"
+// @Param        limit    query     int     false  "Items per page"
+// @Param        status   query     string  false  "Status filter (allowed, denied, whitelisted, monitor)"
+// @Param        search   query     string  false  "Search in name"
+// @Param        orderBy  query     string  false  "Sort field (id, name, status, priority)"
+// @Param        order    query     string  false  "asc or desc"
+// @Success      200 {object} map[string]interface{}
+// @Router       /composite-rules [get]
+func GetCompositeRules(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		page := c.DefaultQuery("page", "1")
+		limit := c.DefaultQuery("limit", "10")
+		status := c.Query("status")
+		search := c.Query("search")
+		orderBy := c.DefaultQuery("orderBy", "id")
+		order := c.DefaultQuery("order", "desc")
+
+		pageNum := 1
+		limitNum := 10
+		fmt.Sscanf(page, "%d", &pageNum)
+		fmt.Sscanf(limit, "%d", &limitNum)
+		if pageNum < 1 {
+			pageNum = 1
+		}
+		if limitNum < 1 {
+			limitNum = 10
+		}
+
+		query := db.Model(&models.CompositeRule{})
+		if status != "" {
+			query = query.Where("status = ?", status)
+		}
+		if search != "" {
+			query = query.Where("name LIKE ?", "%"+search+"%")
+		}
+
+		// Validate orderBy and order
+		switch orderBy {
+		case "id", "name", "status", "priority":
+		default:
+			orderBy = "id"
+		}
+		if order != "asc" && order != "desc" {
+			order = "desc"
+		}
+
+		var total int64
+		if err := query.Count(&total).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count composite rules"})
+			return
+		}
+
+		var rules []models.CompositeRule
+		if err := query.Order(orderBy + " " + order).Limit(limitNum).Offset((pageNum - 1) * limitNum).Find(&rules).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch composite rules"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"items": rules,
+			"total": total,
+		})
+	}
+}
+
+// GetCompositeRule returns a single composite rule
+func GetCompositeRule(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var rule models.CompositeRule
+		if err := db.First(&rule, c.Param("id")).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Rule not found"})
+			return
+		}
+		c.JSON(http.StatusOK, rule)
+	}
+}
+
+// UpdateCompositeRule updates a composite rule
+func UpdateCompositeRule(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var rule models.CompositeRule
+		id := c.Param("id")
+		if err := db.First(&rule, id).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Rule not found"})
+			return
+		}
+		var input models.CompositeRule
+		update := ruleUpdate{}
+		if err := update.bind(c, &input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		update.keepOmitted(&input.Priority, &input.RuleValidity, rule.Priority, rule.RuleValidity)
+
+		if errors := validateCompositeRule(&input); len(errors) > 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Validation failed",
+				"details": errors,
+			})
+			return
+		}
+
+		if validityValidation := applyRuleValidity(&input.RuleValidity); !validityValidation.IsValid {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Validation failed", "details": validityValidation.Errors})
+			return
+		}
+		rule.Name = input.Name
+		rule.Operator = input.Operator
+		rule.Conditions = input.Conditions
+		rule.Status = input.Status
+		rule.Priority = input.Priority
+		rule.RuleValidity = input.RuleValidity
+		if err := db.Save(&rule).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update composite rule"})
+			return
+		}
+		services.PublishEvent("composite", "updated", rule)
+		c.JSON(http.StatusOK, rule)
+	}
+}
+
+// DeleteCompositeRule deletes a composite rule
+func DeleteCompositeRule(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("id")
+		if err := db.Delete(&models.CompositeRule{}, id).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete composite rule"})
+			return
+		}
+		services.PublishEvent("composite", "deleted", models.CompositeRule{ID: parseUint(id)})
+		c.JSON(http.StatusOK, gin.H{"message": "Composite rule deleted"})
+	}
+}
+
+// GetCompositeRuleStats returns the number of composite rules per status
+func GetCompositeRuleStats(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var total, allowed, denied, whitelisted, monitor int64
+		db.Model(&models.CompositeRule{}).Count(&total)
+		db.Model(&models.CompositeRule{}).Where("status = ?", "allowed").Count(&allowed)
+		db.Model(&models.CompositeRule{}).Where("status = ?", "denied").Count(&denied)
+		db.Model(&models.CompositeRule{}).Where("status = ?", "whitelisted").Count(&whitelisted)
+		db.Model(&models.CompositeRule{}).Where("status = ?", "monitor").Count(&monitor)
+		c.JSON(http.StatusOK, gin.H{
+			"total":       total,
+			"allowed":     allowed,
+			"denied":      denied,
+			"whitelisted": whitelisted,
+			"monitor":     monitor,
+		})
+	}
+}
+
+// validateExpressionRule compiles the expression of a rule; compile errors carry line and column
+func validateExpressionRule(rule *models.ExpressionRule) []validation.ValidationError {
+	if _, err := services.CompileExpression(rule.Expression); err != nil {
+		return []validation.ValidationError{{Field: "expression", Message: err.Error(), Value: rule.Expression}}
+	}
+	return nil
+}
+
+// CreateExpressionRule adds a new expression rule
+// @Summary      Create expression rule
+// @Description  Creates a rule matching requests with an expression, e.g. country in ["RU","CN"] && len(username) > 20
+// @Tags         expression
+// @Accept       json
+// @Produce      json
+// @Param        expression  body      models.ExpressionRule  true  "Expression rule"
+// @Success      200 {object}  models.ExpressionRule
+// @Failure      400 {object}  map[string]string
+// @Failure      409 {object}  map[string]string
+// @Failure      500 {object}  map[string]string
+// @Router       /expression-rules [post]
+func CreateExpressionRule(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var rule models.ExpressionRule
+		if err := c.ShouldBindJSON(&rule); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input format", "details": err.Error()})
+			return
+		}
+
+		// The expression must compile
+		if errors := validateExpressionRule(&rule); len(errors) > 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Validation failed",
+				"details": errors,
+			})
+			return
+		}
+
+		// Check if name already exists
+		var existing models.ExpressionRule
+		if err := db.Where("name = ?", rule.Name).First(&existing).Error; err == nil {
+			c.JSON(http.StatusConflict, gin.H{"error": "Expression rule already exists", "name": rule.Name})
+			return
+		}
+
+		// Validate the validity window and resolve the TTL
+		if validityValidation := applyRuleValidity(&rule.RuleValidity); !validityValidation.IsValid {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Validation failed",
+				"details": validityValidation.Errors,
+			})
+			return
+		}
+
+		// Save to MySQL first
+		if err := db.Create(&rule).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save expression rule"})
+			return
+		}
+
+		// Publish event for async processing
+		services.PublishEvent("expression", "created", rule)
+
+		c.JSON(http.StatusOK, rule)
+	}
+}
+
+// ValidateExpression compiles an expression without saving a rule
+// @Summary      Validate expression
+// @Description  Compiles an expression and returns the compile error or the variables it uses
+// @Tags         expression
+// @Accept       json
+// @Produce      json
+// @Success      200 {object} map[string]interface{}
+// @Failure      400 {object} map[string]interface{}
+// @Router       /expression-rules/validate [post]
+func ValidateExpression() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input struct {
+			Expression string `json:"expression" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input format", "details": err.Error()})
+			return
+		}
+		program, err := services.CompileExpression(input.Expression)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"valid":   false,
+				"error":   "Validation failed",
+				"details": []validation.ValidationError{{Field: "expression", Message: err.Error(), Value: input.Expression}},
+			})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"valid": true, "variables": program.Vars()})
+	}
+}
+
+// GetExpressionRules lists expression rules with pagination, filtering and sorting
+// @Summary      List expression rules
+// @Description  Returns paginated, filtered and sorted expression rules
+// @Tags         expression
+// @Produce      json
+// @Param        page     query     int     false  "Page (starting at 1)"
+// @Param        limit    query     int     false  "Items per page"
+// @Param        status   query     string  false  "Status filter (allowed, denied, whitelisted, monitor)"
+// @Param        search   query     string  false  "Search in name and expression"
+// @Param        orderBy  query     string  false  "Sort field (id, name, status, priority)"
+// @Param        order    query     string  false  "asc or desc"
+// @Success      200 {object} map[string]interface{}
+// @Router       /expression-rules [get]
+func GetExpressionRules(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		page := c.DefaultQuery("page", "1")
+		limit := c.DefaultQuery("limit", "10")
+		status := c.Query("status")
+		search := c.Query("search")
+		orderBy := c.DefaultQuery("orderBy", "id")
+		order := c.DefaultQuery("order", "desc")
+
+		pageNum := 1
+		limitNum := 10
+		fmt.Sscanf(page, "%d", &pageNum)
+		fmt.Sscanf(limit, "%d", &limitNum)
+		if pageNum < 1 {
+			pageNum = 1
+		}
+		if limitNum < 1 {
+			limitNum = 10
+		}
+
+		query := db.Model(&models.ExpressionRule{})
+		if status != "" {
+			query = query.Where("status = ?", status)
+		}
+		if search != "" {
+			query = query.Where("name LIKE ? OR expression LIKE ?", "%"+search+"%", "%"+search+"%")
+		}
+
+		// Validate orderBy and order
+		switch orderBy {
+		case "id", "name", "status", "priority":
+		default:
+			orderBy = "id"
+		}
+		if order != "asc" && order != "desc" {
+			order = "desc"
+		}
+
+		var total int64
+		if err := query.Count(&total).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count expression rules"})
+			return
+		}
+
+		var rules []models.ExpressionRule
+		if err := query.Order(orderBy + " " + order).Limit(limitNum).Offset((pageNum - 1) * limitNum).Find(&rules).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch expression rules"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"items": rules,
+			"total": total,
+		})
+	}
+}
+
+// GetExpressionRule returns a single expression rule
+func GetExpressionRule(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var rule models.ExpressionRule
+		if err := db.First(&rule, c.Param("id")).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Rule not found"})
+			return
+		}
+		c.JSON(http.StatusOK, rule)
+	}
+}
+
+// UpdateExpressionRule updates an expression rule
+func UpdateExpressionRule(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var rule models.ExpressionRule
+		id := c.Param("id")
+		if err := db.First(&rule, id).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Rule not found"})
+			return
+		}
+		var input models.ExpressionRule
+		update := ruleUpdate{}
+		if err := update.bind(c, &input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		update.keepOmitted(&input.Priority, &input.RuleValidity, rule.Priority, rule.RuleValidity)
+
+		if errors := validateExpressionRule(&input); len(errors) > 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Validation failed",
+				"details": errors,
+			})
+			return
+		}
+
+		if validityValidation := applyRuleValidity(&input.RuleValidity); !validityValidation.IsValid {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Validation failed", "details": validityValidation.Errors})
+			return
+		}
+		rule.Name = input.Name
+		rule.Expression = input.Expression
+		rule.Status = input.Status
+		rule.Priority = input.Priority
+		rule.RuleValidity = input.RuleValidity
+		if err := db.Save(&rule).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update expression rule"})
+			return
+		}
+		services.PublishEvent("expression", "updated", rule)
+		c.JSON(http.StatusOK, rule)
+	}
+}
+
+// DeleteExpressionRule deletes an expression rule
+func DeleteExpressionRule(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("id")
+		if err := db.Delete(&models.ExpressionRule{}, id).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete expression rule"})
+			return
+		}
+		services.PublishEvent("expression", "deleted", models.ExpressionRule{ID: parseUint(id)})
+		c.JSON(http.StatusOK, gin.H{"message": "Expression rule deleted"})
+	}
+}
+
+// GetExpressionRuleStats returns the number of expression rules per status and the evaluation
+// counters since startup (evaluations, matches, runtime errors and timeouts)
+func GetExpressionRuleStats(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var total, allowed, denied, whitelisted, monitor int64
+		db.Model(&models.ExpressionRule{}).Count(&total)
+		db.Model(&models.ExpressionRule{}).Where("status = ?", "allowed").Count(&allowed)
+		db.Model(&models.ExpressionRule{}).Where("status = ?", "denied").Count(&denied)
+		db.Model(&models.ExpressionRule{}).Where("status = ?", "whitelisted").Count(&whitelisted)
+		db.Model(&models.ExpressionRule{}).Where("status = ?", "monitor").Count(&monitor)
+		c.JSON(http.StatusOK, gin.H{
+			"total":       total,
+			"allowed":     allowed,
+			"denied":      denied,
+			"whitelisted": whitelisted,
+			"monitor":     monitor,
+			"evaluation":  services.ExpressionStats(),
+		})
+	}
+}
+
+// validateGeoRule validates a geo rule and normalizes its value ("eu" to "EU", "de: Berlin" to "DE:Berlin")
+func validateGeoRule(rule *models.GeoRule) []validation.ValidationError {
+	validationResult := validation.ValidateGeoRule(rule.Type, rule.Value, rule.Latitude, rule.Longitude, rule.RadiusKm)
+	if !validationResult.IsValid {
+		return validationResult.Errors
+	}
+	if rule.Type == "radius" {
+		rule.Value = ""
+	} else {
+		rule.Value = services.GeoRuleKey(rule.Type, rule.Value)
+		rule.Latitude, rule.Longitude, rule.RadiusKm = 0, 0, 0
+	}
+	return nil
+}
+
+// CreateGeoRule adds a new geo rule
+// @Summary      Create geo rule
+// @Description  Creates a continent, subdivision, city or radius (geofence) rule, matched against the location resolved from the IP
+// @Tags         geo
+// @Accept       json
+// @Produce      json
+// @Param        geo  body      models.GeoRule  true  "Geo rule"
+// @Success      200 {object}  models.GeoRule
+// @Failure      400 {object}  map[string]string
+// @Failure      409 {object}  map[string]string
+// @Failure      500 {object}  map[string]string
+// @Router       /geo-rules [post]
+func CreateGeoRule(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var rule models.GeoRule
+		if err := c.ShouldBindJSON(&rule); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input format", "details": err.Error()})
+			return
+		}
+
+		// Comprehensive validation
+		if errors := validateGeoRule(&rule); len(errors) > 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Validation failed",
+				"details": errors,
+			})
+			return
+		}
+
+		// Check if name already exists
+		var existing models.GeoRule
+		if err := db.Where("name = ?", rule.Name).First(&existing).Error; err == nil {
+			c.JSON(http.StatusConflict, gin.H{"error": "Geo rule already exists", "name": rule.Name})
+			return
+		}
+
+		// Validate the validity window and resolve the TTL
+		if validityValidation := applyRuleValidity(&rule.RuleValidity); !validityValidation.IsValid {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Validation failed",
+				"details": validityValidation.Errors,
+			})
+			return
+		}
+
+		// Save to MySQL first
+		if err := db.Create(&rule).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save geo rule"})
+			return
+		}
+
+		// Publish event for async processing
+		services.PublishEvent("geo", "created", rule)
+
+		c.JSON(http.StatusOK, rule)
+	}
+}
+
+// GetGeoRules lists geo rules with pagination, filtering and sorting
+// @Summary      List geo rules
+// @Description  Returns paginated, filtered and sorted geo rules
+// @Tags         geo
+// @Produce      json
+// @Param        page     query     int     false  "Page (starting at 1)"
+// @Param        limit    query     int     false  "Items per page"
+// @Param        status   query     string  false  "Status filter (allowed, denied, whitelisted, monitor)"
+// @Param        type     query     string  false  "Type filter (continent, subdivision, city, radius)"
+// @Param        search   query     string  false  "Search in name and value"
+// @Param        orderBy  query     string  false  "Sort field (id, name, type, value, status, priority)"
+// @Param        order    query     string  false  "asc or desc"
+// @Success      200 {object} map[string]interface{}
+// @Router       /geo-rules [get]
+func GetGeoRules(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		page := c.DefaultQuery("page", "1")
+		limit := c.DefaultQuery("limit", "10")
+		status := c.Query("status")
+		ruleType := c.Query("type")
+		search := c.Query("search")
+		orderBy := c.DefaultQuery("orderBy", "id")
+		order := c.DefaultQuery("order", "desc")
+
+		pageNum := 1
+		limitNum := 10
+		fmt.Sscanf(page, "%d", &pageNum)
+		fmt.Sscanf(limit, "%d", &limitNum)
+		if pageNum < 1 {
+			pageNum = 1
+		}
+		if limitNum < 1 {
+			limitNum = 10
+		}
+
+		query := db.Model(&models.GeoRule{})
+		if status != "" {
+			query = query.Where("status = ?", status)
+		}
+		if ruleType != "" {
+			query = query.Where("type = ?", ruleType)
+		}
+		if search != "" {
+			query = query.Where("name LIKE ? OR value LIKE ?", "%"+search+"%", "%"+search+"%")
+		}
+
+		// Validate orderBy and order
+		switch orderBy {
+		case "id", "name", "type", "value", "status", "priority":
+		default:
+			orderBy = "id"
+		}
+		if order != "asc" && order != "desc" {
+			order = "desc"
+		}
+
+		var total int64
+		if err := query.Count(&total).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count geo rules"})
+			return
+		}
+
+		var rules []models.GeoRule
+		if err := query.Order(orderBy + " " + order).Limit(limitNum).Offset((pageNum - 1) * limitNum).Find(&rules).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch geo rules"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"items": rules,
+			"total": total,
+		})
+	}
+}
+
+// GetGeoRule returns a single geo rule
+func GetGeoRule(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var rule models.GeoRule
+		if err := db.First(&rule, c.Param("id")).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Rule not found"})
+			return
+		}
+		c.JSON(http.StatusOK, rule)
+	}
+}
+
+// UpdateGeoRule updates a geo rule
+func UpdateGeoRule(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var rule models.GeoRule
+		id := c.Param("id")
+		if err := db.First(&rule, id).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Rule not found"})
+			return
+		}
+		var input models.GeoRule
+		update := ruleUpdate{}
+		if err := update.bind(c, &input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		update.keepOmitted(&input.Priority, &input.RuleValidity, rule.Priority, rule.RuleValidity)
+
+		if errors := validateGeoRule(&input); len(errors) > 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Validation failed",
+				"details": errors,
+			})
+			return
+		}
+
+		if validityValidation := applyRuleValidity(&input.RuleValidity); !validityValidation.IsValid {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Validation failed", "details": validityValidation.Errors})
+			return
+		}
+		rule.Name = input.Name
+		rule.Type = input.Type
+		rule.Value = input.Value
+		rule.Latitude = input.Latitude
+		rule.Longitude = input.Longitude
+		rule.RadiusKm = input.RadiusKm
+		rule.Status = input.Status
+		rule.Priority = input.Priority
+		rule.RuleValidity = input.RuleValidity
+		if err := db.Save(&rule).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update geo rule"})
+			return
+		}
+		services.PublishEvent("geo", "updated", rule)
+		c.JSON(http.StatusOK, rule)
+	}
+}
+
+// DeleteGeoRule deletes a geo rule
+func DeleteGeoRule(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("id")
+		if err := db.Delete(&models.GeoRule{}, id).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete geo rule"})
+			return
+		}
+		services.PublishEvent("geo", "deleted", models.GeoRule{ID: parseUint(id)})
+		c.JSON(http.StatusOK, gin.H{"message": "Geo rule deleted"})
+	}
+}
+
+// GetGeoRuleStats returns the number of geo rules per status and per type
+func GetGeoRuleStats(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var total, allowed, denied, whitelisted, monitor int64
+		db.Model(&models.GeoRule{}).Count(&total)
+		db.Model(&models.GeoRule{}).Where("status = ?", "allowed").Count(&allowed)
+		db.Model(&models.GeoRule{}).Where("status = ?", "denied").Count(&denied)
+		db.Model(&models.GeoRule{}).Where("status = ?", "whitelisted").Count(&whitelisted)
+		db.Model(&models.GeoRule{}).Where("status = ?", "monitor").Count(&monitor)
+
+		byType := make(map[string]int64)
+		for _, ruleType := range []string{"continent", "subdivision", "city", "radius"} {
+			var count int64
+			db.Model(&models.GeoRule{}).Where("type = ?", ruleType).Count(&count)
+			byType[ruleType] = count
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"total":       total,
+			"allowed":     allowed,
+			"denied":      denied,
+			"whitelisted": whitelisted,
+			"monitor":     monitor,
+			"types":       byType,
+		})
+	}
+}
+
+// normalizeCountryGroup upper-cases the code and the countries and drops duplicate countries
+func normalizeCountryGroup(group *models.CountryGroup) {
+	group.Code = strings.ToUpper(strings.TrimSpace(group.Code))
+	seen := make(map[string]bool, len(group.Countries))
+	countries := make([]string, 0, len(group.Countries))
+	for _, country := range group.Countries {
+		country = strings.ToUpper(strings.TrimSpace(country))
+		if !seen[country] {
+			seen[country] = true
+			countries = append(countries, country)
+		}
+	}
+	group.Countries = countries
+}
+
+// validateCountryGroup normalizes and validates a country group
+func validateCountryGroup(group *models.CountryGroup) []validation.ValidationError {
+	normalizeCountryGroup(group)
+	validationResult := validation.ValidateCountryGroup(group.Code, group.Countries)
+	if !validationResult.IsValid {
+		return validationResult.Errors
+	}
+	return nil
+}
+
+// CreateCountryGroup adds a new country group
+// @Summary      Create country group
+// @Description  Creates a named set of countries with its own status, matched by the country filter
+// @Tags         country-groups
+// @Accept       json
+// @Produce      json
+// @Param        group  body      models.CountryGroup  true  "Country group"
+// @Success      200 {object}  models.CountryGroup
+// @Failure      400 {object}  map[string]string
+// @Failure      409 {object}  map[string]string
+// @Failure      500 {object}  map[string]string
+// @Router       /country-groups [post]
+func CreateCountryGroup(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var group models.CountryGroup
+		if err := c.ShouldBindJSON(&group); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input format", "details": err.Error()})
+			return
+		}
+
+		// Comprehensive validation
+		if errors := validateCountryGroup(&group); len(errors) > 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Validation failed",
+				"details": errors,
+			})
+			return
+		}
+
+		// Check if code already exists
+		var existing models.CountryGroup
+		if err := db.Where("code = ?", group.Code).First(&existing).Error; err == nil {
+			c.JSON(http.StatusConflict, gin.H{"error": "Country group already exists", "code": group.Code})
+			return
+		}
+
+		// Validate the validity window and resolve the TTL
+		if validityValidation := applyRuleValidity(&group.RuleValidity); !validityValidation.IsValid {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Validation failed",
+				"details": validityValidation.Errors,
+			})
+			return
+		}
+
+		// Only SeedCountryGroups creates built-in groups
+		group.BuiltIn = false
+		if err := db.Create(&group).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save country group"})
+			return
+		}
+
+		// Publish event for async processing
+		services.PublishEvent("country_group", "created", group)
+
+		c.JSON(http.StatusOK, group)
+	}
+}
+
+// GetCountryGroups lists country groups with pagination, filtering and sorting
+// @Summary      List country groups
+// @Description  Returns paginated, filtered and sorted country groups
+// @Tags         country-groups
+// @Produce      json
+// @Param        page     query     int     false  "Page (starting at 1)"
+// @Param        limit    query     int     false  "Items per page"
+// @Param        status   query     string  false  "Status filter (allowed, denied, whitelisted, monitor)"
+// @Param        country  query     string  false  "Only groups containing this country code"
+// @Param        search   query     string  false  "Search in code and name"
+// @Param        orderBy  query     string  false  "Sort field (id, code, name, status, priority)"
+// @Param        order    query     string  false  "asc or desc"
+// @Success      200 {object} map[string]interface{}
+// @Router       /country-groups [get]
+func GetCountryGroups(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		page := c.DefaultQuery("page", "1")
+		limit := c.DefaultQuery("limit", "10")
+		status := c.Query("status")
+		country := strings.ToUpper(strings.TrimSpace(c.Query("country")))
+		search := c.Query("search")
+		orderBy := c.DefaultQuery("orderBy", "id")
+		order := c.DefaultQuery("order", "desc")
+
+		pageNum := 1
+		limitNum := 10
+		fmt.Sscanf(page, "%d", &pageNum)
+		fmt.Sscanf(limit, "%d", &limitNum)
+		if pageNum < 1 {
+			pageNum = 1
+		}
+		if limitNum < 1 {
+			limitNum = 10
+		}
+
+		query := db.Model(&models.CountryGroup{})
+		if status != "" {
+			query = query.Where("status = ?", status)
+		}
+		if country != "" {
+			// Countries are stored as a JSON array of upper case codes
+			query = query.Where("countries LIKE ?", `%"`+country+`"%`)
+		}
+		if search != "" {
+			query = query.Where("code LIKE ? OR name LIKE ?", "%"+search+"%", "%"+search+"%")
+		}
+
+		// Validate orderBy and order
+		switch orderBy {
+		case "id", "code", "name", "status", "priority":
+		default:
+			orderBy = "id"
+		}
+		if order != "asc" && order != "desc" {
+			order = "desc"
+		}
+
+		var total int64
+		if err := query.Count(&total).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count country groups"})
+			return
+		}
+
+		var groups []models.CountryGroup
+		if err := query.Order(orderBy + " " + order).Limit(limitNum).Offset((pageNum - 1) * limitNum).Find(&groups).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch country groups"})
+			return
+		}
 
 		c.JSON(http.StatusOK, gin.H{
-			"message":         "Email index recreated successfully",
-			"records_indexed": recordCount,
+			"items": groups,
+			"total": total,
 		})
 	}
 }
 
-// RecreateUserAgentIndex löscht und erstellt den User-Agent-Index neu
-// @Summary      User-Agent-Index neu erstellen
-// @Description  Löscht den User-Agent-Index und erstellt ihn mit allen Daten aus der Datenbank neu
-// @Tags         user-agents
-// @Produce      json
-// @Success      200 {object} map[string]string
-// @Failure      500 {object} map[string]string
-// @Router       /user-agents/recreate-index [post]
-func RecreateUserAgentIndex(db *gorm.DB) gin.HandlerFunc {
+// GetCountryGroup returns a single country group
+func GetCountryGroup(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var group models.CountryGroup
+		if err := db.First(&group, c.Param("id")).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Country group not found"})
+			return
+		}
+		c.JSON(http.StatusOK, group)
+	}
+}
+
+// UpdateCountryGroup updates a country group; the code of built-in groups cannot change
+func UpdateCountryGroup(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// Delete existing index
-		if err := services.DeleteUserAgentIndex(); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete user agent index: " + err.Error()})
+		var group models.CountryGroup
+		id := c.Param("id")
+		if err := db.First(&group, id).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Country group not found"})
+			return
+		}
+		var input models.CountryGroup
+		update := ruleUpdate{}
+		if err := update.bind(c, &input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		update.keepOmitted(&input.Priority, &input.RuleValidity, group.Priority, group.RuleValidity)
+
+		if errors := validateCountryGroup(&input); len(errors) > 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Validation failed",
+				"details": errors,
+			})
+			return
+		}
+		if group.BuiltIn && input.Code != group.Code {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "The code of a built-in country group cannot be changed", "code": group.Code})
+			return
+		}
+		if input.Code != group.Code {
+			var existing models.CountryGroup
+			if err := db.Where("code = ?", input.Code).First(&existing).Error; err == nil {
+				c.JSON(http.StatusConflict, gin.H{"error": "Country group already exists", "code": input.Code})
+				return
+			}
+		}
+
+		if validityValidation := applyRuleValidity(&input.RuleValidity); !validityValidation.IsValid {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Validation failed", "details": validityValidation.Errors})
+			return
+		}
+		group.Code = input.Code
+		group.Name = input.Name
+		group.Countries = input.Countries
+		group.Status = input.Status
+		group.Priority = input.Priority
+		group.RuleValidity = input.RuleValidity
+		if err := db.Save(&group).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update country group"})
 			return
 		}
+		services.PublishEvent("country_group", "updated", group)
+		c.JSON(http.StatusOK, group)
+	}
+}
 
-		// Recreate index with all data
-		if err := services.SyncAllUserAgents(); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to recreate user agent index: " + err.Error()})
+// DeleteCountryGroup deletes a user-defined country group; built-in groups can only be disabled
+// by setting their status to "allowed"
+func DeleteCountryGroup(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var group models.CountryGroup
+		id := c.Param("id")
+		if err := db.First(&group, id).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Country group not found"})
+			return
+		}
+		if group.BuiltIn {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Built-in country groups cannot be deleted", "code": group.Code})
+			return
+		}
+		if err := db.Delete(&group).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete country group"})
 			return
 		}
+		services.PublishEvent("country_group", "deleted", group)
+		c.JSON(http.StatusOK, gin.H{"message": "Country group deleted"})
+	}
+}
 
-		// Count records indexed
-		var recordCount int64
-		db.Model(&models.UserAgent{}).Count(&recordCount)
+// GetCountryGroupStats returns the number of country groups per status
+func GetCountryGroupStats(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var total, allowed, denied, whitelisted, monitor, builtIn int64
+		db.Model(&models.CountryGroup{}).Count(&total)
+		db.Model(&models.CountryGroup{}).Where("status = ?", "allowed").Count(&allowed)
+		db.Model(&models.CountryGroup{}).Where("status = ?", "denied").Count(&denied)
+		db.Model(&models.CountryGroup{}).Where("status = ?", "whitelisted").Count(&whitelisted)
+		db.Model(&models.CountryGroup{}).Where("status = ?", "monitor").Count(&monitor)
+		db.Model(&models.CountryGroup{}).Where("built_in = ?", true).Count(&builtIn)
 
 		c.JSON(http.StatusOK, gin.H{
-			"message":         "User agent index recreated successfully",
-			"records_indexed": recordCount,
+			"total":       total,
+			"allowed":     allowed,
+			"denied":      denied,
+			"whitelisted": whitelisted,
+			"monitor":     monitor,
+			"built_in":    builtIn,
 		})
 	}
 }
 
-// RecreateCountryIndex löscht und erstellt den Country-Index neu
-// @Summary      Country-Index neu erstellen
-// @Description  Löscht den Country-Index und erstellt ihn mit allen Daten aus der Datenbank neu
-// @Tags         countries
+// GetCountryGroupsOfCountry returns the country groups a country belongs to
+// @Summary      Groups of a country
+// @Description  Returns all country groups containing the country code, e.g. EU, EEA and EUROPE for DE
+// @Tags         country-groups
 // @Produce      json
-// @Success      200 {object} map[string]string
-// @Failure      500 {object} map[string]string
-// @Router       /countries/recreate-index [post]
-func RecreateCountryIndex(db *gorm.DB) gin.HandlerFunc {
+// @Param        code  path      string  true  "ISO 3166-1 alpha-2 country code"
+// @Success      200 {object} map[string]interface{}
+// @Failure      400 {object} map[string]string
+// @Router       /countries/{code}/groups [get]
+func GetCountryGroupsOfCountry(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// Delete existing index
-		if err := services.DeleteCountryIndex(); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete country index: " + err.Error()})
+		code := strings.ToUpper(strings.TrimSpace(c.Param("code")))
+		if validationResult := validation.ValidateCountry(code); !validationResult.IsValid {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Validation failed", "details": validationResult.Errors})
 			return
 		}
 
-		// Recreate index with all data
-		if err := services.SyncAllCountries(); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to recreate country index: " + err.Error()})
+		var candidates []models.CountryGroup
+		if err := db.Where("countries LIKE ?", `%"`+code+`"%`).Order("code asc").Find(&candidates).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch country groups"})
 			return
 		}
-
-		// Count records indexed
-		var recordCount int64
-		db.Model(&models.Country{}).Count(&recordCount)
+		groups := make([]models.CountryGroup, 0, len(candidates))
+		for _, group := range candidates {
+			if services.CountryGroupHasMember(group, code) {
+				groups = append(groups, group)
+			}
+		}
 
 		c.JSON(http.StatusOK, gin.H{
-			"message":         "Country index recreated successfully",
-			"records_indexed": recordCount,
+			"country": code,
+			"groups":  groups,
+			"total":   len(groups),
 		})
 	}
 }
 
-// RecreateCharsetIndex löscht und erstellt den Charset-Index neu
-// @Summary      Charset-Index neu erstellen
-// @Description  Löscht den Charset-Index und erstellt ihn mit allen Daten aus der Datenbank neu
-// @Tags         charsets
+// GetDefaultPolicies returns the default policy of every filter that supports one
+// @Summary      List default policies
+// @Description  Returns what each filter answers for a value no rule matches: allow, deny or fall-through
+// @Tags         default-policies
 // @Produce      json
-// @Success      200 {object} map[string]string
+// @Success      200 {object} map[string]interface{}
 // @Failure      500 {object} map[string]string
-// @Router       /charsets/recreate-index [post]
-func RecreateCharsetIndex(db *gorm.DB) gin.HandlerFunc {
+// @Router       /default-policies [get]
+func GetDefaultPolicies(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// Delete existing index
-		if err := services.DeleteCharsetIndex(); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete charset index: " + err.Error()})
+		var stored []models.DefaultPolicy
+		if err := db.Find(&stored).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch default policies"})
 			return
 		}
 
-		// Recreate index with all data
-		if err := services.SyncAllCharsetRules(); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to recreate charset index: " + err.Error()})
-			return
+		policies := make(map[string]string, len(services.DefaultPolicyFilters))
+		for _, filter := range services.DefaultPolicyFilters {
+			policies[filter] = services.PolicyFallThrough
+		}
+		for _, p := range stored {
+			if services.IsDefaultPolicyFilter(p.Filter) {
+				policies[p.Filter] = p.Policy
+			}
 		}
-
-		// Count records indexed
-		var recordCount int64
-		db.Model(&models.CharsetRule{}).Count(&recordCount)
 
 		c.JSON(http.StatusOK, gin.H{
-			"message":         "Charset index recreated successfully",
-			"records_indexed": recordCount,
+			"policies": policies,
+			"values":   []string{services.PolicyAllow, services.PolicyDeny, services.PolicyFallThrough},
 		})
 	}
 }
 
-// RecreateUsernameIndex löscht und erstellt den Username-Index neu
-// @Summary      Username-Index neu erstellen
-// @Description  Löscht den Username-Index und erstellt ihn mit allen Daten aus der Datenbank neu
-// @Tags         usernames
+// UpdateDefaultPolicy sets the default policy of a filter
+// @Summary      Set default policy
+// @Description  Sets what a filter answers for a value no rule matches; with "deny" the rules of the filter form an allowlist
+// @Tags         default-policies
+// @Accept       json
 // @Produce      json
-// @Success      200 {object} map[string]string
-// @Failure      500 {object} map[string]string
-// @Router       /usernames/recreate-index [post]
-func RecreateUsernameIndex(db *gorm.DB) gin.HandlerFunc {
+// @Param        filter  path      string                true  "Filter name (ip, email, user_agent, country, username, asn, charset)"
+// @Param        policy  body      models.DefaultPolicy  true  "Policy"
+// @Success      200 {object}  models.DefaultPolicy
+// @Failure      400 {object}  map[string]string
+// @Failure      500 {object}  map[string]string
+// @Router       /default-policies/{filter} [put]
+func UpdateDefaultPolicy(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// Delete existing index
-		if err := services.DeleteUsernameIndex(); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete username index: " + err.Error()})
+		filter := c.Param("filter")
+		if !services.IsDefaultPolicyFilter(filter) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Filter does not support a default policy",
+				"filter":  filter,
+				"filters": services.DefaultPolicyFilters,
+			})
+			return
+		}
+
+		var input models.DefaultPolicy
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input format", "details": err.Error()})
 			return
 		}
 
-		// Recreate index with all data
-		if err := services.SyncAllUsernameRules(); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to recreate username index: " + err.Error()})
+		var policy models.DefaultPolicy
+		if err := db.Where(models.DefaultPolicy{Filter: filter}).FirstOrInit(&policy).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch default policy"})
+			return
+		}
+		policy.Policy = input.Policy
+		if err := db.Save(&policy).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save default policy"})
 			return
 		}
 
-		// Count records indexed
-		var recordCount int64
-		db.Model(&models.UsernameRule{}).Count(&recordCount)
+		services.PublishEvent("default_policy", "updated", policy)
+		c.JSON(http.StatusOK, policy)
+	}
+}
 
-		c.JSON(http.StatusOK, gin.H{
-			"message":         "Username index recreated successfully",
-			"records_indexed": recordCount,
-		})
+// startReindex starts rebuilding a rule index in the background and answers with the job
+func startReindex(c *gin.Context, db *gorm.DB, index string) {
+	job, started, err := services.StartReindexJob(db, index)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !started {
+		c.JSON(http.StatusConflict, gin.H{"error": "A rebuild of this index is already running", "job": job})
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{
+		"message":    "Index rebuild started",
+		"job":        job,
+		"status_url": "/api/sync/reindex-jobs/" + job.ID,
+	})
+}
+
+// ReindexHandler rebuilds any rule index by name
+// @Summary      Rebuild a rule index
+// @Description  Builds a new version of the index from MySQL and swaps the alias once the document count matches
+// @Tags         sync
+// @Produce      json
+// @Param        index path string true "Index name, e.g. ip-addresses or email_domains"
+// @Success      202 {object} map[string]interface{}
+// @Failure      400 {object} map[string]string
+// @Failure      409 {object} map[string]interface{}
+// @Router       /sync/reindex/{index} [post]
+func ReindexHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		startReindex(c, db, c.Param("index"))
+	}
+}
+
+// GetReindexJobs lists the rebuild jobs of this instance
+// @Summary      List reindex jobs
+// @Tags         sync
+// @Produce      json
+// @Success      200 {object} map[string]interface{}
+// @Router       /sync/reindex-jobs [get]
+func GetReindexJobs() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"jobs": services.ListReindexJobs()})
+	}
+}
+
+// GetReindexJob returns the progress of a rebuild job
+// @Summary      Get reindex job status
+// @Tags         sync
+// @Produce      json
+// @Param        id path string true "Job ID"
+// @Success      200 {object} services.ReindexJob
+// @Failure      404 {object} map[string]string
+// @Router       /sync/reindex-jobs/{id} [get]
+func GetReindexJob() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		job, ok := services.GetReindexJob(c.Param("id"))
+		if !ok {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Reindex job not found"})
+			return
+		}
+		c.JSON(http.StatusOK, job)
+	}
+}
+
+// RecreateIPIndex baut den IP-Index neu auf
+// @Summary      IP-Index neu aufbauen
+// @Description  Baut eine neue Version des IP-Index aus der Datenbank auf und schaltet den Alias um, sobald sie vollständig ist
+// @Tags         ip
+// @Produce      json
+// @Success      202 {object} map[string]interface{}
+// @Failure      409 {object} map[string]interface{}
+// @Router       /ip/recreate-index [post]
+func RecreateIPIndex(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		startReindex(c, db, services.IndexIPs)
+	}
+}
+
+// RecreateEmailIndex baut den Email-Index neu auf
+// @Summary      Email-Index neu aufbauen
+// @Description  Baut eine neue Version des Email-Index aus der Datenbank auf und schaltet den Alias um, sobald sie vollständig ist
+// @Tags         emails
+// @Produce      json
+// @Success      202 {object} map[string]interface{}
+// @Failure      409 {object} map[string]interface{}
+// @Router       /emails/recreate-index [post]
+func RecreateEmailIndex(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		startReindex(c, db, services.IndexEmails)
+	}
+}
+
+// RecreateUserAgentIndex baut den User-Agent-Index neu auf
+// @Summary      User-Agent-Index neu aufbauen
+// @Description  Baut eine neue Version des User-Agent-Index aus der Datenbank auf und schaltet den Alias um, sobald sie vollständig ist
+// @Tags         user-agents
+// @Produce      json
+// @Success      202 {object} map[string]interface{}
+// @Failure      409 {object} map[string]interface{}
+// @Router       /user-agents/recreate-index [post]
+func RecreateUserAgentIndex(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		startReindex(c, db, services.IndexUserAgents)
+	}
+}
+
+// RecreateCountryIndex baut den Country-Index neu auf
+// @Summary      Country-Index neu aufbauen
+// @Description  Baut eine neue Version des Country-Index aus der Datenbank auf und schaltet den Alias um, sobald sie vollständig ist
+// @Tags         countries
+// @Produce      json
+// @Success      202 {object} map[string]interface{}
+// @Failure      409 {object} map[string]interface{}
+// @Router       /countries/recreate-index [post]
+func RecreateCountryIndex(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		startReindex(c, db, services.IndexCountries)
+	}
+}
+
+// RecreateCharsetIndex baut den Charset-Index neu auf
+// @Summary      Charset-Index neu aufbauen
+// @Description  Baut eine neue Version des Charset-Index aus der Datenbank auf und schaltet den Alias um, sobald sie vollständig ist
+// @Tags         charsets
+// @Produce      json
+// @Success      202 {object} map[string]interface{}
+// @Failure      409 {object} map[string]interface{}
+// @Router       /charsets/recreate-index [post]
+func RecreateCharsetIndex(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		startReindex(c, db, services.IndexCharsets)
+	}
+}
+
+// RecreateUsernameIndex baut den Username-Index neu auf
+// @Summary      Username-Index neu aufbauen
+// @Description  Baut eine neue Version des Username-Index aus der Datenbank auf und schaltet den Alias um, sobald sie vollständig ist
+// @Tags         usernames
+// @Produce      json
+// @Success      202 {object} map[string]interface{}
+// @Failure      409 {object} map[string]interface{}
+// @Router       /usernames/recreate-index [post]
+func RecreateUsernameIndex(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		startReindex(c, db, services.IndexUsernames)
 	}
 }
 
@@ -2006,6 +3945,10 @@ func CheckIPConflicts(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
+		// Store one form per address, so ::ffff:192.0.2.1 and 192.0.2.1 are the same rule
+		ip.Address = utils.CanonicalIP(ip.Address)
+		setIPRangeFlag(&ip)
+
 		// Get all existing IPs and CIDR ranges
 		var existingIPs []models.IP
 		if err := db.Find(&existingIPs).Error; err != nil {
@@ -2019,7 +3962,7 @@ func CheckIPConflicts(db *gorm.DB) gin.HandlerFunc {
 		existingStatuses := make(map[string]string)
 
 		for _, existing := range existingIPs {
-			if existing.IsCIDR {
+			if existing.IsCIDR || existing.IsRange {
 				existingCIDRs = append(existingCIDRs, existing.Address)
 				existingStatuses[existing.Address] = existing.Status
 			} else {
@@ -2032,7 +3975,7 @@ func CheckIPConflicts(db *gorm.DB) gin.HandlerFunc {
 		var conflicts []utils.ConflictInfo
 		var err error
 
-		if ip.IsCIDR {
+		if ip.IsCIDR || ip.IsRange {
 			// New entry is a CIDR range - check for conflicts
 			conflicts, err = utils.CheckCIDRConflicts(ip.Address, existingIPAddresses, existingCIDRs, existingStatuses, ip.Status)
 		} else {
@@ -2226,6 +4169,15 @@ func CreateASN(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
+		// Validate the validity window and resolve the TTL
+		if validityValidation := applyRuleValidity(&asn.RuleValidity); !validityValidation.IsValid {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Validation failed",
+				"details": validityValidation.Errors,
+			})
+			return
+		}
+
 		// Create the ASN
 		if err := db.Create(&asn).Error; err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create ASN"})
@@ -2238,6 +4190,7 @@ func CreateASN(db *gorm.DB) gin.HandlerFunc {
 				log.Printf("Failed to sync ASN to Elasticsearch: %v", err)
 			}
 		}()
+		services.PublishEvent("asn", "created", asn)
 
 		c.JSON(http.StatusOK, asn)
 	}
@@ -2394,6 +4347,7 @@ func GetASNStats(db *gorm.DB) gin.HandlerFunc {
 			Allowed     int64 `json:"allowed"`
 			Denied      int64 `json:"denied"`
 			Whitelisted int64 `json:"whitelisted"`
+			Monitor     int64 `json:"monitor"`
 		}
 
 		// Get total count
@@ -2403,6 +4357,7 @@ func GetASNStats(db *gorm.DB) gin.HandlerFunc {
 		db.Model(&models.ASN{}).Where("status = ?", "allowed").Count(&stats.Allowed)
 		db.Model(&models.ASN{}).Where("status = ?", "denied").Count(&stats.Denied)
 		db.Model(&models.ASN{}).Where("status = ?", "whitelisted").Count(&stats.Whitelisted)
+		db.Model(&models.ASN{}).Where("status = ?", "monitor").Count(&stats.Monitor)
 
 		c.JSON(http.StatusOK, stats)
 	}
@@ -2468,11 +4423,20 @@ func UpdateASN(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
+		// Check if ASN exists
+		var existingASN models.ASN
+		if err := db.First(&existingASN, id).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "ASN not found"})
+			return
+		}
+
 		var asn models.ASN
-		if err := c.ShouldBindJSON(&asn); err != nil {
+		update := ruleUpdate{}
+		if err := update.bind(c, &asn); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input format", "details": err.Error()})
 			return
 		}
+		update.keepOmitted(&asn.Priority, &asn.RuleValidity, existingASN.Priority, existingASN.RuleValidity)
 
 		// Validate ASN format
 		if len(asn.ASN) < 3 || !strings.HasPrefix(asn.ASN, "AS") {
@@ -2490,10 +4454,12 @@ func UpdateASN(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		// Check if ASN exists
-		var existingASN models.ASN
-		if err := db.First(&existingASN, id).Error; err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": "ASN not found"})
+		// Validate the validity window and resolve the TTL
+		if validityValidation := applyRuleValidity(&asn.RuleValidity); !validityValidation.IsValid {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Validation failed",
+				"details": validityValidation.Errors,
+			})
 			return
 		}
 
@@ -2503,12 +4469,23 @@ func UpdateASN(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
+		// Updates skips zero values, so set the priority and validity window explicitly
+		if err := db.Model(&existingASN).Updates(map[string]interface{}{
+			"priority":   asn.Priority,
+			"valid_from": asn.ValidFrom,
+			"expires_at": asn.ExpiresAt,
+		}).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update ASN"})
+			return
+		}
+
 		// Sync to Elasticsearch
 		go func() {
 			if err := services.SyncASNToES(existingASN); err != nil {
 				log.Printf("Failed to sync ASN to Elasticsearch: %v", err)
 			}
 		}()
+		services.PublishEvent("asn", "updated", existingASN)
 
 		c.JSON(http.StatusOK, existingASN)
 	}
@@ -2542,61 +4519,16 @@ func DeleteASN(db *gorm.DB) gin.HandlerFunc {
 				log.Printf("Failed to delete ASN from Elasticsearch: %v", err)
 			}
 		}()
+		services.PublishEvent("asn", "deleted", asn)
 
 		c.JSON(http.StatusOK, gin.H{"message": "ASN deleted successfully"})
 	}
 }
 
-// RecreateASNIndex recreates the ASN index in Elasticsearch
+// RecreateASNIndex rebuilds the ASN index of the rule index
 func RecreateASNIndex(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// Delete existing index
-		es := config.ESClient
-		_, err := es.Indices.Delete([]string{"asns"}, es.Indices.Delete.WithContext(context.Background()))
-		if err != nil {
-			// Index might not exist, which is fine
-			log.Printf("Could not delete existing ASN index: %v", err)
-		}
-
-		// Create new index with mapping
-		mapping := `{
-			"mappings": {
-				"properties": {
-					"id": {"type": "long"},
-					"asn": {"type": "keyword"},
-					"name": {"type": "text"},
-					"status": {"type": "keyword"}
-				}
-			}
-		}`
-
-		_, err = es.Indices.Create(
-			"asns",
-			es.Indices.Create.WithBody(strings.NewReader(mapping)),
-			es.Indices.Create.WithContext(context.Background()),
-		)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create ASN index"})
-			return
-		}
-
-		// Sync all ASNs to Elasticsearch
-		var asns []models.ASN
-		if err := db.Find(&asns).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch ASNs"})
-			return
-		}
-
-		for _, asn := range asns {
-			if err := services.SyncASNToES(asn); err != nil {
-				log.Printf("Failed to sync ASN %d to Elasticsearch: %v", asn.ID, err)
-			}
-		}
-
-		c.JSON(http.StatusOK, gin.H{
-			"message": "ASN index recreated successfully",
-			"synced":  len(asns),
-		})
+		startReindex(c, db, services.IndexASNs)
 	}
 }
 
@@ -0,0 +1,55 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"firewall/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func bindTestUpdate(t *testing.T, body string, input interface{}) ruleUpdate {
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPut, "/api/ips/1", strings.NewReader(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+
+	update := ruleUpdate{}
+	require.NoError(t, update.bind(c, input))
+	return update
+}
+
+func TestRuleUpdate_KeepOmitted(t *testing.T) {
+	validFrom := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	expiresAt := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	stored := models.IP{Priority: 50, RuleValidity: models.RuleValidity{ValidFrom: &validFrom, ExpiresAt: &expiresAt}}
+
+	// A form that only sends the rule itself keeps the priority and the validity window
+	var input models.IP
+	update := bindTestUpdate(t, `{"address":"192.0.2.1","status":"denied"}`, &input)
+	update.keepOmitted(&input.Priority, &input.RuleValidity, stored.Priority, stored.RuleValidity)
+	assert.Equal(t, 50, input.Priority)
+	assert.Equal(t, &validFrom, input.ValidFrom)
+	assert.Equal(t, &expiresAt, input.ExpiresAt)
+
+	// Fields that are sent replace the stored values, null clears them; keys ignore the case
+	input = models.IP{}
+	update = bindTestUpdate(t, `{"address":"192.0.2.1","status":"denied","Priority":0,"valid_from":null,"expires_at":null}`, &input)
+	update.keepOmitted(&input.Priority, &input.RuleValidity, stored.Priority, stored.RuleValidity)
+	assert.Equal(t, 0, input.Priority)
+	assert.Nil(t, input.ValidFrom)
+	assert.Nil(t, input.ExpiresAt)
+
+	// A ttl replaces the stored expiry
+	input = models.IP{}
+	update = bindTestUpdate(t, `{"address":"192.0.2.1","status":"denied","ttl":"24h"}`, &input)
+	update.keepOmitted(&input.Priority, &input.RuleValidity, stored.Priority, stored.RuleValidity)
+	assert.Nil(t, input.ExpiresAt)
+	assert.Equal(t, "24h", input.TTL)
+}
@@ -0,0 +1,595 @@
+package expression
+
+import (
+	"fmt"
+	"math"
+	"net/netip"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"firewall/utils"
+)
+
+// node is a type checked syntax tree node
+type node interface {
+	typ() Type
+	eval(s *state) (interface{}, error)
+}
+
+type literalNode struct {
+	value interface{}
+	t     Type
+}
+
+func (n *literalNode) typ() Type { return n.t }
+
+func (n *literalNode) eval(s *state) (interface{}, error) {
+	return n.value, s.step()
+}
+
+type variableNode struct {
+	name string
+	t    Type
+}
+
+func (n *variableNode) typ() Type { return n.t }
+
+func (n *variableNode) eval(s *state) (interface{}, error) {
+	if err := s.step(); err != nil {
+		return nil, err
+	}
+	return normalize(s.env.Get(n.name)), nil
+}
+
+type listNode struct {
+	items []node
+}
+
+func (n *listNode) typ() Type { return List }
+
+func (n *listNode) eval(s *state) (interface{}, error) {
+	list := make([]interface{}, len(n.items))
+	for i, item := range n.items {
+		value, err := item.eval(s)
+		if err != nil {
+			return nil, err
+		}
+		list[i] = value
+	}
+	return list, s.step()
+}
+
+type unaryNode struct {
+	op      string
+	operand node
+}
+
+func (n *unaryNode) typ() Type {
+	if n.op == "!" {
+		return Bool
+	}
+	return Number
+}
+
+func (n *unaryNode) eval(s *state) (interface{}, error) {
+	value, err := n.operand.eval(s)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.step(); err != nil {
+		return nil, err
+	}
+	if n.op == "!" {
+		b, ok := value.(bool)
+		if !ok {
+			return nil, fmt.Errorf("operator ! needs a bool, got %s", typeOf(value))
+		}
+		return !b, nil
+	}
+	f, ok := value.(float64)
+	if !ok {
+		return nil, fmt.Errorf("operator - needs a number, got %s", typeOf(value))
+	}
+	return -f, nil
+}
+
+type logicalNode struct {
+	and         bool
+	left, right node
+}
+
+func (n *logicalNode) typ() Type { return Bool }
+
+func (n *logicalNode) eval(s *state) (interface{}, error) {
+	op := "||"
+	if n.and {
+		op = "&&"
+	}
+	left, err := n.left.eval(s)
+	if err != nil {
+		return nil, err
+	}
+	l, ok := left.(bool)
+	if !ok {
+		return nil, fmt.Errorf("operator %s needs bool operands, got %s", op, typeOf(left))
+	}
+	// Short-circuit
+	if l != n.and {
+		return l, nil
+	}
+	right, err := n.right.eval(s)
+	if err != nil {
+		return nil, err
+	}
+	r, ok := right.(bool)
+	if !ok {
+		return nil, fmt.Errorf("operator %s needs bool operands, got %s", op, typeOf(right))
+	}
+	return r, s.step()
+}
+
+type compareNode struct {
+	op          string
+	left, right node
+}
+
+func (n *compareNode) typ() Type { return Bool }
+
+func (n *compareNode) eval(s *state) (interface{}, error) {
+	left, err := n.left.eval(s)
+	if err != nil {
+		return nil, err
+	}
+	right, err := n.right.eval(s)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.step(); err != nil {
+		return nil, err
+	}
+
+	switch n.op {
+	case "==":
+		return equal(left, right), nil
+	case "!=":
+		return !equal(left, right), nil
+	case "in":
+		switch r := right.(type) {
+		case []interface{}:
+			return listContains(r, left), nil
+		case map[string]interface{}:
+			key, ok := left.(string)
+			if !ok {
+				return false, nil
+			}
+			_, found := r[key]
+			return found, nil
+		case string:
+			l, ok := left.(string)
+			if !ok {
+				return nil, fmt.Errorf("cannot search %s in a string", typeOf(left))
+			}
+			return strings.Contains(r, l), nil
+		case nil:
+			return false, nil
+		}
+		return nil, fmt.Errorf("operator in needs a list, map or string, got %s", typeOf(right))
+	}
+
+	var cmp int
+	switch l := left.(type) {
+	case float64:
+		r, ok := right.(float64)
+		if !ok {
+			return nil, fmt.Errorf("cannot compare number with %s", typeOf(right))
+		}
+		cmp = compareFloats(l, r)
+	case string:
+		r, ok := right.(string)
+		if !ok {
+			return nil, fmt.Errorf("cannot compare string with %s", typeOf(right))
+		}
+		cmp = strings.Compare(l, r)
+	default:
+		return nil, fmt.Errorf("operator %s needs two numbers or two strings, got %s", n.op, typeOf(left))
+	}
+	switch n.op {
+	case "<":
+		return cmp < 0, nil
+	case "<=":
+		return cmp <= 0, nil
+	case ">":
+		return cmp > 0, nil
+	}
+	return cmp >= 0, nil
+}
+
+func compareFloats(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+type arithmeticNode struct {
+	op          string
+	left, right node
+	result      Type
+}
+
+func (n *arithmeticNode) typ() Type { return n.result }
+
+func (n *arithmeticNode) eval(s *state) (interface{}, error) {
+	left, err := n.left.eval(s)
+	if err != nil {
+		return nil, err
+	}
+	right, err := n.right.eval(s)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.step(); err != nil {
+		return nil, err
+	}
+
+	if n.op == "+" {
+		if l, ok := left.(string); ok {
+			r, ok := right.(string)
+			if !ok {
+				return nil, fmt.Errorf("cannot add string and %s", typeOf(right))
+			}
+			if len(l)+len(r) > maxStringLen {
+				return nil, fmt.Errorf("string too long (max %d bytes)", maxStringLen)
+			}
+			return l + r, nil
+		}
+	}
+	l, lok := left.(float64)
+	r, rok := right.(float64)
+	if !lok || !rok {
+		return nil, fmt.Errorf("operator %s needs numbers, got %s and %s", n.op, typeOf(left), typeOf(right))
+	}
+	switch n.op {
+	case "+":
+		return l + r, nil
+	case "-":
+		return l - r, nil
+	case "*":
+		return l * r, nil
+	case "/":
+		if r == 0 {
+			return nil, fmt.Errorf("division by zero")
+		}
+		return l / r, nil
+	}
+	if r == 0 {
+		return nil, fmt.Errorf("modulo by zero")
+	}
+	return math.Mod(l, r), nil
+}
+
+// indexNode is x[i] or x.name; missing keys and out of range indexes are null
+type indexNode struct {
+	target, index node
+}
+
+func (n *indexNode) typ() Type { return Any }
+
+func (n *indexNode) eval(s *state) (interface{}, error) {
+	target, err := n.target.eval(s)
+	if err != nil {
+		return nil, err
+	}
+	index, err := n.index.eval(s)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.step(); err != nil {
+		return nil, err
+	}
+
+	switch t := target.(type) {
+	case map[string]interface{}:
+		key, ok := index.(string)
+		if !ok {
+			return nil, fmt.Errorf("map key must be a string, got %s", typeOf(index))
+		}
+		return normalize(t[key]), nil
+	case []interface{}:
+		i, ok := index.(float64)
+		if !ok {
+			return nil, fmt.Errorf("list index must be a number, got %s", typeOf(index))
+		}
+		if i < 0 || i >= float64(len(t)) || i != math.Trunc(i) {
+			return nil, nil
+		}
+		return normalize(t[int(i)]), nil
+	case nil:
+		return nil, nil
+	}
+	return nil, fmt.Errorf("cannot index %s", typeOf(target))
+}
+
+type callNode struct {
+	name    string
+	fn      *builtin
+	args    []node
+	regex   *regexp.Regexp
+	ipRange utils.IPRange
+}
+
+func (n *callNode) typ() Type { return n.fn.result }
+
+func (n *callNode) eval(s *state) (interface{}, error) {
+	args := make([]interface{}, len(n.args))
+	for i, arg := range n.args {
+		value, err := arg.eval(s)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = value
+	}
+	if err := s.step(); err != nil {
+		return nil, err
+	}
+	result, err := n.fn.call(n, args)
+	if err != nil {
+		return nil, fmt.Errorf("%s(): %w", n.name, err)
+	}
+	return result, nil
+}
+
+// typeSet lists the types a function parameter accepts
+type typeSet []Type
+
+func (ts typeSet) accepts(t Type) bool {
+	for _, allowed := range ts {
+		if allowed == Any || allowed == t || t == Any {
+			return true
+		}
+	}
+	return false
+}
+
+func (ts typeSet) String() string {
+	names := make([]string, len(ts))
+	for i, t := range ts {
+		names[i] = t.String()
+	}
+	return strings.Join(names, " or ")
+}
+
+// Arguments that must be literals, compiled with the expression
+const (
+	literalNone = iota
+	literalRegex
+	literalCIDR
+)
+
+// builtin is a function that can be called as f(x, ...) or x.f(...)
+type builtin struct {
+	params  []typeSet
+	result  Type
+	literal int
+	call    func(n *callNode, args []interface{}) (interface{}, error)
+}
+
+var builtins map[string]*builtin
+
+func init() {
+	str := typeSet{String}
+	builtins = map[string]*builtin{
+		"len": {params: []typeSet{{String, List, Map}}, result: Number, call: func(n *callNode, args []interface{}) (interface{}, error) {
+			switch v := args[0].(type) {
+			case string:
+				return float64(utf8.RuneCountInString(v)), nil
+			case []interface{}:
+				return float64(len(v)), nil
+			case map[string]interface{}:
+				return float64(len(v)), nil
+			case nil:
+				return float64(0), nil
+			}
+			return nil, fmt.Errorf("needs a string, list or map, got %s", typeOf(args[0]))
+		}},
+		"lower": {params: []typeSet{str}, result: String, call: stringFunc(strings.ToLower)},
+		"upper": {params: []typeSet{str}, result: String, call: stringFunc(strings.ToUpper)},
+		"trim":  {params: []typeSet{str}, result: String, call: stringFunc(strings.TrimSpace)},
+		"contains": {params: []typeSet{{String, List}, {Any}}, result: Bool, call: func(n *callNode, args []interface{}) (interface{}, error) {
+			switch v := args[0].(type) {
+			case string:
+				sub, ok := args[1].(string)
+				if !ok {
+					return nil, fmt.Errorf("cannot search %s in a string", typeOf(args[1]))
+				}
+				return strings.Contains(v, sub), nil
+			case []interface{}:
+				return listContains(v, args[1]), nil
+			case nil:
+				return false, nil
+			}
+			return nil, fmt.Errorf("needs a string or list, got %s", typeOf(args[0]))
+		}},
+		"startsWith": {params: []typeSet{str, str}, result: Bool, call: stringPredicate(strings.HasPrefix)},
+		"endsWith":   {params: []typeSet{str, str}, result: Bool, call: stringPredicate(strings.HasSuffix)},
+		"matches": {params: []typeSet{str, str}, result: Bool, literal: literalRegex, call: func(n *callNode, args []interface{}) (interface{}, error) {
+			s, err := stringArg(args[0])
+			if err != nil {
+				return nil, err
+			}
+			return n.regex.MatchString(s), nil
+		}},
+		"inCIDR": {params: []typeSet{str, str}, result: Bool, literal: literalCIDR, call: func(n *callNode, args []interface{}) (interface{}, error) {
+			s, err := stringArg(args[0])
+			if err != nil {
+				return nil, err
+			}
+			addr, err := netip.ParseAddr(s)
+			return err == nil && n.ipRange.Contains(addr), nil
+		}},
+		"number": {params: []typeSet{{String, Number, Bool}}, result: Number, call: func(n *callNode, args []interface{}) (interface{}, error) {
+			switch v := args[0].(type) {
+			case float64:
+				return v, nil
+			case bool:
+				if v {
+					return float64(1), nil
+				}
+				return float64(0), nil
+			case string:
+				f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+				if err != nil {
+					return nil, fmt.Errorf("%q is not a number", v)
+				}
+				return f, nil
+			}
+			return nil, fmt.Errorf("cannot convert %s to a number", typeOf(args[0]))
+		}},
+		"string": {params: []typeSet{{Any}}, result: String, call: func(n *callNode, args []interface{}) (interface{}, error) {
+			switch v := args[0].(type) {
+			case string:
+				return v, nil
+			case float64:
+				return strconv.FormatFloat(v, 'f', -1, 64), nil
+			case bool:
+				return strconv.FormatBool(v), nil
+			case nil:
+				return "", nil
+			}
+			return nil, fmt.Errorf("cannot convert %s to a string", typeOf(args[0]))
+		}},
+	}
+}
+
+func stringArg(v interface{}) (string, error) {
+	switch s := v.(type) {
+	case string:
+		return s, nil
+	case nil:
+		return "", nil
+	}
+	return "", fmt.Errorf("needs a string, got %s", typeOf(v))
+}
+
+func stringFunc(f func(string) string) func(*callNode, []interface{}) (interface{}, error) {
+	return func(n *callNode, args []interface{}) (interface{}, error) {
+		s, err := stringArg(args[0])
+		if err != nil {
+			return nil, err
+		}
+		return f(s), nil
+	}
+}
+
+func stringPredicate(f func(string, string) bool) func(*callNode, []interface{}) (interface{}, error) {
+	return func(n *callNode, args []interface{}) (interface{}, error) {
+		s, err := stringArg(args[0])
+		if err != nil {
+			return nil, err
+		}
+		arg, err := stringArg(args[1])
+		if err != nil {
+			return nil, err
+		}
+		return f(s, arg), nil
+	}
+}
+
+// normalize converts Go values from the environment to the value types of the language
+func normalize(v interface{}) interface{} {
+	switch x := v.(type) {
+	case int:
+		return float64(x)
+	case int32:
+		return float64(x)
+	case int64:
+		return float64(x)
+	case uint:
+		return float64(x)
+	case uint32:
+		return float64(x)
+	case uint64:
+		return float64(x)
+	case float32:
+		return float64(x)
+	case []string:
+		list := make([]interface{}, len(x))
+		for i, s := range x {
+			list[i] = s
+		}
+		return list
+	case map[string]string:
+		m := make(map[string]interface{}, len(x))
+		for k, s := range x {
+			m[k] = s
+		}
+		return m
+	}
+	return v
+}
+
+// typeOf returns the runtime type of a value
+func typeOf(v interface{}) Type {
+	switch v.(type) {
+	case nil:
+		return Null
+	case bool:
+		return Bool
+	case float64:
+		return Number
+	case string:
+		return String
+	case []interface{}:
+		return List
+	case map[string]interface{}:
+		return Map
+	}
+	return Any
+}
+
+// equal compares two values; values of different types are never equal
+func equal(a, b interface{}) bool {
+	switch x := a.(type) {
+	case nil:
+		return b == nil
+	case bool, float64, string:
+		return a == b
+	case []interface{}:
+		y, ok := b.([]interface{})
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for i := range x {
+			if !equal(normalize(x[i]), normalize(y[i])) {
+				return false
+			}
+		}
+		return true
+	case map[string]interface{}:
+		y, ok := b.(map[string]interface{})
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for k, v := range x {
+			if w, found := y[k]; !found || !equal(normalize(v), normalize(w)) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+func listContains(list []interface{}, v interface{}) bool {
+	for _, item := range list {
+		if equal(normalize(item), v) {
+			return true
+		}
+	}
+	return false
+}
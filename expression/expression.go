@@ -0,0 +1,185 @@
+// Package expression implements the small, sandboxed expression language of expression rules, e.g.
+//
+//	country in ["RU", "CN"] && asn_org.contains("Hosting") && len(username) > 20
+//
+// Expressions are compiled once against declared variables and type checked, so typos and type
+// errors are reported at create time. Evaluation has no access to anything but the variables and
+// the built-in functions, has no loops, and is bounded by a step limit and the context deadline.
+package expression
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Type is the static type of a variable or (sub)expression
+type Type int
+
+const (
+	Any    Type = iota // Only known at runtime, e.g. custom JSON fields
+	Bool               // true or false
+	Number             // float64
+	String             // string
+	List               // []interface{}
+	Map                // map[string]interface{}
+	Null               // null
+)
+
+func (t Type) String() string {
+	switch t {
+	case Bool:
+		return "bool"
+	case Number:
+		return "number"
+	case String:
+		return "string"
+	case List:
+		return "list"
+	case Map:
+		return "map"
+	case Null:
+		return "null"
+	}
+	return "any"
+}
+
+// Vars declares the variables an expression may use and their types
+type Vars map[string]Type
+
+// Env provides the variable values during evaluation
+type Env interface {
+	Get(name string) interface{}
+}
+
+// MapEnv is an Env backed by a map
+type MapEnv map[string]interface{}
+
+// Get returns the value of a variable, nil if it is not set
+func (m MapEnv) Get(name string) interface{} {
+	return m[name]
+}
+
+// Limits of the sandbox
+const (
+	MaxLength    = 4096     // Maximum source length
+	maxDepth     = 64       // Maximum nesting depth
+	maxNodes     = 1000     // Maximum number of syntax tree nodes
+	maxSteps     = 100000   // Maximum number of evaluation steps
+	maxStringLen = 64 << 10 // Maximum length of a string built during evaluation
+	maxRegexLen  = 500      // Maximum length of a regex pattern
+)
+
+var (
+	// ErrTimeout is returned when the context is done before the evaluation finished
+	ErrTimeout = errors.New("expression evaluation timed out")
+	// ErrStepLimit is returned when an evaluation takes more than maxSteps steps
+	ErrStepLimit = errors.New("expression evaluation exceeded the step limit")
+)
+
+// Error is a compile error with its position in the source
+type Error struct {
+	Line   int
+	Column int
+	Msg    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("line %d, column %d: %s", e.Line, e.Column, e.Msg)
+}
+
+// newError builds an Error for a byte offset in source
+func newError(source string, offset int, format string, args ...interface{}) *Error {
+	if offset > len(source) {
+		offset = len(source)
+	}
+	line := 1 + strings.Count(source[:offset], "\n")
+	column := offset - strings.LastIndexByte(source[:offset], '\n')
+	return &Error{Line: line, Column: column, Msg: fmt.Sprintf(format, args...)}
+}
+
+// Program is a compiled expression; it is safe for concurrent use
+type Program struct {
+	source string
+	root   node
+	vars   []string
+}
+
+// Compile parses and type checks an expression against the declared variables.
+// The expression must evaluate to a bool.
+func Compile(source string, vars Vars) (*Program, error) {
+	if strings.TrimSpace(source) == "" {
+		return nil, &Error{Line: 1, Column: 1, Msg: "expression is empty"}
+	}
+	if len(source) > MaxLength {
+		return nil, &Error{Line: 1, Column: 1, Msg: fmt.Sprintf("expression too long (max %d characters)", MaxLength)}
+	}
+
+	tokens, err := tokenize(source)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{source: source, tokens: tokens, vars: vars, used: make(map[string]bool)}
+	root, err := p.parse()
+	if err != nil {
+		return nil, err
+	}
+	if t := root.typ(); t != Bool && t != Any {
+		return nil, newError(source, 0, "expression must return a bool, got %s", t)
+	}
+
+	program := &Program{source: source, root: root}
+	for name := range p.used {
+		program.vars = append(program.vars, name)
+	}
+	sort.Strings(program.vars)
+	return program, nil
+}
+
+// Source returns the expression the program was compiled from
+func (p *Program) Source() string {
+	return p.source
+}
+
+// Vars returns the names of the variables the expression uses
+func (p *Program) Vars() []string {
+	return p.vars
+}
+
+// Eval evaluates the expression; it stops with ErrTimeout once ctx is done
+func (p *Program) Eval(ctx context.Context, env Env) (bool, error) {
+	if ctx.Err() != nil {
+		return false, ErrTimeout
+	}
+	s := &state{ctx: ctx, env: env}
+	value, err := p.root.eval(s)
+	if err != nil {
+		return false, err
+	}
+	result, ok := value.(bool)
+	if !ok {
+		return false, fmt.Errorf("expression returned %s, not a bool", typeOf(value))
+	}
+	return result, nil
+}
+
+// state tracks the budget of one evaluation
+type state struct {
+	ctx   context.Context
+	env   Env
+	steps int
+}
+
+// step charges one evaluation step and checks the limits
+func (s *state) step() error {
+	s.steps++
+	if s.steps > maxSteps {
+		return ErrStepLimit
+	}
+	if s.steps%32 == 0 && s.ctx.Err() != nil {
+		return ErrTimeout
+	}
+	return nil
+}
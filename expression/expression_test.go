@@ -0,0 +1,172 @@
+package expression
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testVars = Vars{
+	"ip":       String,
+	"country":  String,
+	"asn_org":  String,
+	"username": String,
+	"score":    Number,
+	"charsets": Map,
+	"fields":   Map,
+}
+
+func TestCompile_Errors(t *testing.T) {
+	testCases := []struct {
+		name  string
+		expr  string
+		error string
+	}{
+		{"empty", "  ", "expression is empty"},
+		{"unknown variable", `contry == "RU"`, `unknown variable "contry", did you mean "country"?`},
+		{"unknown function", `lenght(username) > 3`, `unknown function "lenght"`},
+		{"wrong arity", `len(username, country) > 3`, "len() takes 1 argument(s), got 2"},
+		{"argument type", `lower(score) == "x"`, "lower()"},
+		{"comparison types", `username > 3`, "needs two numbers or two strings"},
+		{"chained comparison", `1 < score < 3`, "comparisons cannot be chained"},
+		{"not a bool", `len(username) + 1`, "expression must return a bool, got number"},
+		{"bad regex", `username.matches("([a-z")`, "invalid pattern"},
+		{"regex not literal", `username.matches(country)`, "must be a string literal"},
+		{"equality types", `country == 3`, "cannot compare string with number"},
+		{"bad cidr", `ip.inCIDR("10.0.0.0/33")`, "10.0.0.0/33"},
+		{"unterminated string", `country == "RU`, "unterminated string"},
+		{"trailing input", `country == "RU" country`, "unexpected"},
+		{"missing operand", `country == `, "unexpected end"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := Compile(tc.expr, testVars)
+			require.Error(t, err)
+			var compileErr *Error
+			assert.ErrorAs(t, err, &compileErr)
+			assert.Contains(t, err.Error(), tc.error)
+		})
+	}
+}
+
+func TestCompile_ErrorPosition(t *testing.T) {
+	_, err := Compile("country == \"RU\" &&\n  usrname == \"x\"", testVars)
+	require.Error(t, err)
+	compileErr := err.(*Error)
+	assert.Equal(t, 2, compileErr.Line)
+	assert.Equal(t, 3, compileErr.Column)
+}
+
+func TestCompile_Limits(t *testing.T) {
+	_, err := Compile(strings.Repeat("(", 100)+"true"+strings.Repeat(")", 100), testVars)
+	assert.ErrorContains(t, err, "nested too deeply")
+
+	_, err = Compile("1 in ["+strings.Repeat("1,", 1500)+"1]", testVars)
+	assert.ErrorContains(t, err, "too complex")
+
+	_, err = Compile(strings.Repeat(" ", MaxLength)+"true", testVars)
+	assert.ErrorContains(t, err, "too long")
+}
+
+func TestProgram_Eval(t *testing.T) {
+	env := MapEnv{
+		"ip":       "203.0.113.7",
+		"country":  "RU",
+		"asn_org":  "Example Hosting Ltd",
+		"username": "a_very_long_generated_username",
+		"score":    42,
+		"charsets": map[string]string{"username": "latin"},
+		"fields": map[string]interface{}{
+			"plan":    "free",
+			"age":     float64(3),
+			"tags":    []interface{}{"trial", "api"},
+			"profile": map[string]interface{}{"verified": false},
+		},
+	}
+
+	testCases := []struct {
+		expr   string
+		result bool
+	}{
+		{`country in ["RU","CN"] && asn_org.contains("Hosting") && len(username) > 20`, true},
+		{`country in ["US"] || asn_org.contains("Hosting")`, true},
+		{`!(country == "RU")`, false},
+		{`country != "ru"`, true},
+		{`lower(country) == "ru"`, true},
+		{`score * 2 - 4 >= 80 && score % 5 == 2`, true},
+		{`-score < 0`, true},
+		{`username.startsWith("a_") && username.endsWith("name")`, true},
+		{`username.matches("^[a-z_]+$")`, true},
+		{`ip.inCIDR("203.0.113.0/24")`, true},
+		{`ip.inCIDR("203.0.113.10-203.0.113.20")`, false},
+		{`charsets.username == "latin"`, true},
+		{`charsets["email"] == null`, true},
+		{`fields.plan == "free" && fields.age < 7`, true},
+		{`"api" in fields.tags && fields.tags[0] == "trial"`, true},
+		{`fields.tags.contains("admin")`, false},
+		{`fields.profile.verified == false`, true},
+		{`fields.missing == null && fields.missing.deeper == null`, true},
+		{`"plan" in fields`, true},
+		{`number("12.5") > 12 && string(score) == "42"`, true},
+		{`"Host" in asn_org && upper(trim(" x ")) + "Y" == "XY"`, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.expr, func(t *testing.T) {
+			program, err := Compile(tc.expr, testVars)
+			require.NoError(t, err)
+			result, err := program.Eval(context.Background(), env)
+			require.NoError(t, err)
+			assert.Equal(t, tc.result, result)
+		})
+	}
+}
+
+func TestProgram_EvalRuntimeErrors(t *testing.T) {
+	env := MapEnv{"score": 1, "fields": map[string]interface{}{"age": "old"}}
+
+	testCases := []string{
+		`fields.age > 3`,
+		`score / 0 > 1`,
+		`number(fields.age) > 3`,
+		`fields.age`,
+	}
+	for _, expr := range testCases {
+		t.Run(expr, func(t *testing.T) {
+			program, err := Compile(expr, testVars)
+			require.NoError(t, err)
+			_, err = program.Eval(context.Background(), env)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestProgram_Vars(t *testing.T) {
+	program, err := Compile(`country == "RU" && fields.x == 1 && country != "CN"`, testVars)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"country", "fields"}, program.Vars())
+}
+
+func TestProgram_EvalLimits(t *testing.T) {
+	program, err := Compile(`country == "RU"`, testVars)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Nanosecond)
+	defer cancel()
+	<-ctx.Done()
+	_, err = program.Eval(ctx, MapEnv{"country": "RU"})
+	assert.ErrorIs(t, err, ErrTimeout)
+
+	// 21 copies of an 8 KiB string exceed the string size limit
+	expr := `fields.s` + strings.Repeat(` + fields.s`, 20) + ` == ""`
+	program, err = Compile(expr, testVars)
+	require.NoError(t, err)
+	big := strings.Repeat("x", 8<<10)
+	_, err = program.Eval(context.Background(), MapEnv{"fields": map[string]interface{}{"s": big}})
+	assert.ErrorContains(t, err, "string too long")
+}
@@ -0,0 +1,581 @@
+package expression
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"firewall/utils"
+)
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdent
+	tokenNumber
+	tokenString
+	tokenOp
+)
+
+type token struct {
+	kind  tokenKind
+	text  string // identifier, operator or the unquoted string
+	num   float64
+	start int // byte offset in the source
+}
+
+// tokenize splits the source into tokens
+func tokenize(source string) ([]token, error) {
+	var tokens []token
+	i := 0
+	for i < len(source) {
+		c := source[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case isIdentByte(c, false):
+			start := i
+			for i < len(source) && isIdentByte(source[i], true) {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokenIdent, text: source[start:i], start: start})
+		case isDigit(c):
+			start := i
+			for i < len(source) && (isDigit(source[i]) || source[i] == '.') {
+				i++
+			}
+			num, err := strconv.ParseFloat(source[start:i], 64)
+			if err != nil {
+				return nil, newError(source, start, "invalid number %q", source[start:i])
+			}
+			tokens = append(tokens, token{kind: tokenNumber, text: source[start:i], num: num, start: start})
+		case c == '"' || c == '\'':
+			start := i
+			var sb strings.Builder
+			i++
+			for {
+				if i >= len(source) {
+					return nil, newError(source, start, "unterminated string")
+				}
+				if source[i] == c {
+					i++
+					break
+				}
+				if source[i] == '\\' && i+1 < len(source) {
+					i++
+					switch source[i] {
+					case 'n':
+						sb.WriteByte('\n')
+					case 't':
+						sb.WriteByte('\t')
+					case '\\', '"', '\'':
+						sb.WriteByte(source[i])
+					default:
+						// Keep unknown escapes, so regex patterns like "\d" need no double escaping
+						sb.WriteByte('\\')
+						sb.WriteByte(source[i])
+					}
+					i++
+					continue
+				}
+				sb.WriteByte(source[i])
+				i++
+			}
+			tokens = append(tokens, token{kind: tokenString, text: sb.String(), start: start})
+		default:
+			if i+1 < len(source) {
+				switch op := source[i : i+2]; op {
+				case "==", "!=", "<=", ">=", "&&", "||":
+					tokens = append(tokens, token{kind: tokenOp, text: op, start: i})
+					i += 2
+					continue
+				}
+			}
+			if !strings.ContainsRune("()[],.!<>+-*/%", rune(c)) {
+				return nil, newError(source, i, "unexpected character %q", c)
+			}
+			tokens = append(tokens, token{kind: tokenOp, text: string(c), start: i})
+			i++
+		}
+	}
+	return append(tokens, token{kind: tokenEOF, start: len(source)}), nil
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// isIdentByte reports whether c may appear in an identifier (ASCII letters, _ and, after the first byte, digits)
+func isIdentByte(c byte, digits bool) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (digits && isDigit(c))
+}
+
+// isComparison reports whether t is a comparison operator
+func isComparison(t token) bool {
+	switch {
+	case t.kind == tokenOp:
+		switch t.text {
+		case "==", "!=", "<", "<=", ">", ">=":
+			return true
+		}
+	case t.kind == tokenIdent:
+		return t.text == "in"
+	}
+	return false
+}
+
+// parser is a recursive descent parser that type checks while it builds the syntax tree
+type parser struct {
+	source string
+	tokens []token
+	pos    int
+	vars   Vars
+	used   map[string]bool
+	depth  int
+	nodes  int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+// accept consumes the next token if it is the operator or keyword op
+func (p *parser) accept(op string) bool {
+	if t := p.peek(); (t.kind == tokenOp || t.kind == tokenIdent) && t.text == op {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expect(op string) error {
+	if !p.accept(op) {
+		return p.errorf(p.peek(), "expected %q, found %s", op, describe(p.peek()))
+	}
+	return nil
+}
+
+func (p *parser) errorf(t token, format string, args ...interface{}) error {
+	return newError(p.source, t.start, format, args...)
+}
+
+func describe(t token) string {
+	switch t.kind {
+	case tokenEOF:
+		return "end of expression"
+	case tokenString:
+		return strconv.Quote(t.text)
+	}
+	return fmt.Sprintf("%q", t.text)
+}
+
+// enter tracks the nesting depth and the number of nodes
+func (p *parser) enter(t token) error {
+	p.depth++
+	p.nodes++
+	if p.depth > maxDepth {
+		return p.errorf(t, "expression nested too deeply (max %d levels)", maxDepth)
+	}
+	if p.nodes > maxNodes {
+		return p.errorf(t, "expression too complex (max %d nodes)", maxNodes)
+	}
+	return nil
+}
+
+func (p *parser) leave() {
+	p.depth--
+}
+
+func (p *parser) parse() (node, error) {
+	n, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokenEOF {
+		return nil, p.errorf(t, "unexpected %s", describe(t))
+	}
+	return n, nil
+}
+
+func (p *parser) parseOr() (node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().text == "||" && p.peek().kind == tokenOp {
+		op := p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		if left, err = p.logical(op, left, right); err != nil {
+			return nil, err
+		}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (node, error) {
+	left, err := p.parseComparison()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().text == "&&" && p.peek().kind == tokenOp {
+		op := p.next()
+		right, err := p.parseComparison()
+		if err != nil {
+			return nil, err
+		}
+		if left, err = p.logical(op, left, right); err != nil {
+			return nil, err
+		}
+	}
+	return left, nil
+}
+
+func (p *parser) logical(op token, left, right node) (node, error) {
+	for _, operand := range []node{left, right} {
+		if t := operand.typ(); t != Bool && t != Any {
+			return nil, p.errorf(op, "operator %s needs bool operands, got %s", op.text, t)
+		}
+	}
+	return &logicalNode{and: op.text == "&&", left: left, right: right}, nil
+}
+
+func (p *parser) parseComparison() (node, error) {
+	left, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+	t := p.peek()
+	if !isComparison(t) {
+		return left, nil
+	}
+	p.next()
+	right, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+
+	lt, rt := left.typ(), right.typ()
+	known := func(t Type) bool { return t != Any && t != Null }
+	switch t.text {
+	case "==", "!=":
+		if known(lt) && known(rt) && lt != rt {
+			return nil, p.errorf(t, "cannot compare %s with %s", lt, rt)
+		}
+	case "in":
+		switch rt {
+		case List, Map, Any:
+		case String:
+			if lt != String && lt != Any {
+				return nil, p.errorf(t, "cannot search %s in a string", lt)
+			}
+		default:
+			return nil, p.errorf(t, "operator in needs a list, map or string on the right, got %s", rt)
+		}
+	default:
+		ordered := func(t Type) bool { return t == Number || t == String || t == Any }
+		if !ordered(lt) || !ordered(rt) || (lt != Any && rt != Any && lt != rt) {
+			return nil, p.errorf(t, "operator %s needs two numbers or two strings, got %s and %s", t.text, lt, rt)
+		}
+	}
+	if isComparison(p.peek()) {
+		return nil, p.errorf(p.peek(), "comparisons cannot be chained, use && instead")
+	}
+	return &compareNode{op: t.text, left: left, right: right}, nil
+}
+
+func (p *parser) parseAdditive() (node, error) {
+	left, err := p.parseMultiplicative()
+	if err != nil {
+		return nil, err
+	}
+	for t := p.peek(); t.kind == tokenOp && (t.text == "+" || t.text == "-"); t = p.peek() {
+		p.next()
+		right, err := p.parseMultiplicative()
+		if err != nil {
+			return nil, err
+		}
+		if left, err = p.arithmetic(t, left, right); err != nil {
+			return nil, err
+		}
+	}
+	return left, nil
+}
+
+func (p *parser) parseMultiplicative() (node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for t := p.peek(); t.kind == tokenOp && (t.text == "*" || t.text == "/" || t.text == "%"); t = p.peek() {
+		p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		if left, err = p.arithmetic(t, left, right); err != nil {
+			return nil, err
+		}
+	}
+	return left, nil
+}
+
+func (p *parser) arithmetic(op token, left, right node) (node, error) {
+	lt, rt := left.typ(), right.typ()
+	result := Number
+	switch {
+	case op.text == "+" && (lt == String || rt == String):
+		if (lt != String && lt != Any) || (rt != String && rt != Any) {
+			return nil, p.errorf(op, "cannot add %s and %s", lt, rt)
+		}
+		result = String
+	case (lt != Number && lt != Any) || (rt != Number && rt != Any):
+		return nil, p.errorf(op, "operator %s needs numbers, got %s and %s", op.text, lt, rt)
+	case op.text == "+" && (lt == Any || rt == Any):
+		result = Any // number or string, decided at runtime
+	}
+	return &arithmeticNode{op: op.text, left: left, right: right, result: result}, nil
+}
+
+func (p *parser) parseUnary() (node, error) {
+	t := p.peek()
+	if t.kind == tokenOp && (t.text == "!" || t.text == "-") {
+		if err := p.enter(t); err != nil {
+			return nil, err
+		}
+		defer p.leave()
+		p.next()
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		want := Bool
+		if t.text == "-" {
+			want = Number
+		}
+		if ot := operand.typ(); ot != want && ot != Any {
+			return nil, p.errorf(t, "operator %s needs a %s, got %s", t.text, want, ot)
+		}
+		return &unaryNode{op: t.text, operand: operand}, nil
+	}
+	return p.parsePostfix()
+}
+
+func (p *parser) parsePostfix() (node, error) {
+	n, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		switch {
+		case t.kind == tokenOp && t.text == ".":
+			p.next()
+			name := p.next()
+			if name.kind != tokenIdent {
+				return nil, p.errorf(name, "expected a field or method name after '.', found %s", describe(name))
+			}
+			if p.peek().kind == tokenOp && p.peek().text == "(" {
+				// Method syntax: x.f(args) is f(x, args)
+				if n, err = p.parseCall(name, n); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			if nt := n.typ(); nt != Map && nt != Any {
+				return nil, p.errorf(name, "%s has no field %q", nt, name.text)
+			}
+			n = &indexNode{target: n, index: &literalNode{value: name.text, t: String}}
+		case t.kind == tokenOp && t.text == "[":
+			p.next()
+			index, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect("]"); err != nil {
+				return nil, err
+			}
+			switch nt, it := n.typ(), index.typ(); {
+			case nt == List && it != Number && it != Any:
+				return nil, p.errorf(t, "list index must be a number, got %s", it)
+			case nt == Map && it != String && it != Any:
+				return nil, p.errorf(t, "map key must be a string, got %s", it)
+			case nt != List && nt != Map && nt != Any:
+				return nil, p.errorf(t, "cannot index %s", nt)
+			}
+			n = &indexNode{target: n, index: index}
+		default:
+			return n, nil
+		}
+	}
+}
+
+func (p *parser) parsePrimary() (node, error) {
+	t := p.next()
+	if err := p.enter(t); err != nil {
+		return nil, err
+	}
+	defer p.leave()
+
+	switch t.kind {
+	case tokenNumber:
+		return &literalNode{value: t.num, t: Number}, nil
+	case tokenString:
+		return &literalNode{value: t.text, t: String}, nil
+	case tokenIdent:
+		switch t.text {
+		case "true", "false":
+			return &literalNode{value: t.text == "true", t: Bool}, nil
+		case "null":
+			return &literalNode{value: nil, t: Null}, nil
+		case "in":
+			return nil, p.errorf(t, "unexpected %s", describe(t))
+		}
+		if p.peek().kind == tokenOp && p.peek().text == "(" {
+			return p.parseCall(t, nil)
+		}
+		typ, ok := p.vars[t.text]
+		if !ok {
+			if suggestion := p.suggest(t.text); suggestion != "" {
+				return nil, p.errorf(t, "unknown variable %q, did you mean %q?", t.text, suggestion)
+			}
+			return nil, p.errorf(t, "unknown variable %q", t.text)
+		}
+		p.used[t.text] = true
+		return &variableNode{name: t.text, t: typ}, nil
+	case tokenOp:
+		switch t.text {
+		case "(":
+			n, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			return n, p.expect(")")
+		case "[":
+			list := &listNode{}
+			for !p.accept("]") {
+				if len(list.items) > 0 {
+					if err := p.expect(","); err != nil {
+						return nil, err
+					}
+				}
+				item, err := p.parseOr()
+				if err != nil {
+					return nil, err
+				}
+				list.items = append(list.items, item)
+			}
+			return list, nil
+		}
+	}
+	return nil, p.errorf(t, "unexpected %s", describe(t))
+}
+
+// parseCall parses the arguments of a function call; receiver is set for method syntax
+func (p *parser) parseCall(name token, receiver node) (node, error) {
+	fn, ok := builtins[name.text]
+	if !ok {
+		return nil, p.errorf(name, "unknown function %q", name.text)
+	}
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	var args []node
+	if receiver != nil {
+		args = append(args, receiver)
+	}
+	for first := true; !p.accept(")"); first = false {
+		if !first {
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+		arg, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+	}
+
+	if len(args) != len(fn.params) {
+		return nil, p.errorf(name, "%s() takes %d argument(s), got %d", name.text, len(fn.params), len(args))
+	}
+	for i, arg := range args {
+		if !fn.params[i].accepts(arg.typ()) {
+			return nil, p.errorf(name, "argument %d of %s() must be %s, got %s", i+1, name.text, fn.params[i], arg.typ())
+		}
+	}
+
+	call := &callNode{name: name.text, fn: fn, args: args}
+	// Patterns and CIDRs must be literals: they are compiled here, never per request
+	switch fn.literal {
+	case literalRegex:
+		pattern, ok := args[1].(*literalNode)
+		if !ok {
+			return nil, p.errorf(name, "the pattern of %s() must be a string literal", name.text)
+		}
+		if len(pattern.value.(string)) > maxRegexLen {
+			return nil, p.errorf(name, "pattern too long (max %d characters)", maxRegexLen)
+		}
+		regex, err := regexp.Compile(pattern.value.(string))
+		if err != nil {
+			return nil, p.errorf(name, "invalid pattern: %v", err)
+		}
+		call.regex = regex
+	case literalCIDR:
+		cidr, ok := args[1].(*literalNode)
+		if !ok {
+			return nil, p.errorf(name, "the range of %s() must be a string literal", name.text)
+		}
+		ipRange, err := utils.ParseIPRange(cidr.value.(string))
+		if err != nil {
+			return nil, p.errorf(name, "invalid CIDR or range: %v", err)
+		}
+		call.ipRange = ipRange
+	}
+	return call, nil
+}
+
+// suggest returns the declared variable closest to name, if it is at most two edits away
+func (p *parser) suggest(name string) string {
+	best, bestDistance := "", 3
+	for candidate := range p.vars {
+		if d := editDistance(name, candidate); d < bestDistance || (d == bestDistance && candidate < best) {
+			best, bestDistance = candidate, d
+		}
+	}
+	return best
+}
+
+// editDistance returns the Levenshtein distance of two strings
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr := make([]int, len(b)+1)
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev = curr
+	}
+	return prev[len(b)]
+}
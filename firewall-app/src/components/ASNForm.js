@@ -29,6 +29,8 @@ import TablePagination from '@mui/material/TablePagination';
 import Link from '@mui/material/Link';
 import { useLocation } from 'react-router-dom';
 import InfiniteScrollASNTable from './InfiniteScrollASNTable';
+import RuleValidityFields from './RuleValidityFields';
+import { toDateTimeLocal, fromDateTimeLocal } from '../utils/rule_validity';
 
 // Memoized Form Component
 const ASNFormComponent = React.memo(({ 
@@ -39,6 +41,9 @@ const ASNFormComponent = React.memo(({
     name,
     status, 
     source,
+    priority,
+    validFrom,
+    expiresAt,
     message, 
     error, 
     editId, 
@@ -49,6 +54,9 @@ const ASNFormComponent = React.memo(({
     onNameChange,
     onStatusChange, 
     onSourceChange,
+    onPriorityChange,
+    onValidFromChange,
+    onExpiresAtChange,
     onSubmit, 
     onCancelEdit 
 }) => (
@@ -105,6 +113,7 @@ const ASNFormComponent = React.memo(({
             <MenuItem value="denied">Denied</MenuItem>
             <MenuItem value="allowed">Allowed</MenuItem>
             <MenuItem value="whitelisted">Whitelisted</MenuItem>
+            <MenuItem value="monitor">Monitor (log only)</MenuItem>
         </TextField>
         <TextField
             label="Source"
@@ -114,6 +123,20 @@ const ASNFormComponent = React.memo(({
             fullWidth
             helperText="Source of the ASN data (e.g., manual, spamhaus)"
         />
+        <TextField
+            label="Priority"
+            type="number"
+            value={priority}
+            onChange={onPriorityChange}
+            helperText="Higher priority wins when rules conflict"
+            fullWidth
+        />
+        <RuleValidityFields
+            validFrom={validFrom}
+            expiresAt={expiresAt}
+            onValidFromChange={onValidFromChange}
+            onExpiresAtChange={onExpiresAtChange}
+        />
         <Button type="submit" variant="contained" color="primary">
             {editId ? 'Update ASN' : 'Add ASN'}
         </Button>
@@ -403,6 +426,9 @@ const ASNForm = () => {
     const [name, setName] = useState('');
     const [status, setStatus] = useState('denied');
     const [source, setSource] = useState('manual');
+    const [priority, setPriority] = useState(0);
+    const [validFrom, setValidFrom] = useState('');
+    const [expiresAt, setExpiresAt] = useState('');
     const [message, setMessage] = useState('');
     const [error, setError] = useState('');
     const [refresh, setRefresh] = useState(false);
@@ -533,7 +559,10 @@ const ASNForm = () => {
                     cc: country,
                     asname: name,
                     status,
-                    source
+                    source,
+                    priority: Number(priority) || 0,
+                    valid_from: fromDateTimeLocal(validFrom),
+                    expires_at: fromDateTimeLocal(expiresAt)
                 });
                 setMessage('ASN updated successfully!');
             } else {
@@ -544,7 +573,10 @@ const ASNForm = () => {
                     cc: country,
                     asname: name,
                     status,
-                    source
+                    source,
+                    priority: Number(priority) || 0,
+                    valid_from: fromDateTimeLocal(validFrom),
+                    expires_at: fromDateTimeLocal(expiresAt)
                 });
                 setMessage('ASN added successfully!');
             }
@@ -557,13 +589,16 @@ const ASNForm = () => {
             setName('');
             setStatus('denied');
             setSource('manual');
+            setPriority(0);
+            setValidFrom('');
+            setExpiresAt('');
             setEditId(null);
             setRefresh(prev => !prev);
         } catch (err) {
             const errorMessage = err.response?.data?.error || err.message || 'Error saving ASN';
             setError(errorMessage);
         }
-    }, [asn, rir, domain, country, name, status, source, editId]);
+    }, [asn, rir, domain, country, name, status, source, priority, validFrom, expiresAt, editId]);
 
     const handleEdit = useCallback((asnData) => {
         setASN(asnData.asn);
@@ -573,6 +608,9 @@ const ASNForm = () => {
         setName(asnData.asname);
         setStatus(asnData.status);
         setSource('manual'); // Always set to manual when editing
+        setPriority(asnData.priority || 0);
+        setValidFrom(toDateTimeLocal(asnData.valid_from));
+        setExpiresAt(toDateTimeLocal(asnData.expires_at));
         setEditId(asnData.id);
     }, []);
 
@@ -683,6 +721,9 @@ const ASNForm = () => {
         setName('');
         setStatus('denied');
         setSource('manual');
+        setPriority(0);
+        setValidFrom('');
+        setExpiresAt('');
         setEditId(null);
     }, []);
 
@@ -714,6 +755,18 @@ const ASNForm = () => {
         setSource(e.target.value);
     }, []);
 
+    const handlePriorityChange = useCallback((e) => {
+        setPriority(e.target.value);
+    }, []);
+
+    const handleValidFromChange = useCallback((e) => {
+        setValidFrom(e.target.value);
+    }, []);
+
+    const handleExpiresAtChange = useCallback((e) => {
+        setExpiresAt(e.target.value);
+    }, []);
+
     const handleSpamhausImport = useCallback(async () => {
         if (window.confirm('This will import ASN data from Spamhaus ASN-DROP list. Existing Spamhaus records will be replaced. Continue?')) {
             try {
@@ -898,6 +951,9 @@ const ASNForm = () => {
                     name={name}
                     status={status}
                     source={source}
+                    priority={priority}
+                    validFrom={validFrom}
+                    expiresAt={expiresAt}
                     message={message}
                     error={error}
                     editId={editId}
@@ -908,6 +964,9 @@ const ASNForm = () => {
                     onNameChange={handleNameChange}
                     onStatusChange={handleStatusChangeForm}
                     onSourceChange={handleSourceChange}
+                    onPriorityChange={handlePriorityChange}
+                    onValidFromChange={handleValidFromChange}
+                    onExpiresAtChange={handleExpiresAtChange}
                     onSubmit={handleSubmit}
                     onCancelEdit={handleCancelEdit}
                 />
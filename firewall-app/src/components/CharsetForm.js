@@ -13,6 +13,8 @@ import ExpandLessIcon from '@mui/icons-material/ExpandLess';
 import axios from '../axiosConfig';
 import { useLocation } from 'react-router-dom';
 import InfiniteScrollCharsetTable from './InfiniteScrollCharsetTable';
+import RuleValidityFields from './RuleValidityFields';
+import { toDateTimeLocal, fromDateTimeLocal } from '../utils/rule_validity';
 
 
 // Separate filter controls component that only re-renders when filter values change
@@ -77,7 +79,7 @@ const FilterControls = memo(({
 });
 
 // Separate form component that only re-renders when form data changes
-const CharsetFormComponent = memo(({ onSubmit, charset, setCharset, status, setStatus, editId, setEditId }) => {
+const CharsetFormComponent = memo(({ onSubmit, charset, setCharset, status, setStatus, priority, setPriority, validFrom, setValidFrom, expiresAt, setExpiresAt, editId, setEditId }) => {
     return (
         <Box component="form" onSubmit={onSubmit} sx={{ display: 'flex', flexDirection: 'column', gap: 2, alignItems: 'stretch', mb: 2 }}>
             <TextField
@@ -98,12 +100,27 @@ const CharsetFormComponent = memo(({ onSubmit, charset, setCharset, status, setS
                 <MenuItem value="denied">Denied</MenuItem>
                 <MenuItem value="allowed">Allowed</MenuItem>
                 <MenuItem value="whitelisted">Whitelisted</MenuItem>
+                <MenuItem value="monitor">Monitor (log only)</MenuItem>
             </TextField>
+            <TextField
+                label="Priority"
+                type="number"
+                value={priority}
+                onChange={(e) => setPriority(e.target.value)}
+                helperText="Higher priority wins when rules conflict"
+                fullWidth
+            />
+            <RuleValidityFields
+                validFrom={validFrom}
+                expiresAt={expiresAt}
+                onValidFromChange={(e) => setValidFrom(e.target.value)}
+                onExpiresAtChange={(e) => setExpiresAt(e.target.value)}
+            />
             <Button type="submit" variant="contained" color="primary">
                 {editId ? 'Update Charset' : 'Add Charset'}
             </Button>
             {editId && (
-                <Button variant="outlined" color="secondary" onClick={() => { setEditId(null); setCharset(''); setStatus('denied'); }}>
+                <Button variant="outlined" color="secondary" onClick={() => { setEditId(null); setCharset(''); setStatus('denied'); setPriority(0); setValidFrom(''); setExpiresAt(''); }}>
                     Cancel Edit
                 </Button>
             )}
@@ -113,6 +130,9 @@ const CharsetFormComponent = memo(({ onSubmit, charset, setCharset, status, setS
     // Only re-render when form data changes
     return prevProps.charset === nextProps.charset && 
            prevProps.status === nextProps.status && 
+           prevProps.priority === nextProps.priority &&
+           prevProps.validFrom === nextProps.validFrom &&
+           prevProps.expiresAt === nextProps.expiresAt &&
            prevProps.editId === nextProps.editId;
 });
 
@@ -440,6 +460,9 @@ const CustomFieldsManager = memo(({
 const CharsetForm = () => {
     const [charset, setCharset] = useState('');
     const [status, setStatus] = useState('denied');
+    const [priority, setPriority] = useState(0);
+    const [validFrom, setValidFrom] = useState('');
+    const [expiresAt, setExpiresAt] = useState('');
     const [message, setMessage] = useState('');
     const [error, setError] = useState('');
     const [refresh, setRefresh] = useState(false);
@@ -566,14 +589,17 @@ const CharsetForm = () => {
         setError('');
         try {
             if (editId) {
-                await axios.put(`/api/charset/${editId}`, { charset, status });
+                await axios.put(`/api/charset/${editId}`, { charset, status, priority: Number(priority) || 0, valid_from: fromDateTimeLocal(validFrom), expires_at: fromDateTimeLocal(expiresAt) });
                 setMessage('Charset updated successfully');
             } else {
-                await axios.post('/api/charset', { charset, status });
+                await axios.post('/api/charset', { charset, status, priority: Number(priority) || 0, valid_from: fromDateTimeLocal(validFrom), expires_at: fromDateTimeLocal(expiresAt) });
                 setMessage('Charset added successfully');
             }
             setCharset('');
             setStatus('denied');
+            setPriority(0);
+            setValidFrom('');
+            setExpiresAt('');
             setEditId(null);
             setRefresh(r => !r);
         } catch (err) {
@@ -649,6 +675,9 @@ const CharsetForm = () => {
     const handleEdit = useCallback((charsetItem) => {
         setCharset(charsetItem.charset);
         setStatus(charsetItem.status);
+        setPriority(charsetItem.priority || 0);
+        setValidFrom(toDateTimeLocal(charsetItem.valid_from));
+        setExpiresAt(toDateTimeLocal(charsetItem.expires_at));
         setEditId(charsetItem.id);
     }, []);
 
@@ -731,6 +760,12 @@ const CharsetForm = () => {
                     setCharset={setCharset}
                     status={status}
                     setStatus={setStatus}
+                    priority={priority}
+                    setPriority={setPriority}
+                    validFrom={validFrom}
+                    setValidFrom={setValidFrom}
+                    expiresAt={expiresAt}
+                    setExpiresAt={setExpiresAt}
                     editId={editId}
                     setEditId={setEditId}
                 />
@@ -24,6 +24,8 @@ import Select from '@mui/material/Select';
 import { useLocation } from 'react-router-dom';
 import CountryFlag from './CountryFlag';
 import InfiniteScrollCountryTable from './InfiniteScrollCountryTable';
+import RuleValidityFields from './RuleValidityFields';
+import { toDateTimeLocal, fromDateTimeLocal } from '../utils/rule_validity';
 
 
 // Memoized Form Component
@@ -31,12 +33,18 @@ const CountryFormComponent = React.memo(({
     country, 
     name,
     status, 
+    priority,
+    validFrom,
+    expiresAt,
     message, 
     error, 
     editId, 
     onCountryChange, 
     onNameChange,
     onStatusChange, 
+    onPriorityChange,
+    onValidFromChange,
+    onExpiresAtChange,
     onSubmit, 
     onCancelEdit 
 }) => (
@@ -67,7 +75,22 @@ const CountryFormComponent = React.memo(({
             <MenuItem value="denied">Denied</MenuItem>
             <MenuItem value="allowed">Allowed</MenuItem>
             <MenuItem value="whitelisted">Whitelisted</MenuItem>
+            <MenuItem value="monitor">Monitor (log only)</MenuItem>
         </TextField>
+        <TextField
+            label="Priority"
+            type="number"
+            value={priority}
+            onChange={onPriorityChange}
+            helperText="Higher priority wins when rules conflict"
+            fullWidth
+        />
+        <RuleValidityFields
+            validFrom={validFrom}
+            expiresAt={expiresAt}
+            onValidFromChange={onValidFromChange}
+            onExpiresAtChange={onExpiresAtChange}
+        />
         <Button type="submit" variant="contained" color="primary">
             {editId ? 'Update Country' : 'Add Country'}
         </Button>
@@ -258,6 +281,9 @@ const CountryForm = () => {
     const [country, setCountry] = useState('');
     const [name, setName] = useState('');
     const [status, setStatus] = useState('denied');
+    const [priority, setPriority] = useState(0);
+    const [validFrom, setValidFrom] = useState('');
+    const [expiresAt, setExpiresAt] = useState('');
     const [message, setMessage] = useState('');
     const [error, setError] = useState('');
     const [refresh, setRefresh] = useState(false);
@@ -372,26 +398,35 @@ const CountryForm = () => {
                 await axios.put(`/api/country/${editId}`, { 
                     Code: country, 
                     Name: name,
-                    Status: status 
+                    Status: status,
+                    priority: Number(priority) || 0,
+                    valid_from: fromDateTimeLocal(validFrom),
+                    expires_at: fromDateTimeLocal(expiresAt)
                 });
                 setMessage('Country updated successfully');
             } else {
                 await axios.post('/api/country', { 
                     Code: country, 
                     Name: name,
-                    Status: status 
+                    Status: status,
+                    priority: Number(priority) || 0,
+                    valid_from: fromDateTimeLocal(validFrom),
+                    expires_at: fromDateTimeLocal(expiresAt)
                 });
                 setMessage('Country added successfully');
             }
             setCountry('');
             setName('');
             setStatus('denied');
+            setPriority(0);
+            setValidFrom('');
+            setExpiresAt('');
             setEditId(null);
             setRefresh(r => !r);
         } catch (err) {
             setError('Error saving country');
         }
-    }, [country, name, status, editId]);
+    }, [country, name, status, priority, validFrom, expiresAt, editId]);
 
     const handleDelete = useCallback(async (id) => {
         if (!window.confirm('Delete this country?')) return;
@@ -408,6 +443,9 @@ const CountryForm = () => {
         setCountry(countryItem.code);
         setName(countryItem.name || '');
         setStatus(countryItem.status);
+        setPriority(countryItem.priority || 0);
+        setValidFrom(toDateTimeLocal(countryItem.valid_from));
+        setExpiresAt(toDateTimeLocal(countryItem.expires_at));
         setEditId(countryItem.id);
     }, []);
 
@@ -486,6 +524,9 @@ const CountryForm = () => {
         setCountry('');
         setName('');
         setStatus('denied');
+        setPriority(0);
+        setValidFrom('');
+        setExpiresAt('');
         setEditId(null);
     }, []);
 
@@ -501,20 +542,38 @@ const CountryForm = () => {
         setStatus(e.target.value);
     }, []);
 
+    const handlePriorityChange = useCallback((e) => {
+        setPriority(e.target.value);
+    }, []);
+
+    const handleValidFromChange = useCallback((e) => {
+        setValidFrom(e.target.value);
+    }, []);
+
+    const handleExpiresAtChange = useCallback((e) => {
+        setExpiresAt(e.target.value);
+    }, []);
+
     // Memoized values for components
     const formProps = React.useMemo(() => ({
         country,
         name,
         status,
+        priority,
+        validFrom,
+        expiresAt,
         message,
         error,
         editId,
         onCountryChange: handleCountryChange,
         onNameChange: handleNameChange,
         onStatusChange: handleStatusChangeForm,
+        onPriorityChange: handlePriorityChange,
+        onValidFromChange: handleValidFromChange,
+        onExpiresAtChange: handleExpiresAtChange,
         onSubmit: handleSubmit,
         onCancelEdit: handleCancelEdit
-    }), [country, name, status, message, error, editId, handleCountryChange, handleNameChange, handleStatusChangeForm, handleSubmit, handleCancelEdit]);
+    }), [country, name, status, priority, validFrom, expiresAt, message, error, editId, handleCountryChange, handleNameChange, handleStatusChangeForm, handlePriorityChange, handleValidFromChange, handleExpiresAtChange, handleSubmit, handleCancelEdit]);
 
     const filterProps = React.useMemo(() => ({
         searchValue,
@@ -28,6 +28,8 @@ import Tooltip from '@mui/material/Tooltip';
 import InfoIcon from '@mui/icons-material/Info';
 import { useLocation } from 'react-router-dom';
 import InfiniteScrollEmailTable from './InfiniteScrollEmailTable';
+import RuleValidityFields from './RuleValidityFields';
+import { toDateTimeLocal, fromDateTimeLocal } from '../utils/rule_validity';
 
 
 // Separate filter controls component that only re-renders when filter values change
@@ -92,7 +94,7 @@ const FilterControls = memo(({
 });
 
 // Separate form component that only re-renders when form data changes
-const EmailFormComponent = memo(({ onSubmit, email, setEmail, status, setStatus, isRegex, setIsRegex, editId, setEditId }) => {
+const EmailFormComponent = memo(({ onSubmit, email, setEmail, status, setStatus, isRegex, setIsRegex, priority, setPriority, validFrom, setValidFrom, expiresAt, setExpiresAt, editId, setEditId }) => {
     return (
         <Box component="form" onSubmit={onSubmit} sx={{ display: 'flex', flexDirection: 'column', gap: 2, alignItems: 'stretch', mb: 2 }}>
             <TextField
@@ -113,6 +115,7 @@ const EmailFormComponent = memo(({ onSubmit, email, setEmail, status, setStatus,
                 <MenuItem value="denied">Denied</MenuItem>
                 <MenuItem value="allowed">Allowed</MenuItem>
                 <MenuItem value="whitelisted">Whitelisted</MenuItem>
+                <MenuItem value="monitor">Monitor (log only)</MenuItem>
             </TextField>
             <Box sx={{ display: 'flex', alignItems: 'center', gap: 1 }}>
                 <FormControlLabel
@@ -151,11 +154,25 @@ const EmailFormComponent = memo(({ onSubmit, email, setEmail, status, setStatus,
                     <InfoIcon color="action" sx={{ fontSize: 20 }} />
                 </Tooltip>
             </Box>
+            <TextField
+                label="Priority"
+                type="number"
+                value={priority}
+                onChange={(e) => setPriority(e.target.value)}
+                helperText="Higher priority wins when rules conflict"
+                fullWidth
+            />
+            <RuleValidityFields
+                validFrom={validFrom}
+                expiresAt={expiresAt}
+                onValidFromChange={(e) => setValidFrom(e.target.value)}
+                onExpiresAtChange={(e) => setExpiresAt(e.target.value)}
+            />
             <Button type="submit" variant="contained" color="primary">
                 {editId ? 'Update Email' : 'Add Email'}
             </Button>
             {editId && (
-                <Button variant="outlined" color="secondary" onClick={() => { setEditId(null); setEmail(''); setStatus('denied'); setIsRegex(false); }}>
+                <Button variant="outlined" color="secondary" onClick={() => { setEditId(null); setEmail(''); setStatus('denied'); setIsRegex(false); setPriority(0); setValidFrom(''); setExpiresAt(''); }}>
                     Cancel Edit
                 </Button>
             )}
@@ -166,6 +183,9 @@ const EmailFormComponent = memo(({ onSubmit, email, setEmail, status, setStatus,
     return prevProps.email === nextProps.email && 
            prevProps.status === nextProps.status && 
            prevProps.isRegex === nextProps.isRegex &&
+           prevProps.priority === nextProps.priority &&
+           prevProps.validFrom === nextProps.validFrom &&
+           prevProps.expiresAt === nextProps.expiresAt &&
            prevProps.editId === nextProps.editId;
 });
 
@@ -280,6 +300,9 @@ const EmailForm = () => {
     const [email, setEmail] = useState('');
     const [status, setStatus] = useState('denied');
     const [isRegex, setIsRegex] = useState(false);
+    const [priority, setPriority] = useState(0);
+    const [validFrom, setValidFrom] = useState('');
+    const [expiresAt, setExpiresAt] = useState('');
     const [message, setMessage] = useState('');
     const [error, setError] = useState('');
     const [refresh, setRefresh] = useState(false);
@@ -381,15 +404,18 @@ const EmailForm = () => {
         setError('');
         try {
             if (editId) {
-                await axiosInstance.put(`/api/email/${editId}`, { address: email, status, IsRegex: isRegex });
+                await axiosInstance.put(`/api/email/${editId}`, { address: email, status, IsRegex: isRegex, priority: Number(priority) || 0, valid_from: fromDateTimeLocal(validFrom), expires_at: fromDateTimeLocal(expiresAt) });
                 setMessage('Email updated successfully');
             } else {
-                await axiosInstance.post('/api/email', { address: email, status, IsRegex: isRegex });
+                await axiosInstance.post('/api/email', { address: email, status, IsRegex: isRegex, priority: Number(priority) || 0, valid_from: fromDateTimeLocal(validFrom), expires_at: fromDateTimeLocal(expiresAt) });
                 setMessage('Email added successfully');
             }
             setEmail('');
             setStatus('denied');
             setIsRegex(false);
+            setPriority(0);
+            setValidFrom('');
+            setExpiresAt('');
             setEditId(null);
             setRefresh(r => !r);
         } catch (error) {
@@ -465,6 +491,9 @@ const EmailForm = () => {
     const handleEdit = useCallback((emailItem) => {
         setEmail(emailItem.address);
         setStatus(emailItem.status);
+        setPriority(emailItem.priority || 0);
+        setValidFrom(toDateTimeLocal(emailItem.valid_from));
+        setExpiresAt(toDateTimeLocal(emailItem.expires_at));
         setEditId(emailItem.id);
     }, []);
 
@@ -504,6 +533,12 @@ const EmailForm = () => {
                     setStatus={setStatus}
                     isRegex={isRegex}
                     setIsRegex={setIsRegex}
+                    priority={priority}
+                    setPriority={setPriority}
+                    validFrom={validFrom}
+                    setValidFrom={setValidFrom}
+                    expiresAt={expiresAt}
+                    setExpiresAt={setExpiresAt}
                     editId={editId}
                     setEditId={setEditId}
                 />
@@ -1,6 +1,8 @@
 import React, { useState, useEffect, useCallback } from 'react';
 import axiosInstance from '../axiosConfig';
 import ConflictTable from './ConflictTable';
+import RuleValidityFields from './RuleValidityFields';
+import { toDateTimeLocal, fromDateTimeLocal } from '../utils/rule_validity';
 // MUI imports
 import Box from '@mui/material/Box';
 import Paper from '@mui/material/Paper';
@@ -36,6 +38,9 @@ const IPFormComponent = React.memo(({
     status, 
     isCidr,
     source,
+    priority,
+    validFrom,
+    expiresAt,
     message, 
     error, 
     editId, 
@@ -43,6 +48,9 @@ const IPFormComponent = React.memo(({
     onStatusChange, 
     onCidrChange,
     onSourceChange,
+    onPriorityChange,
+    onValidFromChange,
+    onExpiresAtChange,
     onSubmit, 
     onCancelEdit 
 }) => (
@@ -66,6 +74,7 @@ const IPFormComponent = React.memo(({
             <MenuItem value="denied">Denied</MenuItem>
             <MenuItem value="allowed">Allowed</MenuItem>
             <MenuItem value="whitelisted">Whitelisted</MenuItem>
+            <MenuItem value="monitor">Monitor (log only)</MenuItem>
         </TextField>
         <FormControlLabel
             control={
@@ -91,6 +100,20 @@ const IPFormComponent = React.memo(({
             <MenuItem value="manual">Manual</MenuItem>
             <MenuItem value="stopforumspam_toxic_cidr">StopForumSpam Toxic CIDR</MenuItem>
         </TextField>
+        <TextField
+            label="Priority"
+            type="number"
+            value={priority}
+            onChange={onPriorityChange}
+            helperText="Higher priority wins when rules conflict"
+            fullWidth
+        />
+        <RuleValidityFields
+            validFrom={validFrom}
+            expiresAt={expiresAt}
+            onValidFromChange={onValidFromChange}
+            onExpiresAtChange={onExpiresAtChange}
+        />
         <Button type="submit" variant="contained" color="primary">
             {editId ? 'Update IP' : 'Add IP'}
         </Button>
@@ -301,6 +324,9 @@ const IPForm = () => {
     const [status, setStatus] = useState('denied');
     const [isCidr, setIsCidr] = useState(false);
     const [source, setSource] = useState('manual');
+    const [priority, setPriority] = useState(0);
+    const [validFrom, setValidFrom] = useState('');
+    const [expiresAt, setExpiresAt] = useState('');
     const [message, setMessage] = useState('');
     const [error, setError] = useState('');
     const [conflicts, setConflicts] = useState([]);
@@ -431,6 +457,9 @@ const IPForm = () => {
             address: ip,
             status: status,
             is_cidr: isCidr,
+            priority: Number(priority) || 0,
+            valid_from: fromDateTimeLocal(validFrom),
+            expires_at: fromDateTimeLocal(expiresAt),
             editId: editId
         };
         
@@ -440,7 +469,10 @@ const IPForm = () => {
                     address: ip,
                     status: status,
                     is_cidr: isCidr,
-                    source: 'manual'
+                    source: 'manual',
+                    priority: Number(priority) || 0,
+                    valid_from: fromDateTimeLocal(validFrom),
+                    expires_at: fromDateTimeLocal(expiresAt)
                 });
                 setMessage('IP address updated successfully');
             } else {
@@ -448,13 +480,19 @@ const IPForm = () => {
                     address: ip,
                     status: status,
                     is_cidr: isCidr,
-                    source: 'manual'
+                    source: 'manual',
+                    priority: Number(priority) || 0,
+                    valid_from: fromDateTimeLocal(validFrom),
+                    expires_at: fromDateTimeLocal(expiresAt)
                 });
                 setMessage('IP address added successfully');
             }
             setIp('');
             setStatus('denied');
             setIsCidr(false);
+            setPriority(0);
+            setValidFrom('');
+            setExpiresAt('');
             setEditId(null);
             setRefresh(r => !r);
         } catch (error) {
@@ -470,6 +508,9 @@ const IPForm = () => {
                     setIp('');
                     setStatus('denied');
                     setIsCidr(false);
+                    setPriority(0);
+                    setValidFrom('');
+                    setExpiresAt('');
                     setEditId(null);
                     setRefresh(r => !r);
                 }
@@ -477,7 +518,7 @@ const IPForm = () => {
                 setError(error.response?.data?.error || 'Error saving IP address');
             }
         }
-    }, [ip, status, isCidr, editId]);
+    }, [ip, status, isCidr, priority, validFrom, expiresAt, editId]);
 
     const handleDeleteAllConflicts = useCallback(async () => {
         if (!pendingOperation || conflicts.length === 0) return;
@@ -522,20 +563,26 @@ const IPForm = () => {
             await Promise.all(deletePromises);
             
             // Retry the original operation
-            const { address, status: opStatus, is_cidr, editId: opEditId } = pendingOperation;
+            const { address, status: opStatus, is_cidr, priority: opPriority, valid_from, expires_at, editId: opEditId } = pendingOperation;
             
             if (opEditId) {
                 await axiosInstance.put(`/api/ip/${opEditId}`, {
                     address,
                     status: opStatus,
-                    is_cidr
+                    is_cidr,
+                    priority: opPriority,
+                    valid_from,
+                    expires_at
                 });
                 setMessage(`IP address updated successfully after removing ${conflictingIds.length} error conflicts`);
             } else {
                 await axiosInstance.post('/api/ip', {
                     address,
                     status: opStatus,
-                    is_cidr
+                    is_cidr,
+                    priority: opPriority,
+                    valid_from,
+                    expires_at
                 });
                 setMessage(`IP address added successfully after removing ${conflictingIds.length} error conflicts`);
             }
@@ -544,6 +591,9 @@ const IPForm = () => {
             setIp('');
             setStatus('denied');
             setIsCidr(false);
+            setPriority(0);
+            setValidFrom('');
+            setExpiresAt('');
             setEditId(null);
             setConflicts([]);
             setPendingOperation(null);
@@ -572,6 +622,9 @@ const IPForm = () => {
         setStatus(ipItem.status);
         setIsCidr(ipItem.is_cidr || false);
         setSource('manual'); // Always set to manual when editing
+        setPriority(ipItem.priority || 0);
+        setValidFrom(toDateTimeLocal(ipItem.valid_from));
+        setExpiresAt(toDateTimeLocal(ipItem.expires_at));
         setEditId(ipItem.id);
     }, []);
 
@@ -663,6 +716,9 @@ const IPForm = () => {
         setStatus('denied');
         setIsCidr(false);
         setSource('manual');
+        setPriority(0);
+        setValidFrom('');
+        setExpiresAt('');
         setEditId(null);
     }, []);
 
@@ -720,12 +776,27 @@ const IPForm = () => {
         setSource(e.target.value);
     }, []);
 
+    const handlePriorityChange = useCallback((e) => {
+        setPriority(e.target.value);
+    }, []);
+
+    const handleValidFromChange = useCallback((e) => {
+        setValidFrom(e.target.value);
+    }, []);
+
+    const handleExpiresAtChange = useCallback((e) => {
+        setExpiresAt(e.target.value);
+    }, []);
+
     // Memoized values for components
     const formProps = React.useMemo(() => ({
         ip,
         status,
         isCidr,
         source,
+        priority,
+        validFrom,
+        expiresAt,
         message,
         error,
         editId,
@@ -733,9 +804,12 @@ const IPForm = () => {
         onStatusChange: handleStatusChangeForm,
         onCidrChange: handleCidrChange,
         onSourceChange: handleSourceChange,
+        onPriorityChange: handlePriorityChange,
+        onValidFromChange: handleValidFromChange,
+        onExpiresAtChange: handleExpiresAtChange,
         onSubmit: handleSubmit,
         onCancelEdit: handleCancelEdit
-    }), [ip, status, isCidr, source, message, error, editId, handleIpChange, handleStatusChangeForm, handleCidrChange, handleSourceChange, handleSubmit, handleCancelEdit]);
+    }), [ip, status, isCidr, source, priority, validFrom, expiresAt, message, error, editId, handleIpChange, handleStatusChangeForm, handleCidrChange, handleSourceChange, handlePriorityChange, handleValidFromChange, handleExpiresAtChange, handleSubmit, handleCancelEdit]);
 
     const filterProps = React.useMemo(() => ({
         searchValue,
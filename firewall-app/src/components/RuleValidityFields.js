@@ -0,0 +1,29 @@
+import React from 'react';
+import Box from '@mui/material/Box';
+import TextField from '@mui/material/TextField';
+
+// Validity window of a rule; both fields are optional, an empty expiry means the rule never expires
+const RuleValidityFields = ({ validFrom, expiresAt, onValidFromChange, onExpiresAtChange }) => (
+    <Box sx={{ display: 'flex', gap: 2 }}>
+        <TextField
+            label="Valid From"
+            type="datetime-local"
+            value={validFrom}
+            onChange={onValidFromChange}
+            InputLabelProps={{ shrink: true }}
+            helperText="Optional: rule applies from this time"
+            fullWidth
+        />
+        <TextField
+            label="Expires At"
+            type="datetime-local"
+            value={expiresAt}
+            onChange={onExpiresAtChange}
+            InputLabelProps={{ shrink: true }}
+            helperText="Optional: empty means the rule never expires"
+            fullWidth
+        />
+    </Box>
+);
+
+export default React.memo(RuleValidityFields);
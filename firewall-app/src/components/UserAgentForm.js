@@ -27,6 +27,8 @@ import Tooltip from '@mui/material/Tooltip';
 import InfoIcon from '@mui/icons-material/Info';
 import { useLocation } from 'react-router-dom';
 import InfiniteScrollUserAgentTable from './InfiniteScrollUserAgentTable';
+import RuleValidityFields from './RuleValidityFields';
+import { toDateTimeLocal, fromDateTimeLocal } from '../utils/rule_validity';
 
 
 // Separate memoized search field component that never re-renders
@@ -93,7 +95,7 @@ const FilterControls = memo(({
 
 // Separate form component that never re-renders
 // Separate form component that only re-renders when form data changes
-const UserAgentFormComponent = memo(({ onSubmit, userAgent, setUserAgent, status, setStatus, isRegex, setIsRegex, editId, setEditId }) => {
+const UserAgentFormComponent = memo(({ onSubmit, userAgent, setUserAgent, status, setStatus, isRegex, setIsRegex, priority, setPriority, validFrom, setValidFrom, expiresAt, setExpiresAt, editId, setEditId }) => {
     return (
         <Box component="form" onSubmit={onSubmit} sx={{ display: 'flex', flexDirection: 'column', gap: 2, alignItems: 'stretch', mb: 2 }}>
             <TextField
@@ -114,6 +116,7 @@ const UserAgentFormComponent = memo(({ onSubmit, userAgent, setUserAgent, status
                 <MenuItem value="denied">Denied</MenuItem>
                 <MenuItem value="allowed">Allowed</MenuItem>
                 <MenuItem value="whitelisted">Whitelisted</MenuItem>
+                <MenuItem value="monitor">Monitor (log only)</MenuItem>
             </TextField>
             <Box sx={{ display: 'flex', alignItems: 'center', gap: 1 }}>
                 <FormControlLabel
@@ -155,11 +158,25 @@ const UserAgentFormComponent = memo(({ onSubmit, userAgent, setUserAgent, status
                     <InfoIcon color="action" sx={{ fontSize: 20 }} />
                 </Tooltip>
             </Box>
+            <TextField
+                label="Priority"
+                type="number"
+                value={priority}
+                onChange={(e) => setPriority(e.target.value)}
+                helperText="Higher priority wins when rules conflict"
+                fullWidth
+            />
+            <RuleValidityFields
+                validFrom={validFrom}
+                expiresAt={expiresAt}
+                onValidFromChange={(e) => setValidFrom(e.target.value)}
+                onExpiresAtChange={(e) => setExpiresAt(e.target.value)}
+            />
             <Button type="submit" variant="contained" color="primary">
                 {editId ? 'Update User Agent' : 'Add User Agent'}
             </Button>
             {editId && (
-                <Button variant="outlined" color="secondary" onClick={() => { setEditId(null); setUserAgent(''); setStatus('denied'); setIsRegex(false); }}>
+                <Button variant="outlined" color="secondary" onClick={() => { setEditId(null); setUserAgent(''); setStatus('denied'); setIsRegex(false); setPriority(0); setValidFrom(''); setExpiresAt(''); }}>
                     Cancel Edit
                 </Button>
             )}
@@ -170,6 +187,9 @@ const UserAgentFormComponent = memo(({ onSubmit, userAgent, setUserAgent, status
     return prevProps.userAgent === nextProps.userAgent && 
            prevProps.status === nextProps.status && 
            prevProps.isRegex === nextProps.isRegex &&
+           prevProps.priority === nextProps.priority &&
+           prevProps.validFrom === nextProps.validFrom &&
+           prevProps.expiresAt === nextProps.expiresAt &&
            prevProps.editId === nextProps.editId;
 });
 
@@ -280,6 +300,9 @@ const UserAgentForm = () => {
     const [userAgent, setUserAgent] = useState('');
     const [status, setStatus] = useState('denied');
     const [isRegex, setIsRegex] = useState(false);
+    const [priority, setPriority] = useState(0);
+    const [validFrom, setValidFrom] = useState('');
+    const [expiresAt, setExpiresAt] = useState('');
     const [message, setMessage] = useState('');
     const [error, setError] = useState('');
     const [refresh, setRefresh] = useState(false);
@@ -383,15 +406,18 @@ const UserAgentForm = () => {
         setError('');
         try {
             if (editId) {
-                await axios.put(`/api/user-agent/${editId}`, { UserAgent: userAgent, Status: status, IsRegex: isRegex });
+                await axios.put(`/api/user-agent/${editId}`, { UserAgent: userAgent, Status: status, IsRegex: isRegex, priority: Number(priority) || 0, valid_from: fromDateTimeLocal(validFrom), expires_at: fromDateTimeLocal(expiresAt) });
                 setMessage('User Agent updated successfully');
             } else {
-                await axios.post('/api/user-agent', { UserAgent: userAgent, Status: status, IsRegex: isRegex });
+                await axios.post('/api/user-agent', { UserAgent: userAgent, Status: status, IsRegex: isRegex, priority: Number(priority) || 0, valid_from: fromDateTimeLocal(validFrom), expires_at: fromDateTimeLocal(expiresAt) });
                 setMessage('User Agent added successfully');
             }
             setUserAgent('');
             setStatus('denied');
             setIsRegex(false); // Reset regex checkbox
+            setPriority(0);
+            setValidFrom('');
+            setExpiresAt('');
             setEditId(null);
             setRefresh(r => !r);
         } catch (error) {
@@ -469,6 +495,9 @@ const UserAgentForm = () => {
     const handleEdit = useCallback((userAgentItem) => {
         setUserAgent(userAgentItem.user_agent);
         setStatus(userAgentItem.status);
+        setPriority(userAgentItem.priority || 0);
+        setValidFrom(toDateTimeLocal(userAgentItem.valid_from));
+        setExpiresAt(toDateTimeLocal(userAgentItem.expires_at));
         setEditId(userAgentItem.id);
     }, []);
 
@@ -508,6 +537,12 @@ const UserAgentForm = () => {
                     setStatus={setStatus}
                     isRegex={isRegex}
                     setIsRegex={setIsRegex}
+                    priority={priority}
+                    setPriority={setPriority}
+                    validFrom={validFrom}
+                    setValidFrom={setValidFrom}
+                    expiresAt={expiresAt}
+                    setExpiresAt={setExpiresAt}
                     editId={editId}
                     setEditId={setEditId}
                 />
@@ -27,10 +27,12 @@ import Tooltip from '@mui/material/Tooltip';
 import InfoIcon from '@mui/icons-material/Info';
 import { useLocation } from 'react-router-dom';
 import InfiniteScrollUsernameTable from './InfiniteScrollUsernameTable';
+import RuleValidityFields from './RuleValidityFields';
+import { toDateTimeLocal, fromDateTimeLocal } from '../utils/rule_validity';
 
 
 // Memoized Form Component
-const UsernameFormComponent = memo(({ onSubmit, username, setUsername, status, setStatus, isRegex, setIsRegex, editId, setEditId }) => {
+const UsernameFormComponent = memo(({ onSubmit, username, setUsername, status, setStatus, isRegex, setIsRegex, priority, setPriority, validFrom, setValidFrom, expiresAt, setExpiresAt, editId, setEditId }) => {
     return (
         <Box component="form" onSubmit={onSubmit} sx={{ display: 'flex', flexDirection: 'column', gap: 2, alignItems: 'stretch', mb: 2 }}>
             <TextField
@@ -51,6 +53,7 @@ const UsernameFormComponent = memo(({ onSubmit, username, setUsername, status, s
                 <MenuItem value="denied">Denied</MenuItem>
                 <MenuItem value="allowed">Allowed</MenuItem>
                 <MenuItem value="whitelisted">Whitelisted</MenuItem>
+                <MenuItem value="monitor">Monitor (log only)</MenuItem>
             </TextField>
             <Box sx={{ display: 'flex', alignItems: 'center', gap: 1 }}>
                 <FormControlLabel
@@ -92,11 +95,25 @@ const UsernameFormComponent = memo(({ onSubmit, username, setUsername, status, s
                     <InfoIcon color="action" sx={{ fontSize: 20 }} />
                 </Tooltip>
             </Box>
+            <TextField
+                label="Priority"
+                type="number"
+                value={priority}
+                onChange={(e) => setPriority(e.target.value)}
+                helperText="Higher priority wins when rules conflict"
+                fullWidth
+            />
+            <RuleValidityFields
+                validFrom={validFrom}
+                expiresAt={expiresAt}
+                onValidFromChange={(e) => setValidFrom(e.target.value)}
+                onExpiresAtChange={(e) => setExpiresAt(e.target.value)}
+            />
             <Button type="submit" variant="contained" color="primary">
                 {editId ? 'Update Username' : 'Add Username'}
             </Button>
             {editId && (
-                <Button variant="outlined" color="secondary" onClick={() => { setEditId(null); setUsername(''); setStatus('denied'); setIsRegex(false); }}>
+                <Button variant="outlined" color="secondary" onClick={() => { setEditId(null); setUsername(''); setStatus('denied'); setIsRegex(false); setPriority(0); setValidFrom(''); setExpiresAt(''); }}>
                     Cancel Edit
                 </Button>
             )}
@@ -107,6 +124,9 @@ const UsernameFormComponent = memo(({ onSubmit, username, setUsername, status, s
     return prevProps.username === nextProps.username && 
            prevProps.status === nextProps.status && 
            prevProps.isRegex === nextProps.isRegex &&
+           prevProps.priority === nextProps.priority &&
+           prevProps.validFrom === nextProps.validFrom &&
+           prevProps.expiresAt === nextProps.expiresAt &&
            prevProps.editId === nextProps.editId;
 });
 
@@ -278,6 +298,9 @@ const UsernameForm = () => {
     const [username, setUsername] = useState('');
     const [status, setStatus] = useState('denied');
     const [isRegex, setIsRegex] = useState(false);
+    const [priority, setPriority] = useState(0);
+    const [validFrom, setValidFrom] = useState('');
+    const [expiresAt, setExpiresAt] = useState('');
     const [message, setMessage] = useState('');
     const [error, setError] = useState('');
     const [refresh, setRefresh] = useState(false);
@@ -389,21 +412,24 @@ const UsernameForm = () => {
         setError('');
         try {
             if (editId) {
-                await axios.put(`/api/username/${editId}`, { username, status, IsRegex: isRegex });
+                await axios.put(`/api/username/${editId}`, { username, status, IsRegex: isRegex, priority: Number(priority) || 0, valid_from: fromDateTimeLocal(validFrom), expires_at: fromDateTimeLocal(expiresAt) });
                 setMessage('Username updated successfully');
             } else {
-                await axios.post('/api/username', { username, status, IsRegex: isRegex });
+                await axios.post('/api/username', { username, status, IsRegex: isRegex, priority: Number(priority) || 0, valid_from: fromDateTimeLocal(validFrom), expires_at: fromDateTimeLocal(expiresAt) });
                 setMessage('Username added successfully');
             }
             setUsername('');
             setStatus('denied');
             setIsRegex(false);
+            setPriority(0);
+            setValidFrom('');
+            setExpiresAt('');
             setEditId(null);
             setRefresh(r => !r);
         } catch (err) {
             setError('Error saving username');
         }
-    }, [username, status, editId, isRegex]);
+    }, [username, status, editId, isRegex, priority, validFrom, expiresAt]);
 
     const handleDelete = useCallback(async (id) => {
         if (!window.confirm('Delete this username?')) return;
@@ -419,6 +445,9 @@ const UsernameForm = () => {
     const handleEdit = useCallback((usernameItem) => {
         setUsername(usernameItem.username);
         setStatus(usernameItem.status);
+        setPriority(usernameItem.priority || 0);
+        setValidFrom(toDateTimeLocal(usernameItem.valid_from));
+        setExpiresAt(toDateTimeLocal(usernameItem.expires_at));
         setEditId(usernameItem.id);
     }, []);
 
@@ -497,6 +526,9 @@ const UsernameForm = () => {
         setUsername('');
         setStatus('denied');
         setIsRegex(false);
+        setPriority(0);
+        setValidFrom('');
+        setExpiresAt('');
         setEditId(null);
     }, []);
 
@@ -572,6 +604,12 @@ const UsernameForm = () => {
                     setStatus={setStatus}
                     isRegex={isRegex}
                     setIsRegex={setIsRegex}
+                    priority={priority}
+                    setPriority={setPriority}
+                    validFrom={validFrom}
+                    setValidFrom={setValidFrom}
+                    expiresAt={expiresAt}
+                    setExpiresAt={setExpiresAt}
                     editId={editId}
                     setEditId={setEditId}
                 />
@@ -0,0 +1,19 @@
+// Conversions between the RFC 3339 times of the API (valid_from, expires_at)
+// and the local time value of a datetime-local input
+
+const pad = (n) => String(n).padStart(2, '0');
+
+// API time -> "YYYY-MM-DDTHH:mm" in local time, '' when unset
+export const toDateTimeLocal = (value) => {
+    if (!value) {
+        return '';
+    }
+    const date = new Date(value);
+    if (isNaN(date.getTime())) {
+        return '';
+    }
+    return `${date.getFullYear()}-${pad(date.getMonth() + 1)}-${pad(date.getDate())}T${pad(date.getHours())}:${pad(date.getMinutes())}`;
+};
+
+// datetime-local value -> API time, null clears the field
+export const fromDateTimeLocal = (value) => (value ? new Date(value).toISOString() : null);
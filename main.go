@@ -36,12 +36,20 @@ func main() {
 		log.Printf("Warning: Country seeding failed: %v", err)
 	}
 
+	// Seed the built-in country groups that are missing
+	if err := services.SeedCountryGroups(config.DB); err != nil {
+		log.Printf("Warning: Country group seeding failed: %v", err)
+	}
+
 	// Seed charsets if table is empty
 	if err := services.SeedCharsets(config.DB); err != nil {
 		log.Printf("Warning: Charset seeding failed: %v", err)
 	}
 
-	config.InitElasticsearch()
+	// Initialize the rule index (Elasticsearch or in-process, see search.backend)
+	if err := services.InitRuleIndex(); err != nil {
+		log.Fatalf("Rule index initialization failed: %v", err)
+	}
 
 	// Initialize all services
 	log.Println("Initializing services...")
@@ -63,9 +71,23 @@ func main() {
 		log.Println("ASN service initialized successfully")
 	}
 
+	// Initialize the optional City database
+	if err := services.InitCity(); err != nil {
+		log.Printf("Warning: City database initialization failed: %v", err)
+		log.Println("Subdivision, city and radius geo rules will be disabled")
+	} else {
+		log.Println("City database initialized successfully")
+	}
+
 	// Initialize cache factory (switches between in-memory and distributed based on config)
 	_ = services.GetCacheFactory()
 
+	// Compile filter rules into the in-memory rule engine
+	ruleEngine := services.GetRuleEngine()
+	if err := ruleEngine.Load(config.DB); err != nil {
+		log.Fatalf("Rule engine initialization failed: %v", err)
+	}
+
 	// Initialize event processor
 	eventProcessor := services.GetEventProcessor()
 
@@ -78,6 +100,12 @@ func main() {
 	// Initialize scheduled sync
 	scheduledSync := services.GetScheduledSync()
 
+	// Initialize the janitor that removes expired rules
+	ruleJanitor := services.GetRuleJanitor()
+
+	// Initialize automatic bans of repeat offenders
+	escalationService := services.GetEscalationService()
+
 	// Initialize traffic logging and analytics services
 	trafficLogging := services.NewTrafficLoggingService(config.DB)
 	analyticsService := services.NewAnalyticsService(config.DB, trafficLogging)
@@ -143,11 +171,20 @@ func main() {
 	// Stop scheduled sync
 	scheduledSync.Stop()
 
+	// Stop escalation service
+	escalationService.Stop()
+
+	// Stop rule janitor
+	ruleJanitor.Stop()
+
 	// Stop retry queue
 	retryQueue.Stop()
 
 	// Stop event processor
 	eventProcessor.Stop()
 
+	// Stop rule engine
+	ruleEngine.Stop()
+
 	log.Println("Server stopped gracefully")
 }
@@ -13,15 +13,26 @@ func Migrate(db *gorm.DB) error {
 	err := db.AutoMigrate(
 		&models.IP{},
 		&models.Email{},
+		&models.EmailDomainRule{},
 		&models.UserAgent{},
 		&models.Country{},
 		&models.CharsetRule{},
 		&models.UsernameRule{},
 		&models.ASN{},
+		&models.ContentRule{},
+		&models.VelocityRule{},
+		&models.CompositeRule{},
+		&models.ExpressionRule{},
+		&models.GeoRule{},
+		&models.CountryGroup{},
+		&models.DefaultPolicy{},
 		&models.SyncTracker{},
 		&models.TrafficLog{},
 		&models.DataRelationship{},
 		&models.AnalyticsAggregation{},
+		&models.MonitorRuleStat{},
+		&models.ArchivedRule{},
+		&models.EscalationOffense{},
 	)
 	if err != nil {
 		return err
@@ -40,6 +51,7 @@ func Migrate(db *gorm.DB) error {
 	db.Exec("CREATE INDEX IF NOT EXISTS idx_ip_address ON i_ps (address)")
 	db.Exec("CREATE INDEX IF NOT EXISTS idx_email_status ON emails (status)")
 	db.Exec("CREATE INDEX IF NOT EXISTS idx_email_address ON emails (address)")
+	db.Exec("CREATE INDEX IF NOT EXISTS idx_email_domain_status ON email_domain_rules (status)")
 	db.Exec("CREATE INDEX IF NOT EXISTS idx_useragent_status ON user_agents (status)")
 	db.Exec("CREATE INDEX IF NOT EXISTS idx_useragent_useragent ON user_agents (user_agent(100))")
 	db.Exec("CREATE INDEX IF NOT EXISTS idx_country_status ON countries (status)")
@@ -50,6 +62,12 @@ func Migrate(db *gorm.DB) error {
 	db.Exec("CREATE INDEX IF NOT EXISTS idx_username_username ON username_rules (username)")
 	db.Exec("CREATE INDEX IF NOT EXISTS idx_asn_status ON asns (status)")
 	db.Exec("CREATE INDEX IF NOT EXISTS idx_asn_asn ON asns (asn)")
+	db.Exec("CREATE INDEX IF NOT EXISTS idx_content_rule_status ON content_rules (status)")
+	db.Exec("CREATE INDEX IF NOT EXISTS idx_velocity_rule_status ON velocity_rules (status)")
+	db.Exec("CREATE INDEX IF NOT EXISTS idx_composite_rule_status ON composite_rules (status)")
+	db.Exec("CREATE INDEX IF NOT EXISTS idx_expression_rule_status ON expression_rules (status)")
+	db.Exec("CREATE INDEX IF NOT EXISTS idx_geo_rule_status ON geo_rules (status)")
+	db.Exec("CREATE INDEX IF NOT EXISTS idx_country_group_status ON country_groups (status)")
 
 	// Composite indexes for common filter combinations (status + search field)
 	// Using limited key lengths to prevent MySQL key length errors
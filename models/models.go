@@ -2,62 +2,211 @@ package models
 
 import "time"
 
+// RuleValidity limits a rule to a time window; rules without bounds are always active.
+// TTL is only accepted on create and sets ExpiresAt relative to ValidFrom (or now)
+type RuleValidity struct {
+	ValidFrom *time.Time `gorm:"index" json:"valid_from,omitempty"` // Rule is ignored before this time
+	ExpiresAt *time.Time `gorm:"index" json:"expires_at,omitempty"` // Rule is ignored and removed by the janitor after this time
+	TTL       string     `gorm:"-" json:"ttl,omitempty"`            // Duration such as "24h", not stored
+}
+
+// ActiveAt reports whether the rule applies at t
+func (v RuleValidity) ActiveAt(t time.Time) bool {
+	if v.ValidFrom != nil && t.Before(*v.ValidFrom) {
+		return false
+	}
+	return v.ExpiresAt == nil || t.Before(*v.ExpiresAt)
+}
+
+// NextChange returns the first bound after t, or the zero time if the rule never changes state again
+func (v RuleValidity) NextChange(t time.Time) time.Time {
+	var next time.Time
+	for _, bound := range []*time.Time{v.ValidFrom, v.ExpiresAt} {
+		if bound != nil && bound.After(t) && (next.IsZero() || bound.Before(next)) {
+			next = *bound
+		}
+	}
+	return next
+}
+
 // IP represents the structure for the IP addresses table
 type IP struct {
 	ID        uint      `gorm:"primaryKey" json:"id"`
-	Address   string    `gorm:"unique;not null;type:varchar(45)" json:"address" binding:"required"`                          // IPv6 max length or CIDR notation
-	Status    string    `gorm:"not null;type:varchar(20)" json:"status" binding:"required,oneof=allowed denied whitelisted"` // "denied", "allowed", "whitelisted"
-	IsCIDR    bool      `gorm:"column:is_c_id_r;default:false;type:boolean" json:"is_cidr"`                                  // Correct column for CIDR flag
-	Source    string    `gorm:"type:varchar(50)" json:"source"`                                                              // Source of the IP data (e.g., "stopforumspam_toxic_cidr", "manual")
+	Address   string    `gorm:"unique;not null;type:varchar(100)" json:"address" binding:"required"`                                 // IP, CIDR notation or start-end range
+	Status    string    `gorm:"not null;type:varchar(20)" json:"status" binding:"required,oneof=allowed denied whitelisted monitor"` // "denied", "allowed", "whitelisted", "monitor" (logged only)
+	Priority  int       `gorm:"default:0;index" json:"priority"`                                                                     // Higher priority wins when rules conflict
+	IsCIDR    bool      `gorm:"column:is_c_id_r;default:false;type:boolean" json:"is_cidr"`                                          // Correct column for CIDR flag
+	IsRange   bool      `gorm:"default:false;type:boolean" json:"is_range"`                                                          // Whether the address is a start-end range
+	CIDRs     []string  `gorm:"-" json:"cidrs,omitempty"`                                                                            // Minimal CIDR decomposition of a range (responses only)
+	Source    string    `gorm:"type:varchar(50)" json:"source"`                                                                      // Source of the IP data (e.g., "stopforumspam_toxic_cidr", "manual")
 	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
 	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+	RuleValidity
 }
 
 // Email represents the structure for the Emails table
 type Email struct {
 	ID        uint      `gorm:"primaryKey" json:"id"`
-	Address   string    `gorm:"unique;not null;type:varchar(254)" json:"address" binding:"required,email"`                   // RFC 5321 max length
-	Status    string    `gorm:"not null;type:varchar(20)" json:"status" binding:"required,oneof=allowed denied whitelisted"` // "denied", "allowed", "whitelisted"
-	IsRegex   bool      `gorm:"default:false;type:boolean" json:"is_regex"`                                                  // Whether this is a regex pattern
+	Address   string    `gorm:"unique;not null;type:varchar(254)" json:"address" binding:"required,email"`                           // RFC 5321 max length
+	Status    string    `gorm:"not null;type:varchar(20)" json:"status" binding:"required,oneof=allowed denied whitelisted monitor"` // "denied", "allowed", "whitelisted", "monitor" (logged only)
+	Priority  int       `gorm:"default:0;index" json:"priority"`                                                                     // Higher priority wins when rules conflict
+	IsRegex   bool      `gorm:"default:false;type:boolean" json:"is_regex"`                                                          // Whether this is a regex pattern
+	Source    string    `gorm:"type:varchar(50)" json:"source"`                                                                      // Source of the rule (e.g., "manual", "auto_escalation")
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+	RuleValidity
+}
+
+// EmailDomainRule represents the structure for the email domain rules table
+type EmailDomainRule struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Domain    string    `gorm:"unique;not null;type:varchar(255)" json:"domain" binding:"required,max=255"`                          // "example.com", "*.example.com" (with subdomains) or "*.xyz" (TLD)
+	Status    string    `gorm:"not null;type:varchar(20)" json:"status" binding:"required,oneof=allowed denied whitelisted monitor"` // "denied", "allowed", "whitelisted", "monitor" (logged only)
+	Priority  int       `gorm:"default:0;index" json:"priority"`                                                                     // Higher priority wins when rules conflict
 	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
 	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+	RuleValidity
 }
 
 // UserAgent represents the structure for the User Agents table
 type UserAgent struct {
 	ID        uint      `gorm:"primaryKey" json:"id"`
-	UserAgent string    `gorm:"unique;not null;type:varchar(500)" json:"user_agent" binding:"required,max=500"`              // Reasonable max length
-	Status    string    `gorm:"not null;type:varchar(20)" json:"status" binding:"required,oneof=allowed denied whitelisted"` // "denied", "allowed", "whitelisted"
-	IsRegex   bool      `gorm:"default:false;type:boolean" json:"is_regex"`                                                  // Whether this is a regex pattern
+	UserAgent string    `gorm:"unique;not null;type:varchar(500)" json:"user_agent" binding:"required,max=500"`                      // Reasonable max length
+	Status    string    `gorm:"not null;type:varchar(20)" json:"status" binding:"required,oneof=allowed denied whitelisted monitor"` // "denied", "allowed", "whitelisted", "monitor" (logged only)
+	Priority  int       `gorm:"default:0;index" json:"priority"`                                                                     // Higher priority wins when rules conflict
+	IsRegex   bool      `gorm:"default:false;type:boolean" json:"is_regex"`                                                          // Whether this is a regex pattern
 	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
 	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+	RuleValidity
 }
 
 // Country represents the structure for the Countries table
 type Country struct {
 	ID        uint      `gorm:"primaryKey" json:"id"`
-	Code      string    `gorm:"unique;not null;type:varchar(2)" json:"code" binding:"required,len=2,alpha"`                  // ISO 3166-1 alpha-2 code
-	Name      string    `gorm:"not null;type:varchar(100)" json:"name" binding:"required,max=100"`                           // Country name
-	Status    string    `gorm:"not null;type:varchar(20)" json:"status" binding:"required,oneof=allowed denied whitelisted"` // "denied", "allowed", "whitelisted"
+	Code      string    `gorm:"unique;not null;type:varchar(2)" json:"code" binding:"required,len=2,alpha"`                          // ISO 3166-1 alpha-2 code
+	Name      string    `gorm:"not null;type:varchar(100)" json:"name" binding:"required,max=100"`                                   // Country name
+	Status    string    `gorm:"not null;type:varchar(20)" json:"status" binding:"required,oneof=allowed denied whitelisted monitor"` // "denied", "allowed", "whitelisted", "monitor" (logged only)
+	Priority  int       `gorm:"default:0;index" json:"priority"`                                                                     // Higher priority wins when rules conflict
 	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
 	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+	RuleValidity
+}
+
+// CountryGroup is a named set of countries with its own status, e.g. "EU"; the country filter
+// matches a country against the groups it belongs to. Built-in groups are seeded by SeedCountryGroups.
+type CountryGroup struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Code      string    `gorm:"unique;not null;type:varchar(20)" json:"code" binding:"required,max=20"` // e.g. "EU", "EEA", "EUROPE"
+	Name      string    `gorm:"not null;type:varchar(100)" json:"name" binding:"required,max=100"`
+	Countries []string  `gorm:"serializer:json;type:text" json:"countries" binding:"required,min=1"`                                 // ISO 3166-1 alpha-2 codes, stored as JSON
+	Status    string    `gorm:"not null;type:varchar(20)" json:"status" binding:"required,oneof=allowed denied whitelisted monitor"` // "denied", "allowed", "whitelisted", "monitor" (logged only)
+	Priority  int       `gorm:"default:0;index" json:"priority"`                                                                     // Higher priority wins when rules conflict
+	BuiltIn   bool      `gorm:"default:false" json:"built_in"`                                                                       // Seeded group, cannot be deleted
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+	RuleValidity
 }
 
 type CharsetRule struct {
 	ID        uint      `gorm:"primaryKey" json:"id"`
 	Charset   string    `gorm:"unique;not null;type:varchar(100)" json:"charset" binding:"required,max=100,alphanum"`
-	Status    string    `gorm:"not null;type:varchar(20)" json:"status" binding:"required,oneof=allowed denied whitelisted"` // denied, allowed, whitelisted
+	Status    string    `gorm:"not null;type:varchar(20)" json:"status" binding:"required,oneof=allowed denied whitelisted monitor"` // denied, allowed, whitelisted, monitor (logged only)
+	Priority  int       `gorm:"default:0;index" json:"priority"`                                                                     // Higher priority wins when rules conflict
 	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
 	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+	RuleValidity
 }
 
 type UsernameRule struct {
 	ID        uint      `gorm:"primaryKey" json:"id"`
 	Username  string    `gorm:"unique;not null;type:varchar(100)" json:"username" binding:"required,max=100"`
-	Status    string    `gorm:"not null;type:varchar(20)" json:"status" binding:"required,oneof=allowed denied whitelisted"` // denied, allowed, whitelisted
-	IsRegex   bool      `gorm:"default:false;type:boolean" json:"is_regex"`                                                  // Whether this is a regex pattern
+	Status    string    `gorm:"not null;type:varchar(20)" json:"status" binding:"required,oneof=allowed denied whitelisted monitor"` // denied, allowed, whitelisted, monitor (logged only)
+	Priority  int       `gorm:"default:0;index" json:"priority"`                                                                     // Higher priority wins when rules conflict
+	IsRegex   bool      `gorm:"default:false;type:boolean" json:"is_regex"`                                                          // Whether this is a regex pattern
+	Source    string    `gorm:"type:varchar(50)" json:"source"`                                                                      // Source of the rule (e.g., "manual", "auto_escalation")
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+	RuleValidity
+}
+
+// ContentRule represents the structure for the content rules table
+type ContentRule struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Pattern   string    `gorm:"unique;not null;type:varchar(500)" json:"pattern" binding:"required,max=500"`                                // Keyword, phrase or regex
+	MatchType string    `gorm:"not null;type:varchar(20);default:keyword" json:"match_type" binding:"omitempty,oneof=keyword phrase regex"` // "keyword" (default), "phrase", "regex"
+	Status    string    `gorm:"not null;type:varchar(20)" json:"status" binding:"required,oneof=allowed denied whitelisted monitor"`        // denied, allowed, whitelisted, monitor (logged only)
+	Priority  int       `gorm:"default:0;index" json:"priority"`                                                                            // Higher priority wins when rules conflict
 	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
 	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+	RuleValidity
+}
+
+// VelocityRule represents the structure for the velocity rules table: a key (one request field or a
+// field pair) is denied once it was seen more than Threshold times within the sliding Window
+type VelocityRule struct {
+	ID            uint      `gorm:"primaryKey" json:"id"`
+	Name          string    `gorm:"unique;not null;type:varchar(100)" json:"name" binding:"required,max=100"`
+	KeyFields     string    `gorm:"not null;type:varchar(100)" json:"key_fields" binding:"required,max=100"`         // Field or comma-separated field pair the requests are counted by (e.g. "ip", "ip,action")
+	DistinctField string    `gorm:"type:varchar(50)" json:"distinct_field" binding:"omitempty,max=50"`               // Optional: count distinct values of this field per key instead of requests (e.g. "ip" per "email")
+	Threshold     int       `gorm:"not null" json:"threshold" binding:"required,min=1"`                              // The rule hits once the count exceeds the threshold
+	Window        string    `gorm:"not null;type:varchar(20)" json:"window" binding:"required,max=20"`               // Sliding window as a duration (e.g. "1m", "1h")
+	Status        string    `gorm:"not null;type:varchar(20)" json:"status" binding:"required,oneof=denied monitor"` // "denied" or "monitor" (logged only)
+	Priority      int       `gorm:"default:0;index" json:"priority"`                                                 // Higher priority wins when rules conflict
+	CreatedAt     time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt     time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+	RuleValidity
+}
+
+// CompositeCondition is a single field condition of a composite rule
+type CompositeCondition struct {
+	Field  string   `json:"field"`            // Request field, e.g. "country", "user_agent", "asn" or a custom field
+	Match  string   `json:"match"`            // "exact", "regex", "cidr" (CIDR block or start-end range, for IP fields) or "in"
+	Value  string   `json:"value,omitempty"`  // Value, pattern or CIDR for exact, regex and cidr conditions
+	Values []string `json:"values,omitempty"` // Accepted values for in conditions
+}
+
+// CompositeRule represents the structure for the composite rules table: a named set of field
+// conditions joined by AND or OR, e.g. "deny when country is XX and the user agent matches curl"
+type CompositeRule struct {
+	ID         uint                 `gorm:"primaryKey" json:"id"`
+	Name       string               `gorm:"unique;not null;type:varchar(100)" json:"name" binding:"required,max=100"`
+	Operator   string               `gorm:"not null;type:varchar(3);default:and" json:"operator" binding:"omitempty,oneof=and or"`               // "and" (default) or "or"
+	Conditions []CompositeCondition `gorm:"serializer:json;type:text" json:"conditions" binding:"required,min=1"`                                // Stored as JSON
+	Status     string               `gorm:"not null;type:varchar(20)" json:"status" binding:"required,oneof=allowed denied whitelisted monitor"` // "denied", "allowed", "whitelisted", "monitor" (logged only)
+	Priority   int                  `gorm:"default:0;index" json:"priority"`                                                                     // Higher priority wins when rules conflict
+	CreatedAt  time.Time            `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt  time.Time            `gorm:"autoUpdateTime" json:"updated_at"`
+	RuleValidity
+}
+
+// ExpressionRule matches requests with an expression, e.g. `country in ["RU","CN"] && len(username) > 20`;
+// see the expression package for the language
+type ExpressionRule struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	Name       string    `gorm:"unique;not null;type:varchar(100)" json:"name" binding:"required,max=100"`
+	Expression string    `gorm:"not null;type:text" json:"expression" binding:"required"`
+	Status     string    `gorm:"not null;type:varchar(20)" json:"status" binding:"required,oneof=allowed denied whitelisted monitor"` // "denied", "allowed", "whitelisted", "monitor" (logged only)
+	Priority   int       `gorm:"default:0;index" json:"priority"`                                                                     // Higher priority wins when rules conflict
+	CreatedAt  time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt  time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+	RuleValidity
+}
+
+// GeoRule matches the resolved location of the request IP: a continent ("EU"), a subdivision
+// ("US-CA"), a city ("DE:Berlin") or a geofence (a radius around a coordinate)
+type GeoRule struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Name      string    `gorm:"unique;not null;type:varchar(100)" json:"name" binding:"required,max=100"`
+	Type      string    `gorm:"not null;type:varchar(20);index" json:"type" binding:"required,oneof=continent subdivision city radius"`
+	Value     string    `gorm:"type:varchar(150)" json:"value"` // Continent code, ISO 3166-2 code or "country:city"; empty for radius rules
+	Latitude  float64   `json:"latitude,omitempty"`             // Center of a radius rule
+	Longitude float64   `json:"longitude,omitempty"`
+	RadiusKm  float64   `json:"radius_km,omitempty"`
+	Status    string    `gorm:"not null;type:varchar(20)" json:"status" binding:"required,oneof=allowed denied whitelisted monitor"` // "denied", "allowed", "whitelisted", "monitor" (logged only)
+	Priority  int       `gorm:"default:0;index" json:"priority"`                                                                     // Higher priority wins when rules conflict
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+	RuleValidity
 }
 
 // SyncTracker tracks the last sync timestamp for each data type
@@ -69,16 +218,51 @@ type SyncTracker struct {
 	UpdatedAt time.Time `gorm:"autoUpdateTime"`
 }
 
+// DefaultPolicy decides what a filter returns for a value no rule matches: "allow", "deny"
+// (the rules of the filter form an allowlist) or "fall-through" (the other filters decide)
+type DefaultPolicy struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Filter    string    `gorm:"unique;not null;type:varchar(50)" json:"filter"` // Filter name, e.g. "country"
+	Policy    string    `gorm:"not null;type:varchar(20)" json:"policy" binding:"required,oneof=allow deny fall-through"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
 // ASN represents the structure for the ASNs table
 type ASN struct {
 	ID        uint      `gorm:"primaryKey" json:"id"`
-	ASN       string    `gorm:"unique;not null;type:varchar(20)" json:"asn" binding:"required,max=20"`                       // ASN number (e.g., "AS12345")
-	RIR       string    `gorm:"type:varchar(20)" json:"rir" binding:"omitempty,max=20"`                                      // Regional Internet Registry (e.g., "arin", "ripencc") - optional
-	Domain    string    `gorm:"type:varchar(255)" json:"domain" binding:"omitempty,max=255"`                                 // Domain name - optional
-	Country   string    `gorm:"type:varchar(2)" json:"cc" binding:"omitempty,len=2,alpha"`                                   // Country code (ISO 3166-1 alpha-2) - optional
-	Name      string    `gorm:"not null;type:varchar(255)" json:"asname" binding:"required,max=255"`                         // ASN name/description
-	Status    string    `gorm:"not null;type:varchar(20)" json:"status" binding:"required,oneof=allowed denied whitelisted"` // "denied", "allowed", "whitelisted"
-	Source    string    `gorm:"type:varchar(50)" json:"source"`                                                              // Source of the ASN data (e.g., "spamhaus", "manual")
+	ASN       string    `gorm:"unique;not null;type:varchar(20)" json:"asn" binding:"required,max=20"`                               // ASN number (e.g., "AS12345")
+	RIR       string    `gorm:"type:varchar(20)" json:"rir" binding:"omitempty,max=20"`                                              // Regional Internet Registry (e.g., "arin", "ripencc") - optional
+	Domain    string    `gorm:"type:varchar(255)" json:"domain" binding:"omitempty,max=255"`                                         // Domain name - optional
+	Country   string    `gorm:"type:varchar(2)" json:"cc" binding:"omitempty,len=2,alpha"`                                           // Country code (ISO 3166-1 alpha-2) - optional
+	Name      string    `gorm:"not null;type:varchar(255)" json:"asname" binding:"required,max=255"`                                 // ASN name/description
+	Status    string    `gorm:"not null;type:varchar(20)" json:"status" binding:"required,oneof=allowed denied whitelisted monitor"` // "denied", "allowed", "whitelisted", "monitor" (logged only)
+	Priority  int       `gorm:"default:0;index" json:"priority"`                                                                     // Higher priority wins when rules conflict
+	Source    string    `gorm:"type:varchar(50)" json:"source"`                                                                      // Source of the ASN data (e.g., "spamhaus", "manual")
 	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
 	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+	RuleValidity
+}
+
+// ArchivedRule keeps a copy of an expired rule when filtering.expired_rule_action is "archive"
+type ArchivedRule struct {
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	RuleType   string     `gorm:"not null;type:varchar(50);index:idx_archived_rule" json:"rule_type"` // Event type of the rule ("ip", "email", ...)
+	RuleID     uint       `gorm:"not null;index:idx_archived_rule" json:"rule_id"`
+	Data       string     `gorm:"type:json" json:"data"` // Rule as it was when it expired
+	ExpiresAt  *time.Time `json:"expires_at"`
+	ArchivedAt time.Time  `gorm:"autoCreateTime" json:"archived_at"`
+}
+
+// EscalationOffense counts the automatic bans of one value under an escalation policy
+type EscalationOffense struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	Policy      string    `gorm:"not null;type:varchar(100);uniqueIndex:idx_escalation_offense" json:"policy"`
+	Field       string    `gorm:"not null;type:varchar(20)" json:"field"` // "ip", "email" or "username"
+	Value       string    `gorm:"not null;type:varchar(255);uniqueIndex:idx_escalation_offense" json:"value"`
+	Offenses    int       `gorm:"not null;default:0" json:"offenses"` // Number of bans so far, selects the next ban duration
+	RuleID      uint      `json:"rule_id"`                            // Rule created by the last ban
+	LastBanAt   time.Time `json:"last_ban_at"`
+	BannedUntil time.Time `json:"banned_until"` // Denials before this time are not counted again
+	CreatedAt   time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt   time.Time `gorm:"autoUpdateTime" json:"updated_at"`
 }
@@ -11,14 +11,19 @@ type TrafficLog struct {
 	RequestID string    `json:"request_id" gorm:"size:36;not null"`
 
 	// Request data
-	IPAddress string `json:"ip_address" gorm:"size:45"`
-	Email     string `json:"email" gorm:"size:255"`
-	UserAgent string `json:"user_agent" gorm:"type:text"`
-	Username  string `json:"username" gorm:"size:255"`
-	Country   string `json:"country" gorm:"size:10"`
-	ASN       string `json:"asn" gorm:"size:20"`
-	Charset   string `json:"charset" gorm:"size:50"`
-	Content   string `json:"content" gorm:"type:text"`
+	IPAddress   string `json:"ip_address" gorm:"size:45"`
+	Email       string `json:"email" gorm:"size:255"` // As sent by the client
+	UserAgent   string `json:"user_agent" gorm:"type:text"`
+	Username    string `json:"username" gorm:"size:255"`
+	Country     string `json:"country" gorm:"size:10"`
+	ASN         string `json:"asn" gorm:"size:20"`
+	Continent   string `json:"continent" gorm:"size:2"`    // Resolved from the IP
+	Subdivision string `json:"subdivision" gorm:"size:10"` // Resolved from the IP (City database), e.g. "US-CA"
+	City        string `json:"city" gorm:"size:100"`       // Resolved from the IP (City database)
+	Charset     string `json:"charset" gorm:"size:50"`
+	Content     string `json:"content" gorm:"type:text"`
+
+	CanonicalEmail string `json:"canonical_email" gorm:"size:255;index"` // Normalized address the rules were matched against
 
 	// Filter results
 	FinalResult   string `json:"final_result" gorm:"type:enum('allowed','denied','whitelisted');not null"`
@@ -82,3 +87,14 @@ type AnalyticsAggregation struct {
 	AvgResponseTimeMs float64 `json:"avg_response_time_ms"`
 	CacheHitRate      float64 `json:"cache_hit_rate"`
 }
+
+// MonitorRuleStat counts the hits of a monitor rule per hour
+type MonitorRuleStat struct {
+	ID         uint      `json:"id" gorm:"primaryKey"`
+	Filter     string    `json:"filter" gorm:"size:50;not null;uniqueIndex:idx_monitor_rule_bucket"` // Filter (and rule table) that matched, e.g. "ip", "username"
+	RuleID     uint      `json:"rule_id" gorm:"not null;uniqueIndex:idx_monitor_rule_bucket"`
+	Bucket     time.Time `json:"bucket" gorm:"not null;uniqueIndex:idx_monitor_rule_bucket"` // Start of the hour
+	Hits       int64     `json:"hits" gorm:"default:0"`
+	WouldBlock int64     `json:"would_block" gorm:"default:0"` // Hits that would have changed the decision to denied
+	LastHitAt  time.Time `json:"last_hit_at"`
+}
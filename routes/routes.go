@@ -46,6 +46,13 @@ func SetupRoutes(r *gin.Engine) {
 	api.GET("/emails/stats", controllers.GetEmailStats(db))
 	api.POST("/emails/recreate-index", controllers.RecreateEmailIndex(db))
 
+	// EmailDomainRule CRUD
+	api.POST("/email-domain", controllers.CreateEmailDomain(db))
+	api.GET("/email-domains", controllers.GetEmailDomains(db))
+	api.PUT("/email-domain/:id", controllers.UpdateEmailDomain(db))
+	api.DELETE("/email-domain/:id", controllers.DeleteEmailDomain(db))
+	api.GET("/email-domains/stats", controllers.GetEmailDomainStats(db))
+
 	// CRUD routes for User Agents
 	api.POST("/user-agent", controllers.CreateUserAgent(db))
 	api.GET("/user-agents", controllers.GetUserAgents(db))
@@ -60,8 +67,17 @@ func SetupRoutes(r *gin.Engine) {
 	api.PUT("/country/:id", controllers.UpdateCountry(db))
 	api.DELETE("/country/:id", controllers.DeleteCountry(db))
 	api.GET("/countries/stats", controllers.GetCountryStats(db))
+	api.GET("/countries/:code/groups", controllers.GetCountryGroupsOfCountry(db))
 	api.POST("/countries/recreate-index", controllers.RecreateCountryIndex(db))
 
+	// CountryGroup CRUD
+	api.POST("/country-groups", controllers.CreateCountryGroup(db))
+	api.GET("/country-groups", controllers.GetCountryGroups(db))
+	api.GET("/country-groups/stats", controllers.GetCountryGroupStats(db))
+	api.GET("/country-groups/:id", controllers.GetCountryGroup(db))
+	api.PUT("/country-groups/:id", controllers.UpdateCountryGroup(db))
+	api.DELETE("/country-groups/:id", controllers.DeleteCountryGroup(db))
+
 	// CharsetRule CRUD
 	api.POST("/charset", controllers.CreateCharsetRule(db))
 	api.GET("/charsets", controllers.GetCharsetRules(db))
@@ -85,6 +101,49 @@ func SetupRoutes(r *gin.Engine) {
 	api.GET("/usernames/stats", controllers.GetUsernameStats(db))
 	api.POST("/usernames/recreate-index", controllers.RecreateUsernameIndex(db))
 
+	// ContentRule CRUD
+	api.POST("/content-rule", controllers.CreateContentRule(db))
+	api.GET("/content-rules", controllers.GetContentRules(db))
+	api.PUT("/content-rule/:id", controllers.UpdateContentRule(db))
+	api.DELETE("/content-rule/:id", controllers.DeleteContentRule(db))
+	api.GET("/content-rules/stats", controllers.GetContentRuleStats(db))
+
+	// VelocityRule CRUD
+	api.POST("/velocity-rule", controllers.CreateVelocityRule(db))
+	api.GET("/velocity-rules", controllers.GetVelocityRules(db))
+	api.PUT("/velocity-rule/:id", controllers.UpdateVelocityRule(db))
+	api.DELETE("/velocity-rule/:id", controllers.DeleteVelocityRule(db))
+	api.GET("/velocity-rules/stats", controllers.GetVelocityRuleStats(db))
+
+	// CompositeRule CRUD
+	api.POST("/composite-rules", controllers.CreateCompositeRule(db))
+	api.GET("/composite-rules", controllers.GetCompositeRules(db))
+	api.GET("/composite-rules/stats", controllers.GetCompositeRuleStats(db))
+	api.GET("/composite-rules/:id", controllers.GetCompositeRule(db))
+	api.PUT("/composite-rules/:id", controllers.UpdateCompositeRule(db))
+	api.DELETE("/composite-rules/:id", controllers.DeleteCompositeRule(db))
+
+	// ExpressionRule CRUD
+	api.POST("/expression-rules", controllers.CreateExpressionRule(db))
+	api.POST("/expression-rules/validate", controllers.ValidateExpression())
+	api.GET("/expression-rules", controllers.GetExpressionRules(db))
+	api.GET("/expression-rules/stats", controllers.GetExpressionRuleStats(db))
+	api.GET("/expression-rules/:id", controllers.GetExpressionRule(db))
+	api.PUT("/expression-rules/:id", controllers.UpdateExpressionRule(db))
+	api.DELETE("/expression-rules/:id", controllers.DeleteExpressionRule(db))
+
+	// GeoRule CRUD
+	api.POST("/geo-rules", controllers.CreateGeoRule(db))
+	api.GET("/geo-rules", controllers.GetGeoRules(db))
+	api.GET("/geo-rules/stats", controllers.GetGeoRuleStats(db))
+	api.GET("/geo-rules/:id", controllers.GetGeoRule(db))
+	api.PUT("/geo-rules/:id", controllers.UpdateGeoRule(db))
+	api.DELETE("/geo-rules/:id", controllers.DeleteGeoRule(db))
+
+	// Default policies per filter
+	api.GET("/default-policies", controllers.GetDefaultPolicies(db))
+	api.PUT("/default-policies/:filter", controllers.UpdateDefaultPolicy(db))
+
 	// ASN CRUD
 	api.POST("/asn", controllers.CreateASN(db))
 	api.GET("/asns", controllers.GetASNs(db))
@@ -106,6 +165,7 @@ func SetupRoutes(r *gin.Engine) {
 
 	// Filtering route
 	api.POST("/filter", controllers.FilterRequestHandler(db))
+	api.POST("/filter/batch", controllers.FilterBatchHandler(db))
 
 	// Manual sync routes
 	api.POST("/sync", func(c *gin.Context) {
@@ -118,6 +178,11 @@ func SetupRoutes(r *gin.Engine) {
 
 	api.POST("/sync/full", controllers.ManualFullSync(db))
 
+	// Zero-downtime index rebuilds
+	api.POST("/sync/reindex/:index", controllers.ReindexHandler(db))
+	api.GET("/sync/reindex-jobs", controllers.GetReindexJobs())
+	api.GET("/sync/reindex-jobs/:id", controllers.GetReindexJob())
+
 	// Force sync route
 	api.POST("/sync/force", func(c *gin.Context) {
 		scheduledSync := services.GetScheduledSync()
@@ -132,6 +197,9 @@ func SetupRoutes(r *gin.Engine) {
 		var emailCount int64
 		db.Model(&models.Email{}).Count(&emailCount)
 		totalRecords += emailCount
+		var emailDomainCount int64
+		db.Model(&models.EmailDomainRule{}).Count(&emailDomainCount)
+		totalRecords += emailDomainCount
 		var userAgentCount int64
 		db.Model(&models.UserAgent{}).Count(&userAgentCount)
 		totalRecords += userAgentCount
@@ -144,6 +212,9 @@ func SetupRoutes(r *gin.Engine) {
 		var usernameCount int64
 		db.Model(&models.UsernameRule{}).Count(&usernameCount)
 		totalRecords += usernameCount
+		var contentCount int64
+		db.Model(&models.ContentRule{}).Count(&contentCount)
+		totalRecords += contentCount
 
 		c.JSON(http.StatusOK, gin.H{
 			"message":        "Force sync completed successfully",
@@ -178,6 +249,7 @@ func SetupRoutes(r *gin.Engine) {
 	api.GET("/analytics/top-data/:type", controllers.GetTopData(db))
 	api.GET("/analytics/insights", controllers.GetRelationshipInsights(db))
 	api.GET("/analytics/stats", controllers.GetTrafficStats(db))
+	api.GET("/analytics/monitor-rules", controllers.GetMonitorRuleStats(db))
 	api.POST("/analytics/cleanup", controllers.CleanupOldLogs(db))
 
 	// Cache management route
@@ -0,0 +1,84 @@
+package services
+
+// ahoCorasick finds all occurrences of many patterns in a single pass over the text
+type ahoCorasick struct {
+	nodes []acNode
+}
+
+// acNode is a state of the automaton; output holds the patterns ending here, including via fail links
+type acNode struct {
+	next   map[byte]int32
+	fail   int32
+	output []int32
+}
+
+// newAhoCorasick builds the automaton over the bytes of the patterns; empty patterns are ignored
+func newAhoCorasick(patterns []string) *ahoCorasick {
+	ac := &ahoCorasick{nodes: []acNode{{next: map[byte]int32{}}}}
+
+	for i, pattern := range patterns {
+		if pattern == "" {
+			continue
+		}
+		state := int32(0)
+		for j := 0; j < len(pattern); j++ {
+			next, ok := ac.nodes[state].next[pattern[j]]
+			if !ok {
+				next = int32(len(ac.nodes))
+				ac.nodes = append(ac.nodes, acNode{next: map[byte]int32{}})
+				ac.nodes[state].next[pattern[j]] = next
+			}
+			state = next
+		}
+		ac.nodes[state].output = append(ac.nodes[state].output, int32(i))
+	}
+
+	// Breadth-first: the fail link of a node points to the longest proper suffix that is also a prefix
+	queue := make([]int32, 0, len(ac.nodes))
+	for _, child := range ac.nodes[0].next {
+		queue = append(queue, child)
+	}
+	for len(queue) > 0 {
+		state := queue[0]
+		queue = queue[1:]
+		for b, child := range ac.nodes[state].next {
+			fail := ac.nodes[state].fail
+			for {
+				if next, ok := ac.nodes[fail].next[b]; ok {
+					ac.nodes[child].fail = next
+					break
+				}
+				if fail == 0 {
+					ac.nodes[child].fail = 0
+					break
+				}
+				fail = ac.nodes[fail].fail
+			}
+			ac.nodes[child].output = append(ac.nodes[child].output, ac.nodes[ac.nodes[child].fail].output...)
+			queue = append(queue, child)
+		}
+	}
+	return ac
+}
+
+// each calls fn with the pattern index and end offset of every occurrence; fn returns false to stop
+func (ac *ahoCorasick) each(text string, fn func(pattern, end int) bool) {
+	state := int32(0)
+	for i := 0; i < len(text); i++ {
+		for {
+			if next, ok := ac.nodes[state].next[text[i]]; ok {
+				state = next
+				break
+			}
+			if state == 0 {
+				break
+			}
+			state = ac.nodes[state].fail
+		}
+		for _, pattern := range ac.nodes[state].output {
+			if !fn(int(pattern), i+1) {
+				return
+			}
+		}
+	}
+}
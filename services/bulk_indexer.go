@@ -0,0 +1,197 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"firewall/config"
+)
+
+// bulkSettings returns search.bulk_size, search.bulk_flush_interval and search.bulk_concurrency
+func bulkSettings() (size int, flushInterval time.Duration, concurrency int) {
+	size, flushInterval, concurrency = 1000, time.Second, 4
+	if config.AppConfig != nil {
+		if config.AppConfig.Search.BulkSize > 0 {
+			size = config.AppConfig.Search.BulkSize
+		}
+		if config.AppConfig.Search.BulkFlushInterval > 0 {
+			flushInterval = config.AppConfig.Search.BulkFlushInterval
+		}
+		if config.AppConfig.Search.BulkConcurrency > 0 {
+			concurrency = config.AppConfig.Search.BulkConcurrency
+		}
+	}
+	return size, flushInterval, concurrency
+}
+
+// BulkStats counts the documents sent by a BulkIndexer
+type BulkStats struct {
+	Indexed int `json:"indexed"`
+	Failed  int `json:"failed"`  // Queued for retry
+	Dropped int `json:"dropped"` // Lost because the retry queue was full
+}
+
+// BulkIndexer batches the documents of one rule index into bulk requests. A batch is sent when it
+// reaches the bulk size or the flush interval passes, with at most bulk_concurrency requests in
+// flight; Add blocks while all are busy. The failed documents of a request are queued for retry
+// as one batch.
+type BulkIndexer struct {
+	index    string
+	size     int
+	interval time.Duration
+	slots    chan struct{}
+
+	mu      sync.Mutex
+	pending []RuleDocument
+	timer   *time.Timer
+	stats   BulkStats
+	wg      sync.WaitGroup
+}
+
+// NewBulkIndexer returns a BulkIndexer for index configured from the search settings
+func NewBulkIndexer(index string) *BulkIndexer {
+	size, interval, concurrency := bulkSettings()
+	return &BulkIndexer{
+		index:    index,
+		size:     size,
+		interval: interval,
+		slots:    make(chan struct{}, concurrency),
+	}
+}
+
+// Add queues a document
+func (b *BulkIndexer) Add(doc RuleDocument) {
+	b.mu.Lock()
+	b.pending = append(b.pending, doc)
+	if len(b.pending) < b.size {
+		if b.timer == nil {
+			b.timer = time.AfterFunc(b.interval, b.Flush)
+		}
+		b.mu.Unlock()
+		return
+	}
+	batch := b.take()
+	b.mu.Unlock()
+	b.send(batch)
+}
+
+// Flush sends the queued documents without waiting for the request to finish
+func (b *BulkIndexer) Flush() {
+	b.mu.Lock()
+	batch := b.take()
+	b.mu.Unlock()
+	b.send(batch)
+}
+
+// Close sends the remaining documents and waits for all requests
+func (b *BulkIndexer) Close() BulkStats {
+	b.Flush()
+	b.wg.Wait()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.stats
+}
+
+// take removes the pending batch; the caller holds the lock. The batch is counted in wg right
+// away, so Close waits for batches a timer flush took but has not sent yet.
+func (b *BulkIndexer) take() []RuleDocument {
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	batch := b.pending
+	b.pending = nil
+	if len(batch) > 0 {
+		b.wg.Add(1)
+	}
+	return batch
+}
+
+// send runs a bulk request for a batch from take once a slot is free
+func (b *BulkIndexer) send(batch []RuleDocument) {
+	if len(batch) == 0 {
+		return
+	}
+	b.slots <- struct{}{}
+	go func() {
+		defer func() {
+			<-b.slots
+			b.wg.Done()
+		}()
+
+		failed := batch
+		failures, err := GetRuleIndex().BulkUpsert(context.Background(), b.index, batch)
+		if err != nil {
+			log.Printf("Bulk request to %s failed, queueing %d documents for retry: %v", b.index, len(batch), err)
+		} else {
+			failed = failedDocuments(b.index, batch, failures)
+		}
+
+		queued := len(failed) == 0 || QueueForRetry("sync_bulk", &bulkRetry{index: b.index, docs: failed})
+
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		b.stats.Indexed += len(batch) - len(failed)
+		if queued {
+			b.stats.Failed += len(failed)
+		} else {
+			b.stats.Dropped += len(failed)
+		}
+	}()
+}
+
+// failedDocuments returns the documents of a batch that failed individually
+func failedDocuments(index string, batch []RuleDocument, failures []BulkFailure) []RuleDocument {
+	if len(failures) == 0 {
+		return nil
+	}
+	failed := make(map[string]bool, len(failures))
+	for _, failure := range failures {
+		failed[failure.ID] = true
+		log.Printf("Error indexing %s/%s: %v", index, failure.ID, failure.Err)
+	}
+	var docs []RuleDocument
+	for _, doc := range batch {
+		if failed[doc.ID] {
+			docs = append(docs, doc)
+		}
+	}
+	return docs
+}
+
+// bulkRetry holds the failed documents of a bulk request. It is one retry item however many
+// documents failed, so a large failure cannot overflow the retry queue.
+type bulkRetry struct {
+	index string
+	docs  []RuleDocument
+}
+
+// retry resends the documents; only those failing again are kept for the next attempt
+func (r *bulkRetry) retry() error {
+	failures, err := GetRuleIndex().BulkUpsert(context.Background(), r.index, r.docs)
+	if err != nil {
+		return err
+	}
+	r.docs = failedDocuments(r.index, r.docs, failures)
+	if len(r.docs) > 0 {
+		return fmt.Errorf("%d documents of %s failed", len(r.docs), r.index)
+	}
+	return nil
+}
+
+// bulkSync sends the documents of rules through a BulkIndexer and waits for it. It fails when
+// documents were dropped because the retry queue was full.
+func bulkSync[T any](index string, rules []T, document func(T) RuleDocument) (BulkStats, error) {
+	indexer := NewBulkIndexer(index)
+	for _, rule := range rules {
+		indexer.Add(document(rule))
+	}
+	stats := indexer.Close()
+	if stats.Dropped > 0 {
+		return stats, fmt.Errorf("%d documents of %s were dropped, the retry queue is full", stats.Dropped, index)
+	}
+	return stats, nil
+}
@@ -0,0 +1,179 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"firewall/config"
+	"firewall/models"
+
+	"github.com/elastic/go-elasticsearch/v8"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// batchRecorder is a memory rule index that records bulk batch sizes and fails chosen documents
+type batchRecorder struct {
+	RuleIndex
+	mu      sync.Mutex
+	batches []int
+	failIDs map[string]bool
+	err     error
+}
+
+func (b *batchRecorder) BulkUpsert(ctx context.Context, index string, docs []RuleDocument) ([]BulkFailure, error) {
+	b.mu.Lock()
+	b.batches = append(b.batches, len(docs))
+	b.mu.Unlock()
+	if b.err != nil {
+		return nil, b.err
+	}
+
+	var failures []BulkFailure
+	var indexed []RuleDocument
+	for _, doc := range docs {
+		if b.failIDs[doc.ID] {
+			failures = append(failures, BulkFailure{ID: doc.ID, Err: errors.New("mapper_parsing_exception")})
+		} else {
+			indexed = append(indexed, doc)
+		}
+	}
+	if _, err := b.RuleIndex.BulkUpsert(ctx, index, indexed); err != nil {
+		return nil, err
+	}
+	return failures, nil
+}
+
+func useBulkSettings(t *testing.T, size int, interval time.Duration, concurrency int) {
+	previous := config.AppConfig
+	t.Cleanup(func() { config.AppConfig = previous })
+	config.AppConfig = &config.Config{Search: config.SearchConfig{
+		BulkSize:          size,
+		BulkFlushInterval: interval,
+		BulkConcurrency:   concurrency,
+	}}
+}
+
+func useRuleIndex(t *testing.T, index RuleIndex) {
+	previous := GetRuleIndex()
+	t.Cleanup(func() { SetRuleIndex(previous) })
+	SetRuleIndex(index)
+}
+
+func testIPs(n int) []models.IP {
+	ips := make([]models.IP, n)
+	for i := range ips {
+		ips[i] = models.IP{ID: uint(i + 1), Address: "192.0.2.1", Status: "denied"}
+	}
+	return ips
+}
+
+func TestBulkSync_Batches(t *testing.T) {
+	useBulkSettings(t, 2, time.Minute, 2)
+	recorder := &batchRecorder{RuleIndex: NewMemoryRuleIndex()}
+	useRuleIndex(t, recorder)
+
+	stats, err := bulkSync(IndexIPs, testIPs(5), ipDocument)
+	assert.NoError(t, err)
+	assert.Equal(t, BulkStats{Indexed: 5}, stats)
+	assert.ElementsMatch(t, []int{2, 2, 1}, recorder.batches)
+
+	assert.Len(t, indexedDocs(recorder.RuleIndex, IndexIPs, "address", "192.0.2.1"), 5)
+}
+
+func TestBulkSync_ItemFailures(t *testing.T) {
+	useBulkSettings(t, 10, time.Minute, 1)
+	recorder := &batchRecorder{RuleIndex: NewMemoryRuleIndex(), failIDs: map[string]bool{"2": true}}
+	useRuleIndex(t, recorder)
+
+	stats, err := bulkSync(IndexIPs, testIPs(3), ipDocument)
+	assert.NoError(t, err)
+	assert.Equal(t, BulkStats{Indexed: 2, Failed: 1}, stats)
+}
+
+func TestBulkSync_RequestFailure(t *testing.T) {
+	useBulkSettings(t, 10, time.Minute, 1)
+	recorder := &batchRecorder{RuleIndex: NewMemoryRuleIndex(), err: errors.New("cluster unavailable")}
+	useRuleIndex(t, recorder)
+
+	stats, err := bulkSync(IndexIPs, testIPs(3), ipDocument)
+	assert.NoError(t, err)
+	assert.Equal(t, BulkStats{Failed: 3}, stats)
+}
+
+func TestBulkRetry_KeepsFailedDocuments(t *testing.T) {
+	recorder := &batchRecorder{RuleIndex: NewMemoryRuleIndex(), failIDs: map[string]bool{"2": true}}
+	useRuleIndex(t, recorder)
+
+	batch := &bulkRetry{index: IndexIPs}
+	for _, ip := range testIPs(3) {
+		batch.docs = append(batch.docs, ipDocument(ip))
+	}
+
+	// The next attempt only resends the document that failed again
+	assert.Error(t, batch.retry())
+	if assert.Len(t, batch.docs, 1) {
+		assert.Equal(t, "2", batch.docs[0].ID)
+	}
+
+	recorder.failIDs = nil
+	assert.NoError(t, batch.retry())
+	assert.Empty(t, batch.docs)
+	assert.Equal(t, []int{3, 1}, recorder.batches)
+}
+
+func TestBulkIndexer_FlushInterval(t *testing.T) {
+	useBulkSettings(t, 100, 20*time.Millisecond, 1)
+	recorder := &batchRecorder{RuleIndex: NewMemoryRuleIndex()}
+	useRuleIndex(t, recorder)
+
+	indexer := NewBulkIndexer(IndexIPs)
+	indexer.Add(ipDocument(testIPs(1)[0]))
+
+	// The incomplete batch is sent without Flush or Close
+	assert.Eventually(t, func() bool {
+		recorder.mu.Lock()
+		defer recorder.mu.Unlock()
+		return len(recorder.batches) == 1
+	}, time.Second, 5*time.Millisecond)
+	assert.Equal(t, BulkStats{Indexed: 1}, indexer.Close())
+}
+
+func TestElasticsearchRuleIndex_BulkUpsertFailures(t *testing.T) {
+	var body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		body = string(data)
+		w.Header().Set("X-Elastic-Product", "Elasticsearch")
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"errors":true,"items":[
+			{"index":{"_id":"1","status":201}},
+			{"index":{"_id":"2","status":400,"error":{"type":"mapper_parsing_exception"}}},
+			{"index":{"_id":"3","status":409,"error":{"type":"version_conflict_engine_exception"}}}
+		]}`)
+	}))
+	defer server.Close()
+	client, err := elasticsearch.NewClient(elasticsearch.Config{Addresses: []string{server.URL}})
+	require.NoError(t, err)
+	index := NewElasticsearchRuleIndex(client, "")
+
+	failures, err := index.BulkUpsert(context.Background(), IndexIPs, []RuleDocument{
+		{ID: "1", Source: map[string]interface{}{"address": "192.0.2.1"}},
+		{ID: "2", Source: map[string]interface{}{"address": "not an ip"}},
+		{ID: "3", Version: 100, Source: map[string]interface{}{"address": "192.0.2.3"}},
+	})
+	assert.NoError(t, err)
+	assert.Contains(t, body, `{"index":{"_id":"2"}}`)
+	// A newer version is stored already, that is not a failure
+	assert.Contains(t, body, `{"index":{"_id":"3","version":100,"version_type":"external"}}`)
+	if assert.Len(t, failures, 1) {
+		assert.Equal(t, "2", failures[0].ID)
+		assert.ErrorContains(t, failures[0].Err, "mapper_parsing_exception")
+	}
+}
@@ -0,0 +1,402 @@
+package services
+
+import (
+	"context"
+	"unicode/utf8"
+)
+
+// charsetFilter checks the enabled charset fields against the charset rules
+type charsetFilter struct{}
+
+func (charsetFilter) Name() string { return "charset" }
+
+// Fields returns the fields enabled in the charset fields configuration
+func (charsetFilter) Fields() []string {
+	return GetCharsetFieldsConfig().GetEnabledFields()
+}
+
+func (f charsetFilter) Evaluate(ctx context.Context, input *FilterInput) FilterResult {
+	snapshot := GetRuleEngine().Snapshot()
+	output := FilterResult{Result: "allowed", Field: "charset"}
+	var monitor []MonitorHit
+
+	for _, field := range f.Fields() {
+		// Use the raw value, e.g. the email before normalization
+		value := input.RawValue(field)
+		if value == "" {
+			continue
+		}
+		charset := detectCharset(value)
+		if rule := snapshot.Monitor().MatchCharset(charset); rule != nil {
+			monitor = append(monitor, newMonitorHit(rule, field, value))
+		}
+		// Keep collecting monitor hits once a field is whitelisted
+		if output.Result == "whitelisted" {
+			continue
+		}
+		rule := snapshot.MatchCharset(charset)
+		if rule == nil {
+			// The first field without a charset rule decides unless a rule denies or whitelists another field
+			if output.RuleID == 0 && output.DefaultPolicy == "" && snapshot.DefaultPolicy("charset") != PolicyFallThrough {
+				output = snapshot.defaultResult("charset", field, value)
+			}
+			continue
+		}
+		switch rule.Status {
+		case "whitelisted", "denied":
+			output = ruleResult(rule, field, "charset", value)
+		}
+	}
+	output.Monitor = monitor
+	return output
+}
+
+// Enhanced Charset Detection with Unicode Script Support
+func detectCharset(s string) string {
+	if s == "" {
+		return "ASCII"
+	}
+
+	// Count characters by script
+	scriptCounts := make(map[string]int)
+	totalChars := 0
+
+	for _, r := range s {
+		totalChars++
+		script := getUnicodeScript(r)
+		scriptCounts[script]++
+	}
+
+	// If only ASCII characters, return ASCII
+	if scriptCounts["ASCII"] == totalChars {
+		return "ASCII"
+	}
+
+	// Find the dominant script (script with highest count)
+	var dominantScript string
+	maxCount := 0
+	for script, count := range scriptCounts {
+		if count > maxCount {
+			maxCount = count
+			dominantScript = script
+		}
+	}
+
+	// If dominant script has more than 50% of characters, use it
+	if float64(maxCount)/float64(totalChars) > 0.5 {
+		return dominantScript
+	}
+
+	// If no dominant script, check for mixed content
+	if len(scriptCounts) > 1 {
+		return "Mixed"
+	}
+
+	// Fallback to UTF-8 for valid strings
+	if utf8.ValidString(s) {
+		return "UTF-8"
+	}
+
+	return "Other"
+}
+
+// getUnicodeScript determines the Unicode script for a rune
+func getUnicodeScript(r rune) string {
+	// ASCII range
+	if r <= 127 {
+		return "ASCII"
+	}
+
+	// Basic Latin (extended)
+	if r >= 0x0080 && r <= 0x00FF {
+		return "Latin"
+	}
+
+	// Latin Extended-A
+	if r >= 0x0100 && r <= 0x017F {
+		return "Latin"
+	}
+
+	// Latin Extended-B
+	if r >= 0x0180 && r <= 0x024F {
+		return "Latin"
+	}
+
+	// Cyrillic
+	if r >= 0x0400 && r <= 0x04FF {
+		return "Cyrillic"
+	}
+
+	// Cyrillic Extended
+	if r >= 0x0500 && r <= 0x052F {
+		return "Cyrillic"
+	}
+
+	// Arabic
+	if r >= 0x0600 && r <= 0x06FF {
+		return "Arabic"
+	}
+
+	// Arabic Extended
+	if r >= 0x0750 && r <= 0x077F {
+		return "Arabic"
+	}
+
+	// Arabic Presentation Forms-A
+	if r >= 0xFB50 && r <= 0xFDFF {
+		return "Arabic"
+	}
+
+	// Arabic Presentation Forms-B
+	if r >= 0xFE70 && r <= 0xFEFF {
+		return "Arabic"
+	}
+
+	// Hebrew
+	if r >= 0x0590 && r <= 0x05FF {
+		return "Hebrew"
+	}
+
+	// Greek
+	if r >= 0x0370 && r <= 0x03FF {
+		return "Greek"
+	}
+
+	// Greek Extended
+	if r >= 0x1F00 && r <= 0x1FFF {
+		return "Greek"
+	}
+
+	// Thai
+	if r >= 0x0E00 && r <= 0x0E7F {
+		return "Thai"
+	}
+
+	// Devanagari (Hindi, Sanskrit, etc.)
+	if r >= 0x0900 && r <= 0x097F {
+		return "Devanagari"
+	}
+
+	// Bengali
+	if r >= 0x0980 && r <= 0x09FF {
+		return "Bengali"
+	}
+
+	// Tamil
+	if r >= 0x0B80 && r <= 0x0BFF {
+		return "Tamil"
+	}
+
+	// Telugu
+	if r >= 0x0C00 && r <= 0x0C7F {
+		return "Telugu"
+	}
+
+	// Kannada
+	if r >= 0x0C80 && r <= 0x0CFF {
+		return "Kannada"
+	}
+
+	// Malayalam
+	if r >= 0x0D00 && r <= 0x0D7F {
+		return "Malayalam"
+	}
+
+	// Gujarati
+	if r >= 0x0A80 && r <= 0x0AFF {
+		return "Gujarati"
+	}
+
+	// Gurmukhi (Punjabi)
+	if r >= 0x0A00 && r <= 0x0A7F {
+		return "Gurmukhi"
+	}
+
+	// Oriya
+	if r >= 0x0B00 && r <= 0x0B7F {
+		return "Oriya"
+	}
+
+	// Chinese (Simplified and Traditional)
+	if r >= 0x4E00 && r <= 0x9FFF {
+		return "Chinese"
+	}
+
+	// Chinese Extended
+	if r >= 0x3400 && r <= 0x4DBF {
+		return "Chinese"
+	}
+
+	// Chinese Extended-A
+	if r >= 0x20000 && r <= 0x2A6DF {
+		return "Chinese"
+	}
+
+	// Japanese Hiragana
+	if r >= 0x3040 && r <= 0x309F {
+		return "Japanese"
+	}
+
+	// Japanese Katakana
+	if r >= 0x30A0 && r <= 0x30FF {
+		return "Japanese"
+	}
+
+	// Japanese Katakana Phonetic Extensions
+	if r >= 0x31F0 && r <= 0x31FF {
+		return "Japanese"
+	}
+
+	// Korean Hangul
+	if r >= 0xAC00 && r <= 0xD7AF {
+		return "Korean"
+	}
+
+	// Korean Hangul Jamo
+	if r >= 0x1100 && r <= 0x11FF {
+		return "Korean"
+	}
+
+	// Korean Hangul Compatibility Jamo
+	if r >= 0x3130 && r <= 0x318F {
+		return "Korean"
+	}
+
+	// Korean Hangul Jamo Extended-A
+	if r >= 0xA960 && r <= 0xA97F {
+		return "Korean"
+	}
+
+	// Korean Hangul Jamo Extended-B
+	if r >= 0xD7B0 && r <= 0xD7FF {
+		return "Korean"
+	}
+
+	// Vietnamese (Latin with diacritics)
+	if r >= 0x1EA0 && r <= 0x1EFF {
+		return "Vietnamese"
+	}
+
+	// Armenian
+	if r >= 0x0530 && r <= 0x058F {
+		return "Armenian"
+	}
+
+	// Georgian
+	if r >= 0x10A0 && r <= 0x10FF {
+		return "Georgian"
+	}
+
+	// Ethiopic
+	if r >= 0x1200 && r <= 0x137F {
+		return "Ethiopic"
+	}
+
+	// Mongolian
+	if r >= 0x1800 && r <= 0x18AF {
+		return "Mongolian"
+	}
+
+	// Tibetan
+	if r >= 0x0F00 && r <= 0x0FFF {
+		return "Tibetan"
+	}
+
+	// Khmer
+	if r >= 0x1780 && r <= 0x17FF {
+		return "Khmer"
+	}
+
+	// Lao
+	if r >= 0x0E80 && r <= 0x0EFF {
+		return "Lao"
+	}
+
+	// Myanmar
+	if r >= 0x1000 && r <= 0x109F {
+		return "Myanmar"
+	}
+
+	// Sinhala
+	if r >= 0x0D80 && r <= 0x0DFF {
+		return "Sinhala"
+	}
+
+	// Malayalam
+	if r >= 0x0D00 && r <= 0x0D7F {
+		return "Malayalam"
+	}
+
+	// Telugu
+	if r >= 0x0C00 && r <= 0x0C7F {
+		return "Telugu"
+	}
+
+	// Kannada
+	if r >= 0x0C80 && r <= 0x0CFF {
+		return "Kannada"
+	}
+
+	// Gujarati
+	if r >= 0x0A80 && r <= 0x0AFF {
+		return "Gujarati"
+	}
+
+	// Gurmukhi
+	if r >= 0x0A00 && r <= 0x0A7F {
+		return "Gurmukhi"
+	}
+
+	// Oriya
+	if r >= 0x0B00 && r <= 0x0B7F {
+		return "Oriya"
+	}
+
+	// Bengali
+	if r >= 0x0980 && r <= 0x09FF {
+		return "Bengali"
+	}
+
+	// Devanagari
+	if r >= 0x0900 && r <= 0x097F {
+		return "Devanagari"
+	}
+
+	// Tamil
+	if r >= 0x0B80 && r <= 0x0BFF {
+		return "Tamil"
+	}
+
+	// Thai
+	if r >= 0x0E00 && r <= 0x0E7F {
+		return "Thai"
+	}
+
+	// Lao
+	if r >= 0x0E80 && r <= 0x0EFF {
+		return "Lao"
+	}
+
+	// Khmer
+	if r >= 0x1780 && r <= 0x17FF {
+		return "Khmer"
+	}
+
+	// Myanmar
+	if r >= 0x1000 && r <= 0x109F {
+		return "Myanmar"
+	}
+
+	// Sinhala
+	if r >= 0x0D80 && r <= 0x0DFF {
+		return "Sinhala"
+	}
+
+	// Default to Latin for other extended Latin characters
+	if r >= 0x0250 && r <= 0x02AF {
+		return "Latin"
+	}
+
+	// Default to Other for unrecognized characters
+	return "Other"
+}
@@ -1,973 +1,9 @@
-package controllers
+package services
 
 import (
 	"testing"
 )
 
-func TestNormalizeEmail(t *testing.T) {
-	tests := []struct {
-		name     string
-		input    string
-		expected string
-	}{
-		// Empty and invalid cases
-		{
-			name:     "empty email",
-			input:    "",
-			expected: "",
-		},
-		{
-			name:     "invalid email format - no @",
-			input:    "testgmail.com",
-			expected: "testgmail.com",
-		},
-		{
-			name:     "invalid email format - multiple @",
-			input:    "test@gmail@com",
-			expected: "test@gmail@com",
-		},
-		{
-			name:     "invalid email format - only @",
-			input:    "@gmail.com",
-			expected: "@gmail.com",
-		},
-
-		// Non-Gmail domains - should remain unchanged
-		{
-			name:     "non-gmail domain - yahoo",
-			input:    "test@yahoo.com",
-			expected: "test@yahoo.com",
-		},
-		{
-			name:     "non-gmail domain - hotmail",
-			input:    "test@hotmail.com",
-			expected: "test@hotmail.com",
-		},
-		{
-			name:     "non-gmail domain - custom domain",
-			input:    "test@example.com",
-			expected: "test@example.com",
-		},
-		{
-			name:     "non-gmail domain with dots",
-			input:    "t.e.s.t@example.com",
-			expected: "t.e.s.t@example.com",
-		},
-
-		// Gmail domains - dots should be removed from local part
-		{
-			name:     "gmail.com - no dots",
-			input:    "test@gmail.com",
-			expected: "test@gmail.com",
-		},
-		{
-			name:     "gmail.com - with dots",
-			input:    "t.e.s.t@gmail.com",
-			expected: "test@gmail.com",
-		},
-		{
-			name:     "gmail.com - multiple dots",
-			input:    "t.e.s.t.e.s.t@gmail.com",
-			expected: "testest@gmail.com",
-		},
-		{
-			name:     "gmail.com - dots at start and end",
-			input:    ".test.@gmail.com",
-			expected: "test@gmail.com",
-		},
-		{
-			name:     "gmail.com - only dots",
-			input:    "....@gmail.com",
-			expected: "@gmail.com",
-		},
-
-		// Gmail country domains - should also normalize
-		{
-			name:     "gmail.de - with dots",
-			input:    "t.e.s.t@gmail.de",
-			expected: "test@gmail.de",
-		},
-		{
-			name:     "gmail.co.uk - with dots",
-			input:    "t.e.s.t@gmail.co.uk",
-			expected: "test@gmail.co.uk",
-		},
-		{
-			name:     "gmail.fr - with dots",
-			input:    "t.e.s.t@gmail.fr",
-			expected: "test@gmail.fr",
-		},
-		{
-			name:     "gmail.it - with dots",
-			input:    "t.e.s.t@gmail.it",
-			expected: "test@gmail.it",
-		},
-		{
-			name:     "gmail.es - with dots",
-			input:    "t.e.s.t@gmail.es",
-			expected: "test@gmail.es",
-		},
-		{
-			name:     "gmail.nl - with dots",
-			input:    "t.e.s.t@gmail.nl",
-			expected: "test@gmail.nl",
-		},
-		{
-			name:     "gmail.se - with dots",
-			input:    "t.e.s.t@gmail.se",
-			expected: "test@gmail.se",
-		},
-		{
-			name:     "gmail.no - with dots",
-			input:    "t.e.s.t@gmail.no",
-			expected: "test@gmail.no",
-		},
-		{
-			name:     "gmail.dk - with dots",
-			input:    "t.e.s.t@gmail.dk",
-			expected: "test@gmail.dk",
-		},
-		{
-			name:     "gmail.fi - with dots",
-			input:    "t.e.s.t@gmail.fi",
-			expected: "test@gmail.fi",
-		},
-		{
-			name:     "gmail.pl - with dots",
-			input:    "t.e.s.t@gmail.pl",
-			expected: "test@gmail.pl",
-		},
-		{
-			name:     "gmail.cz - with dots",
-			input:    "t.e.s.t@gmail.cz",
-			expected: "test@gmail.cz",
-		},
-		{
-			name:     "gmail.hu - with dots",
-			input:    "t.e.s.t@gmail.hu",
-			expected: "test@gmail.hu",
-		},
-		{
-			name:     "gmail.ro - with dots",
-			input:    "t.e.s.t@gmail.ro",
-			expected: "test@gmail.ro",
-		},
-		{
-			name:     "gmail.bg - with dots",
-			input:    "t.e.s.t@gmail.bg",
-			expected: "test@gmail.bg",
-		},
-		{
-			name:     "gmail.hr - with dots",
-			input:    "t.e.s.t@gmail.hr",
-			expected: "test@gmail.hr",
-		},
-		{
-			name:     "gmail.si - with dots",
-			input:    "t.e.s.t@gmail.si",
-			expected: "test@gmail.si",
-		},
-		{
-			name:     "gmail.sk - with dots",
-			input:    "t.e.s.t@gmail.sk",
-			expected: "test@gmail.sk",
-		},
-		{
-			name:     "gmail.lt - with dots",
-			input:    "t.e.s.t@gmail.lt",
-			expected: "test@gmail.lt",
-		},
-		{
-			name:     "gmail.lv - with dots",
-			input:    "t.e.s.t@gmail.lv",
-			expected: "test@gmail.lv",
-		},
-		{
-			name:     "gmail.ee - with dots",
-			input:    "t.e.s.t@gmail.ee",
-			expected: "test@gmail.ee",
-		},
-		{
-			name:     "gmail.pt - with dots",
-			input:    "t.e.s.t@gmail.pt",
-			expected: "test@gmail.pt",
-		},
-		{
-			name:     "gmail.gr - with dots",
-			input:    "t.e.s.t@gmail.gr",
-			expected: "test@gmail.gr",
-		},
-		{
-			name:     "gmail.at - with dots",
-			input:    "t.e.s.t@gmail.at",
-			expected: "test@gmail.at",
-		},
-		{
-			name:     "gmail.ch - with dots",
-			input:    "t.e.s.t@gmail.ch",
-			expected: "test@gmail.ch",
-		},
-		{
-			name:     "gmail.be - with dots",
-			input:    "t.e.s.t@gmail.be",
-			expected: "test@gmail.be",
-		},
-		{
-			name:     "gmail.lu - with dots",
-			input:    "t.e.s.t@gmail.lu",
-			expected: "test@gmail.lu",
-		},
-		{
-			name:     "gmail.ie - with dots",
-			input:    "t.e.s.t@gmail.ie",
-			expected: "test@gmail.ie",
-		},
-		{
-			name:     "gmail.mt - with dots",
-			input:    "t.e.s.t@gmail.mt",
-			expected: "test@gmail.mt",
-		},
-		{
-			name:     "gmail.cy - with dots",
-			input:    "t.e.s.t@gmail.cy",
-			expected: "test@gmail.cy",
-		},
-		{
-			name:     "gmail.is - with dots",
-			input:    "t.e.s.t@gmail.is",
-			expected: "test@gmail.is",
-		},
-		{
-			name:     "gmail.li - with dots",
-			input:    "t.e.s.t@gmail.li",
-			expected: "test@gmail.li",
-		},
-		{
-			name:     "gmail.mc - with dots",
-			input:    "t.e.s.t@gmail.mc",
-			expected: "test@gmail.mc",
-		},
-		{
-			name:     "gmail.ad - with dots",
-			input:    "t.e.s.t@gmail.ad",
-			expected: "test@gmail.ad",
-		},
-		{
-			name:     "gmail.va - with dots",
-			input:    "t.e.s.t@gmail.va",
-			expected: "test@gmail.va",
-		},
-		{
-			name:     "gmail.sm - with dots",
-			input:    "t.e.s.t@gmail.sm",
-			expected: "test@gmail.sm",
-		},
-		{
-			name:     "gmail.by - with dots",
-			input:    "t.e.s.t@gmail.by",
-			expected: "test@gmail.by",
-		},
-		{
-			name:     "gmail.md - with dots",
-			input:    "t.e.s.t@gmail.md",
-			expected: "test@gmail.md",
-		},
-		{
-			name:     "gmail.ua - with dots",
-			input:    "t.e.s.t@gmail.ua",
-			expected: "test@gmail.ua",
-		},
-		{
-			name:     "gmail.ge - with dots",
-			input:    "t.e.s.t@gmail.ge",
-			expected: "test@gmail.ge",
-		},
-		{
-			name:     "gmail.am - with dots",
-			input:    "t.e.s.t@gmail.am",
-			expected: "test@gmail.am",
-		},
-		{
-			name:     "gmail.az - with dots",
-			input:    "t.e.s.t@gmail.az",
-			expected: "test@gmail.az",
-		},
-		{
-			name:     "gmail.kz - with dots",
-			input:    "t.e.s.t@gmail.kz",
-			expected: "test@gmail.kz",
-		},
-		{
-			name:     "gmail.kg - with dots",
-			input:    "t.e.s.t@gmail.kg",
-			expected: "test@gmail.kg",
-		},
-		{
-			name:     "gmail.tj - with dots",
-			input:    "t.e.s.t@gmail.tj",
-			expected: "test@gmail.tj",
-		},
-		{
-			name:     "gmail.tm - with dots",
-			input:    "t.e.s.t@gmail.tm",
-			expected: "test@gmail.tm",
-		},
-		{
-			name:     "gmail.uz - with dots",
-			input:    "t.e.s.t@gmail.uz",
-			expected: "test@gmail.uz",
-		},
-		{
-			name:     "gmail.mn - with dots",
-			input:    "t.e.s.t@gmail.mn",
-			expected: "test@gmail.mn",
-		},
-		{
-			name:     "gmail.kr - with dots",
-			input:    "t.e.s.t@gmail.kr",
-			expected: "test@gmail.kr",
-		},
-		{
-			name:     "gmail.jp - with dots",
-			input:    "t.e.s.t@gmail.jp",
-			expected: "test@gmail.jp",
-		},
-		{
-			name:     "gmail.cn - with dots",
-			input:    "t.e.s.t@gmail.cn",
-			expected: "test@gmail.cn",
-		},
-		{
-			name:     "gmail.hk - with dots",
-			input:    "t.e.s.t@gmail.hk",
-			expected: "test@gmail.hk",
-		},
-		{
-			name:     "gmail.tw - with dots",
-			input:    "t.e.s.t@gmail.tw",
-			expected: "test@gmail.tw",
-		},
-		{
-			name:     "gmail.sg - with dots",
-			input:    "t.e.s.t@gmail.sg",
-			expected: "test@gmail.sg",
-		},
-		{
-			name:     "gmail.my - with dots",
-			input:    "t.e.s.t@gmail.my",
-			expected: "test@gmail.my",
-		},
-		{
-			name:     "gmail.th - with dots",
-			input:    "t.e.s.t@gmail.th",
-			expected: "test@gmail.th",
-		},
-		{
-			name:     "gmail.vn - with dots",
-			input:    "t.e.s.t@gmail.vn",
-			expected: "test@gmail.vn",
-		},
-		{
-			name:     "gmail.ph - with dots",
-			input:    "t.e.s.t@gmail.ph",
-			expected: "test@gmail.ph",
-		},
-		{
-			name:     "gmail.id - with dots",
-			input:    "t.e.s.t@gmail.id",
-			expected: "test@gmail.id",
-		},
-		{
-			name:     "gmail.in - with dots",
-			input:    "t.e.s.t@gmail.in",
-			expected: "test@gmail.in",
-		},
-		{
-			name:     "gmail.pk - with dots",
-			input:    "t.e.s.t@gmail.pk",
-			expected: "test@gmail.pk",
-		},
-		{
-			name:     "gmail.bd - with dots",
-			input:    "t.e.s.t@gmail.bd",
-			expected: "test@gmail.bd",
-		},
-		{
-			name:     "gmail.lk - with dots",
-			input:    "t.e.s.t@gmail.lk",
-			expected: "test@gmail.lk",
-		},
-		{
-			name:     "gmail.np - with dots",
-			input:    "t.e.s.t@gmail.np",
-			expected: "test@gmail.np",
-		},
-		{
-			name:     "gmail.mm - with dots",
-			input:    "t.e.s.t@gmail.mm",
-			expected: "test@gmail.mm",
-		},
-		{
-			name:     "gmail.kh - with dots",
-			input:    "t.e.s.t@gmail.kh",
-			expected: "test@gmail.kh",
-		},
-		{
-			name:     "gmail.la - with dots",
-			input:    "t.e.s.t@gmail.la",
-			expected: "test@gmail.la",
-		},
-		{
-			name:     "gmail.br - with dots",
-			input:    "t.e.s.t@gmail.br",
-			expected: "test@gmail.br",
-		},
-		{
-			name:     "gmail.ar - with dots",
-			input:    "t.e.s.t@gmail.ar",
-			expected: "test@gmail.ar",
-		},
-		{
-			name:     "gmail.cl - with dots",
-			input:    "t.e.s.t@gmail.cl",
-			expected: "test@gmail.cl",
-		},
-		{
-			name:     "gmail.co - with dots",
-			input:    "t.e.s.t@gmail.co",
-			expected: "test@gmail.co",
-		},
-		{
-			name:     "gmail.pe - with dots",
-			input:    "t.e.s.t@gmail.pe",
-			expected: "test@gmail.pe",
-		},
-		{
-			name:     "gmail.ve - with dots",
-			input:    "t.e.s.t@gmail.ve",
-			expected: "test@gmail.ve",
-		},
-		{
-			name:     "gmail.ec - with dots",
-			input:    "t.e.s.t@gmail.ec",
-			expected: "test@gmail.ec",
-		},
-		{
-			name:     "gmail.bo - with dots",
-			input:    "t.e.s.t@gmail.bo",
-			expected: "test@gmail.bo",
-		},
-		{
-			name:     "gmail.py - with dots",
-			input:    "t.e.s.t@gmail.py",
-			expected: "test@gmail.py",
-		},
-		{
-			name:     "gmail.uy - with dots",
-			input:    "t.e.s.t@gmail.uy",
-			expected: "test@gmail.uy",
-		},
-		{
-			name:     "gmail.gy - with dots",
-			input:    "t.e.s.t@gmail.gy",
-			expected: "test@gmail.gy",
-		},
-		{
-			name:     "gmail.sr - with dots",
-			input:    "t.e.s.t@gmail.sr",
-			expected: "test@gmail.sr",
-		},
-		{
-			name:     "gmail.gf - with dots",
-			input:    "t.e.s.t@gmail.gf",
-			expected: "test@gmail.gf",
-		},
-		{
-			name:     "gmail.mx - with dots",
-			input:    "t.e.s.t@gmail.mx",
-			expected: "test@gmail.mx",
-		},
-		{
-			name:     "gmail.ca - with dots",
-			input:    "t.e.s.t@gmail.ca",
-			expected: "test@gmail.ca",
-		},
-		{
-			name:     "gmail.us - with dots",
-			input:    "t.e.s.t@gmail.us",
-			expected: "test@gmail.us",
-		},
-		{
-			name:     "gmail.au - with dots",
-			input:    "t.e.s.t@gmail.au",
-			expected: "test@gmail.au",
-		},
-		{
-			name:     "gmail.nz - with dots",
-			input:    "t.e.s.t@gmail.nz",
-			expected: "test@gmail.nz",
-		},
-		{
-			name:     "gmail.fj - with dots",
-			input:    "t.e.s.t@gmail.fj",
-			expected: "test@gmail.fj",
-		},
-		{
-			name:     "gmail.pg - with dots",
-			input:    "t.e.s.t@gmail.pg",
-			expected: "test@gmail.pg",
-		},
-		{
-			name:     "gmail.sb - with dots",
-			input:    "t.e.s.t@gmail.sb",
-			expected: "test@gmail.sb",
-		},
-		{
-			name:     "gmail.vu - with dots",
-			input:    "t.e.s.t@gmail.vu",
-			expected: "test@gmail.vu",
-		},
-		{
-			name:     "gmail.nc - with dots",
-			input:    "t.e.s.t@gmail.nc",
-			expected: "test@gmail.nc",
-		},
-		{
-			name:     "gmail.pf - with dots",
-			input:    "t.e.s.t@gmail.pf",
-			expected: "test@gmail.pf",
-		},
-		{
-			name:     "gmail.ws - with dots",
-			input:    "t.e.s.t@gmail.ws",
-			expected: "test@gmail.ws",
-		},
-		{
-			name:     "gmail.to - with dots",
-			input:    "t.e.s.t@gmail.to",
-			expected: "test@gmail.to",
-		},
-		{
-			name:     "gmail.ck - with dots",
-			input:    "t.e.s.t@gmail.ck",
-			expected: "test@gmail.ck",
-		},
-		{
-			name:     "gmail.nu - with dots",
-			input:    "t.e.s.t@gmail.nu",
-			expected: "test@gmail.nu",
-		},
-		{
-			name:     "gmail.tk - with dots",
-			input:    "t.e.s.t@gmail.tk",
-			expected: "test@gmail.tk",
-		},
-		{
-			name:     "gmail.wf - with dots",
-			input:    "t.e.s.t@gmail.wf",
-			expected: "test@gmail.wf",
-		},
-		{
-			name:     "gmail.as - with dots",
-			input:    "t.e.s.t@gmail.as",
-			expected: "test@gmail.as",
-		},
-		{
-			name:     "gmail.gu - with dots",
-			input:    "t.e.s.t@gmail.gu",
-			expected: "test@gmail.gu",
-		},
-		{
-			name:     "gmail.mp - with dots",
-			input:    "t.e.s.t@gmail.mp",
-			expected: "test@gmail.mp",
-		},
-		{
-			name:     "gmail.pr - with dots",
-			input:    "t.e.s.t@gmail.pr",
-			expected: "test@gmail.pr",
-		},
-		{
-			name:     "gmail.vi - with dots",
-			input:    "t.e.s.t@gmail.vi",
-			expected: "test@gmail.vi",
-		},
-		{
-			name:     "gmail.um - with dots",
-			input:    "t.e.s.t@gmail.um",
-			expected: "test@gmail.um",
-		},
-		{
-			name:     "gmail.af - with dots",
-			input:    "t.e.s.t@gmail.af",
-			expected: "test@gmail.af",
-		},
-		{
-			name:     "gmail.ir - with dots",
-			input:    "t.e.s.t@gmail.ir",
-			expected: "test@gmail.ir",
-		},
-		{
-			name:     "gmail.iq - with dots",
-			input:    "t.e.s.t@gmail.iq",
-			expected: "test@gmail.iq",
-		},
-		{
-			name:     "gmail.sa - with dots",
-			input:    "t.e.s.t@gmail.sa",
-			expected: "test@gmail.sa",
-		},
-		{
-			name:     "gmail.ae - with dots",
-			input:    "t.e.s.t@gmail.ae",
-			expected: "test@gmail.ae",
-		},
-		{
-			name:     "gmail.om - with dots",
-			input:    "t.e.s.t@gmail.om",
-			expected: "test@gmail.om",
-		},
-		{
-			name:     "gmail.qa - with dots",
-			input:    "t.e.s.t@gmail.qa",
-			expected: "test@gmail.qa",
-		},
-		{
-			name:     "gmail.bh - with dots",
-			input:    "t.e.s.t@gmail.bh",
-			expected: "test@gmail.bh",
-		},
-		{
-			name:     "gmail.kw - with dots",
-			input:    "t.e.s.t@gmail.kw",
-			expected: "test@gmail.kw",
-		},
-		{
-			name:     "gmail.ye - with dots",
-			input:    "t.e.s.t@gmail.ye",
-			expected: "test@gmail.ye",
-		},
-		{
-			name:     "gmail.jo - with dots",
-			input:    "t.e.s.t@gmail.jo",
-			expected: "test@gmail.jo",
-		},
-		{
-			name:     "gmail.lb - with dots",
-			input:    "t.e.s.t@gmail.lb",
-			expected: "test@gmail.lb",
-		},
-		{
-			name:     "gmail.sy - with dots",
-			input:    "t.e.s.t@gmail.sy",
-			expected: "test@gmail.sy",
-		},
-		{
-			name:     "gmail.il - with dots",
-			input:    "t.e.s.t@gmail.il",
-			expected: "test@gmail.il",
-		},
-		{
-			name:     "gmail.ps - with dots",
-			input:    "t.e.s.t@gmail.ps",
-			expected: "test@gmail.ps",
-		},
-		{
-			name:     "gmail.eg - with dots",
-			input:    "t.e.s.t@gmail.eg",
-			expected: "test@gmail.eg",
-		},
-		{
-			name:     "gmail.ly - with dots",
-			input:    "t.e.s.t@gmail.ly",
-			expected: "test@gmail.ly",
-		},
-		{
-			name:     "gmail.tn - with dots",
-			input:    "t.e.s.t@gmail.tn",
-			expected: "test@gmail.tn",
-		},
-		{
-			name:     "gmail.dz - with dots",
-			input:    "t.e.s.t@gmail.dz",
-			expected: "test@gmail.dz",
-		},
-		{
-			name:     "gmail.ma - with dots",
-			input:    "t.e.s.t@gmail.ma",
-			expected: "test@gmail.ma",
-		},
-		{
-			name:     "gmail.mr - with dots",
-			input:    "t.e.s.t@gmail.mr",
-			expected: "test@gmail.mr",
-		},
-		{
-			name:     "gmail.sn - with dots",
-			input:    "t.e.s.t@gmail.sn",
-			expected: "test@gmail.sn",
-		},
-		{
-			name:     "gmail.gm - with dots",
-			input:    "t.e.s.t@gmail.gm",
-			expected: "test@gmail.gm",
-		},
-		{
-			name:     "gmail.gw - with dots",
-			input:    "t.e.s.t@gmail.gw",
-			expected: "test@gmail.gw",
-		},
-		{
-			name:     "gmail.gn - with dots",
-			input:    "t.e.s.t@gmail.gn",
-			expected: "test@gmail.gn",
-		},
-		{
-			name:     "gmail.sl - with dots",
-			input:    "t.e.s.t@gmail.sl",
-			expected: "test@gmail.sl",
-		},
-		{
-			name:     "gmail.lr - with dots",
-			input:    "t.e.s.t@gmail.lr",
-			expected: "test@gmail.lr",
-		},
-		{
-			name:     "gmail.ci - with dots",
-			input:    "t.e.s.t@gmail.ci",
-			expected: "test@gmail.ci",
-		},
-		{
-			name:     "gmail.gh - with dots",
-			input:    "t.e.s.t@gmail.gh",
-			expected: "test@gmail.gh",
-		},
-		{
-			name:     "gmail.tg - with dots",
-			input:    "t.e.s.t@gmail.tg",
-			expected: "test@gmail.tg",
-		},
-		{
-			name:     "gmail.bj - with dots",
-			input:    "t.e.s.t@gmail.bj",
-			expected: "test@gmail.bj",
-		},
-		{
-			name:     "gmail.ne - with dots",
-			input:    "t.e.s.t@gmail.ne",
-			expected: "test@gmail.ne",
-		},
-		{
-			name:     "gmail.bf - with dots",
-			input:    "t.e.s.t@gmail.bf",
-			expected: "test@gmail.bf",
-		},
-		{
-			name:     "gmail.ml - with dots",
-			input:    "t.e.s.t@gmail.ml",
-			expected: "test@gmail.ml",
-		},
-		{
-			name:     "gmail.cf - with dots",
-			input:    "t.e.s.t@gmail.cf",
-			expected: "test@gmail.cf",
-		},
-		{
-			name:     "gmail.cm - with dots",
-			input:    "t.e.s.t@gmail.cm",
-			expected: "test@gmail.cm",
-		},
-		{
-			name:     "gmail.td - with dots",
-			input:    "t.e.s.t@gmail.td",
-			expected: "test@gmail.td",
-		},
-		{
-			name:     "gmail.cg - with dots",
-			input:    "t.e.s.t@gmail.cg",
-			expected: "test@gmail.cg",
-		},
-		{
-			name:     "gmail.ga - with dots",
-			input:    "t.e.s.t@gmail.ga",
-			expected: "test@gmail.ga",
-		},
-		{
-			name:     "gmail.gq - with dots",
-			input:    "t.e.s.t@gmail.gq",
-			expected: "test@gmail.gq",
-		},
-		{
-			name:     "gmail.st - with dots",
-			input:    "t.e.s.t@gmail.st",
-			expected: "test@gmail.st",
-		},
-		{
-			name:     "gmail.ao - with dots",
-			input:    "t.e.s.t@gmail.ao",
-			expected: "test@gmail.ao",
-		},
-		{
-			name:     "gmail.cd - with dots",
-			input:    "t.e.s.t@gmail.cd",
-			expected: "test@gmail.cd",
-		},
-		{
-			name:     "gmail.zr - with dots",
-			input:    "t.e.s.t@gmail.zr",
-			expected: "test@gmail.zr",
-		},
-		{
-			name:     "gmail.rw - with dots",
-			input:    "t.e.s.t@gmail.rw",
-			expected: "test@gmail.rw",
-		},
-		{
-			name:     "gmail.bi - with dots",
-			input:    "t.e.s.t@gmail.bi",
-			expected: "test@gmail.bi",
-		},
-		{
-			name:     "gmail.mw - with dots",
-			input:    "t.e.s.t@gmail.mw",
-			expected: "test@gmail.mw",
-		},
-		{
-			name:     "gmail.zm - with dots",
-			input:    "t.e.s.t@gmail.zm",
-			expected: "test@gmail.zm",
-		},
-		{
-			name:     "gmail.zw - with dots",
-			input:    "t.e.s.t@gmail.zw",
-			expected: "test@gmail.zw",
-		},
-		{
-			name:     "gmail.na - with dots",
-			input:    "t.e.s.t@gmail.na",
-			expected: "test@gmail.na",
-		},
-		{
-			name:     "gmail.bw - with dots",
-			input:    "t.e.s.t@gmail.bw",
-			expected: "test@gmail.bw",
-		},
-		{
-			name:     "gmail.ls - with dots",
-			input:    "t.e.s.t@gmail.ls",
-			expected: "test@gmail.ls",
-		},
-		{
-			name:     "gmail.sz - with dots",
-			input:    "t.e.s.t@gmail.sz",
-			expected: "test@gmail.sz",
-		},
-		{
-			name:     "gmail.ke - with dots",
-			input:    "t.e.s.t@gmail.ke",
-			expected: "test@gmail.ke",
-		},
-		{
-			name:     "gmail.tz - with dots",
-			input:    "t.e.s.t@gmail.tz",
-			expected: "test@gmail.tz",
-		},
-		{
-			name:     "gmail.ug - with dots",
-			input:    "t.e.s.t@gmail.ug",
-			expected: "test@gmail.ug",
-		},
-		{
-			name:     "gmail.et - with dots",
-			input:    "t.e.s.t@gmail.et",
-			expected: "test@gmail.et",
-		},
-		{
-			name:     "gmail.so - with dots",
-			input:    "t.e.s.t@gmail.so",
-			expected: "test@gmail.so",
-		},
-		{
-			name:     "gmail.dj - with dots",
-			input:    "t.e.s.t@gmail.dj",
-			expected: "test@gmail.dj",
-		},
-		{
-			name:     "gmail.km - with dots",
-			input:    "t.e.s.t@gmail.km",
-			expected: "test@gmail.km",
-		},
-		{
-			name:     "gmail.mg - with dots",
-			input:    "t.e.s.t@gmail.mg",
-			expected: "test@gmail.mg",
-		},
-		{
-			name:     "gmail.mu - with dots",
-			input:    "t.e.s.t@gmail.mu",
-			expected: "test@gmail.mu",
-		},
-		{
-			name:     "gmail.sc - with dots",
-			input:    "t.e.s.t@gmail.sc",
-			expected: "test@gmail.sc",
-		},
-		{
-			name:     "gmail.re - with dots",
-			input:    "t.e.s.t@gmail.re",
-			expected: "test@gmail.re",
-		},
-		{
-			name:     "gmail.yt - with dots",
-			input:    "t.e.s.t@gmail.yt",
-			expected: "test@gmail.yt",
-		},
-
-		// Case sensitivity tests
-		{
-			name:     "gmail.com - uppercase",
-			input:    "TEST@GMAIL.COM",
-			expected: "test@gmail.com",
-		},
-		{
-			name:     "gmail.com - mixed case",
-			input:    "Test@Gmail.Com",
-			expected: "test@gmail.com",
-		},
-		{
-			name:     "gmail.com - uppercase with dots",
-			input:    "T.E.S.T@GMAIL.COM",
-			expected: "test@gmail.com",
-		},
-
-		// Edge cases
-		{
-			name:     "gmail.com - single character",
-			input:    "a@gmail.com",
-			expected: "a@gmail.com",
-		},
-		{
-			name:     "gmail.com - single character with dots",
-			input:    "a.b.c@gmail.com",
-			expected: "abc@gmail.com",
-		},
-		{
-			name:     "gmail.com - very long local part",
-			input:    "very.long.email.address.with.many.dots@gmail.com",
-			expected: "verylongemailaddresswithmanydots@gmail.com",
-		},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			result := normalizeEmail(tt.input)
-			if result != tt.expected {
-				t.Errorf("normalizeEmail(%q) = %q, want %q", tt.input, result, tt.expected)
-			}
-		})
-	}
-}
-
 func TestGetFieldValue(t *testing.T) {
 	tests := []struct {
 		name      string
@@ -0,0 +1,192 @@
+package services
+
+import (
+	"context"
+	"firewall/models"
+	"firewall/utils"
+	"net/netip"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// compositeCondition is a compiled field condition of a composite rule
+type compositeCondition struct {
+	field   string
+	match   string // "exact", "regex", "cidr" or "in"
+	value   string
+	values  map[string]bool
+	regex   *regexp.Regexp
+	ipRange utils.IPRange
+}
+
+// newCompositeCondition compiles a condition; it returns nil if the condition is invalid
+func newCompositeCondition(c models.CompositeCondition) *compositeCondition {
+	cond := &compositeCondition{field: strings.TrimSpace(c.Field), match: c.Match, value: c.Value}
+	if cond.field == "" {
+		return nil
+	}
+	switch c.Match {
+	case "exact":
+		if c.Value == "" {
+			return nil
+		}
+	case "regex":
+		regex, err := regexp.Compile(c.Value)
+		if err != nil {
+			return nil
+		}
+		cond.regex = regex
+	case "cidr":
+		ipRange, err := utils.ParseIPRange(c.Value)
+		if err != nil {
+			return nil
+		}
+		cond.ipRange = ipRange
+	case "in":
+		if len(c.Values) == 0 {
+			return nil
+		}
+		cond.values = make(map[string]bool, len(c.Values))
+		for _, v := range c.Values {
+			cond.values[strings.ToLower(strings.TrimSpace(v))] = true
+		}
+	default:
+		return nil
+	}
+	return cond
+}
+
+// matches checks the condition against the (resolved) input; exact and in conditions ignore case
+func (c *compositeCondition) matches(input *FilterInput) bool {
+	value := input.Value(c.field)
+	if value == "" {
+		return false
+	}
+	switch c.match {
+	case "exact":
+		return strings.EqualFold(value, c.value)
+	case "regex":
+		return c.regex.MatchString(value)
+	case "cidr":
+		addr, err := netip.ParseAddr(value)
+		return err == nil && c.ipRange.Contains(addr)
+	case "in":
+		return c.values[strings.ToLower(value)]
+	}
+	return false
+}
+
+// compositeRule is a compiled composite rule: its conditions joined by AND or OR
+type compositeRule struct {
+	*compiledRule
+	or         bool
+	conditions []*compositeCondition
+}
+
+// newCompositeRule compiles a composite rule; it returns nil if any condition is invalid
+func newCompositeRule(r models.CompositeRule) *compositeRule {
+	if len(r.Conditions) == 0 {
+		return nil
+	}
+	rule := &compositeRule{
+		compiledRule: &compiledRule{ID: r.ID, Value: r.Name, Status: r.Status, Priority: r.Priority, Type: "composite"},
+		or:           strings.EqualFold(r.Operator, "or"),
+	}
+	for _, c := range r.Conditions {
+		cond := newCompositeCondition(c)
+		if cond == nil {
+			return nil
+		}
+		rule.conditions = append(rule.conditions, cond)
+	}
+	return rule
+}
+
+// matches evaluates the conditions and returns the fields of the matching ones
+func (r *compositeRule) matches(input *FilterInput) ([]string, bool) {
+	var fields []string
+	for _, cond := range r.conditions {
+		if cond.matches(input) {
+			fields = append(fields, cond.field)
+			if r.or {
+				return fields, true
+			}
+		} else if !r.or {
+			return nil, false
+		}
+	}
+	return fields, !r.or
+}
+
+// compositeIndex holds the composite rules of a snapshot, ordered by precedence
+type compositeIndex struct {
+	rules []*compositeRule
+}
+
+func (ci *compositeIndex) add(rule *compositeRule) bool {
+	if rule == nil {
+		return false
+	}
+	ci.rules = append(ci.rules, rule)
+	return true
+}
+
+func (ci *compositeIndex) sort() {
+	sort.SliceStable(ci.rules, func(i, j int) bool {
+		return ci.rules[i].outranks(ci.rules[j].compiledRule)
+	})
+}
+
+// fields returns the request fields used by the rules
+func (ci *compositeIndex) fields() []string {
+	seen := make(map[string]bool)
+	var fields []string
+	for _, rule := range ci.rules {
+		for _, cond := range rule.conditions {
+			if !seen[cond.field] {
+				seen[cond.field] = true
+				fields = append(fields, cond.field)
+			}
+		}
+	}
+	return fields
+}
+
+// match returns the highest ranked matching rule and the fields of its matching conditions
+func (ci *compositeIndex) match(input *FilterInput) (*compositeRule, []string) {
+	for _, rule := range ci.rules {
+		if fields, ok := rule.matches(input); ok {
+			return rule, fields
+		}
+	}
+	return nil, nil
+}
+
+func (ci *compositeIndex) len() int {
+	return len(ci.rules)
+}
+
+// compositeFilter runs the composite rules; country and asn are resolved before the filters run
+type compositeFilter struct{}
+
+func (compositeFilter) Name() string { return "composite" }
+
+// Fields returns the fields used by the current composite rules; without rules the filter does not run
+func (compositeFilter) Fields() []string {
+	snapshot := GetRuleEngine().Snapshot()
+	return append(snapshot.composite.fields(), snapshot.Monitor().composite.fields()...)
+}
+
+func (compositeFilter) Evaluate(ctx context.Context, input *FilterInput) FilterResult {
+	snapshot := GetRuleEngine().Snapshot()
+
+	result := FilterResult{Result: "allowed", Field: "composite"}
+	if rule, fields := snapshot.composite.match(input); rule != nil {
+		result = ruleResult(rule.compiledRule, strings.Join(fields, ","), "composite", rule.Value)
+	}
+	if monitor, fields := snapshot.Monitor().composite.match(input); monitor != nil {
+		result = withMonitorHit(result, monitor.compiledRule, strings.Join(fields, ","), monitor.Value)
+	}
+	return result
+}
@@ -0,0 +1,128 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"firewall/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewCompositeRule(t *testing.T) {
+	rule := newCompositeRule(models.CompositeRule{
+		ID: 1, Name: "curl from XX", Operator: "and", Status: "denied",
+		Conditions: []models.CompositeCondition{
+			{Field: "country", Match: "exact", Value: "XX"},
+			{Field: "user_agent", Match: "regex", Value: "(?i)curl"},
+		},
+	})
+	if assert.NotNil(t, rule) {
+		assert.False(t, rule.or)
+		assert.Len(t, rule.conditions, 2)
+		assert.Equal(t, "composite", rule.Type)
+	}
+
+	invalid := []models.CompositeCondition{
+		{Field: "user_agent", Match: "regex", Value: "([invalid"},
+		{Field: "ip", Match: "cidr", Value: "10.0.0.0/33"},
+		{Field: "asn", Match: "in"},
+		{Field: "country", Match: "prefix", Value: "X"},
+		{Field: "", Match: "exact", Value: "X"},
+	}
+	for _, cond := range invalid {
+		assert.Nil(t, newCompositeRule(models.CompositeRule{ID: 2, Name: "bad", Status: "denied", Conditions: []models.CompositeCondition{cond}}), cond)
+	}
+	assert.Nil(t, newCompositeRule(models.CompositeRule{ID: 3, Name: "empty", Status: "denied"}))
+}
+
+func TestCompositeRule_Matches(t *testing.T) {
+	and := newCompositeRule(models.CompositeRule{
+		ID: 1, Name: "admin from hosting", Status: "denied",
+		Conditions: []models.CompositeCondition{
+			{Field: "username", Match: "regex", Value: "^admin"},
+			{Field: "asn", Match: "in", Values: []string{"AS16509", "AS14061"}},
+			{Field: "ip", Match: "cidr", Value: "203.0.113.0-203.0.113.127"},
+		},
+	})
+	or := newCompositeRule(models.CompositeRule{
+		ID: 2, Name: "suspicious", Operator: "or", Status: "denied",
+		Conditions: []models.CompositeCondition{
+			{Field: "country", Match: "exact", Value: "xx"},
+			{Field: "signup_source", Match: "exact", Value: "bot"},
+		},
+	})
+
+	testCases := []struct {
+		name   string
+		rule   *compositeRule
+		input  *FilterInput
+		match  bool
+		fields []string
+	}{
+		{"and all match", and, &FilterInput{Username: "admin1", ASN: "as16509", IP: "203.0.113.7"}, true, []string{"username", "asn", "ip"}},
+		{"and asn not listed", and, &FilterInput{Username: "admin1", ASN: "AS3320", IP: "203.0.113.7"}, false, nil},
+		{"and ip outside range", and, &FilterInput{Username: "admin1", ASN: "AS16509", IP: "203.0.113.200"}, false, nil},
+		{"and field missing", and, &FilterInput{Username: "admin1", ASN: "AS16509"}, false, nil},
+		{"or first matches", or, &FilterInput{Country: "XX"}, true, []string{"country"}},
+		{"or custom field matches", or, &FilterInput{Country: "DE", Fields: map[string]string{"signup_source": "BOT"}}, true, []string{"signup_source"}},
+		{"or none match", or, &FilterInput{Country: "DE"}, false, nil},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fields, ok := tc.rule.matches(tc.input)
+			assert.Equal(t, tc.match, ok)
+			if tc.match {
+				assert.Equal(t, tc.fields, fields)
+			}
+		})
+	}
+}
+
+func TestEvaluateFilterInput_Composite(t *testing.T) {
+	engine := GetRuleEngine()
+	previous := engine.Snapshot()
+	defer engine.snapshot.Store(previous)
+
+	engine.snapshot.Store(BuildRuleSnapshot(RuleSet{
+		Composites: []models.CompositeRule{
+			{ID: 1, Name: "curl from XX", Status: "denied", Conditions: []models.CompositeCondition{
+				{Field: "country", Match: "exact", Value: "XX"},
+				{Field: "user_agent", Match: "regex", Value: "(?i)curl"},
+			}},
+			{ID: 2, Name: "trusted curl", Status: "whitelisted", Priority: 10, Conditions: []models.CompositeCondition{
+				{Field: "user_agent", Match: "regex", Value: "(?i)curl"},
+				{Field: "username", Match: "in", Values: []string{"deploy"}},
+			}},
+			{ID: 3, Name: "curl anywhere", Status: "monitor", Conditions: []models.CompositeCondition{
+				{Field: "user_agent", Match: "regex", Value: "(?i)curl"},
+			}},
+		},
+	}))
+
+	result, err := EvaluateFilterInput(context.Background(), &FilterInput{Country: "XX", UserAgent: "curl/8.0"})
+	assert.NoError(t, err)
+	assert.Equal(t, "denied", result.Result)
+	assert.Equal(t, "composite denied", result.Reason)
+	assert.Equal(t, "country,user_agent", result.Field)
+	assert.Equal(t, "curl from XX", result.Value)
+	assert.Equal(t, uint(1), result.RuleID)
+
+	// The higher priority rule wins
+	result, err = EvaluateFilterInput(context.Background(), &FilterInput{Country: "XX", UserAgent: "curl/8.0", Username: "deploy"})
+	assert.NoError(t, err)
+	assert.Equal(t, "whitelisted", result.Result)
+	assert.Equal(t, uint(2), result.RuleID)
+
+	// Only one condition of the AND rule matches; the monitor rule still records the request
+	result, err = EvaluateFilterInput(context.Background(), &FilterInput{Country: "DE", UserAgent: "curl/8.0"})
+	assert.NoError(t, err)
+	assert.Equal(t, "allowed", result.Result)
+	if assert.Len(t, result.Trace.Monitor, 1) {
+		assert.Equal(t, "composite", result.Trace.Monitor[0].Filter)
+		assert.Equal(t, uint(3), result.Trace.Monitor[0].RuleID)
+	}
+
+	assert.Equal(t, 2, engine.Snapshot().Stats()["composite"])
+}
@@ -0,0 +1,161 @@
+package services
+
+import (
+	"context"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// contentFilter checks the content field against keyword, phrase and regex content rules
+type contentFilter struct{}
+
+func (contentFilter) Name() string     { return "content" }
+func (contentFilter) Fields() []string { return []string{"content"} }
+
+func (contentFilter) Evaluate(ctx context.Context, input *FilterInput) FilterResult {
+	content := input.Content
+	if content == "" {
+		return FilterResult{Result: "allowed", Reason: "empty content", Field: "content"}
+	}
+
+	// The value of a content result is the matched term, not the whole content
+	snapshot := GetRuleEngine().Snapshot()
+	rule, term := snapshot.MatchContent(content)
+	monitor, monitorTerm := snapshot.Monitor().MatchContent(content)
+	return withMonitorHit(ruleResult(rule, "content", "content", term), monitor, "content", monitorTerm)
+}
+
+// foldLetters maps letters without a canonical decomposition to their ASCII folding
+var foldLetters = map[rune]string{
+	'ß': "ss", 'æ': "ae", 'œ': "oe", 'ø': "o", 'ł': "l", 'đ': "d", 'ð': "d", 'þ': "th", 'ı': "i",
+}
+
+// foldText lower-cases text, removes diacritics (é -> e) and collapses whitespace runs to a single space
+func foldText(s string) string {
+	var b strings.Builder
+	b.Grow(len(s))
+	space := false
+	for _, r := range norm.NFD.String(s) {
+		if unicode.Is(unicode.Mn, r) {
+			continue
+		}
+		if unicode.IsSpace(r) {
+			space = b.Len() > 0
+			continue
+		}
+		if space {
+			b.WriteByte(' ')
+			space = false
+		}
+		r = unicode.ToLower(r)
+		if folded, ok := foldLetters[r]; ok {
+			b.WriteString(folded)
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// isWordBoundary reports whether text[start:end] is not preceded or followed by a letter or digit
+func isWordBoundary(text string, start, end int) bool {
+	if start > 0 {
+		if r, _ := utf8.DecodeLastRuneInString(text[:start]); unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return false
+		}
+	}
+	if end < len(text) {
+		if r, _ := utf8.DecodeRuneInString(text[end:]); unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// contentIndex matches folded content against all keyword and phrase rules in one
+// Aho-Corasick pass, then against the regex rules in precedence order
+type contentIndex struct {
+	terms    []string        // folded keywords and phrases
+	literals []*compiledRule // rule for each term
+	index    map[string]int  // position of each term
+	matcher  *ahoCorasick
+	regexes  []*compiledRule
+}
+
+func newContentIndex() *contentIndex {
+	return &contentIndex{index: make(map[string]int), matcher: newAhoCorasick(nil)}
+}
+
+// add registers a rule; empty patterns and invalid regexes are skipped
+func (ci *contentIndex) add(id uint, pattern, matchType, status string, priority int) bool {
+	rule := &compiledRule{ID: id, Value: pattern, Status: status, Priority: priority, Type: matchType}
+	if matchType == "regex" {
+		// Regexes run case-insensitively against the folded content
+		re, err := regexp.Compile("(?i)" + pattern)
+		if err != nil {
+			return false
+		}
+		rule.regex = re
+		ci.regexes = append(ci.regexes, rule)
+		return true
+	}
+
+	term := foldText(pattern)
+	if term == "" {
+		return false
+	}
+	if i, ok := ci.index[term]; ok {
+		if rule.outranks(ci.literals[i]) {
+			ci.literals[i] = rule
+		}
+		return true
+	}
+	ci.index[term] = len(ci.terms)
+	ci.terms = append(ci.terms, term)
+	ci.literals = append(ci.literals, rule)
+	return true
+}
+
+// build compiles the automaton and orders the regexes; call once after all rules are added
+func (ci *contentIndex) build() {
+	ci.matcher = newAhoCorasick(ci.terms)
+	sort.SliceStable(ci.regexes, func(i, j int) bool {
+		return ci.regexes[i].outranks(ci.regexes[j])
+	})
+}
+
+// match returns the highest ranked rule and the matched term (the rule pattern, or the regex match)
+func (ci *contentIndex) match(content string) (*compiledRule, string) {
+	text := foldText(content)
+
+	var best *compiledRule
+	var term string
+	ci.matcher.each(text, func(pattern, end int) bool {
+		rule := ci.literals[pattern]
+		// Keywords and phrases only match whole words
+		if rule.outranks(best) && isWordBoundary(text, end-len(ci.terms[pattern]), end) {
+			best, term = rule, rule.Value
+		}
+		return true
+	})
+
+	for _, rule := range ci.regexes {
+		// Regexes are sorted, nothing further down can outrank the current best
+		if !rule.outranks(best) {
+			break
+		}
+		if loc := rule.regex.FindStringIndex(text); loc != nil {
+			return rule, text[loc[0]:loc[1]]
+		}
+	}
+	return best, term
+}
+
+func (ci *contentIndex) len() int {
+	return len(ci.terms) + len(ci.regexes)
+}
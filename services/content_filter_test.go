@@ -0,0 +1,101 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"firewall/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAhoCorasick(t *testing.T) {
+	ac := newAhoCorasick([]string{"he", "she", "his", "hers", ""})
+
+	type hit struct{ pattern, end int }
+	var hits []hit
+	ac.each("ushers", func(pattern, end int) bool {
+		hits = append(hits, hit{pattern, end})
+		return true
+	})
+	assert.ElementsMatch(t, []hit{{1, 4}, {0, 4}, {3, 6}}, hits)
+
+	// Returning false stops the scan
+	count := 0
+	ac.each("ushers", func(pattern, end int) bool {
+		count++
+		return false
+	})
+	assert.Equal(t, 1, count)
+}
+
+func TestFoldText(t *testing.T) {
+	assert.Equal(t, "cafe creme", foldText("  Café\t\nCRÈME "))
+	assert.Equal(t, "strasse", foldText("Straße"))
+	assert.Equal(t, "", foldText(" \n "))
+}
+
+func TestContentIndex_Match(t *testing.T) {
+	ci := newContentIndex()
+	assert.True(t, ci.add(1, "viagra", "keyword", "denied", 0))
+	assert.True(t, ci.add(2, "Free  Money", "phrase", "denied", 0))
+	assert.True(t, ci.add(3, `casino\d+`, "regex", "denied", 0))
+	assert.True(t, ci.add(4, "newsletter", "keyword", "whitelisted", 10))
+	assert.True(t, ci.add(5, "VIAGRA", "keyword", "denied", 5)) // Same folded term, higher priority
+	assert.False(t, ci.add(6, "(", "regex", "denied", 0))
+	assert.False(t, ci.add(7, " ", "keyword", "denied", 0))
+	ci.build()
+	assert.Equal(t, 4, ci.len())
+
+	tests := []struct {
+		content string
+		id      uint
+		term    string
+	}{
+		{"Buy VIÁGRA now", 5, "VIAGRA"},
+		{"get free\nmoney today", 2, "Free  Money"},
+		{"play at Casino777", 3, "casino777"},
+		{"our newsletter about viagra", 4, "newsletter"},
+		{"viagras are not a word we know", 0, ""}, // Keywords only match whole words
+		{"nothing to see here", 0, ""},
+	}
+	for _, tt := range tests {
+		rule, term := ci.match(tt.content)
+		if tt.id == 0 {
+			assert.Nil(t, rule, tt.content)
+			continue
+		}
+		if assert.NotNil(t, rule, tt.content) {
+			assert.Equal(t, tt.id, rule.ID, tt.content)
+			assert.Equal(t, tt.term, term, tt.content)
+		}
+	}
+}
+
+func TestEvaluateFilters_Content(t *testing.T) {
+	engine := GetRuleEngine()
+	previous := engine.Snapshot()
+	defer engine.snapshot.Store(previous)
+
+	engine.snapshot.Store(BuildRuleSnapshot(RuleSet{
+		Contents: []models.ContentRule{
+			{ID: 1, Pattern: "cheap pills", MatchType: "phrase", Status: "denied"},
+			{ID: 2, Pattern: "lottery", MatchType: "keyword", Status: "monitor"},
+		},
+	}))
+
+	result, err := EvaluateFilterInput(context.Background(), &FilterInput{Country: "US", Content: "Get CHEAP pills here"})
+	assert.NoError(t, err)
+	assert.Equal(t, "denied", result.Result)
+	assert.Equal(t, "content denied", result.Reason)
+	assert.Equal(t, "content", result.Field)
+	assert.Equal(t, "cheap pills", result.Value)
+	assert.Equal(t, uint(1), result.RuleID)
+
+	result, err = EvaluateFilterInput(context.Background(), &FilterInput{Country: "US", Content: "You won the lottery"})
+	assert.NoError(t, err)
+	assert.Equal(t, "allowed", result.Result)
+	assert.Equal(t, []MonitorHit{
+		{Filter: "content", RuleID: 2, RuleType: "keyword", Field: "content", Value: "lottery", WouldBlock: true},
+	}, result.Trace.Monitor)
+}
@@ -0,0 +1,76 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"firewall/models"
+
+	"gorm.io/gorm"
+)
+
+// CountryGroupData represents the seed data for a built-in country group
+type CountryGroupData struct {
+	Code      string
+	Name      string
+	Countries string // space separated ISO 3166-1 alpha-2 codes
+}
+
+const euCountries = "AT BE BG HR CY CZ DK EE FI FR DE GR HU IE IT LV LT LU MT NL PL PT RO SK SI ES SE"
+
+// builtInCountryGroups are seeded with status "allowed"; membership follows the
+// MaxMind continent assignment, so CY is in ASIA and TR is not in EUROPE
+var builtInCountryGroups = []CountryGroupData{
+	{"EU", "European Union", euCountries},
+	{"EEA", "European Economic Area", euCountries + " IS LI NO"},
+	// Comprehensively sanctioned countries (OFAC-style); review against the current lists before enforcing
+	{"SANCTIONED", "Comprehensively sanctioned countries", "CU IR KP SY"},
+	{"AFRICA", "Africa", "AO BF BI BJ BW CD CF CG CI CM CV DJ DZ EG EH ER ET GA GH GM GN GQ GW KE KM LR LS LY MA MG ML MR MU MW MZ NA NE NG RE RW SC SD SH SL SN SO SS ST SZ TD TG TN TZ UG YT ZA ZM ZW"},
+	{"ANTARCTICA", "Antarctica", "AQ BV GS HM TF"},
+	{"ASIA", "Asia", "AE AF AM AZ BD BH BN BT CC CN CX CY GE HK ID IL IN IO IQ IR JO JP KG KH KP KR KW KZ LA LB LK MM MN MO MV MY NP OM PH PK PS QA SA SG SY TH TJ TL TM TR TW UZ VN YE"},
+	{"EUROPE", "Europe", "AD AL AT AX BA BE BG BY CH CZ DE DK EE ES FI FO FR GB GG GI GR HR HU IE IM IS IT JE LI LT LU LV MC MD ME MK MT NL NO PL PT RO RS RU SE SI SJ SK SM UA VA XK"},
+	{"NORTH_AMERICA", "North America", "AG AI AW BB BL BM BQ BS BZ CA CR CU CW DM DO GD GL GP GT HN HT JM KN KY LC MF MQ MS MX NI PA PM PR SV SX TC TT US VC VG VI"},
+	{"OCEANIA", "Oceania", "AS AU CK FJ FM GU KI MH MP NC NF NR NU NZ PF PG PN PW SB TK TO TV UM VU WF WS"},
+	{"SOUTH_AMERICA", "South America", "AR BO BR CL CO EC FK GF GY PE PY SR UY VE"},
+}
+
+// SeedCountryGroups inserts the built-in country groups that do not exist yet;
+// existing groups are left untouched so status and membership changes survive restarts
+func SeedCountryGroups(db *gorm.DB) error {
+	var existing []string
+	if err := db.Model(&models.CountryGroup{}).Pluck("code", &existing).Error; err != nil {
+		return fmt.Errorf("failed to check country groups: %w", err)
+	}
+	seeded := make(map[string]bool, len(existing))
+	for _, code := range existing {
+		seeded[code] = true
+	}
+
+	var groups []models.CountryGroup
+	for _, group := range builtInCountryGroups {
+		if seeded[group.Code] {
+			continue
+		}
+		groups = append(groups, models.CountryGroup{
+			Code:      group.Code,
+			Name:      group.Name,
+			Countries: strings.Fields(group.Countries),
+			Status:    "allowed",
+			BuiltIn:   true,
+			CreatedAt: time.Now(),
+			UpdatedAt: time.Now(),
+		})
+	}
+	if len(groups) == 0 {
+		return nil
+	}
+
+	if err := db.Create(&groups).Error; err != nil {
+		return fmt.Errorf("failed to insert country groups: %w", err)
+	}
+
+	log.Printf("Successfully seeded %d country groups", len(groups))
+	return nil
+}
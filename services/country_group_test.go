@@ -0,0 +1,109 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"firewall/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuiltInCountryGroups(t *testing.T) {
+	codes := make(map[string]bool)
+	for _, group := range builtInCountryGroups {
+		assert.False(t, codes[group.Code], "duplicate group %s", group.Code)
+		codes[group.Code] = true
+
+		seen := make(map[string]bool)
+		for _, country := range strings.Fields(group.Countries) {
+			assert.Len(t, country, 2, "group %s", group.Code)
+			assert.False(t, seen[country], "duplicate country %s in group %s", country, group.Code)
+			seen[country] = true
+		}
+	}
+	assert.Len(t, strings.Fields(euCountries), 27)
+}
+
+func TestCountryGroupIndex(t *testing.T) {
+	index := newCountryGroupIndex()
+	assert.True(t, index.add(models.CountryGroup{ID: 1, Code: "EUROPE", Countries: []string{"DE", "FR", "CH", "GB"}, Status: "allowed"}))
+	assert.True(t, index.add(models.CountryGroup{ID: 2, Code: "DACH", Countries: []string{"de", " AT ", "CH", "CH"}, Status: "denied"}))
+	assert.False(t, index.add(models.CountryGroup{ID: 3, Code: "BROKEN", Countries: []string{"DEU"}, Status: "denied"}))
+	index.sort()
+
+	assert.Equal(t, 2, index.len())
+	// The smaller group is more specific
+	assert.Equal(t, "DACH", index.match("de").Value)
+	assert.Equal(t, "DACH", index.match("AT").Value)
+	assert.Equal(t, "EUROPE", index.match("FR").Value)
+	assert.Nil(t, index.match("US"))
+	assert.True(t, CountryGroupHasMember(models.CountryGroup{Countries: []string{"DE"}}, "de"))
+}
+
+func TestEvaluateFilterInput_CountryGroups(t *testing.T) {
+	engine := GetRuleEngine()
+	previous := engine.Snapshot()
+	defer engine.snapshot.Store(previous)
+
+	engine.snapshot.Store(BuildRuleSnapshot(RuleSet{
+		Countries: []models.Country{
+			{ID: 1, Code: "FR", Status: "whitelisted"},
+			{ID: 2, Code: "DE", Status: "allowed"},
+		},
+		CountryGroups: []models.CountryGroup{
+			{ID: 1, Code: "EU", Countries: []string{"DE", "FR", "IT", "PL"}, Status: "denied"},
+			{ID: 2, Code: "SANCTIONED", Countries: []string{"CU", "IR", "KP", "SY"}, Status: "denied", Priority: 10},
+			{ID: 3, Code: "EEA", Countries: []string{"DE", "FR", "IT", "PL", "NO"}, Status: "monitor"},
+		},
+		GeoRules: []models.GeoRule{
+			{ID: 1, Name: "europe", Type: "continent", Value: "EU", Status: "whitelisted"},
+		},
+	}))
+	assert.Equal(t, 2, engine.Snapshot().Stats()["country_groups"])
+	assert.Equal(t, 1, engine.Snapshot().Monitor().Stats()["country_groups"])
+
+	// The group decides for its members
+	result, err := EvaluateFilterInput(context.Background(), &FilterInput{Country: "IT", Geo: &GeoContext{Continent: "EU", Country: "IT"}})
+	assert.NoError(t, err)
+	assert.Equal(t, "denied", result.Result)
+	assert.Equal(t, "country group denied", result.Reason)
+	assert.Equal(t, "group", result.RuleType)
+	assert.Equal(t, uint(1), result.RuleID)
+	if assert.Len(t, result.Trace.Monitor, 1) {
+		assert.Equal(t, "country_group", result.Trace.Monitor[0].Filter)
+		assert.Equal(t, uint(3), result.Trace.Monitor[0].RuleID)
+	}
+
+	// A country rule is more specific than its groups
+	result, err = EvaluateFilterInput(context.Background(), &FilterInput{Country: "FR"})
+	assert.NoError(t, err)
+	assert.Equal(t, "whitelisted", result.Result)
+	assert.Equal(t, "country whitelisted", result.Reason)
+
+	// ... unless the group has a higher priority
+	engine.snapshot.Store(BuildRuleSnapshot(RuleSet{
+		Countries:     []models.Country{{ID: 1, Code: "IR", Status: "whitelisted"}},
+		CountryGroups: []models.CountryGroup{{ID: 2, Code: "SANCTIONED", Countries: []string{"CU", "IR", "KP", "SY"}, Status: "denied", Priority: 10}},
+	}))
+	result, err = EvaluateFilterInput(context.Background(), &FilterInput{Country: "IR"})
+	assert.NoError(t, err)
+	assert.Equal(t, "denied", result.Result)
+	assert.Equal(t, uint(2), result.RuleID)
+
+	result, err = EvaluateFilterInput(context.Background(), &FilterInput{Country: "US"})
+	assert.NoError(t, err)
+	assert.Equal(t, "allowed", result.Result)
+}
+
+func TestCompiledRule_GroupSpecificity(t *testing.T) {
+	country := &compiledRule{ID: 3, Type: "exact"}
+	small := &compiledRule{ID: 2, Type: "group", bits: 4}
+	large := &compiledRule{ID: 1, Type: "group", bits: 250}
+	continent := &compiledRule{ID: 0, Type: "continent"}
+
+	assert.True(t, country.outranks(small))
+	assert.True(t, small.outranks(large))
+	assert.True(t, large.outranks(continent))
+}
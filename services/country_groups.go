@@ -0,0 +1,68 @@
+package services
+
+import (
+	"firewall/models"
+	"sort"
+	"strings"
+)
+
+// countryGroupIndex maps each country to the group rules containing it; they are evaluated by the country filter
+type countryGroupIndex struct {
+	members map[string][]*compiledRule // "DE" -> EU, EEA, EUROPE, ordered by precedence
+	groups  int
+}
+
+func newCountryGroupIndex() *countryGroupIndex {
+	return &countryGroupIndex{members: make(map[string][]*compiledRule)}
+}
+
+// add compiles a country group; it returns false if the group has no valid country code
+func (ci *countryGroupIndex) add(g models.CountryGroup) bool {
+	countries := make(map[string]struct{}, len(g.Countries))
+	for _, c := range g.Countries {
+		if c = strings.ToUpper(strings.TrimSpace(c)); len(c) == 2 {
+			countries[c] = struct{}{}
+		}
+	}
+	if len(countries) == 0 {
+		return false
+	}
+
+	// bits holds the group size, so a small group is more specific than a large one
+	rule := &compiledRule{ID: g.ID, Value: g.Code, Status: g.Status, Priority: g.Priority, Type: "group", bits: len(countries)}
+	for c := range countries {
+		ci.members[c] = append(ci.members[c], rule)
+	}
+	ci.groups++
+	return true
+}
+
+func (ci *countryGroupIndex) sort() {
+	for _, rules := range ci.members {
+		sort.SliceStable(rules, func(i, j int) bool {
+			return rules[i].outranks(rules[j])
+		})
+	}
+}
+
+// match returns the highest ranked group rule containing country, nil if there is none
+func (ci *countryGroupIndex) match(country string) *compiledRule {
+	if rules := ci.members[strings.ToUpper(country)]; len(rules) > 0 {
+		return rules[0]
+	}
+	return nil
+}
+
+func (ci *countryGroupIndex) len() int {
+	return ci.groups
+}
+
+// CountryGroupHasMember reports whether a group contains a country code, ignoring case
+func CountryGroupHasMember(group models.CountryGroup, country string) bool {
+	for _, c := range group.Countries {
+		if strings.EqualFold(strings.TrimSpace(c), country) {
+			return true
+		}
+	}
+	return false
+}
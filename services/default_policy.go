@@ -0,0 +1,59 @@
+package services
+
+// Default policies decide what a filter returns for a value that no rule matches
+const (
+	PolicyAllow       = "allow"        // The value is allowed and the verdict counts as a match
+	PolicyDeny        = "deny"         // Only values matched by a rule pass: the rules form an allowlist
+	PolicyFallThrough = "fall-through" // No verdict, the other filters decide (default)
+)
+
+// DefaultPolicyFilters are the filters that support a default policy; they match a single value per field
+var DefaultPolicyFilters = []string{"ip", "email", "user_agent", "country", "username", "asn", "charset"}
+
+// IsDefaultPolicyFilter reports whether a filter supports a default policy
+func IsDefaultPolicyFilter(filter string) bool {
+	for _, f := range DefaultPolicyFilters {
+		if f == filter {
+			return true
+		}
+	}
+	return false
+}
+
+// DefaultPolicy returns the default policy of a filter, fall-through unless one is set
+func (s *RuleSnapshot) DefaultPolicy(filter string) string {
+	if policy, ok := s.defaults[filter]; ok {
+		return policy
+	}
+	return PolicyFallThrough
+}
+
+// defaultResult is the result of a filter for a value no rule matched
+func (s *RuleSnapshot) defaultResult(filter, field string, value interface{}) FilterResult {
+	switch policy := s.DefaultPolicy(filter); policy {
+	case PolicyDeny:
+		return FilterResult{Result: "denied", Reason: filter + " not in allowlist", Field: field, Value: value, DefaultPolicy: policy}
+	case PolicyAllow:
+		return FilterResult{Result: "allowed", Reason: filter + " not in denylist", Field: field, Value: value, DefaultPolicy: policy}
+	}
+	return FilterResult{Result: "allowed", Field: field, Value: value}
+}
+
+// ruleOrDefault converts a matched rule into a FilterResult; without a rule the default policy of the filter applies
+func (s *RuleSnapshot) ruleOrDefault(filter string, rule *compiledRule, field, kind string, value interface{}) FilterResult {
+	if rule == nil {
+		return s.defaultResult(filter, field, value)
+	}
+	return ruleResult(rule, field, kind, value)
+}
+
+// defaultPolicies returns the policies that differ from fall-through
+func (s *RuleSnapshot) defaultPolicies() map[string]string {
+	policies := make(map[string]string, len(s.defaults))
+	for filter, policy := range s.defaults {
+		if policy != PolicyFallThrough {
+			policies[filter] = policy
+		}
+	}
+	return policies
+}
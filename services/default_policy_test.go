@@ -0,0 +1,104 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"firewall/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEvaluateFilterInput_DefaultDeny(t *testing.T) {
+	engine := GetRuleEngine()
+	previous := engine.Snapshot()
+	defer engine.snapshot.Store(previous)
+
+	engine.snapshot.Store(BuildRuleSnapshot(RuleSet{
+		Countries:     []models.Country{{ID: 1, Code: "DE", Status: "allowed"}},
+		CountryGroups: []models.CountryGroup{{ID: 1, Code: "DACH", Countries: []string{"DE", "AT", "CH"}, Status: "allowed"}},
+		ASNs:          []models.ASN{{ID: 1, ASN: "AS3320", Status: "allowed"}},
+		IPs:           []models.IP{{ID: 1, Address: "203.0.113.7", Status: "whitelisted"}},
+		DefaultPolicies: []models.DefaultPolicy{
+			{Filter: "country", Policy: PolicyDeny},
+			{Filter: "asn", Policy: PolicyDeny},
+			{Filter: "email", Policy: PolicyFallThrough},
+			{Filter: "username", Policy: "sometimes"},
+		},
+	}))
+	snapshot := engine.Snapshot()
+	assert.Equal(t, PolicyDeny, snapshot.DefaultPolicy("country"))
+	assert.Equal(t, PolicyFallThrough, snapshot.DefaultPolicy("username"))
+	assert.Equal(t, PolicyFallThrough, snapshot.DefaultPolicy("ip"))
+	assert.Equal(t, map[string]string{"country": PolicyDeny, "asn": PolicyDeny}, snapshot.Stats()["default_policies"])
+	assert.Equal(t, 1, snapshot.Stats()["skipped"])
+
+	// Countries in the allowlist, directly or through a group, pass
+	result, err := EvaluateFilterInput(context.Background(), &FilterInput{Country: "DE", ASN: "AS3320"})
+	assert.NoError(t, err)
+	assert.Equal(t, "allowed", result.Result)
+	result, err = EvaluateFilterInput(context.Background(), &FilterInput{Country: "AT"})
+	assert.NoError(t, err)
+	assert.Equal(t, "allowed", result.Result)
+
+	result, err = EvaluateFilterInput(context.Background(), &FilterInput{Country: "US", ASN: "AS3320"})
+	assert.NoError(t, err)
+	assert.Equal(t, "denied", result.Result)
+	assert.Equal(t, "country not in allowlist", result.Reason)
+	assert.Equal(t, "country", result.Field)
+	assert.Equal(t, "US", result.Value)
+	assert.Equal(t, PolicyDeny, result.DefaultPolicy)
+
+	result, err = EvaluateFilterInput(context.Background(), &FilterInput{ASN: "AS15169"})
+	assert.NoError(t, err)
+	assert.Equal(t, "denied", result.Result)
+	assert.Equal(t, "asn not in allowlist", result.Reason)
+
+	// Unknown values are not subject to the policy
+	result, err = EvaluateFilterInput(context.Background(), &FilterInput{Country: "", Email: "alice@example.com"})
+	assert.NoError(t, err)
+	assert.Equal(t, "allowed", result.Result)
+
+	// A whitelisted rule of another filter overrides the default deny
+	result, err = EvaluateFilterInput(context.Background(), &FilterInput{IP: "203.0.113.7", Country: "US", ASN: "AS3320"})
+	assert.NoError(t, err)
+	assert.Equal(t, "whitelisted", result.Result)
+}
+
+func TestDefaultPolicy_Allow(t *testing.T) {
+	snapshot := BuildRuleSnapshot(RuleSet{
+		DefaultPolicies: []models.DefaultPolicy{{Filter: "email", Policy: PolicyAllow}},
+	})
+
+	result := snapshot.ruleOrDefault("email", nil, "email", "email", "alice@example.com")
+	assert.Equal(t, "allowed", result.Result)
+	assert.Equal(t, "email not in denylist", result.Reason)
+
+	// An allow policy counts as a match for first-match-by-priority, fall-through does not
+	verdicts := []FilterVerdict{
+		{Filter: "email", FilterResult: result},
+		{Filter: "username", FilterResult: FilterResult{Result: "denied", RuleID: 1}},
+	}
+	assert.Equal(t, "allowed", resolveVerdicts(verdicts, ResolutionFirstMatchByPriority).Result)
+	verdicts[0].FilterResult = snapshot.ruleOrDefault("ip", nil, "ip", "ip", "203.0.113.7")
+	assert.Equal(t, "denied", resolveVerdicts(verdicts, ResolutionFirstMatchByPriority).Result)
+}
+
+func TestCharsetFilter_DefaultDeny(t *testing.T) {
+	engine := GetRuleEngine()
+	previous := engine.Snapshot()
+	defer engine.snapshot.Store(previous)
+
+	engine.snapshot.Store(BuildRuleSnapshot(RuleSet{
+		Charsets:        []models.CharsetRule{{ID: 1, Charset: "ASCII", Status: "allowed"}},
+		DefaultPolicies: []models.DefaultPolicy{{Filter: "charset", Policy: PolicyDeny}},
+	}))
+
+	result := charsetFilter{}.Evaluate(context.Background(), &FilterInput{Username: "alice"})
+	assert.Equal(t, "allowed", result.Result)
+
+	result = charsetFilter{}.Evaluate(context.Background(), &FilterInput{Username: "алиса"})
+	assert.Equal(t, "denied", result.Result)
+	assert.Equal(t, "charset not in allowlist", result.Reason)
+	assert.Equal(t, "username", result.Field)
+}
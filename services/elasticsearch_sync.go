@@ -2,49 +2,49 @@ package services
 
 import (
 	"context"
-	"encoding/json"
 	"firewall/config"
 	"firewall/models"
+	"firewall/utils"
 	"fmt"
 	"log"
-	"strings"
-
-	"github.com/elastic/go-elasticsearch/v8/esapi"
+	"time"
 )
 
-// IndexIPAddress indexes an IP address to Elasticsearch
-func IndexIPAddress(ip models.IP) error {
-	es := config.ESClient
-
-	// Create the document to index
-	doc := map[string]interface{}{
-		"address": ip.Address,
-		"status":  ip.Status,
-		"is_cidr": ip.IsCIDR,
-	}
-
-	docJSON, err := json.Marshal(doc)
-	if err != nil {
-		return err
-	}
+// indexDocument stores a rule document in the rule index
+func indexDocument(index string, doc RuleDocument) error {
+	return GetRuleIndex().Upsert(context.Background(), index, doc)
+}
 
-	// Index the document
-	// Use database ID as document ID to avoid issues with special characters in CIDR notation
-	docID := fmt.Sprintf("%d", ip.ID)
-	req := esapi.IndexRequest{
-		Index:      "ip-addresses",
-		DocumentID: docID,
-		Body:       strings.NewReader(string(docJSON)),
+// documentVersion is the version of a rule document, the updated_at of the rule in
+// nanoseconds; 0 (unversioned) if it is not set
+func documentVersion(updatedAt time.Time) int64 {
+	if updatedAt.IsZero() {
+		return 0
 	}
+	return updatedAt.UnixNano()
+}
 
-	res, err := req.Do(context.Background(), es)
-	if err != nil {
-		return err
-	}
-	defer res.Body.Close()
+// ipDocument returns the rule index document of an IP rule; the database ID is the
+// document ID to avoid issues with special characters in CIDR notation. "range" holds the
+// addresses covered by the rule for containment queries.
+func ipDocument(ip models.IP) RuleDocument {
+	doc := RuleDocument{ID: fmt.Sprintf("%d", ip.ID), Version: documentVersion(ip.UpdatedAt), Source: map[string]interface{}{
+		"address":  ip.Address,
+		"status":   ip.Status,
+		"is_cidr":  ip.IsCIDR,
+		"is_range": ip.IsRange,
+	}}
+	if ipRange, err := utils.ParseIPRange(ip.Address); err == nil {
+		doc.Source["range"] = map[string]interface{}{"gte": ipRange.Start.String(), "lte": ipRange.End.String()}
+	}
+	return doc
+}
 
-	if res.IsError() {
-		log.Printf("Error indexing IP: %s", res.String())
+// IndexIPAddress indexes an IP address to the rule index
+func IndexIPAddress(ip models.IP) error {
+	doc := ipDocument(ip)
+	if err := indexDocument(IndexIPs, doc); err != nil {
+		log.Printf("Error indexing IP: %v", err)
 		return err
 	}
 
@@ -52,37 +52,21 @@ func IndexIPAddress(ip models.IP) error {
 	return nil
 }
 
-// IndexEmail indexes an email to Elasticsearch
-func IndexEmail(email models.Email) error {
-	es := config.ESClient
-
-	doc := map[string]interface{}{
+// emailDocument returns the rule index document of an email rule; the database ID is the
+// document ID to avoid issues with special characters in patterns
+func emailDocument(email models.Email) RuleDocument {
+	return RuleDocument{ID: fmt.Sprintf("%d", email.ID), Version: documentVersion(email.UpdatedAt), Source: map[string]interface{}{
 		"email":    email.Address,
 		"status":   email.Status,
 		"is_regex": email.IsRegex,
-	}
-
-	docJSON, err := json.Marshal(doc)
-	if err != nil {
-		return err
-	}
-
-	// Use database ID as document ID to avoid issues with special characters in patterns
-	docID := fmt.Sprintf("%d", email.ID)
-	req := esapi.IndexRequest{
-		Index:      "emails",
-		DocumentID: docID,
-		Body:       strings.NewReader(string(docJSON)),
-	}
-
-	res, err := req.Do(context.Background(), es)
-	if err != nil {
-		return err
-	}
-	defer res.Body.Close()
+	}}
+}
 
-	if res.IsError() {
-		log.Printf("Error indexing email: %s", res.String())
+// IndexEmail indexes an email to the rule index
+func IndexEmail(email models.Email) error {
+	doc := emailDocument(email)
+	if err := indexDocument(IndexEmails, doc); err != nil {
+		log.Printf("Error indexing email: %v", err)
 		return err
 	}
 
@@ -90,37 +74,21 @@ func IndexEmail(email models.Email) error {
 	return nil
 }
 
-// IndexUserAgent indexes a user agent to Elasticsearch
-func IndexUserAgent(userAgent models.UserAgent) error {
-	es := config.ESClient
-
-	doc := map[string]interface{}{
+// userAgentDocument returns the rule index document of a user agent rule; the database ID
+// is the document ID to avoid issues with special characters in patterns
+func userAgentDocument(userAgent models.UserAgent) RuleDocument {
+	return RuleDocument{ID: fmt.Sprintf("%d", userAgent.ID), Version: documentVersion(userAgent.UpdatedAt), Source: map[string]interface{}{
 		"user_agent": userAgent.UserAgent,
 		"status":     userAgent.Status,
 		"is_regex":   userAgent.IsRegex,
-	}
-
-	docJSON, err := json.Marshal(doc)
-	if err != nil {
-		return err
-	}
-
-	// Use database ID as document ID to avoid issues with special characters in patterns
-	docID := fmt.Sprintf("%d", userAgent.ID)
-	req := esapi.IndexRequest{
-		Index:      "user-agents",
-		DocumentID: docID,
-		Body:       strings.NewReader(string(docJSON)),
-	}
-
-	res, err := req.Do(context.Background(), es)
-	if err != nil {
-		return err
-	}
-	defer res.Body.Close()
+	}}
+}
 
-	if res.IsError() {
-		log.Printf("Error indexing user agent: %s", res.String())
+// IndexUserAgent indexes a user agent to the rule index
+func IndexUserAgent(userAgent models.UserAgent) error {
+	doc := userAgentDocument(userAgent)
+	if err := indexDocument(IndexUserAgents, doc); err != nil {
+		log.Printf("Error indexing user agent: %v", err)
 		return err
 	}
 
@@ -128,34 +96,19 @@ func IndexUserAgent(userAgent models.UserAgent) error {
 	return nil
 }
 
-// IndexCountry indexes a country to Elasticsearch
-func IndexCountry(country models.Country) error {
-	es := config.ESClient
-
-	doc := map[string]interface{}{
+// countryDocument returns the rule index document of a country rule, keyed by country code
+func countryDocument(country models.Country) RuleDocument {
+	return RuleDocument{ID: country.Code, Version: documentVersion(country.UpdatedAt), Source: map[string]interface{}{
 		"country": country.Code,
 		"status":  country.Status,
-	}
-
-	docJSON, err := json.Marshal(doc)
-	if err != nil {
-		return err
-	}
-
-	req := esapi.IndexRequest{
-		Index:      "countries",
-		DocumentID: country.Code,
-		Body:       strings.NewReader(string(docJSON)),
-	}
-
-	res, err := req.Do(context.Background(), es)
-	if err != nil {
-		return err
-	}
-	defer res.Body.Close()
+	}}
+}
 
-	if res.IsError() {
-		log.Printf("Error indexing country: %s", res.String())
+// IndexCountry indexes a country to the rule index
+func IndexCountry(country models.Country) error {
+	doc := countryDocument(country)
+	if err := indexDocument(IndexCountries, doc); err != nil {
+		log.Printf("Error indexing country: %v", err)
 		return err
 	}
 
@@ -163,34 +116,21 @@ func IndexCountry(country models.Country) error {
 	return nil
 }
 
-// IndexCharsetRule indexes a charset rule to Elasticsearch
-func IndexCharsetRule(charset models.CharsetRule) error {
-	es := config.ESClient
-
-	doc := map[string]interface{}{
+// charsetDocument returns the rule index document of a charset rule. It is keyed by database
+// ID like SyncCharsetToES and DeleteCharsetFromES, so each rule has exactly one document.
+func charsetDocument(charset models.CharsetRule) RuleDocument {
+	return RuleDocument{ID: fmt.Sprintf("%d", charset.ID), Version: documentVersion(charset.UpdatedAt), Source: map[string]interface{}{
+		"id":      charset.ID,
 		"charset": charset.Charset,
 		"status":  charset.Status,
-	}
-
-	docJSON, err := json.Marshal(doc)
-	if err != nil {
-		return err
-	}
-
-	req := esapi.IndexRequest{
-		Index:      "charsets",
-		DocumentID: charset.Charset,
-		Body:       strings.NewReader(string(docJSON)),
-	}
-
-	res, err := req.Do(context.Background(), es)
-	if err != nil {
-		return err
-	}
-	defer res.Body.Close()
+	}}
+}
 
-	if res.IsError() {
-		log.Printf("Error indexing charset rule: %s", res.String())
+// IndexCharsetRule indexes a charset rule to the rule index
+func IndexCharsetRule(charset models.CharsetRule) error {
+	doc := charsetDocument(charset)
+	if err := indexDocument(IndexCharsets, doc); err != nil {
+		log.Printf("Error indexing charset rule: %v", err)
 		return err
 	}
 
@@ -198,49 +138,74 @@ func IndexCharsetRule(charset models.CharsetRule) error {
 	return nil
 }
 
-// IndexUsernameRule indexes a username rule to Elasticsearch
-func IndexUsernameRule(username models.UsernameRule) error {
-	es := config.ESClient
-
-	doc := map[string]interface{}{
+// usernameDocument returns the rule index document of a username rule; the database ID is
+// the document ID to avoid issues with special characters in patterns
+func usernameDocument(username models.UsernameRule) RuleDocument {
+	return RuleDocument{ID: fmt.Sprintf("%d", username.ID), Version: documentVersion(username.UpdatedAt), Source: map[string]interface{}{
+		"id":       username.ID,
 		"username": username.Username,
 		"status":   username.Status,
 		"is_regex": username.IsRegex,
-	}
+	}}
+}
 
-	docJSON, err := json.Marshal(doc)
-	if err != nil {
+// IndexUsernameRule indexes a username rule to the rule index
+func IndexUsernameRule(username models.UsernameRule) error {
+	doc := usernameDocument(username)
+	if err := indexDocument(IndexUsernames, doc); err != nil {
+		log.Printf("Error indexing username rule: %v", err)
 		return err
 	}
 
-	// Use database ID as document ID to avoid issues with special characters in patterns
-	docID := fmt.Sprintf("%d", username.ID)
-	req := esapi.IndexRequest{
-		Index:      "usernames",
-		DocumentID: docID,
-		Body:       strings.NewReader(string(docJSON)),
-	}
+	log.Printf("Successfully indexed username rule: %s", username.Username)
+	return nil
+}
 
-	res, err := req.Do(context.Background(), es)
-	if err != nil {
-		return err
-	}
-	defer res.Body.Close()
+// emailDomainDocument returns the rule index document of an email domain rule
+func emailDomainDocument(domain models.EmailDomainRule) RuleDocument {
+	return RuleDocument{ID: fmt.Sprintf("%d", domain.ID), Version: documentVersion(domain.UpdatedAt), Source: map[string]interface{}{
+		"domain":   domain.Domain,
+		"status":   domain.Status,
+		"priority": domain.Priority,
+	}}
+}
 
-	if res.IsError() {
-		log.Printf("Error indexing username rule: %s", res.String())
-		return err
+// IndexEmailDomainRule indexes an email domain rule to the rule index
+func IndexEmailDomainRule(domain models.EmailDomainRule) error {
+	doc := emailDomainDocument(domain)
+	if err := indexDocument(IndexEmailDomains, doc); err != nil {
+		return fmt.Errorf("error indexing email domain rule: %w", err)
 	}
 
-	log.Printf("Successfully indexed username rule: %s", username.Username)
+	log.Printf("Successfully indexed email domain rule: %s", domain.Domain)
 	return nil
 }
 
-// IndexASN indexes an ASN to Elasticsearch
-func IndexASN(asn models.ASN) error {
-	es := config.ESClient
+// contentDocument returns the rule index document of a content rule; the database ID is the
+// document ID, patterns can contain arbitrary text
+func contentDocument(content models.ContentRule) RuleDocument {
+	return RuleDocument{ID: fmt.Sprintf("%d", content.ID), Version: documentVersion(content.UpdatedAt), Source: map[string]interface{}{
+		"pattern":    content.Pattern,
+		"match_type": content.MatchType,
+		"status":     content.Status,
+		"priority":   content.Priority,
+	}}
+}
 
-	doc := map[string]interface{}{
+// IndexContentRule indexes a content rule to the rule index
+func IndexContentRule(content models.ContentRule) error {
+	doc := contentDocument(content)
+	if err := indexDocument(IndexContentRules, doc); err != nil {
+		return fmt.Errorf("error indexing content rule: %w", err)
+	}
+
+	log.Printf("Successfully indexed content rule: %d", content.ID)
+	return nil
+}
+
+// asnDocument returns the rule index document of an ASN rule
+func asnDocument(asn models.ASN) RuleDocument {
+	return RuleDocument{ID: fmt.Sprintf("%d", asn.ID), Version: documentVersion(asn.UpdatedAt), Source: map[string]interface{}{
 		"asn":    asn.ASN,
 		"rir":    asn.RIR,
 		"domain": asn.Domain,
@@ -248,29 +213,14 @@ func IndexASN(asn models.ASN) error {
 		"asname": asn.Name,
 		"status": asn.Status,
 		"source": asn.Source,
-	}
-
-	docJSON, err := json.Marshal(doc)
-	if err != nil {
-		return err
-	}
-
-	// Use database ID as document ID
-	docID := fmt.Sprintf("%d", asn.ID)
-	req := esapi.IndexRequest{
-		Index:      "asns",
-		DocumentID: docID,
-		Body:       strings.NewReader(string(docJSON)),
-	}
-
-	res, err := req.Do(context.Background(), es)
-	if err != nil {
-		return err
-	}
-	defer res.Body.Close()
+	}}
+}
 
-	if res.IsError() {
-		log.Printf("Error indexing ASN: %s", res.String())
+// IndexASN indexes an ASN to the rule index
+func IndexASN(asn models.ASN) error {
+	doc := asnDocument(asn)
+	if err := indexDocument(IndexASNs, doc); err != nil {
+		log.Printf("Error indexing ASN: %v", err)
 		return err
 	}
 
@@ -278,158 +228,170 @@ func IndexASN(asn models.ASN) error {
 	return nil
 }
 
-// SyncASNToES synchronizes an ASN rule to Elasticsearch
+// SyncASNToES synchronizes an ASN rule to the rule index
 func SyncASNToES(asn models.ASN) error {
 	return IndexASN(asn)
 }
 
-// DeleteASNFromES removes an ASN rule from Elasticsearch
+// DeleteASNFromES removes an ASN rule from the rule index
 func DeleteASNFromES(asnID uint) error {
-	es := config.ESClient
-
-	docID := fmt.Sprintf("%d", asnID)
-	req := esapi.DeleteRequest{
-		Index:      "asns",
-		DocumentID: docID,
-	}
-
-	res, err := req.Do(context.Background(), es)
-	if err != nil {
-		return err
-	}
-	defer res.Body.Close()
-
-	if res.IsError() {
-		log.Printf("Error deleting ASN from Elasticsearch: %s", res.String())
+	if err := deleteDocument(IndexASNs, fmt.Sprintf("%d", asnID)); err != nil {
+		log.Printf("Error deleting ASN from the rule index: %v", err)
 		return err
 	}
 
-	log.Printf("Successfully deleted ASN from Elasticsearch: %d", asnID)
+	log.Printf("Successfully deleted ASN from the rule index: %d", asnID)
 	return nil
 }
 
-// SyncAllIPs syncs all IP addresses from MySQL to Elasticsearch
+// deleteDocument removes a rule document from an index; missing documents are not an error
+func deleteDocument(index, docID string) error {
+	return GetRuleIndex().Delete(context.Background(), index, docID)
+}
+
+// DeleteIPFromES removes an IP rule from the rule index
+func DeleteIPFromES(id uint) error {
+	return deleteDocument(IndexIPs, fmt.Sprintf("%d", id))
+}
+
+// DeleteEmailFromES removes an email rule from the rule index
+func DeleteEmailFromES(id uint) error {
+	return deleteDocument(IndexEmails, fmt.Sprintf("%d", id))
+}
+
+// DeleteUserAgentFromES removes a user agent rule from the rule index
+func DeleteUserAgentFromES(id uint) error {
+	return deleteDocument(IndexUserAgents, fmt.Sprintf("%d", id))
+}
+
+// DeleteCountryFromES removes a country rule from the rule index; country documents are keyed by code
+func DeleteCountryFromES(code string) error {
+	return deleteDocument(IndexCountries, code)
+}
+
+// SyncAllIPs syncs all IP addresses from MySQL to the rule index
 func SyncAllIPs() error {
 	var ips []models.IP
 	if err := config.DB.Find(&ips).Error; err != nil {
 		return err
 	}
 
-	for _, ip := range ips {
-		if err := IndexIPAddress(ip); err != nil {
-			log.Printf("Error syncing IP %s: %v", ip.Address, err)
-		}
+	stats, err := bulkSync(IndexIPs, ips, ipDocument)
+	log.Printf("Synced %d IP addresses to the rule index (%d failed, queued for retry)", stats.Indexed, stats.Failed)
+	return err
+}
+
+// SyncIPsFromSource syncs the IP addresses of one import source, e.g. after a list import
+func SyncIPsFromSource(source string) error {
+	var ips []models.IP
+	if err := config.DB.Where("source = ?", source).Find(&ips).Error; err != nil {
+		return err
 	}
 
-	log.Printf("Synced %d IP addresses to Elasticsearch", len(ips))
-	return nil
+	stats, err := bulkSync(IndexIPs, ips, ipDocument)
+	log.Printf("Synced %d IP addresses from %s to the rule index (%d failed, queued for retry)", stats.Indexed, source, stats.Failed)
+	return err
 }
 
-// SyncAllEmails syncs all emails from MySQL to Elasticsearch
+// SyncAllEmails syncs all emails from MySQL to the rule index
 func SyncAllEmails() error {
 	var emails []models.Email
 	if err := config.DB.Find(&emails).Error; err != nil {
 		return err
 	}
 
-	for _, email := range emails {
-		if err := IndexEmail(email); err != nil {
-			log.Printf("Error syncing email %s: %v", email.Address, err)
-		}
-	}
-
-	log.Printf("Synced %d emails to Elasticsearch", len(emails))
-	return nil
+	stats, err := bulkSync(IndexEmails, emails, emailDocument)
+	log.Printf("Synced %d emails to the rule index (%d failed, queued for retry)", stats.Indexed, stats.Failed)
+	return err
 }
 
-// SyncAllUserAgents syncs all user agents from MySQL to Elasticsearch
+// SyncAllUserAgents syncs all user agents from MySQL to the rule index
 func SyncAllUserAgents() error {
 	var userAgents []models.UserAgent
 	if err := config.DB.Find(&userAgents).Error; err != nil {
 		return err
 	}
 
-	for _, userAgent := range userAgents {
-		if err := IndexUserAgent(userAgent); err != nil {
-			log.Printf("Error syncing user agent %s: %v", userAgent.UserAgent, err)
-		}
-	}
-
-	log.Printf("Synced %d user agents to Elasticsearch", len(userAgents))
-	return nil
+	stats, err := bulkSync(IndexUserAgents, userAgents, userAgentDocument)
+	log.Printf("Synced %d user agents to the rule index (%d failed, queued for retry)", stats.Indexed, stats.Failed)
+	return err
 }
 
-// SyncAllCountries syncs all countries from MySQL to Elasticsearch
+// SyncAllCountries syncs all countries from MySQL to the rule index
 func SyncAllCountries() error {
 	var countries []models.Country
 	if err := config.DB.Find(&countries).Error; err != nil {
 		return err
 	}
 
-	for _, country := range countries {
-		if err := IndexCountry(country); err != nil {
-			log.Printf("Error syncing country %s: %v", country.Code, err)
-		}
-	}
-
-	log.Printf("Synced %d countries to Elasticsearch", len(countries))
-	return nil
+	stats, err := bulkSync(IndexCountries, countries, countryDocument)
+	log.Printf("Synced %d countries to the rule index (%d failed, queued for retry)", stats.Indexed, stats.Failed)
+	return err
 }
 
-// SyncAllCharsetRules syncs all charset rules from MySQL to Elasticsearch
+// SyncAllCharsetRules syncs all charset rules from MySQL to the rule index
 func SyncAllCharsetRules() error {
 	var charsets []models.CharsetRule
 	if err := config.DB.Find(&charsets).Error; err != nil {
 		return err
 	}
 
-	for _, charset := range charsets {
-		if err := IndexCharsetRule(charset); err != nil {
-			log.Printf("Error syncing charset rule %s: %v", charset.Charset, err)
-		}
-	}
-
-	log.Printf("Synced %d charset rules to Elasticsearch", len(charsets))
-	return nil
+	stats, err := bulkSync(IndexCharsets, charsets, charsetDocument)
+	log.Printf("Synced %d charset rules to the rule index (%d failed, queued for retry)", stats.Indexed, stats.Failed)
+	return err
 }
 
-// SyncAllUsernameRules syncs all username rules from MySQL to Elasticsearch
+// SyncAllUsernameRules syncs all username rules from MySQL to the rule index
 func SyncAllUsernameRules() error {
 	var usernames []models.UsernameRule
 	if err := config.DB.Find(&usernames).Error; err != nil {
 		return err
 	}
 
-	for _, username := range usernames {
-		if err := IndexUsernameRule(username); err != nil {
-			log.Printf("Error syncing username rule %s: %v", username.Username, err)
-		}
+	stats, err := bulkSync(IndexUsernames, usernames, usernameDocument)
+	log.Printf("Synced %d username rules to the rule index (%d failed, queued for retry)", stats.Indexed, stats.Failed)
+	return err
+}
+
+// SyncAllEmailDomainRules syncs all email domain rules from MySQL to the rule index
+func SyncAllEmailDomainRules() error {
+	var domains []models.EmailDomainRule
+	if err := config.DB.Find(&domains).Error; err != nil {
+		return err
 	}
 
-	log.Printf("Synced %d username rules to Elasticsearch", len(usernames))
-	return nil
+	stats, err := bulkSync(IndexEmailDomains, domains, emailDomainDocument)
+	log.Printf("Synced %d email domain rules to the rule index (%d failed, queued for retry)", stats.Indexed, stats.Failed)
+	return err
 }
 
-// SyncAllASNs syncs all ASNs from MySQL to Elasticsearch
+// SyncAllContentRules syncs all content rules from MySQL to the rule index
+func SyncAllContentRules() error {
+	var contents []models.ContentRule
+	if err := config.DB.Find(&contents).Error; err != nil {
+		return err
+	}
+
+	stats, err := bulkSync(IndexContentRules, contents, contentDocument)
+	log.Printf("Synced %d content rules to the rule index (%d failed, queued for retry)", stats.Indexed, stats.Failed)
+	return err
+}
+
+// SyncAllASNs syncs all ASNs from MySQL to the rule index
 func SyncAllASNs() error {
 	var asns []models.ASN
 	if err := config.DB.Find(&asns).Error; err != nil {
 		return err
 	}
 
-	for _, asn := range asns {
-		if err := IndexASN(asn); err != nil {
-			log.Printf("Error syncing ASN %s: %v", asn.ASN, err)
-		}
-	}
-
-	log.Printf("Synced %d ASNs to Elasticsearch", len(asns))
-	return nil
+	stats, err := bulkSync(IndexASNs, asns, asnDocument)
+	log.Printf("Synced %d ASNs to the rule index (%d failed, queued for retry)", stats.Indexed, stats.Failed)
+	return err
 }
 
-// SyncAllData syncs all data from MySQL to Elasticsearch
+// SyncAllData syncs all data from MySQL to the rule index
 func SyncAllData() error {
-	log.Println("Starting full data sync to Elasticsearch...")
+	log.Println("Starting full data sync to the rule index...")
 
 	if err := SyncAllIPs(); err != nil {
 		log.Printf("Error syncing IPs: %v", err)
@@ -439,6 +401,10 @@ func SyncAllData() error {
 		log.Printf("Error syncing emails: %v", err)
 	}
 
+	if err := SyncAllEmailDomainRules(); err != nil {
+		log.Printf("Error syncing email domain rules: %v", err)
+	}
+
 	if err := SyncAllUserAgents(); err != nil {
 		log.Printf("Error syncing user agents: %v", err)
 	}
@@ -459,146 +425,57 @@ func SyncAllData() error {
 		log.Printf("Error syncing ASNs: %v", err)
 	}
 
+	if err := SyncAllContentRules(); err != nil {
+		log.Printf("Error syncing content rules: %v", err)
+	}
+
 	log.Println("Full data sync completed")
 	return nil
 }
 
-// DeleteIPIndex deletes the IP index from Elasticsearch
-func DeleteIPIndex() error {
-	es := config.ESClient
-	req := esapi.IndicesDeleteRequest{
-		Index: []string{"ips"},
-	}
-	res, err := req.Do(context.Background(), es)
+// recreateIndex drops an index of the rule index and creates it empty
+func recreateIndex(index, name string) error {
+	err := GetRuleIndex().Recreate(context.Background(), index)
+	RefreshMappingStatus(context.Background())
 	if err != nil {
-		return err
-	}
-	defer res.Body.Close()
-
-	if res.IsError() && res.StatusCode != 404 {
-		return fmt.Errorf("error deleting IP index: %s", res.String())
+		return fmt.Errorf("error recreating %s index: %w", name, err)
 	}
 
-	log.Println("IP index deleted successfully")
+	log.Printf("%s index recreated successfully", name)
 	return nil
 }
 
-// DeleteEmailIndex deletes the email index from Elasticsearch
-func DeleteEmailIndex() error {
-	es := config.ESClient
-	req := esapi.IndicesDeleteRequest{
-		Index: []string{"emails"},
-	}
-	res, err := req.Do(context.Background(), es)
-	if err != nil {
-		return err
-	}
-	defer res.Body.Close()
-
-	if res.IsError() && res.StatusCode != 404 {
-		return fmt.Errorf("error deleting email index: %s", res.String())
-	}
+// DeleteIPIndex empties the IP index
+func DeleteIPIndex() error {
+	return recreateIndex(IndexIPs, "IP")
+}
 
-	log.Println("Email index deleted successfully")
-	return nil
+// DeleteEmailIndex empties the email index
+func DeleteEmailIndex() error {
+	return recreateIndex(IndexEmails, "Email")
 }
 
-// DeleteUserAgentIndex deletes the user agent index from Elasticsearch
+// DeleteUserAgentIndex empties the user agent index
 func DeleteUserAgentIndex() error {
-	es := config.ESClient
-	req := esapi.IndicesDeleteRequest{
-		Index: []string{"user-agents"},
-	}
-	res, err := req.Do(context.Background(), es)
-	if err != nil {
-		return err
-	}
-	defer res.Body.Close()
-
-	if res.IsError() && res.StatusCode != 404 {
-		return fmt.Errorf("error deleting user agent index: %s", res.String())
-	}
-
-	log.Println("User agent index deleted successfully")
-	return nil
+	return recreateIndex(IndexUserAgents, "User agent")
 }
 
-// DeleteCountryIndex deletes the country index from Elasticsearch
+// DeleteCountryIndex empties the country index
 func DeleteCountryIndex() error {
-	es := config.ESClient
-	req := esapi.IndicesDeleteRequest{
-		Index: []string{"countries"},
-	}
-	res, err := req.Do(context.Background(), es)
-	if err != nil {
-		return err
-	}
-	defer res.Body.Close()
-
-	if res.IsError() && res.StatusCode != 404 {
-		return fmt.Errorf("error deleting country index: %s", res.String())
-	}
-
-	log.Println("Country index deleted successfully")
-	return nil
+	return recreateIndex(IndexCountries, "Country")
 }
 
-// DeleteCharsetIndex deletes the charset index from Elasticsearch
+// DeleteCharsetIndex empties the charset index
 func DeleteCharsetIndex() error {
-	es := config.ESClient
-	req := esapi.IndicesDeleteRequest{
-		Index: []string{"charsets"},
-	}
-	res, err := req.Do(context.Background(), es)
-	if err != nil {
-		return err
-	}
-	defer res.Body.Close()
-
-	if res.IsError() && res.StatusCode != 404 {
-		return fmt.Errorf("error deleting charset index: %s", res.String())
-	}
-
-	log.Println("Charset index deleted successfully")
-	return nil
+	return recreateIndex(IndexCharsets, "Charset")
 }
 
-// DeleteUsernameIndex deletes the username index from Elasticsearch
+// DeleteUsernameIndex empties the username index
 func DeleteUsernameIndex() error {
-	es := config.ESClient
-	req := esapi.IndicesDeleteRequest{
-		Index: []string{"usernames"},
-	}
-	res, err := req.Do(context.Background(), es)
-	if err != nil {
-		return err
-	}
-	defer res.Body.Close()
-
-	if res.IsError() && res.StatusCode != 404 {
-		return fmt.Errorf("error deleting username index: %s", res.String())
-	}
-
-	log.Println("Username index deleted successfully")
-	return nil
+	return recreateIndex(IndexUsernames, "Username")
 }
 
-// DeleteASNIndex deletes the ASN index from Elasticsearch
+// DeleteASNIndex empties the ASN index
 func DeleteASNIndex() error {
-	es := config.ESClient
-	req := esapi.IndicesDeleteRequest{
-		Index: []string{"asns"},
-	}
-	res, err := req.Do(context.Background(), es)
-	if err != nil {
-		return err
-	}
-	defer res.Body.Close()
-
-	if res.IsError() && res.StatusCode != 404 {
-		return fmt.Errorf("error deleting ASN index: %s", res.String())
-	}
-
-	log.Println("ASN index deleted successfully")
-	return nil
+	return recreateIndex(IndexASNs, "ASN")
 }
@@ -0,0 +1,68 @@
+package services
+
+import "strings"
+
+// domainIndex matches email domains against domain rules with one map lookup per label:
+// "example.com" matches the domain only, "*.example.com" the domain and all of its
+// subdomains and "*.xyz" a whole TLD
+type domainIndex struct {
+	exact    map[string]*compiledRule
+	suffixes map[string]*compiledRule
+}
+
+func newDomainIndex() *domainIndex {
+	return &domainIndex{exact: make(map[string]*compiledRule), suffixes: make(map[string]*compiledRule)}
+}
+
+// normalizeDomain lower-cases a domain and removes surrounding whitespace and a trailing dot
+func normalizeDomain(domain string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(domain)), ".")
+}
+
+// emailDomain returns the normalized domain part of an email address
+func emailDomain(email string) string {
+	at := strings.LastIndexByte(email, '@')
+	if at < 0 {
+		return ""
+	}
+	return normalizeDomain(email[at+1:])
+}
+
+// add registers a rule; empty domains are skipped
+func (d *domainIndex) add(id uint, domain, status string, priority int) bool {
+	rule := &compiledRule{ID: id, Value: domain, Status: status, Priority: priority, Type: "domain"}
+	key, wildcard := strings.CutPrefix(normalizeDomain(domain), "*.")
+	if key == "" || strings.Contains(key, "*") {
+		return false
+	}
+	if !wildcard {
+		addExact(d.exact, key, rule)
+		return true
+	}
+	rule.Type = "subdomain"
+	rule.bits = strings.Count(key, ".") + 1
+	addExact(d.suffixes, key, rule)
+	return true
+}
+
+// match returns the highest ranked rule for domain, checking the domain and each of its parent domains
+func (d *domainIndex) match(domain string) *compiledRule {
+	if domain == "" {
+		return nil
+	}
+	best := d.exact[domain]
+	for suffix := domain; ; {
+		if rule := d.suffixes[suffix]; rule != nil && rule.outranks(best) {
+			best = rule
+		}
+		dot := strings.IndexByte(suffix, '.')
+		if dot < 0 {
+			return best
+		}
+		suffix = suffix[dot+1:]
+	}
+}
+
+func (d *domainIndex) len() int {
+	return len(d.exact) + len(d.suffixes)
+}
@@ -0,0 +1,112 @@
+package services
+
+import (
+	"strings"
+	"sync"
+
+	"firewall/config"
+
+	"golang.org/x/net/idna"
+)
+
+// emailProvider holds the alias rules of one mail provider
+type emailProvider struct {
+	canonicalDomain string
+	stripDots       bool
+	separators      []string
+	caseFold        bool
+}
+
+// emailNormalizer canonicalizes email addresses with the configured provider rules
+type emailNormalizer struct {
+	enabled   bool
+	caseFold  bool
+	providers map[string]*emailProvider // by ASCII domain
+}
+
+var (
+	emailNormalizerInstance *emailNormalizer
+	emailNormalizerOnce     sync.Once
+)
+
+// getEmailNormalizer returns the normalizer built from filtering.email_normalization
+func getEmailNormalizer() *emailNormalizer {
+	emailNormalizerOnce.Do(func() {
+		cfg := config.EmailNormalizationConfig{Enabled: true, DefaultCaseFold: true, Providers: config.DefaultEmailProviders}
+		if config.AppConfig != nil {
+			cfg = config.AppConfig.Filtering.EmailNormalization
+		}
+		emailNormalizerInstance = newEmailNormalizer(cfg)
+	})
+	return emailNormalizerInstance
+}
+
+func newEmailNormalizer(cfg config.EmailNormalizationConfig) *emailNormalizer {
+	n := &emailNormalizer{enabled: cfg.Enabled, caseFold: cfg.DefaultCaseFold, providers: make(map[string]*emailProvider)}
+	for _, p := range cfg.Providers {
+		provider := &emailProvider{
+			canonicalDomain: asciiDomain(p.CanonicalDomain),
+			stripDots:       p.StripDots,
+			separators:      p.SubaddressSeparators,
+			caseFold:        p.CaseFold,
+		}
+		for _, domain := range p.Domains {
+			n.providers[asciiDomain(domain)] = provider
+		}
+	}
+	return n
+}
+
+// asciiDomain returns the lower-case punycode form of a domain (bücher.de -> xn--bcher-kva.de);
+// domains that are not valid IDNs are only lower-cased
+func asciiDomain(domain string) string {
+	domain = normalizeDomain(domain)
+	if ascii, err := idna.Lookup.ToASCII(domain); err == nil {
+		return ascii
+	}
+	return domain
+}
+
+// NormalizeEmail returns the canonical form of an address, so aliases of one mailbox
+// (J.Doe+news@googlemail.com, jdoe@gmail.com) match the same rules.
+// The result is stable: normalizing a canonical address returns it unchanged.
+func NormalizeEmail(email string) string {
+	return getEmailNormalizer().normalize(email)
+}
+
+func (n *emailNormalizer) normalize(email string) string {
+	email = strings.TrimSpace(email)
+	if strings.Count(email, "@") != 1 {
+		return strings.ToLower(email) // Invalid email format, only lower-cased
+	}
+	at := strings.IndexByte(email, '@')
+	local, domain := email[:at], asciiDomain(email[at+1:])
+
+	if !n.enabled {
+		return strings.ToLower(local) + "@" + domain
+	}
+	provider := n.providers[domain]
+	if provider == nil {
+		if n.caseFold {
+			local = strings.ToLower(local)
+		}
+		return local + "@" + domain
+	}
+
+	if provider.caseFold {
+		local = strings.ToLower(local)
+	}
+	for _, separator := range provider.separators {
+		// A leading separator is part of the name, not a sub-address
+		if i := strings.Index(local, separator); i > 0 {
+			local = local[:i]
+		}
+	}
+	if provider.stripDots {
+		local = strings.ReplaceAll(local, ".", "")
+	}
+	if provider.canonicalDomain != "" {
+		domain = provider.canonicalDomain
+	}
+	return local + "@" + domain
+}
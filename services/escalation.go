@@ -0,0 +1,303 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"firewall/config"
+	"firewall/models"
+	"firewall/utils"
+	"fmt"
+	"log"
+	"net/netip"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// escalationSource marks the rules created by the escalation service
+const escalationSource = "auto_escalation"
+
+// escalationColumns maps an escalation field to its traffic log column
+var escalationColumns = map[string]string{
+	"ip":       "ip_address",
+	"email":    "canonical_email",
+	"username": "username",
+}
+
+// EscalationService bans repeat offenders found in the traffic log with temporary denied rules
+type EscalationService struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+var (
+	escalationService     *EscalationService
+	escalationServiceOnce sync.Once
+)
+
+// GetEscalationService returns the singleton escalation service
+func GetEscalationService() *EscalationService {
+	escalationServiceOnce.Do(func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		escalationService = &EscalationService{
+			ctx:    ctx,
+			cancel: cancel,
+		}
+		escalationService.start()
+	})
+	return escalationService
+}
+
+// start begins the periodic scan if escalation is enabled
+func (es *EscalationService) start() {
+	cfg := config.AppConfig.Escalation
+	if !cfg.Enabled {
+		log.Println("Escalation service disabled")
+		return
+	}
+	if !config.AppConfig.Logging.TrafficLogging {
+		log.Println("Warning: escalation is enabled but traffic logging is disabled, no offenders will be found")
+	}
+
+	es.wg.Add(1)
+	go es.run(cfg.Interval)
+	log.Printf("Escalation service started (%d policies, interval: %v)", len(cfg.Policies), cfg.Interval)
+}
+
+func (es *EscalationService) run(interval time.Duration) {
+	defer es.wg.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	// Get distributed lock service
+	distributedLock := GetDistributedLock()
+
+	for {
+		select {
+		case <-ticker.C:
+			// Only one instance scans at a time, otherwise offenders would be banned twice
+			lockName := "escalation"
+			acquired, _ := distributedLock.TryAcquireLock(lockName, config.AppConfig.Locking.LockTTL)
+			if !acquired {
+				continue
+			}
+
+			bans, err := RunEscalation(config.DB, config.AppConfig.Escalation.Policies, time.Now())
+			if err != nil {
+				log.Printf("Escalation: %v", err)
+			} else if bans > 0 {
+				log.Printf("Escalation: banned %d repeat offenders", bans)
+			}
+
+			distributedLock.ReleaseLock(lockName)
+		case <-es.ctx.Done():
+			return
+		}
+	}
+}
+
+// Stop gracefully stops the escalation service
+func (es *EscalationService) Stop() {
+	es.cancel()
+	es.wg.Wait()
+	log.Println("Escalation service stopped")
+}
+
+// RunEscalation applies each policy once and returns the number of new bans
+func RunEscalation(db *gorm.DB, policies []config.EscalationPolicy, now time.Time) (int, error) {
+	bans := 0
+	for _, policy := range policies {
+		n, err := escalatePolicy(db, policy, now)
+		bans += n
+		if err != nil {
+			return bans, fmt.Errorf("policy %s: %w", policy.Name, err)
+		}
+	}
+	return bans, nil
+}
+
+// escalatePolicy bans every value that was denied more than policy.Threshold times within policy.Window
+func escalatePolicy(db *gorm.DB, policy config.EscalationPolicy, now time.Time) (int, error) {
+	column, ok := escalationColumns[policy.Field]
+	if !ok {
+		return 0, fmt.Errorf("unsupported field %q", policy.Field)
+	}
+
+	var candidates []struct {
+		Value   string
+		Denials int64
+	}
+	if err := db.Model(&models.TrafficLog{}).
+		Select(column+" AS value, COUNT(*) AS denials").
+		Where("final_result = ? AND timestamp >= ? AND "+column+" <> ''", "denied", now.Add(-policy.Window)).
+		Group(column).
+		Having("COUNT(*) > ?", policy.Threshold).
+		Scan(&candidates).Error; err != nil {
+		return 0, fmt.Errorf("failed to count denials: %w", err)
+	}
+
+	bans := 0
+	for _, candidate := range candidates {
+		banned, err := escalateValue(db, policy, column, candidate.Value, candidate.Denials, now)
+		if err != nil {
+			log.Printf("Escalation: failed to ban %s %q: %v", policy.Field, candidate.Value, err)
+			continue
+		}
+		if banned {
+			bans++
+		}
+	}
+	return bans, nil
+}
+
+// escalateValue bans one offender unless it is already banned or has a rule that was not created by escalation
+func escalateValue(db *gorm.DB, policy config.EscalationPolicy, column, logged string, denials int64, now time.Time) (bool, error) {
+	value, ok := escalationValue(policy.Field, logged)
+	if !ok {
+		return false, nil
+	}
+
+	var offense models.EscalationOffense
+	err := db.Where("policy = ? AND value = ?", policy.Name, value).First(&offense).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, err
+	}
+
+	found, source, err := findBanRule(db, policy.Field, value)
+	if err != nil {
+		return false, err
+	}
+	if found {
+		// Manual rules win; active bans are not renewed and expired ones are left to the janitor
+		if source != escalationSource {
+			log.Printf("Escalation: %s %q has a manual rule, not banning", policy.Field, value)
+		}
+		return false, nil
+	}
+
+	if offense.BannedUntil.After(now) {
+		// The ban was revoked before it ended; count new denials from now on
+		offense.BannedUntil = now
+		return false, db.Save(&offense).Error
+	}
+
+	// Denials during the last ban (caused by the ban itself) do not count again
+	if since := now.Add(-policy.Window); offense.BannedUntil.After(since) {
+		if err := db.Model(&models.TrafficLog{}).
+			Where(column+" = ? AND final_result = ? AND timestamp > ?", logged, "denied", offense.BannedUntil).
+			Count(&denials).Error; err != nil {
+			return false, err
+		}
+		if denials <= int64(policy.Threshold) {
+			return false, nil
+		}
+	}
+
+	duration, offenses := banDuration(policy, offense, now)
+	expiresAt := now.Add(duration)
+	ruleID, err := createBanRule(db, policy.Field, value, expiresAt)
+	if err != nil {
+		return false, err
+	}
+
+	offense.Policy = policy.Name
+	offense.Field = policy.Field
+	offense.Value = value
+	offense.Offenses = offenses
+	offense.RuleID = ruleID
+	offense.LastBanAt = now
+	offense.BannedUntil = expiresAt
+	if err := db.Save(&offense).Error; err != nil {
+		return true, err
+	}
+
+	log.Printf("Escalation: banned %s %q for %v (offense %d, %d denials, policy %s)", policy.Field, value, duration, offenses, denials, policy.Name)
+	return true, nil
+}
+
+// banDuration returns the length of the next ban and the new offense count. The ladder
+// restarts once policy.ResetAfter has passed since the end of the last ban
+func banDuration(policy config.EscalationPolicy, offense models.EscalationOffense, now time.Time) (time.Duration, int) {
+	offenses := offense.Offenses
+	if policy.ResetAfter > 0 && now.Sub(offense.BannedUntil) > policy.ResetAfter {
+		offenses = 0
+	}
+	step := min(offenses, len(policy.BanDurations)-1)
+	return policy.BanDurations[step], offenses + 1
+}
+
+// escalationValue returns the value as stored in the rule tables; invalid values are not banned
+func escalationValue(field, value string) (string, bool) {
+	switch field {
+	case "ip":
+		addr, err := netip.ParseAddr(value)
+		if err != nil {
+			return "", false
+		}
+		return utils.NormalizeAddr(addr).String(), true
+	case "email":
+		return value, len(value) <= 254
+	case "username":
+		return value, len(value) <= 100
+	}
+	return "", false
+}
+
+// findBanRule looks up the rule of a value in the table of its field
+func findBanRule(db *gorm.DB, field, value string) (bool, string, error) {
+	var err error
+	switch field {
+	case "ip":
+		var rule models.IP
+		if err = db.Where("address = ?", value).First(&rule).Error; err == nil {
+			return true, rule.Source, nil
+		}
+	case "email":
+		var rule models.Email
+		if err = db.Where("address = ?", value).First(&rule).Error; err == nil {
+			return true, rule.Source, nil
+		}
+	case "username":
+		var rule models.UsernameRule
+		if err = db.Where("username = ?", value).First(&rule).Error; err == nil {
+			return true, rule.Source, nil
+		}
+	default:
+		return false, "", fmt.Errorf("unsupported field %q", field)
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, "", nil
+	}
+	return false, "", err
+}
+
+// createBanRule creates a temporary denied rule and publishes it like the rule controllers do
+func createBanRule(db *gorm.DB, field, value string, expiresAt time.Time) (uint, error) {
+	validity := models.RuleValidity{ExpiresAt: &expiresAt}
+	switch field {
+	case "ip":
+		rule := models.IP{Address: value, Status: "denied", Source: escalationSource, RuleValidity: validity}
+		if err := db.Create(&rule).Error; err != nil {
+			return 0, err
+		}
+		PublishEvent("ip", "created", rule)
+		return rule.ID, nil
+	case "email":
+		rule := models.Email{Address: value, Status: "denied", Source: escalationSource, RuleValidity: validity}
+		if err := db.Create(&rule).Error; err != nil {
+			return 0, err
+		}
+		PublishEvent("email", "created", rule)
+		return rule.ID, nil
+	case "username":
+		rule := models.UsernameRule{Username: value, Status: "denied", Source: escalationSource, RuleValidity: validity}
+		if err := db.Create(&rule).Error; err != nil {
+			return 0, err
+		}
+		PublishEvent("username", "created", rule)
+		return rule.ID, nil
+	}
+	return 0, fmt.Errorf("unsupported field %q", field)
+}
@@ -0,0 +1,58 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"firewall/config"
+	"firewall/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBanDuration(t *testing.T) {
+	policy := config.EscalationPolicy{
+		BanDurations: []time.Duration{time.Hour, 6 * time.Hour, 24 * time.Hour, 7 * 24 * time.Hour},
+		ResetAfter:   30 * 24 * time.Hour,
+	}
+	now := time.Now()
+
+	tests := []struct {
+		name        string
+		offense     models.EscalationOffense
+		duration    time.Duration
+		newOffenses int
+	}{
+		{"first offense", models.EscalationOffense{}, time.Hour, 1},
+		{"second offense", models.EscalationOffense{Offenses: 1, BannedUntil: now.Add(-time.Hour)}, 6 * time.Hour, 2},
+		{"fourth offense", models.EscalationOffense{Offenses: 3, BannedUntil: now.Add(-time.Hour)}, 7 * 24 * time.Hour, 4},
+		{"last step repeats", models.EscalationOffense{Offenses: 9, BannedUntil: now.Add(-time.Hour)}, 7 * 24 * time.Hour, 10},
+		{"ladder resets", models.EscalationOffense{Offenses: 3, BannedUntil: now.Add(-31 * 24 * time.Hour)}, time.Hour, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			duration, offenses := banDuration(policy, tt.offense, now)
+			assert.Equal(t, tt.duration, duration)
+			assert.Equal(t, tt.newOffenses, offenses)
+		})
+	}
+}
+
+func TestEscalationValue(t *testing.T) {
+	value, ok := escalationValue("ip", "::ffff:203.0.113.7")
+	assert.True(t, ok)
+	assert.Equal(t, "203.0.113.7", value)
+
+	_, ok = escalationValue("ip", "not-an-ip")
+	assert.False(t, ok)
+
+	value, ok = escalationValue("email", "jdoe@gmail.com")
+	assert.True(t, ok)
+	assert.Equal(t, "jdoe@gmail.com", value)
+
+	_, ok = escalationValue("username", string(make([]byte, 101)))
+	assert.False(t, ok)
+
+	_, ok = escalationValue("country", "US")
+	assert.False(t, ok)
+}
@@ -99,6 +99,13 @@ func (ep *EventProcessor) processEvent(event Event) {
 			cache.InvalidateAll("email")
 			cache.InvalidateFilter("email")
 		}
+	case "email_domain":
+		ep.processEmailDomainEvent(event)
+		// Domain rules are part of the email filter
+		if event.Action == "created" || event.Action == "updated" || event.Action == "deleted" {
+			cache.InvalidateAll("email")
+			cache.InvalidateFilter("email")
+		}
 	case "user_agent":
 		ep.processUserAgentEvent(event)
 		// Invalidate cache for user agent-related data
@@ -126,9 +133,55 @@ func (ep *EventProcessor) processEvent(event Event) {
 			cache.InvalidateAll("username")
 			cache.InvalidateFilter("username")
 		}
+	case "content":
+		ep.processContentEvent(event)
+		// Invalidate cache for content-related data
+		if event.Action == "created" || event.Action == "updated" || event.Action == "deleted" {
+			cache.InvalidateAll("content")
+		}
+	case "velocity":
+		// Velocity rules only live in MySQL and the rule snapshot
+		if event.Action == "created" || event.Action == "updated" || event.Action == "deleted" {
+			cache.InvalidateAll("velocity")
+		}
+	case "composite":
+		// Composite rules only live in MySQL and the rule snapshot
+		if event.Action == "created" || event.Action == "updated" || event.Action == "deleted" {
+			cache.InvalidateAll("composite")
+		}
+	case "expression":
+		// Expression rules only live in MySQL and the rule snapshot
+		if event.Action == "created" || event.Action == "updated" || event.Action == "deleted" {
+			cache.InvalidateAll("expression")
+		}
+	case "geo":
+		// Geo rules only live in MySQL and the rule snapshot
+		if event.Action == "created" || event.Action == "updated" || event.Action == "deleted" {
+			cache.InvalidateAll("geo")
+		}
+	case "country_group":
+		// Country groups only live in MySQL and the rule snapshot
+		if event.Action == "created" || event.Action == "updated" || event.Action == "deleted" {
+			cache.InvalidateAll("country_group")
+		}
+	case "default_policy":
+		// Default policies change the decision for every unmatched value, drop the cached decisions
+		if event.Action == "updated" {
+			cache.InvalidateAll("filter")
+		}
+	case "asn":
+		// ASN documents are synced to Elasticsearch by the controllers
+		if event.Action == "created" || event.Action == "updated" || event.Action == "deleted" || event.Action == "imported" {
+			cache.InvalidateAll("asn")
+			cache.InvalidateFilter("asn")
+		}
 	default:
 		log.Printf("Unknown event type: %s", event.Type)
+		return
 	}
+
+	// Rebuild the in-memory rule snapshot used by EvaluateFilters
+	GetRuleEngine().RequestReload()
 }
 
 // Charset-Event-Handler
@@ -160,9 +213,21 @@ func (ep *EventProcessor) processIPEvent(event Event) {
 				QueueForRetry("sync_ip", ipData)
 			}
 		}
+	case "imported":
+		// List imports (e.g. StopForumSpam) publish the source instead of every rule
+		if data, ok := event.Data.(map[string]interface{}); ok {
+			if source, ok := data["source"].(string); ok && source != "" {
+				if err := SyncIPsFromSource(source); err != nil {
+					log.Printf("Error indexing imported IPs from %s: %v", source, err)
+				}
+			}
+		}
 	case "deleted":
-		// Handle deletion if needed
-		log.Printf("IP deletion event received")
+		if ipData, ok := event.Data.(models.IP); ok {
+			if err := DeleteIPFromES(ipData.ID); err != nil {
+				log.Printf("Error deleting IP from ES: %v", err)
+			}
+		}
 	}
 }
 
@@ -177,7 +242,11 @@ func (ep *EventProcessor) processEmailEvent(event Event) {
 			}
 		}
 	case "deleted":
-		log.Printf("Email deletion event received")
+		if emailData, ok := event.Data.(models.Email); ok {
+			if err := DeleteEmailFromES(emailData.ID); err != nil {
+				log.Printf("Error deleting email from ES: %v", err)
+			}
+		}
 	}
 }
 
@@ -192,7 +261,11 @@ func (ep *EventProcessor) processUserAgentEvent(event Event) {
 			}
 		}
 	case "deleted":
-		log.Printf("User agent deletion event received")
+		if userAgentData, ok := event.Data.(models.UserAgent); ok {
+			if err := DeleteUserAgentFromES(userAgentData.ID); err != nil {
+				log.Printf("Error deleting user agent from ES: %v", err)
+			}
+		}
 	}
 }
 
@@ -207,7 +280,12 @@ func (ep *EventProcessor) processCountryEvent(event Event) {
 			}
 		}
 	case "deleted":
-		log.Printf("Country deletion event received")
+		// Country documents are keyed by code, which delete requests by ID do not carry
+		if countryData, ok := event.Data.(models.Country); ok && countryData.Code != "" {
+			if err := DeleteCountryFromES(countryData.Code); err != nil {
+				log.Printf("Error deleting country from ES: %v", err)
+			}
+		}
 	}
 }
 
@@ -229,6 +307,42 @@ func (ep *EventProcessor) processUsernameEvent(event Event) {
 	}
 }
 
+// processEmailDomainEvent handles email domain rule events
+func (ep *EventProcessor) processEmailDomainEvent(event Event) {
+	switch event.Action {
+	case "created", "updated":
+		if domainData, ok := event.Data.(models.EmailDomainRule); ok {
+			if err := SyncEmailDomainToES(domainData); err != nil {
+				log.Printf("Error indexing email domain: %v", err)
+			}
+		}
+	case "deleted":
+		if domainData, ok := event.Data.(models.EmailDomainRule); ok {
+			if err := DeleteEmailDomainFromES(domainData.ID); err != nil {
+				log.Printf("Error deleting email domain from ES: %v", err)
+			}
+		}
+	}
+}
+
+// processContentEvent handles content rule events
+func (ep *EventProcessor) processContentEvent(event Event) {
+	switch event.Action {
+	case "created", "updated":
+		if contentData, ok := event.Data.(models.ContentRule); ok {
+			if err := SyncContentRuleToES(contentData); err != nil {
+				log.Printf("Error indexing content rule: %v", err)
+			}
+		}
+	case "deleted":
+		if contentData, ok := event.Data.(models.ContentRule); ok {
+			if err := DeleteContentRuleFromES(contentData.ID); err != nil {
+				log.Printf("Error deleting content rule from ES: %v", err)
+			}
+		}
+	}
+}
+
 // Stop gracefully stops the event processor
 func (ep *EventProcessor) Stop() {
 	ep.cancel()
@@ -0,0 +1,242 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"firewall/config"
+	"firewall/expression"
+	"firewall/models"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ExpressionVars are the request variables available to expression rules
+var ExpressionVars = expression.Vars{
+	"ip":         expression.String,
+	"email":      expression.String, // canonical email
+	"user_agent": expression.String,
+	"country":    expression.String, // resolved from the IP when not sent
+	"asn":        expression.String, // resolved from the IP when not sent, e.g. "AS16509"
+	"asn_org":    expression.String, // organization of the ASN, e.g. "Amazon.com, Inc."
+	"username":   expression.String,
+	"content":    expression.String,
+	"charset":    expression.String, // charset of the first non-empty enabled charset field
+	"charsets":   expression.Map,    // charset per enabled charset field
+	"fields":     expression.Map,    // the request body as sent, including custom JSON fields
+}
+
+// defaultExpressionTimeout is used when filtering.expression_timeout is not configured
+const defaultExpressionTimeout = 10 * time.Millisecond
+
+// maxCachedPrograms bounds the compiled program cache; it is reset when full
+const maxCachedPrograms = 10000
+
+var (
+	programCacheMu sync.Mutex
+	programCache   = make(map[string]*expression.Program)
+)
+
+// CompileExpression compiles an expression rule against ExpressionVars; programs are cached by source,
+// so rule reloads only compile new or changed expressions
+func CompileExpression(source string) (*expression.Program, error) {
+	programCacheMu.Lock()
+	program, found := programCache[source]
+	programCacheMu.Unlock()
+	if found {
+		return program, nil
+	}
+
+	program, err := expression.Compile(source, ExpressionVars)
+	if err != nil {
+		return nil, err
+	}
+
+	programCacheMu.Lock()
+	if len(programCache) >= maxCachedPrograms {
+		programCache = make(map[string]*expression.Program)
+	}
+	programCache[source] = program
+	programCacheMu.Unlock()
+	return program, nil
+}
+
+// expressionStats counts the evaluations of expression rules
+var expressionStats struct {
+	evaluations atomic.Int64
+	matches     atomic.Int64
+	errors      atomic.Int64
+	timeouts    atomic.Int64
+}
+
+// ExpressionStats returns the evaluation counters of the expression rules since startup
+func ExpressionStats() map[string]int64 {
+	return map[string]int64{
+		"evaluations": expressionStats.evaluations.Load(),
+		"matches":     expressionStats.matches.Load(),
+		"errors":      expressionStats.errors.Load(),
+		"timeouts":    expressionStats.timeouts.Load(),
+	}
+}
+
+// expressionTimeout returns the configured time budget of the expression rules per request
+func expressionTimeout() time.Duration {
+	if config.AppConfig != nil && config.AppConfig.Filtering.ExpressionTimeout > 0 {
+		return config.AppConfig.Filtering.ExpressionTimeout
+	}
+	return defaultExpressionTimeout
+}
+
+// expressionEnv provides the request variables; the ASN organization and the charsets are
+// only resolved when an expression uses them
+type expressionEnv struct {
+	input    *FilterInput
+	asnOrg   *string
+	charsets map[string]interface{}
+	charset  string
+}
+
+func (e *expressionEnv) Get(name string) interface{} {
+	switch name {
+	case "asn_org":
+		if e.asnOrg == nil {
+			org := ""
+			if e.input.IP != "" {
+				org = GetASNOrgFromIPWithFallback(e.input.IP)
+			}
+			e.asnOrg = &org
+		}
+		return *e.asnOrg
+	case "charset", "charsets":
+		if e.charsets == nil {
+			e.detectCharsets()
+		}
+		if name == "charset" {
+			return e.charset
+		}
+		return e.charsets
+	case "fields":
+		if e.input.Raw != nil {
+			return e.input.Raw
+		}
+		fields := make(map[string]interface{}, len(e.input.Fields))
+		for k, v := range e.input.Fields {
+			fields[k] = v
+		}
+		return fields
+	}
+	return e.input.Value(name)
+}
+
+// detectCharsets detects the charsets of the enabled charset fields, like the charset filter
+func (e *expressionEnv) detectCharsets() {
+	e.charsets = make(map[string]interface{})
+	for _, field := range GetCharsetFieldsConfig().GetEnabledFields() {
+		value := e.input.RawValue(field)
+		if value == "" {
+			continue
+		}
+		charset := detectCharset(value)
+		e.charsets[field] = charset
+		if e.charset == "" {
+			e.charset = charset
+		}
+	}
+}
+
+// expressionRule is a compiled expression rule
+type expressionRule struct {
+	*compiledRule
+	program *expression.Program
+}
+
+// newExpressionRule compiles an expression rule; it returns nil if the expression does not compile
+func newExpressionRule(r models.ExpressionRule) *expressionRule {
+	program, err := CompileExpression(r.Expression)
+	if err != nil {
+		return nil
+	}
+	return &expressionRule{
+		compiledRule: &compiledRule{ID: r.ID, Value: r.Name, Status: r.Status, Priority: r.Priority, Type: "expression"},
+		program:      program,
+	}
+}
+
+// expressionIndex holds the expression rules of a snapshot, ordered by precedence
+type expressionIndex struct {
+	rules []*expressionRule
+}
+
+func (ei *expressionIndex) add(rule *expressionRule) bool {
+	if rule == nil {
+		return false
+	}
+	ei.rules = append(ei.rules, rule)
+	return true
+}
+
+func (ei *expressionIndex) sort() {
+	sort.SliceStable(ei.rules, func(i, j int) bool {
+		return ei.rules[i].outranks(ei.rules[j].compiledRule)
+	})
+}
+
+// match returns the highest ranked rule whose expression is true; rules that fail at runtime
+// or run out of time do not match
+func (ei *expressionIndex) match(ctx context.Context, env *expressionEnv) *expressionRule {
+	for _, rule := range ei.rules {
+		expressionStats.evaluations.Add(1)
+		matched, err := rule.program.Eval(ctx, env)
+		if err != nil {
+			if errors.Is(err, expression.ErrTimeout) {
+				expressionStats.timeouts.Add(1)
+				// The budget is spent, the remaining rules would time out as well
+				return nil
+			}
+			expressionStats.errors.Add(1)
+			continue
+		}
+		if matched {
+			expressionStats.matches.Add(1)
+			return rule
+		}
+	}
+	return nil
+}
+
+func (ei *expressionIndex) len() int {
+	return len(ei.rules)
+}
+
+// expressionFilter runs the expression rules; country and asn are resolved before the filters run
+type expressionFilter struct{}
+
+func (expressionFilter) Name() string { return "expression" }
+
+// Fields returns the standard fields while there are expression rules; without rules the filter does not run
+func (expressionFilter) Fields() []string {
+	snapshot := GetRuleEngine().Snapshot()
+	if snapshot.expression.len() == 0 && snapshot.Monitor().expression.len() == 0 {
+		return nil
+	}
+	return []string{"ip", "email", "user_agent", "country", "asn", "username", "content"}
+}
+
+func (expressionFilter) Evaluate(ctx context.Context, input *FilterInput) FilterResult {
+	snapshot := GetRuleEngine().Snapshot()
+
+	// One time budget for all expression rules of the request
+	ctx, cancel := context.WithTimeout(ctx, expressionTimeout())
+	defer cancel()
+	env := &expressionEnv{input: input}
+
+	result := FilterResult{Result: "allowed", Field: "expression"}
+	if rule := snapshot.expression.match(ctx, env); rule != nil {
+		result = ruleResult(rule.compiledRule, "expression", "expression", rule.Value)
+	}
+	if monitor := snapshot.Monitor().expression.match(ctx, env); monitor != nil {
+		result = withMonitorHit(result, monitor.compiledRule, "expression", monitor.Value)
+	}
+	return result
+}
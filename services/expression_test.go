@@ -0,0 +1,118 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"firewall/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompileExpression(t *testing.T) {
+	program, err := CompileExpression(`country in ["RU","CN"] && asn_org.contains("Hosting") && len(username) > 20`)
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{"asn_org", "country", "username"}, program.Vars())
+	}
+
+	// Compiled programs are cached by source
+	again, err := CompileExpression(program.Source())
+	assert.NoError(t, err)
+	assert.Same(t, program, again)
+
+	_, err = CompileExpression(`usernme == "x"`)
+	assert.ErrorContains(t, err, `did you mean "username"?`)
+	assert.Nil(t, newExpressionRule(models.ExpressionRule{ID: 1, Name: "bad", Expression: `len(country`, Status: "denied"}))
+}
+
+func TestExpressionEnv(t *testing.T) {
+	input := NewFilterInput(map[string]interface{}{
+		"ip":       "203.0.113.7",
+		"username": "alice",
+		"plan":     "free",
+		"age_days": float64(2),
+		"tags":     []interface{}{"trial"},
+	})
+	env := &expressionEnv{input: input}
+
+	assert.Equal(t, "203.0.113.7", env.Get("ip"))
+	assert.Equal(t, "alice", env.Get("username"))
+	assert.Equal(t, "", env.Get("country"))
+	fields := env.Get("fields").(map[string]interface{})
+	assert.Equal(t, "free", fields["plan"])
+	assert.Equal(t, float64(2), fields["age_days"])
+
+	// Inputs built without a request body expose their string fields
+	env = &expressionEnv{input: &FilterInput{Fields: map[string]string{"plan": "pro"}}}
+	assert.Equal(t, map[string]interface{}{"plan": "pro"}, env.Get("fields"))
+}
+
+func TestFilterInput_CacheKeyRawFields(t *testing.T) {
+	a := NewFilterInput(map[string]interface{}{"ip": "203.0.113.7", "age_days": float64(2)})
+	b := NewFilterInput(map[string]interface{}{"ip": "203.0.113.7", "age_days": float64(30)})
+	assert.NotEqual(t, a.CacheKey(), b.CacheKey())
+}
+
+func TestEvaluateFilterInput_Expression(t *testing.T) {
+	engine := GetRuleEngine()
+	previous := engine.Snapshot()
+	defer engine.snapshot.Store(previous)
+
+	engine.snapshot.Store(BuildRuleSnapshot(RuleSet{
+		Expressions: []models.ExpressionRule{
+			{ID: 1, Name: "long usernames from RU/CN", Status: "denied", Expression: `country in ["RU","CN"] && len(username) > 20`},
+			{ID: 2, Name: "trusted partner", Status: "whitelisted", Priority: 10, Expression: `fields.partner_id == 42`},
+			{ID: 3, Name: "new accounts", Status: "monitor", Expression: `fields.age_days < 7`},
+			{ID: 4, Name: "runtime error", Status: "denied", Priority: 5, Expression: `fields.age_days / 0 > 1`},
+			{ID: 5, Name: "does not compile", Status: "denied", Expression: `len(`},
+		},
+	}))
+	assert.Equal(t, 3, engine.Snapshot().Stats()["expression"])
+	assert.Equal(t, 1, engine.Snapshot().Monitor().Stats()["expression"])
+	assert.Equal(t, 1, engine.Snapshot().Stats()["skipped"])
+
+	before := ExpressionStats()
+	result, err := EvaluateFilterInput(context.Background(), NewFilterInput(map[string]interface{}{
+		"country": "RU", "username": "a_very_long_generated_username", "age_days": float64(2),
+	}))
+	assert.NoError(t, err)
+	assert.Equal(t, "denied", result.Result)
+	assert.Equal(t, "expression denied", result.Reason)
+	assert.Equal(t, "long usernames from RU/CN", result.Value)
+	assert.Equal(t, uint(1), result.RuleID)
+	if assert.Len(t, result.Trace.Monitor, 1) {
+		assert.Equal(t, "expression", result.Trace.Monitor[0].Filter)
+		assert.Equal(t, uint(3), result.Trace.Monitor[0].RuleID)
+	}
+	after := ExpressionStats()
+	assert.Equal(t, int64(1), after["errors"]-before["errors"])
+	assert.Equal(t, int64(2), after["matches"]-before["matches"])
+
+	// The higher priority rule wins
+	result, err = EvaluateFilterInput(context.Background(), NewFilterInput(map[string]interface{}{
+		"country": "RU", "username": "a_very_long_generated_username", "partner_id": float64(42),
+	}))
+	assert.NoError(t, err)
+	assert.Equal(t, "whitelisted", result.Result)
+	assert.Equal(t, uint(2), result.RuleID)
+
+	result, err = EvaluateFilterInput(context.Background(), NewFilterInput(map[string]interface{}{
+		"country": "DE", "username": "a_very_long_generated_username",
+	}))
+	assert.NoError(t, err)
+	assert.Equal(t, "allowed", result.Result)
+}
+
+func TestExpressionIndex_Timeout(t *testing.T) {
+	index := &expressionIndex{}
+	index.add(newExpressionRule(models.ExpressionRule{ID: 1, Name: "slow", Status: "denied", Expression: `username == "x"`}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Nanosecond)
+	defer cancel()
+	<-ctx.Done()
+
+	before := ExpressionStats()
+	assert.Nil(t, index.match(ctx, &expressionEnv{input: &FilterInput{Username: "x"}}))
+	assert.Equal(t, int64(1), ExpressionStats()["timeouts"]-before["timeouts"])
+}
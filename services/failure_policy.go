@@ -0,0 +1,132 @@
+package services
+
+import (
+	"context"
+	"firewall/config"
+	"log"
+	"sync"
+)
+
+// Failure policies for filters that return an "error" result
+const (
+	FailOpen      = "fail-open"      // The filter is ignored
+	FailClosed    = "fail-closed"    // The filter denies the request
+	MySQLFallback = "mysql-fallback" // The filter's own fallback, else the rules are reloaded from MySQL and the filter runs again; fails open if it still errors
+)
+
+// fallbackFilter is a filter with side effects (e.g. the velocity counters) that must not
+// simply run again; under mysql-fallback its Fallback replaces the reload and the second run
+type fallbackFilter interface {
+	Filter
+	Fallback(ctx context.Context, input *FilterInput) FilterResult
+}
+
+// failurePolicy returns the policy of a filter: filtering.failure_policies, then filtering.failure_policy
+func failurePolicy(filter string) string {
+	if config.AppConfig == nil {
+		return FailOpen
+	}
+	if policy, ok := config.AppConfig.Filtering.FailurePolicies[filter]; ok {
+		return policy
+	}
+	if policy := config.AppConfig.Filtering.FailurePolicy; policy != "" {
+		return policy
+	}
+	return FailOpen
+}
+
+// applyFailurePolicies replaces the error verdicts according to the failure policy of their
+// filter and reports whether any filter failed. The verdicts keep their order.
+func applyFailurePolicies(ctx context.Context, input *FilterInput, filters []Filter, verdicts []FilterVerdict) ([]FilterVerdict, bool) {
+	degraded := false
+	for i := range verdicts {
+		v := &verdicts[i]
+		if v.Result != "error" {
+			continue
+		}
+		degraded = true
+		log.Printf("Filter %s failed: %s", v.Filter, v.Reason)
+
+		policy := failurePolicy(v.Filter)
+		if policy == MySQLFallback {
+			if result, ok := mysqlFallback(ctx, input, filters, v.Filter); ok {
+				v.FilterResult = result
+				v.FailurePolicy = policy
+				continue
+			}
+			policy = FailOpen
+		}
+
+		v.FailurePolicy = policy
+		if policy == FailClosed {
+			v.FilterResult = FilterResult{Result: "denied", Reason: v.Filter + " unavailable", Field: v.Field, Value: v.Value}
+		}
+	}
+	if degraded {
+		recordDegradedDecision(verdicts)
+	}
+	return verdicts, degraded
+}
+
+// mysqlFallback runs the fallback of the filter, or reloads the rule snapshot from MySQL
+// and evaluates the filter again
+func mysqlFallback(ctx context.Context, input *FilterInput, filters []Filter, name string) (FilterResult, bool) {
+	for _, f := range filters {
+		if f.Name() != name {
+			continue
+		}
+		if fb, ok := f.(fallbackFilter); ok {
+			result := fb.Fallback(ctx, input)
+			return result, result.Result != "error"
+		}
+		if err := GetRuleEngine().Refresh(config.DB); err != nil {
+			log.Printf("Filter %s: MySQL fallback failed: %v", name, err)
+			return FilterResult{}, false
+		}
+		result := f.Evaluate(ctx, input)
+		return result, result.Result != "error"
+	}
+	return FilterResult{}, false
+}
+
+// degradedStats counts the decisions made while a filter was failing
+var degradedStats = struct {
+	sync.Mutex
+	total    int64
+	byFilter map[string]int64
+	byPolicy map[string]int64
+}{byFilter: make(map[string]int64), byPolicy: make(map[string]int64)}
+
+func recordDegradedDecision(verdicts []FilterVerdict) {
+	degradedStats.Lock()
+	defer degradedStats.Unlock()
+
+	degradedStats.total++
+	for _, v := range verdicts {
+		if v.FailurePolicy != "" {
+			degradedStats.byFilter[v.Filter]++
+			degradedStats.byPolicy[v.FailurePolicy]++
+		}
+	}
+}
+
+// DegradedDecisionStats returns the number of degraded decisions since the start, in total,
+// per failed filter and per applied failure policy
+func DegradedDecisionStats() map[string]interface{} {
+	degradedStats.Lock()
+	defer degradedStats.Unlock()
+
+	byFilter := make(map[string]int64, len(degradedStats.byFilter))
+	for filter, count := range degradedStats.byFilter {
+		byFilter[filter] = count
+	}
+	byPolicy := make(map[string]int64, len(degradedStats.byPolicy))
+	for policy, count := range degradedStats.byPolicy {
+		byPolicy[policy] = count
+	}
+	return map[string]interface{}{
+		"total":     degradedStats.total,
+		"by_filter": byFilter,
+		"by_policy": byPolicy,
+	}
+}
@@ -0,0 +1,135 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"firewall/config"
+	"firewall/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// failingFilter always reports a backend error
+type failingFilter struct{}
+
+func (failingFilter) Name() string     { return "failing" }
+func (failingFilter) Fields() []string { return []string{"ip"} }
+
+func (failingFilter) Evaluate(ctx context.Context, input *FilterInput) FilterResult {
+	return FilterResult{Result: "error", Reason: "backend unreachable", Field: "ip", Value: input.IP}
+}
+
+// failingCounter is a velocity counter whose backend is down; it counts the attempts
+type failingCounter struct{ adds int }
+
+func (f *failingCounter) Add(ctx context.Context, key, member string, now time.Time, window time.Duration) (int64, error) {
+	f.adds++
+	return 0, errors.New("redis: connection refused")
+}
+
+// withFailurePolicy sets the failure policies for the duration of a test
+func withFailurePolicy(t *testing.T, policy string, overrides map[string]string) {
+	previous := config.AppConfig.Filtering
+	config.AppConfig.Filtering.FailurePolicy = policy
+	config.AppConfig.Filtering.FailurePolicies = overrides
+	t.Cleanup(func() { config.AppConfig.Filtering = previous })
+}
+
+func TestFailurePolicy(t *testing.T) {
+	withFailurePolicy(t, FailClosed, map[string]string{"velocity": FailOpen})
+
+	assert.Equal(t, FailClosed, failurePolicy("ip"))
+	assert.Equal(t, FailOpen, failurePolicy("velocity"))
+}
+
+func TestApplyFailurePolicies(t *testing.T) {
+	verdicts := func() []FilterVerdict {
+		return []FilterVerdict{
+			{Filter: "ip", FilterResult: FilterResult{Result: "allowed", Field: "ip"}},
+			{Filter: "failing", FilterResult: FilterResult{Result: "error", Reason: "backend unreachable", Field: "ip", Value: "192.0.2.1"}},
+		}
+	}
+	input := &FilterInput{IP: "192.0.2.1"}
+	filters := []Filter{ipFilter{}, failingFilter{}}
+
+	withFailurePolicy(t, FailOpen, nil)
+	result, degraded := applyFailurePolicies(context.Background(), input, filters, verdicts())
+	assert.True(t, degraded)
+	assert.Equal(t, "error", result[1].Result)
+	assert.Equal(t, FailOpen, result[1].FailurePolicy)
+	assert.Equal(t, "allowed", resolveVerdicts(result, ResolutionAllowOverrides).Result)
+
+	withFailurePolicy(t, FailOpen, map[string]string{"failing": FailClosed})
+	result, degraded = applyFailurePolicies(context.Background(), input, filters, verdicts())
+	assert.True(t, degraded)
+	assert.Equal(t, "denied", result[1].Result)
+	assert.Equal(t, "failing unavailable", result[1].Reason)
+	assert.Equal(t, "denied", resolveVerdicts(result, ResolutionAllowOverrides).Result)
+
+	// The filter still fails after the fallback, so it fails open
+	withFailurePolicy(t, MySQLFallback, nil)
+	result, degraded = applyFailurePolicies(context.Background(), input, filters, verdicts())
+	assert.True(t, degraded)
+	assert.Equal(t, "error", result[1].Result)
+	assert.Equal(t, FailOpen, result[1].FailurePolicy)
+
+	// Without errors nothing changes
+	result, degraded = applyFailurePolicies(context.Background(), input, filters, verdicts()[:1])
+	assert.False(t, degraded)
+	assert.Empty(t, result[0].FailurePolicy)
+}
+
+func TestEvaluateFilterInput_Degraded(t *testing.T) {
+	RegisterFilter(failingFilter{})
+	defer UnregisterFilter("failing")
+	withFailurePolicy(t, FailClosed, nil)
+
+	before := DegradedDecisionStats()
+
+	result, err := EvaluateFilterInput(context.Background(), &FilterInput{IP: "192.0.2.1"})
+	assert.NoError(t, err)
+	assert.Equal(t, "denied", result.Result)
+	assert.Equal(t, "failing unavailable", result.Reason)
+	assert.True(t, result.Degraded)
+
+	stats := DegradedDecisionStats()
+	assert.Equal(t, before["total"].(int64)+1, stats["total"])
+	assert.Equal(t, before["by_filter"].(map[string]int64)["failing"]+1, stats["by_filter"].(map[string]int64)["failing"])
+}
+
+func TestMySQLFallback_Velocity(t *testing.T) {
+	engine := GetRuleEngine()
+	previous := engine.Snapshot()
+	defer engine.snapshot.Store(previous)
+	engine.snapshot.Store(BuildRuleSnapshot(RuleSet{
+		Velocities: []models.VelocityRule{
+			{ID: 9101, Name: "fallback signups per ip", KeyFields: "ip,action", Threshold: 1, Window: "1m", Status: "denied"},
+		},
+	}))
+
+	getVelocityCounter()
+	counter := &failingCounter{}
+	shared := velocityCounterInstance
+	velocityCounterInstance = counter
+	defer func() { velocityCounterInstance = shared }()
+	withFailurePolicy(t, FailOpen, map[string]string{"velocity": MySQLFallback})
+
+	evaluate := func() FilterResultWithResolvedData {
+		input := NewFilterInput(map[string]interface{}{"ip": "192.0.2.20", "action": "signup"})
+		result, err := EvaluateFilterInput(context.Background(), input)
+		assert.NoError(t, err)
+		assert.True(t, result.Degraded)
+		return result
+	}
+
+	// The in-memory counter takes over without counting the request twice in the shared one
+	assert.Equal(t, "allowed", evaluate().Result)
+	assert.Equal(t, 1, counter.adds)
+	result := evaluate()
+	assert.Equal(t, "denied", result.Result)
+	assert.Equal(t, uint(9101), result.RuleID)
+	assert.Equal(t, 2, counter.adds)
+}
@@ -0,0 +1,194 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Filter is a single check in the filter pipeline
+type Filter interface {
+	// Name identifies the filter; registering a filter with an existing name replaces it
+	Name() string
+	// Fields lists the input fields the filter reads; it only runs if one of them is set
+	Fields() []string
+	// Evaluate checks the input and returns allowed, denied or whitelisted
+	Evaluate(ctx context.Context, input *FilterInput) FilterResult
+}
+
+// FilterInput carries the request values shared by all filters.
+// Country and ASN hold the resolved values once EvaluateFilterInput has run.
+type FilterInput struct {
+	IP        string
+	Email     string // canonical email, see NormalizeEmail
+	UserAgent string
+	Country   string
+	ASN       string
+	Username  string
+	Content   string
+	Fields    map[string]string      // raw string fields of the request, including custom fields
+	Raw       map[string]interface{} // the request body as sent, including non-string custom fields
+	Geo       *GeoContext            // resolved from the IP before the filters run; shared, do not modify
+}
+
+// NewFilterInput extracts the standard fields and all string custom fields from a request body
+func NewFilterInput(input map[string]interface{}) *FilterInput {
+	fi := &FilterInput{Fields: make(map[string]string, len(input)), Raw: input}
+	for key := range input {
+		if value, ok := getFieldValue(input, key); ok {
+			fi.Fields[key] = value
+		}
+	}
+	fi.IP = fi.Fields["ip"]
+	fi.Email = NormalizeEmail(fi.Fields["email"])
+	fi.UserAgent = fi.Fields["user_agent"]
+	fi.Country = fi.Fields["country"]
+	fi.ASN = fi.Fields["asn"]
+	fi.Username = fi.Fields["username"]
+	fi.Content = fi.Fields["content"]
+	return fi
+}
+
+// getFieldValue dynamically retrieves a field value from the input map
+// This allows for custom fields to be checked for charset detection
+func getFieldValue(input map[string]interface{}, fieldName string) (string, bool) {
+	if value, exists := input[fieldName]; exists {
+		if strValue, ok := value.(string); ok {
+			return strValue, true
+		}
+	}
+	return "", false
+}
+
+// Value returns the (normalized) value of a field, falling back to custom fields
+func (fi *FilterInput) Value(field string) string {
+	switch field {
+	case "ip":
+		return fi.IP
+	case "email":
+		return fi.Email
+	case "user_agent":
+		return fi.UserAgent
+	case "country":
+		return fi.Country
+	case "asn":
+		return fi.ASN
+	case "username":
+		return fi.Username
+	case "content":
+		return fi.Content
+	}
+	return fi.Fields[field]
+}
+
+// RawValue returns the field as sent by the client, e.g. the email before normalization
+func (fi *FilterInput) RawValue(field string) string {
+	if value, ok := fi.Fields[field]; ok {
+		return value
+	}
+	return fi.Value(field)
+}
+
+// CacheKey builds the filter cache key from the request values (before country/ASN resolution);
+// content and custom fields are hashed
+func (fi *FilterInput) CacheKey() string {
+	key := "filter:" + fi.IP + ":" + fi.Email + ":" + fi.UserAgent + ":" + fi.Country + ":" + fi.ASN + ":" + fi.Username
+
+	var extra []string
+	for field, value := range fi.Fields {
+		switch field {
+		case "ip", "email", "user_agent", "country", "asn", "username":
+			continue
+		}
+		extra = append(extra, field+"="+value)
+	}
+	// Non-string fields can be used by expression rules
+	for field, value := range fi.Raw {
+		if _, ok := fi.Fields[field]; ok {
+			continue
+		}
+		data, _ := json.Marshal(value)
+		extra = append(extra, field+"="+string(data))
+	}
+	if len(extra) == 0 {
+		return key
+	}
+	sort.Strings(extra)
+	sum := sha256.Sum256([]byte(strings.Join(extra, "\x00")))
+	return key + ":" + hex.EncodeToString(sum[:8])
+}
+
+// Cacheable reports whether the decision for the input may be cached; requests counted
+// by velocity rules are not, every one of them has to reach the counters
+func (fi *FilterInput) Cacheable() bool {
+	snapshot := GetRuleEngine().Snapshot()
+	return !snapshot.velocity.counts(fi) && !snapshot.Monitor().velocity.counts(fi)
+}
+
+// appliesTo reports whether any of the filter's fields is set
+func (fi *FilterInput) appliesTo(f Filter) bool {
+	for _, field := range f.Fields() {
+		if fi.Value(field) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	filterRegistryMu sync.RWMutex
+	filterRegistry   = []Filter{
+		ipFilter{},
+		emailFilter{},
+		userAgentFilter{},
+		countryFilter{},
+		usernameFilter{},
+		asnFilter{},
+		charsetFilter{},
+		contentFilter{},
+		velocityFilter{},
+		compositeFilter{},
+		expressionFilter{},
+	}
+)
+
+// RegisterFilter adds a filter to the pipeline or replaces one with the same name
+func RegisterFilter(f Filter) {
+	filterRegistryMu.Lock()
+	defer filterRegistryMu.Unlock()
+
+	for i, existing := range filterRegistry {
+		if existing.Name() == f.Name() {
+			filterRegistry[i] = f
+			return
+		}
+	}
+	filterRegistry = append(filterRegistry, f)
+}
+
+// UnregisterFilter removes a filter from the pipeline
+func UnregisterFilter(name string) {
+	filterRegistryMu.Lock()
+	defer filterRegistryMu.Unlock()
+
+	for i, existing := range filterRegistry {
+		if existing.Name() == name {
+			filterRegistry = append(filterRegistry[:i:i], filterRegistry[i+1:]...)
+			return
+		}
+	}
+}
+
+// RegisteredFilters returns a copy of the registered filters in registration order
+func RegisteredFilters() []Filter {
+	filterRegistryMu.RLock()
+	defer filterRegistryMu.RUnlock()
+
+	filters := make([]Filter, len(filterRegistry))
+	copy(filters, filterRegistry)
+	return filters
+}
@@ -0,0 +1,112 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"firewall/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// phoneFilter is a test filter reading a custom field
+type phoneFilter struct {
+	blocked string
+}
+
+func (phoneFilter) Name() string     { return "phone" }
+func (phoneFilter) Fields() []string { return []string{"phone"} }
+
+func (f phoneFilter) Evaluate(ctx context.Context, input *FilterInput) FilterResult {
+	phone := input.Value("phone")
+	if strings.HasPrefix(phone, f.blocked) {
+		return FilterResult{Result: "denied", Reason: "phone denied", Field: "phone", Value: phone}
+	}
+	return FilterResult{Result: "allowed", Field: "phone", Value: phone}
+}
+
+func TestRegisterFilter_CustomField(t *testing.T) {
+	RegisterFilter(phoneFilter{blocked: "+999"})
+	defer UnregisterFilter("phone")
+
+	ctx := context.Background()
+	input := NewFilterInput(map[string]interface{}{"phone": "+999123", "ip": "198.51.100.1", "asn": "AS1"})
+
+	result, err := EvaluateFilterInput(ctx, input)
+	assert.NoError(t, err)
+	assert.Equal(t, "denied", result.Result)
+	assert.Equal(t, "phone denied", result.Reason)
+
+	// Registering under the same name replaces the filter
+	RegisterFilter(phoneFilter{blocked: "+888"})
+	count := 0
+	for _, f := range RegisteredFilters() {
+		if f.Name() == "phone" {
+			count++
+		}
+	}
+	assert.Equal(t, 1, count)
+
+	result, err = EvaluateFilterInput(ctx, NewFilterInput(map[string]interface{}{"phone": "+999123", "ip": "198.51.100.1", "asn": "AS1"}))
+	assert.NoError(t, err)
+	assert.Equal(t, "allowed", result.Result)
+}
+
+func TestUnregisterFilter(t *testing.T) {
+	RegisterFilter(phoneFilter{blocked: "+999"})
+	UnregisterFilter("phone")
+
+	for _, f := range RegisteredFilters() {
+		assert.NotEqual(t, "phone", f.Name())
+	}
+}
+
+func TestNewFilterInput(t *testing.T) {
+	input := NewFilterInput(map[string]interface{}{
+		"ip":       "192.0.2.1",
+		"email":    "User@Example.com",
+		"username": "alice",
+		"custom":   "value",
+		"number":   42,
+	})
+
+	assert.Equal(t, "192.0.2.1", input.IP)
+	assert.Equal(t, "alice", input.Value("username"))
+	assert.Equal(t, "value", input.Value("custom"))
+	assert.Equal(t, "", input.Value("number"))
+
+	// RawValue keeps the value sent by the client
+	input.Email = "user@example.com"
+	assert.Equal(t, "user@example.com", input.Value("email"))
+	assert.Equal(t, "User@Example.com", input.RawValue("email"))
+}
+
+func TestFilterInput_CacheKey(t *testing.T) {
+	a := NewFilterInput(map[string]interface{}{"ip": "192.0.2.1", "custom": "x"})
+	b := NewFilterInput(map[string]interface{}{"ip": "192.0.2.1", "custom": "y"})
+	c := NewFilterInput(map[string]interface{}{"ip": "192.0.2.1"})
+
+	assert.True(t, strings.HasPrefix(a.CacheKey(), "filter:192.0.2.1:"))
+	assert.NotEqual(t, a.CacheKey(), b.CacheKey())
+	assert.Equal(t, "filter:192.0.2.1:::::", c.CacheKey())
+}
+
+func TestCharsetFilter_Evaluate(t *testing.T) {
+	engine := GetRuleEngine()
+	previous := engine.Snapshot()
+	defer engine.snapshot.Store(previous)
+
+	engine.snapshot.Store(BuildRuleSnapshot(RuleSet{
+		Charsets: []models.CharsetRule{{ID: 1, Charset: "Cyrillic", Status: "denied"}},
+	}))
+
+	// username is enabled for charset detection by default
+	input := NewFilterInput(map[string]interface{}{"username": "пользователь"})
+	assert.True(t, input.appliesTo(charsetFilter{}))
+
+	result := charsetFilter{}.Evaluate(context.Background(), input)
+	assert.Equal(t, "denied", result.Result)
+	assert.Equal(t, "charset denied", result.Reason)
+	assert.Equal(t, "username", result.Field)
+}
@@ -2,811 +2,506 @@ package services
 
 import (
 	"context"
-	"encoding/json"
 	"firewall/config"
 	"firewall/models"
-	"firewall/utils"
 	"fmt"
 	"log"
-	"regexp"
+	"sort"
 	"strings"
+	"time"
 
-	"github.com/elastic/go-elasticsearch/v8/esapi"
 	"gorm.io/gorm"
 )
 
 // FilterResult defines the structure of the response for filtering
 // Vereinheitlicht: result, reason, field, value
 type FilterResult struct {
-	Result string      `json:"result"`
-	Reason string      `json:"reason,omitempty"`
-	Field  string      `json:"field,omitempty"`
-	Value  interface{} `json:"value,omitempty"`
+	Result   string      `json:"result"`
+	Reason   string      `json:"reason,omitempty"`
+	Field    string      `json:"field,omitempty"`
+	Value    interface{} `json:"value,omitempty"`
+	RuleID   uint        `json:"rule_id,omitempty"`   // ID of the matched rule
+	RuleType string      `json:"rule_type,omitempty"` // "exact", "cidr", "regex", "charset"
+	Priority int         `json:"priority,omitempty"`  // Priority of the matched rule
+	Degraded bool        `json:"degraded,omitempty"`  // A filter failed and the result follows its failure policy
+	// DefaultPolicy is set when no rule matched and the default policy of the filter decided ("allow" or "deny")
+	DefaultPolicy string       `json:"default_policy,omitempty"`
+	Geo           *GeoContext  `json:"geo,omitempty"` // Location resolved from the IP, set on the final result
+	Monitor       []MonitorHit `json:"-"`             // Monitor rules matched by the filter, collected into the trace
 }
 
-const NumFilters = 6
-
-// FilterResultWithResolvedData includes the resolved country and ASN values
+// FilterResultWithResolvedData includes the resolved country and ASN values and the decision trace
 type FilterResultWithResolvedData struct {
 	FilterResult
 	ResolvedCountry string
 	ResolvedASN     string
+	Trace           *DecisionTrace
 }
 
-// EvaluateFilters runs only the necessary filters concurrently and returns the final result with resolved data
+// EvaluateFilters runs the registered filters for the standard fields
 func EvaluateFilters(ctx context.Context, ip, email, userAgent, country, asn, username string) (FilterResultWithResolvedData, error) {
+	return EvaluateFilterInput(ctx, &FilterInput{
+		IP:        ip,
+		Email:     email,
+		UserAgent: userAgent,
+		Country:   country,
+		ASN:       asn,
+		Username:  username,
+	})
+}
+
+// EvaluateFilterInput runs only the necessary filters concurrently and returns the final result with resolved data.
+// Country and ASN on the input are replaced by their resolved values.
+func EvaluateFilterInput(ctx context.Context, input *FilterInput) (FilterResultWithResolvedData, error) {
+	start := time.Now()
+
+	// Rules match the canonical address; normalizing is a no-op for inputs from NewFilterInput
+	input.Email = NormalizeEmail(input.Email)
+
 	// Auto-geolocate IP if country is empty and IP is provided
-	resolvedCountry := country
-	if country == "" && ip != "" {
-		resolvedCountry = GetCountryFromIPWithFallback(ip)
+	if input.Country == "" && input.IP != "" {
+		input.Country = GetCountryFromIPWithFallback(input.IP)
 		// Log the geolocation result for debugging
-		if resolvedCountry != "" {
-			fmt.Printf("Auto-geolocated IP %s to country: %s\n", ip, resolvedCountry)
+		if input.Country != "" {
+			fmt.Printf("Auto-geolocated IP %s to country: %s\n", input.IP, input.Country)
 		}
 	}
 
 	// Auto-resolve ASN if not provided but IP is available
-	resolvedASN := asn
-	if asn == "" && ip != "" {
-		resolvedASN = GetASNFromIPWithFallback(ip)
+	if input.ASN == "" && input.IP != "" {
+		input.ASN = GetASNFromIPWithFallback(input.IP)
 	}
 
-	// Determine which filters to run based on non-empty fields
-	var filtersToRun int
-	var results chan FilterResult
-
-	// Count how many filters we need to run
-	if ip != "" {
-		filtersToRun++
+	// Resolve the continent, subdivision, city and location for the geo rules and the response
+	if input.Geo == nil && input.IP != "" {
+		input.Geo = GetGeoContextWithFallback(input.IP)
 	}
-	if email != "" {
-		filtersToRun++
-	}
-	if userAgent != "" {
-		filtersToRun++
-	}
-	if country != "" {
-		filtersToRun++
-	}
-	if username != "" {
-		filtersToRun++
+
+	// Determine which filters to run based on non-empty fields
+	var filters []Filter
+	for _, f := range RegisteredFilters() {
+		if input.appliesTo(f) {
+			filters = append(filters, f)
+		}
 	}
-	if asn != "" || ip != "" { // ASN filter runs if either ASN is provided or IP is provided (for auto-ASN lookup)
-		filtersToRun++
+
+	trace := &DecisionTrace{
+		Filters:         []FilterVerdict{},
+		ResolvedCountry: input.Country,
+		ResolvedASN:     input.ASN,
 	}
 
 	// If no filters to run, return allowed
-	if filtersToRun == 0 {
+	if len(filters) == 0 {
+		trace.LatencyMicros = time.Since(start).Microseconds()
 		return FilterResultWithResolvedData{
-			FilterResult:    FilterResult{Result: "allowed", Reason: "no filter fields provided"},
-			ResolvedCountry: resolvedCountry,
-			ResolvedASN:     resolvedASN,
+			FilterResult:    FilterResult{Result: "allowed", Reason: "no filter fields provided", Geo: input.Geo},
+			ResolvedCountry: input.Country,
+			ResolvedASN:     input.ASN,
+			Trace:           trace,
 		}, nil
 	}
 
-	// Create channel with exact size needed
-	results = make(chan FilterResult, filtersToRun)
-
-	// Start only the necessary filters concurrently
-	if ip != "" {
-		go filterIP(ctx, ip, results)
-	}
-	if email != "" {
-		go filterEmail(ctx, email, results)
-	}
-	if userAgent != "" {
-		go filterUserAgent(ctx, userAgent, results)
+	// Create channel with exact size needed and start the filters concurrently
+	results := make(chan FilterVerdict, len(filters))
+	for _, f := range filters {
+		go func(f Filter) {
+			filterStart := time.Now()
+			res := f.Evaluate(ctx, input)
+			results <- FilterVerdict{Filter: f.Name(), FilterResult: res, LatencyMicros: time.Since(filterStart).Microseconds()}
+		}(f)
 	}
-	if resolvedCountry != "" {
-		go filterCountry(ctx, resolvedCountry, results)
-	}
-	if username != "" {
-		go filterUsername(ctx, username, results)
+
+	// Collect and evaluate the results
+	filterResult, verdicts, err := collectResults(ctx, results, len(filters))
+	if err == nil {
+		var degraded bool
+		if verdicts, degraded = applyFailurePolicies(ctx, input, filters, verdicts); degraded {
+			filterResult = resolveVerdicts(verdicts, resolutionStrategy())
+			filterResult.Degraded = true
+		}
 	}
-	if asn != "" || ip != "" {
-		go filterASN(ctx, ip, resolvedASN, results)
+	filterResult.Geo = input.Geo
+	trace.Filters = verdicts
+	if err == nil {
+		trace.Monitor = collectMonitorHits(verdicts, filterResult, resolutionStrategy())
 	}
+	trace.LatencyMicros = time.Since(start).Microseconds()
 
-	// Collect and evaluate the results
-	filterResult, err := collectResults(ctx, results, filtersToRun)
 	return FilterResultWithResolvedData{
 		FilterResult:    filterResult,
-		ResolvedCountry: resolvedCountry,
-		ResolvedASN:     resolvedASN,
+		ResolvedCountry: input.Country,
+		ResolvedASN:     input.ASN,
+		Trace:           trace,
 	}, err
 }
 
-// collectResults processes filter results with dynamic count
-func collectResults(ctx context.Context, result chan FilterResult, filterCount int) (FilterResult, error) {
-	output := FilterResult{Result: "allowed"}
+// Resolution strategies for conflicting verdicts
+const (
+	ResolutionFirstMatchByPriority = "first-match-by-priority"
+	ResolutionDenyOverrides        = "deny-overrides"
+	ResolutionAllowOverrides       = "allow-overrides"
+)
+
+// resolutionStrategy returns the configured strategy (allow-overrides by default)
+func resolutionStrategy() string {
+	if config.AppConfig != nil && config.AppConfig.Filtering.ResolutionStrategy != "" {
+		return config.AppConfig.Filtering.ResolutionStrategy
+	}
+	return ResolutionAllowOverrides
+}
+
+// collectResults waits for all filter verdicts, orders them by filter registration
+// and resolves the final result with the configured strategy
+func collectResults(ctx context.Context, result chan FilterVerdict, filterCount int) (FilterResult, []FilterVerdict, error) {
+	verdicts := make([]FilterVerdict, 0, filterCount)
 
 	for i := 0; i < filterCount; i++ {
+		// A cancelled context always wins, even if results are already buffered
+		if err := ctx.Err(); err != nil {
+			return FilterResult{Result: "timeout", Reason: "timeout"}, verdicts, err
+		}
 		select {
 		case res := <-result:
-			if res.Result == "whitelisted" {
-				return res, nil
-			} else if res.Result == "denied" {
-				output = res // Update output to the denied result
-			}
+			verdicts = append(verdicts, res)
 		case <-ctx.Done():
-			return FilterResult{Result: "timeout", Reason: "timeout"}, ctx.Err()
+			return FilterResult{Result: "timeout", Reason: "timeout"}, verdicts, ctx.Err()
 		}
 	}
 
-	return output, nil
-}
-
-// filterIP runs the IP filter
-func filterIP(ctx context.Context, ip string, result chan FilterResult) {
-	// Handle empty IP addresses - treat as invalid input
-	if ip == "" {
-		result <- FilterResult{Result: "allowed", Reason: "empty ip address", Field: "ip", Value: ip}
-		return
+	// Arrival order is random, registration order makes the decision reproducible
+	order := make(map[string]int)
+	for i, f := range RegisteredFilters() {
+		order[f.Name()] = i
 	}
+	sort.SliceStable(verdicts, func(i, j int) bool {
+		return order[verdicts[i].Filter] < order[verdicts[j].Filter]
+	})
 
-	es := config.ESClient
+	return resolveVerdicts(verdicts, resolutionStrategy()), verdicts, nil
+}
 
-	// First check for exact IP matches (including existing data without is_cidr field)
-	exactQuery := `{
-		"query": {
-			"bool": {
-				"should": [
-					{"bool": {"must": [{"term": {"address.keyword": "` + ip + `"}}, {"term": {"is_cidr": false}}]}},
-					{"bool": {"must": [{"term": {"address.keyword": "` + ip + `"}}, {"bool": {"must_not": {"exists": {"field": "is_cidr"}}}}]}}
-				],
-				"minimum_should_match": 1
+// resolveVerdicts picks the final result from verdicts sorted by filter order.
+// Within a strategy the highest priority wins; ties go to the earlier filter.
+func resolveVerdicts(verdicts []FilterVerdict, strategy string) FilterResult {
+	best := func(match func(FilterVerdict) bool) *FilterVerdict {
+		var winner *FilterVerdict
+		for i := range verdicts {
+			if match(verdicts[i]) && (winner == nil || verdicts[i].Priority > winner.Priority) {
+				winner = &verdicts[i]
 			}
 		}
-	}`
-
-	req := esapi.SearchRequest{
-		Index: []string{"ip-addresses"},
-		Body:  strings.NewReader(exactQuery),
-	}
-
-	res, err := req.Do(ctx, es)
-	if err != nil {
-		result <- FilterResult{Result: "error", Reason: "elasticsearch error", Field: "ip", Value: ip}
-		return
-	}
-	defer res.Body.Close()
-
-	var r map[string]interface{}
-	if err := json.NewDecoder(res.Body).Decode(&r); err != nil {
-		result <- FilterResult{Result: "error", Reason: "decode error", Field: "ip", Value: ip}
-		return
-	}
-
-	if hits, found := r["hits"].(map[string]interface{}); found {
-		totalHits := hits["total"].(map[string]interface{})["value"].(float64)
-		if totalHits > 0 {
-			firstHit := hits["hits"].([]interface{})[0].(map[string]interface{})
-			source := firstHit["_source"].(map[string]interface{})
-			status := source["status"].(string)
-
-			if status == "denied" {
-				result <- FilterResult{Result: "denied", Reason: "ip denied", Field: "ip", Value: ip}
-			} else if status == "whitelisted" {
-				result <- FilterResult{Result: "whitelisted", Reason: "ip whitelisted", Field: "ip", Value: ip}
-			} else {
-				result <- FilterResult{Result: "allowed", Field: "ip", Value: ip}
-			}
-			return
+		return winner
+	}
+	isResult := func(result string) func(FilterVerdict) bool {
+		return func(v FilterVerdict) bool { return v.Result == result }
+	}
+
+	var winner *FilterVerdict
+	switch strategy {
+	case ResolutionFirstMatchByPriority:
+		// Any verdict backed by a rule or a default policy (or a non-allowed verdict) counts as a match
+		winner = best(func(v FilterVerdict) bool {
+			return v.Result == "denied" || v.Result == "whitelisted" || (v.Result == "allowed" && (v.RuleID != 0 || v.DefaultPolicy != ""))
+		})
+	case ResolutionDenyOverrides:
+		if winner = best(isResult("denied")); winner == nil {
+			winner = best(isResult("whitelisted"))
 		}
-	}
-
-	// If no exact match, check CIDR blocks
-	cidrQuery := `{
-		"query": {
-			"bool": {
-				"must": [
-					{"term": {"is_cidr": true}}
-				]
-			}
+	default:
+		if winner = best(isResult("whitelisted")); winner == nil {
+			winner = best(isResult("denied"))
 		}
-	}`
-
-	req = esapi.SearchRequest{
-		Index: []string{"ip-addresses"},
-		Body:  strings.NewReader(cidrQuery),
 	}
 
-	res, err = req.Do(ctx, es)
-	if err != nil {
-		result <- FilterResult{Result: "error", Reason: "elasticsearch error", Field: "ip", Value: ip}
-		return
+	if winner == nil {
+		return FilterResult{Result: "allowed"}
 	}
-	defer res.Body.Close()
-
-	if err := json.NewDecoder(res.Body).Decode(&r); err != nil {
-		result <- FilterResult{Result: "error", Reason: "decode error", Field: "ip", Value: ip}
-		return
-	}
-
-	if hits, found := r["hits"].(map[string]interface{}); found {
-		hitsList := hits["hits"].([]interface{})
-		for _, hit := range hitsList {
-			hitMap := hit.(map[string]interface{})
-			source := hitMap["_source"].(map[string]interface{})
-			cidrBlock := source["address"].(string)
-			status := source["status"].(string)
+	return winner.FilterResult
+}
 
-			// Check if IP falls within this CIDR block
-			inRange, err := utils.IsIPInCIDR(ip, cidrBlock)
-			if err != nil {
-				continue // Skip invalid CIDR blocks
+// collectMonitorHits gathers the monitor hits of all verdicts and checks for each one
+// whether enforcing it as a deny would have changed the final result
+func collectMonitorHits(verdicts []FilterVerdict, final FilterResult, strategy string) []MonitorHit {
+	var hits []MonitorHit
+	for _, v := range verdicts {
+		for _, hit := range v.Monitor {
+			// Filters evaluating several rule types (country and geo rules) set the filter of their hits
+			if hit.Filter == "" {
+				hit.Filter = v.Filter
 			}
-			if inRange {
-				if status == "denied" {
-					result <- FilterResult{Result: "denied", Reason: "ip cidr denied", Field: "ip", Value: ip}
-				} else if status == "whitelisted" {
-					result <- FilterResult{Result: "whitelisted", Reason: "ip cidr whitelisted", Field: "ip", Value: ip}
-				} else {
-					result <- FilterResult{Result: "allowed", Field: "ip", Value: ip}
-				}
-				return
+			if final.Result != "denied" {
+				shadow := append(append([]FilterVerdict(nil), verdicts...), FilterVerdict{
+					Filter:       v.Filter,
+					FilterResult: FilterResult{Result: "denied", RuleID: hit.RuleID, Priority: hit.Priority},
+				})
+				hit.WouldBlock = resolveVerdicts(shadow, strategy).Result == "denied"
 			}
+			hits = append(hits, hit)
 		}
 	}
-
-	// No matches found
-	result <- FilterResult{Result: "allowed", Field: "ip", Value: ip}
+	return hits
 }
 
-// filterEmail runs the email filter
-func filterEmail(ctx context.Context, email string, result chan FilterResult) {
-	// Handle empty email addresses - treat as allowed
-	if email == "" {
-		result <- FilterResult{Result: "allowed", Reason: "empty email address", Field: "email", Value: email}
-		return
+// withMonitorHit adds the matching monitor rule, if any, to a filter result
+func withMonitorHit(result FilterResult, rule *compiledRule, field string, value interface{}) FilterResult {
+	if rule != nil {
+		result.Monitor = append(result.Monitor, newMonitorHit(rule, field, value))
 	}
+	return result
+}
 
-	es := config.ESClient
+func newMonitorHit(rule *compiledRule, field string, value interface{}) MonitorHit {
+	return MonitorHit{RuleID: rule.ID, RuleType: rule.Type, Priority: rule.Priority, Field: field, Value: value}
+}
 
-	// First try exact match
-	exactQuery := `{
-		"query": {
-			"bool": {
-				"must": [
-					{"term": {"email.keyword": "` + email + `"}},
-					{"term": {"is_regex": false}}
-				]
-			}
-		}
-	}`
+// ruleResult converts a matched rule into a FilterResult; reason is prefixed with kind (e.g. "ip cidr")
+func ruleResult(rule *compiledRule, field, kind string, value interface{}) FilterResult {
+	if rule == nil {
+		return FilterResult{Result: "allowed", Field: field, Value: value}
+	}
+	result := FilterResult{Result: "allowed", Field: field, Value: value, RuleID: rule.ID, RuleType: rule.Type, Priority: rule.Priority}
+	switch rule.Status {
+	case "denied":
+		result.Result = "denied"
+		result.Reason = kind + " denied"
+	case "whitelisted":
+		result.Result = "whitelisted"
+		result.Reason = kind + " whitelisted"
+	}
+	return result
+}
 
-	req := esapi.SearchRequest{
-		Index: []string{"emails"},
-		Body:  strings.NewReader(exactQuery),
+// ruleKind returns the reason prefix for a matched rule (e.g. "ip cidr", "ip range", "email regex", "email domain")
+func ruleKind(field string, rule *compiledRule) string {
+	if rule == nil {
+		return field
 	}
-
-	res, err := req.Do(ctx, es)
-	if err != nil {
-		result <- FilterResult{Result: "error", Reason: "elasticsearch error", Field: "email", Value: email}
-		return
+	switch rule.Type {
+	case "cidr", "range", "regex":
+		return field + " " + rule.Type
+	case "domain", "subdomain":
+		return field + " domain"
 	}
-	defer res.Body.Close()
+	return field
+}
 
-	var r map[string]interface{}
-	if err := json.NewDecoder(res.Body).Decode(&r); err != nil {
-		result <- FilterResult{Result: "error", Reason: "decode error", Field: "email", Value: email}
-		return
-	}
+// ipFilter runs the IP filter
+type ipFilter struct{}
 
-	if hits, found := r["hits"].(map[string]interface{}); found {
-		totalHits := hits["total"].(map[string]interface{})["value"].(float64)
-		if totalHits > 0 {
-			firstHit := hits["hits"].([]interface{})[0].(map[string]interface{})
-			source := firstHit["_source"].(map[string]interface{})
-			status := source["status"].(string)
+func (ipFilter) Name() string     { return "ip" }
+func (ipFilter) Fields() []string { return []string{"ip"} }
 
-			if status == "denied" {
-				result <- FilterResult{Result: "denied", Reason: "email denied", Field: "email", Value: email}
-			} else if status == "whitelisted" {
-				result <- FilterResult{Result: "whitelisted", Reason: "email whitelisted", Field: "email", Value: email}
-			} else {
-				result <- FilterResult{Result: "allowed", Field: "email", Value: email}
-			}
-			return
-		}
+func (ipFilter) Evaluate(ctx context.Context, input *FilterInput) FilterResult {
+	ip := input.IP
+	// Handle empty IP addresses - treat as invalid input
+	if ip == "" {
+		return FilterResult{Result: "allowed", Reason: "empty ip address", Field: "ip", Value: ip}
 	}
 
-	// If no exact match, try regex patterns
-	regexQuery := `{
-		"query": {
-			"bool": {
-				"must": [
-					{"term": {"is_regex": true}}
-				]
-			}
-		}
-	}`
+	// Exact addresses first, then the longest matching CIDR block
+	snapshot := GetRuleEngine().Snapshot()
+	rule := snapshot.MatchIP(ip)
+	return withMonitorHit(snapshot.ruleOrDefault("ip", rule, "ip", ruleKind("ip", rule), ip), snapshot.Monitor().MatchIP(ip), "ip", ip)
+}
 
-	req = esapi.SearchRequest{
-		Index: []string{"emails"},
-		Body:  strings.NewReader(regexQuery),
-	}
+// emailFilter runs the email filter
+type emailFilter struct{}
 
-	res, err = req.Do(ctx, es)
-	if err != nil {
-		result <- FilterResult{Result: "error", Reason: "elasticsearch error", Field: "email", Value: email}
-		return
-	}
-	defer res.Body.Close()
+func (emailFilter) Name() string     { return "email" }
+func (emailFilter) Fields() []string { return []string{"email"} }
 
-	if err := json.NewDecoder(res.Body).Decode(&r); err != nil {
-		result <- FilterResult{Result: "error", Reason: "decode error", Field: "email", Value: email}
-		return
+func (emailFilter) Evaluate(ctx context.Context, input *FilterInput) FilterResult {
+	email := input.Email
+	// Handle empty email addresses - treat as allowed
+	if email == "" {
+		return FilterResult{Result: "allowed", Reason: "empty email address", Field: "email", Value: email}
 	}
 
-	if hits, found := r["hits"].(map[string]interface{}); found {
-		hitsList := hits["hits"].([]interface{})
-		for _, hit := range hitsList {
-			hitMap := hit.(map[string]interface{})
-			source := hitMap["_source"].(map[string]interface{})
-			pattern := source["email"].(string)
-			status := source["status"].(string)
+	snapshot := GetRuleEngine().Snapshot()
+	rule := snapshot.MatchEmail(email)
+	return withMonitorHit(snapshot.ruleOrDefault("email", rule, "email", ruleKind("email", rule), email), snapshot.Monitor().MatchEmail(email), "email", email)
+}
 
-			// Check if email matches the regex pattern
-			matched, err := regexp.MatchString(pattern, email)
-			if err != nil {
-				continue // Skip invalid regex patterns
-			}
-			if matched {
-				if status == "denied" {
-					result <- FilterResult{Result: "denied", Reason: "email regex denied", Field: "email", Value: email}
-				} else if status == "whitelisted" {
-					result <- FilterResult{Result: "whitelisted", Reason: "email regex whitelisted", Field: "email", Value: email}
-				} else {
-					result <- FilterResult{Result: "allowed", Field: "email", Value: email}
-				}
-				return
-			}
-		}
-	}
+// userAgentFilter runs the user agent filter
+type userAgentFilter struct{}
 
-	// No matches found
-	result <- FilterResult{Result: "allowed", Field: "email", Value: email}
-}
+func (userAgentFilter) Name() string     { return "user_agent" }
+func (userAgentFilter) Fields() []string { return []string{"user_agent"} }
 
-// filterUserAgent runs the user agent filter
-func filterUserAgent(ctx context.Context, userAgent string, result chan FilterResult) {
+func (userAgentFilter) Evaluate(ctx context.Context, input *FilterInput) FilterResult {
+	userAgent := input.UserAgent
 	// Handle empty user agent strings - treat as allowed
 	if userAgent == "" {
-		result <- FilterResult{Result: "allowed", Reason: "empty user agent", Field: "user_agent", Value: userAgent}
-		return
-	}
-
-	es := config.ESClient
-
-	// First try exact match
-	exactQuery := `{
-		"query": {
-			"bool": {
-				"must": [
-					{"term": {"user_agent.keyword": "` + userAgent + `"}},
-					{"term": {"is_regex": false}}
-				]
-			}
-		}
-	}`
-
-	req := esapi.SearchRequest{
-		Index: []string{"user-agents"},
-		Body:  strings.NewReader(exactQuery),
+		return FilterResult{Result: "allowed", Reason: "empty user agent", Field: "user_agent", Value: userAgent}
 	}
 
-	res, err := req.Do(ctx, es)
-	if err != nil {
-		result <- FilterResult{Result: "error", Reason: "elasticsearch error", Field: "user_agent", Value: userAgent}
-		return
-	}
-	defer res.Body.Close()
-
-	var r map[string]interface{}
-	if err := json.NewDecoder(res.Body).Decode(&r); err != nil {
-		result <- FilterResult{Result: "error", Reason: "decode error", Field: "user_agent", Value: userAgent}
-		return
-	}
-
-	if hits, found := r["hits"].(map[string]interface{}); found {
-		totalHits := hits["total"].(map[string]interface{})["value"].(float64)
-		if totalHits > 0 {
-			firstHit := hits["hits"].([]interface{})[0].(map[string]interface{})
-			source := firstHit["_source"].(map[string]interface{})
-			status := source["status"].(string)
-
-			if status == "denied" {
-				result <- FilterResult{Result: "denied", Reason: "user_agent denied", Field: "user_agent", Value: userAgent}
-			} else if status == "whitelisted" {
-				result <- FilterResult{Result: "whitelisted", Reason: "user_agent whitelisted", Field: "user_agent", Value: userAgent}
-			} else {
-				result <- FilterResult{Result: "allowed", Field: "user_agent", Value: userAgent}
-			}
-			return
-		}
-	}
-
-	// If no exact match, try regex patterns
-	regexQuery := `{
-		"query": {
-			"bool": {
-				"must": [
-					{"term": {"is_regex": true}}
-				]
-			}
-		}
-	}`
+	snapshot := GetRuleEngine().Snapshot()
+	rule := snapshot.MatchUserAgent(userAgent)
+	return withMonitorHit(snapshot.ruleOrDefault("user_agent", rule, "user_agent", ruleKind("user_agent", rule), userAgent), snapshot.Monitor().MatchUserAgent(userAgent), "user_agent", userAgent)
+}
 
-	req = esapi.SearchRequest{
-		Index: []string{"user-agents"},
-		Body:  strings.NewReader(regexQuery),
-	}
+// countryFilter runs the country filter against the provided or resolved country
+type countryFilter struct{}
 
-	res, err = req.Do(ctx, es)
-	if err != nil {
-		result <- FilterResult{Result: "error", Reason: "elasticsearch error", Field: "user_agent", Value: userAgent}
-		return
-	}
-	defer res.Body.Close()
+func (countryFilter) Name() string { return "country" }
 
-	if err := json.NewDecoder(res.Body).Decode(&r); err != nil {
-		result <- FilterResult{Result: "error", Reason: "decode error", Field: "user_agent", Value: userAgent}
-		return
+// Fields returns country, and ip while there are geo rules; they match the location resolved from the IP
+func (countryFilter) Fields() []string {
+	snapshot := GetRuleEngine().Snapshot()
+	if snapshot.geo.len() == 0 && snapshot.Monitor().geo.len() == 0 {
+		return []string{"country"}
 	}
+	return []string{"country", "ip"}
+}
 
-	if hits, found := r["hits"].(map[string]interface{}); found {
-		hitsList := hits["hits"].([]interface{})
-		for _, hit := range hitsList {
-			hitMap := hit.(map[string]interface{})
-			source := hitMap["_source"].(map[string]interface{})
-			pattern := source["user_agent"].(string)
-			status := source["status"].(string)
+func (countryFilter) Evaluate(ctx context.Context, input *FilterInput) FilterResult {
+	country := input.Country
+	snapshot := GetRuleEngine().Snapshot()
 
-			// Check if user agent matches the regex pattern
-			matched, err := regexp.MatchString(pattern, userAgent)
-			if err != nil {
-				continue // Skip invalid regex patterns
-			}
-			if matched {
-				if status == "denied" {
-					result <- FilterResult{Result: "denied", Reason: "user_agent regex denied", Field: "user_agent", Value: userAgent}
-				} else if status == "whitelisted" {
-					result <- FilterResult{Result: "whitelisted", Reason: "user_agent regex whitelisted", Field: "user_agent", Value: userAgent}
-				} else {
-					result <- FilterResult{Result: "allowed", Field: "user_agent", Value: userAgent}
-				}
-				return
-			}
+	// The most specific rule decides: city or geofence, subdivision, country, country group, continent
+	var result FilterResult
+	geo := snapshot.geo.match(input.Geo)
+	var rule *compiledRule
+	kind := "country"
+	if country != "" {
+		rule = snapshot.MatchCountry(country)
+		if group := snapshot.MatchCountryGroup(country); group != nil && group.outranks(rule) {
+			rule, kind = group, "country group"
 		}
 	}
-
-	// No matches found
-	result <- FilterResult{Result: "allowed", Field: "user_agent", Value: userAgent}
-}
-
-// filterCountry runs the country filter
-func filterCountry(ctx context.Context, country string, result chan FilterResult) {
-	// Handle empty country codes - treat as allowed
-	if country == "" {
-		result <- FilterResult{Result: "allowed", Reason: "empty country code", Field: "country", Value: country}
-		return
+	switch {
+	case geo != nil && geo.rule.outranks(rule):
+		result = ruleResult(geo.rule, geo.field, geo.kind, geo.value)
+	case country == "":
+		// Handle empty country codes - treat as allowed
+		result = FilterResult{Result: "allowed", Reason: "empty country code", Field: "country", Value: country}
+	default:
+		result = snapshot.ruleOrDefault("country", rule, "country", kind, country)
 	}
 
-	es := config.ESClient
-	query := `{
-		"query": {
-			"match": {
-				"country": "` + country + `"
-			}
+	if country != "" {
+		result = withMonitorHit(result, snapshot.Monitor().MatchCountry(country), "country", country)
+		if group := snapshot.Monitor().MatchCountryGroup(country); group != nil {
+			hit := newMonitorHit(group, "country", country)
+			hit.Filter = "country_group"
+			result.Monitor = append(result.Monitor, hit)
 		}
-	}`
-
-	req := esapi.SearchRequest{
-		Index: []string{"countries"},
-		Body:  strings.NewReader(query),
 	}
-
-	res, err := req.Do(ctx, es)
-	if err != nil {
-		result <- FilterResult{Result: "error", Reason: "elasticsearch error", Field: "country", Value: country}
-		return
+	if monitor := snapshot.Monitor().geo.match(input.Geo); monitor != nil {
+		hit := newMonitorHit(monitor.rule, monitor.field, monitor.value)
+		hit.Filter = "geo"
+		result.Monitor = append(result.Monitor, hit)
 	}
-	defer res.Body.Close()
+	return result
+}
 
-	var r map[string]interface{}
-	if err := json.NewDecoder(res.Body).Decode(&r); err != nil {
-		result <- FilterResult{Result: "error", Reason: "decode error", Field: "country", Value: country}
-		return
-	}
+// usernameFilter runs the username filter
+type usernameFilter struct{}
 
-	if hits, found := r["hits"].(map[string]interface{}); found {
-		totalHits := hits["total"].(map[string]interface{})["value"].(float64)
-		if totalHits > 0 {
-			firstHit := hits["hits"].([]interface{})[0].(map[string]interface{})
-			source := firstHit["_source"].(map[string]interface{})
-			status := source["status"].(string)
+func (usernameFilter) Name() string     { return "username" }
+func (usernameFilter) Fields() []string { return []string{"username"} }
 
-			if status == "denied" {
-				result <- FilterResult{Result: "denied", Reason: "country denied", Field: "country", Value: country}
-			} else if status == "whitelisted" {
-				result <- FilterResult{Result: "whitelisted", Reason: "country whitelisted", Field: "country", Value: country}
-			} else {
-				result <- FilterResult{Result: "allowed", Field: "country", Value: country}
-			}
-		} else {
-			result <- FilterResult{Result: "allowed", Field: "country", Value: country}
-		}
-	} else {
-		result <- FilterResult{Result: "error", Reason: "no hits", Field: "country", Value: country}
-	}
-}
-
-// filterUsername runs the username filter
-func filterUsername(ctx context.Context, username string, result chan FilterResult) {
+func (usernameFilter) Evaluate(ctx context.Context, input *FilterInput) FilterResult {
+	username := input.Username
 	// Handle empty usernames - treat as allowed
 	if username == "" {
-		result <- FilterResult{Result: "allowed", Reason: "empty username", Field: "username", Value: username}
-		return
-	}
-
-	es := config.ESClient
-
-	// First try exact match
-	exactQuery := `{
-		"query": {
-			"bool": {
-				"must": [
-					{"term": {"username.keyword": "` + username + `"}},
-					{"term": {"is_regex": false}}
-				]
-			}
-		}
-	}`
-
-	req := esapi.SearchRequest{
-		Index: []string{"usernames"},
-		Body:  strings.NewReader(exactQuery),
-	}
-
-	res, err := req.Do(ctx, es)
-	if err != nil {
-		result <- FilterResult{Result: "error", Reason: "elasticsearch error", Field: "username", Value: username}
-		return
-	}
-	defer res.Body.Close()
-
-	var r map[string]interface{}
-	if err := json.NewDecoder(res.Body).Decode(&r); err != nil {
-		result <- FilterResult{Result: "error", Reason: "decode error", Field: "username", Value: username}
-		return
-	}
-
-	if hits, found := r["hits"].(map[string]interface{}); found {
-		totalHits := hits["total"].(map[string]interface{})["value"].(float64)
-		if totalHits > 0 {
-			firstHit := hits["hits"].([]interface{})[0].(map[string]interface{})
-			source := firstHit["_source"].(map[string]interface{})
-			status := source["status"].(string)
-
-			if status == "denied" {
-				result <- FilterResult{Result: "denied", Reason: "username denied", Field: "username", Value: username}
-			} else if status == "whitelisted" {
-				result <- FilterResult{Result: "whitelisted", Reason: "username whitelisted", Field: "username", Value: username}
-			} else {
-				result <- FilterResult{Result: "allowed", Field: "username", Value: username}
-			}
-			return
-		}
-	}
-
-	// If no exact match, try regex patterns
-	regexQuery := `{
-		"query": {
-			"bool": {
-				"must": [
-					{"term": {"is_regex": true}}
-				]
-			}
-		}
-	}`
-
-	req = esapi.SearchRequest{
-		Index: []string{"usernames"},
-		Body:  strings.NewReader(regexQuery),
-	}
-
-	res, err = req.Do(ctx, es)
-	if err != nil {
-		result <- FilterResult{Result: "error", Reason: "elasticsearch error", Field: "username", Value: username}
-		return
-	}
-	defer res.Body.Close()
-
-	if err := json.NewDecoder(res.Body).Decode(&r); err != nil {
-		result <- FilterResult{Result: "error", Reason: "decode error", Field: "username", Value: username}
-		return
+		return FilterResult{Result: "allowed", Reason: "empty username", Field: "username", Value: username}
 	}
 
-	if hits, found := r["hits"].(map[string]interface{}); found {
-		hitsList := hits["hits"].([]interface{})
-		for _, hit := range hitsList {
-			hitMap := hit.(map[string]interface{})
-			source := hitMap["_source"].(map[string]interface{})
-			pattern := source["username"].(string)
-			status := source["status"].(string)
+	snapshot := GetRuleEngine().Snapshot()
+	rule := snapshot.MatchUsername(username)
+	return withMonitorHit(snapshot.ruleOrDefault("username", rule, "username", ruleKind("username", rule), username), snapshot.Monitor().MatchUsername(username), "username", username)
+}
 
-			// Check if username matches the regex pattern
-			matched, err := regexp.MatchString(pattern, username)
-			if err != nil {
-				continue // Skip invalid regex patterns
-			}
-			if matched {
-				if status == "denied" {
-					result <- FilterResult{Result: "denied", Reason: "username regex denied", Field: "username", Value: username}
-				} else if status == "whitelisted" {
-					result <- FilterResult{Result: "whitelisted", Reason: "username regex whitelisted", Field: "username", Value: username}
-				} else {
-					result <- FilterResult{Result: "allowed", Field: "username", Value: username}
-				}
-				return
-			}
-		}
-	}
+// asnFilter runs the ASN filter; it also runs for IP-only requests (for auto-ASN lookup)
+type asnFilter struct{}
 
-	// No matches found
-	result <- FilterResult{Result: "allowed", Field: "username", Value: username}
-}
+func (asnFilter) Name() string     { return "asn" }
+func (asnFilter) Fields() []string { return []string{"asn", "ip"} }
 
-// filterASN runs the ASN filter
-func filterASN(ctx context.Context, ip, asn string, result chan FilterResult) {
+func (asnFilter) Evaluate(ctx context.Context, input *FilterInput) FilterResult {
+	ip, asn := input.IP, input.ASN
 	// If ASN is provided manually, use it
 	if asn != "" {
 		// Validate ASN format
 		if len(asn) < 3 || !strings.HasPrefix(asn, "AS") {
-			result <- FilterResult{Result: "error", Reason: "invalid asn format", Field: "asn", Value: asn}
-			return
+			// Invalid input, not a backend failure; the failure policy does not apply
+			return FilterResult{Result: "allowed", Reason: "invalid asn format", Field: "asn", Value: asn}
 		}
 	} else if ip != "" {
-		// ASN should already be resolved in the main function
+		// ASN should already be resolved in EvaluateFilterInput
 		// If we still don't have an ASN, just allow
-		if asn == "" {
-			result <- FilterResult{Result: "allowed", Reason: "no asn found", Field: "asn", Value: ip}
-			return
-		}
+		return FilterResult{Result: "allowed", Reason: "no asn found", Field: "asn", Value: ip}
 	} else {
 		// No IP or ASN provided
-		result <- FilterResult{Result: "allowed", Reason: "no ip or asn provided", Field: "asn", Value: ""}
-		return
+		return FilterResult{Result: "allowed", Reason: "no ip or asn provided", Field: "asn", Value: ""}
 	}
 
-	es := config.ESClient
-
-	// Query ASN rules
-	query := `{
-		"query": {
-			"match": {
-				"asn": "` + asn + `"
-			}
-		}
-	}`
-
-	req := esapi.SearchRequest{
-		Index: []string{"asns"},
-		Body:  strings.NewReader(query),
-	}
-
-	res, err := req.Do(ctx, es)
-	if err != nil {
-		result <- FilterResult{Result: "error", Reason: "elasticsearch error", Field: "asn", Value: asn}
-		return
-	}
-	defer res.Body.Close()
-
-	var r map[string]interface{}
-	if err := json.NewDecoder(res.Body).Decode(&r); err != nil {
-		result <- FilterResult{Result: "error", Reason: "decode error", Field: "asn", Value: asn}
-		return
-	}
-
-	if hits, found := r["hits"].(map[string]interface{}); found {
-		totalHits := hits["total"].(map[string]interface{})["value"].(float64)
-		if totalHits > 0 {
-			firstHit := hits["hits"].([]interface{})[0].(map[string]interface{})
-			source := firstHit["_source"].(map[string]interface{})
-			status := source["status"].(string)
-
-			if status == "denied" {
-				result <- FilterResult{Result: "denied", Reason: "asn denied", Field: "asn", Value: asn}
-			} else if status == "whitelisted" {
-				result <- FilterResult{Result: "whitelisted", Reason: "asn whitelisted", Field: "asn", Value: asn}
-			} else {
-				result <- FilterResult{Result: "allowed", Field: "asn", Value: asn}
-			}
-		} else {
-			result <- FilterResult{Result: "allowed", Field: "asn", Value: asn}
-		}
-	} else {
-		result <- FilterResult{Result: "error", Reason: "no hits", Field: "asn", Value: asn}
-	}
+	snapshot := GetRuleEngine().Snapshot()
+	return withMonitorHit(snapshot.ruleOrDefault("asn", snapshot.MatchASN(asn), "asn", "asn", asn), snapshot.Monitor().MatchASN(asn), "asn", asn)
 }
 
-// SyncCharsetToES synchronisiert eine CharsetRule zu Elasticsearch
+// SyncCharsetToES synchronisiert eine CharsetRule in den Regel-Index
 func SyncCharsetToES(charset models.CharsetRule) error {
-	ctx := context.Background()
-	_, err := config.ESClient.Index(
-		"charsets",
-		strings.NewReader(fmt.Sprintf(`{"id": %d, "charset": "%s", "status": "%s"}`, charset.ID, charset.Charset, charset.Status)),
-		config.ESClient.Index.WithDocumentID(fmt.Sprintf("%d", charset.ID)),
-		config.ESClient.Index.WithContext(ctx),
-	)
-	if err == nil {
-		log.Printf("Indexed Charset: %d %s %s", charset.ID, charset.Charset, charset.Status)
-	}
-	return err
+	return IndexCharsetRule(charset)
 }
 
-// DeleteCharsetFromES entfernt eine CharsetRule aus Elasticsearch
+// DeleteCharsetFromES entfernt eine CharsetRule aus dem Regel-Index
 func DeleteCharsetFromES(id uint) error {
-	ctx := context.Background()
-	_, err := config.ESClient.Delete(
-		"charsets",
-		fmt.Sprintf("%d", id),
-		config.ESClient.Delete.WithContext(ctx),
-	)
-	return err
+	return deleteDocument(IndexCharsets, fmt.Sprintf("%d", id))
 }
 
-// SyncAllCharsetsToES synchronisiert alle CharsetRules nach Elasticsearch
+// SyncAllCharsetsToES synchronisiert alle CharsetRules in den Regel-Index
 func SyncAllCharsetsToES(db *gorm.DB) error {
 	var charsets []models.CharsetRule
 	if err := db.Find(&charsets).Error; err != nil {
 		return err
 	}
-	for _, c := range charsets {
-		_ = SyncCharsetToES(c)
-	}
-	log.Printf("Synced %d charsets to Elasticsearch", len(charsets))
-	return nil
+	stats, err := bulkSync(IndexCharsets, charsets, charsetDocument)
+	log.Printf("Synced %d charsets to the rule index (%d failed, queued for retry)", stats.Indexed, stats.Failed)
+	return err
 }
 
-// SyncUsernameToES synchronisiert eine UsernameRule zu Elasticsearch
+// SyncUsernameToES synchronisiert eine UsernameRule in den Regel-Index
 func SyncUsernameToES(username models.UsernameRule) error {
-	ctx := context.Background()
-	_, err := config.ESClient.Index(
-		"usernames",
-		strings.NewReader(fmt.Sprintf(`{"id": %d, "username": "%s", "status": "%s", "is_regex": %t}`, username.ID, username.Username, username.Status, username.IsRegex)),
-		config.ESClient.Index.WithDocumentID(fmt.Sprintf("%d", username.ID)),
-		config.ESClient.Index.WithContext(ctx),
-	)
-	if err == nil {
-		log.Printf("Indexed Username: %d %s %s %t", username.ID, username.Username, username.Status, username.IsRegex)
-	}
-	return err
+	return IndexUsernameRule(username)
 }
 
-// DeleteUsernameFromES entfernt eine UsernameRule aus Elasticsearch
+// DeleteUsernameFromES entfernt eine UsernameRule aus dem Regel-Index
 func DeleteUsernameFromES(id uint) error {
-	ctx := context.Background()
-	_, err := config.ESClient.Delete(
-		"usernames",
-		fmt.Sprintf("%d", id),
-		config.ESClient.Delete.WithContext(ctx),
-	)
-	return err
+	return deleteDocument(IndexUsernames, fmt.Sprintf("%d", id))
+}
+
+// SyncEmailDomainToES indexes an EmailDomainRule to the rule index
+func SyncEmailDomainToES(domain models.EmailDomainRule) error {
+	return IndexEmailDomainRule(domain)
+}
+
+// DeleteEmailDomainFromES removes an EmailDomainRule from the rule index
+func DeleteEmailDomainFromES(id uint) error {
+	return deleteDocument(IndexEmailDomains, fmt.Sprintf("%d", id))
 }
 
-// SyncAllUsernamesToES synchronisiert alle UsernameRules nach Elasticsearch
+// SyncContentRuleToES indexes a ContentRule to the rule index
+func SyncContentRuleToES(content models.ContentRule) error {
+	return IndexContentRule(content)
+}
+
+// DeleteContentRuleFromES removes a ContentRule from the rule index
+func DeleteContentRuleFromES(id uint) error {
+	return deleteDocument(IndexContentRules, fmt.Sprintf("%d", id))
+}
+
+// SyncAllUsernamesToES synchronisiert alle UsernameRules in den Regel-Index
 func SyncAllUsernamesToES(db *gorm.DB) error {
 	var usernames []models.UsernameRule
 	if err := db.Find(&usernames).Error; err != nil {
 		return err
 	}
-	for _, u := range usernames {
-		_ = SyncUsernameToES(u)
-	}
-	log.Printf("Synced %d usernames to Elasticsearch", len(usernames))
-	return nil
+	stats, err := bulkSync(IndexUsernames, usernames, usernameDocument)
+	log.Printf("Synced %d usernames to the rule index (%d failed, queued for retry)", stats.Indexed, stats.Failed)
+	return err
 }
 
 // Event-Handler für Charset-Events
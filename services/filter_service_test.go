@@ -6,6 +6,8 @@ import (
 	"firewall/config"
 	"firewall/models"
 	"fmt"
+	"math/big"
+	"net/netip"
 	"testing"
 	"time"
 
@@ -75,7 +77,7 @@ func TestFilterResult_EmptyFields(t *testing.T) {
 func TestEvaluateFilters_EmptyInput(t *testing.T) {
 	ctx := context.Background()
 
-	result, err := EvaluateFilters(ctx, "", "", "", "", "")
+	result, err := EvaluateFilters(ctx, "", "", "", "", "", "")
 	assert.NoError(t, err)
 	assert.Equal(t, "allowed", result.Result)
 }
@@ -90,7 +92,7 @@ func TestEvaluateFilters_WithIPOnly(t *testing.T) {
 		}
 	}()
 
-	result, err := EvaluateFilters(ctx, "192.168.1.1", "", "", "", "")
+	result, err := EvaluateFilters(ctx, "192.168.1.1", "", "", "", "", "")
 	// We expect an error because there's no Elasticsearch client, but the function should not panic
 	if err == nil {
 		t.Log("EvaluateFilters completed without error (unexpected in test environment)")
@@ -112,7 +114,7 @@ func TestEvaluateFilters_WithEmailOnly(t *testing.T) {
 		}
 	}()
 
-	result, err := EvaluateFilters(ctx, "", "test@example.com", "", "", "")
+	result, err := EvaluateFilters(ctx, "", "test@example.com", "", "", "", "")
 	// We expect an error because there's no Elasticsearch client, but the function should not panic
 	if err == nil {
 		t.Log("EvaluateFilters completed without error (unexpected in test environment)")
@@ -134,7 +136,7 @@ func TestEvaluateFilters_WithUserAgentOnly(t *testing.T) {
 		}
 	}()
 
-	result, err := EvaluateFilters(ctx, "", "", "Mozilla/5.0", "", "")
+	result, err := EvaluateFilters(ctx, "", "", "Mozilla/5.0", "", "", "")
 	// We expect an error because there's no Elasticsearch client, but the function should not panic
 	if err == nil {
 		t.Log("EvaluateFilters completed without error (unexpected in test environment)")
@@ -156,7 +158,7 @@ func TestEvaluateFilters_WithCountryOnly(t *testing.T) {
 		}
 	}()
 
-	result, err := EvaluateFilters(ctx, "", "", "", "US", "")
+	result, err := EvaluateFilters(ctx, "", "", "", "US", "", "")
 	// We expect an error because there's no Elasticsearch client, but the function should not panic
 	if err == nil {
 		t.Log("EvaluateFilters completed without error (unexpected in test environment)")
@@ -178,7 +180,7 @@ func TestEvaluateFilters_WithUsernameOnly(t *testing.T) {
 		}
 	}()
 
-	result, err := EvaluateFilters(ctx, "", "", "", "", "testuser")
+	result, err := EvaluateFilters(ctx, "", "", "", "", "", "testuser")
 	// We expect an error because there's no Elasticsearch client, but the function should not panic
 	if err == nil {
 		t.Log("EvaluateFilters completed without error (unexpected in test environment)")
@@ -200,7 +202,7 @@ func TestEvaluateFilters_WithAllFields(t *testing.T) {
 		}
 	}()
 
-	result, err := EvaluateFilters(ctx, "192.168.1.1", "test@example.com", "Mozilla/5.0", "US", "testuser")
+	result, err := EvaluateFilters(ctx, "192.168.1.1", "test@example.com", "Mozilla/5.0", "US", "", "testuser")
 	// We expect an error because there's no Elasticsearch client, but the function should not panic
 	if err == nil {
 		t.Log("EvaluateFilters completed without error (unexpected in test environment)")
@@ -213,10 +215,12 @@ func TestEvaluateFilters_WithAllFields(t *testing.T) {
 }
 
 func TestEvaluateFilters_WithTimeout(t *testing.T) {
+	// Rule lookups are in-memory, so only an already expired context reliably times out
 	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Millisecond)
 	defer cancel()
+	<-ctx.Done()
 
-	result, err := EvaluateFilters(ctx, "192.168.1.1", "test@example.com", "Mozilla/5.0", "US", "testuser")
+	result, err := EvaluateFilters(ctx, "192.168.1.1", "test@example.com", "Mozilla/5.0", "US", "", "testuser")
 
 	// Should timeout due to very short timeout
 	assert.Error(t, err)
@@ -230,36 +234,36 @@ func TestEvaluateFilters_WithTimeout(t *testing.T) {
 
 func TestCollectResults_AllAllowed(t *testing.T) {
 	ctx := context.Background()
-	results := make(chan FilterResult, 5)
+	results := make(chan FilterVerdict, 5)
 
 	// Send all allowed results
 	go func() {
-		results <- FilterResult{Result: "allowed", Field: "ip", Value: "192.168.1.1"}
-		results <- FilterResult{Result: "allowed", Field: "email", Value: "test@example.com"}
-		results <- FilterResult{Result: "allowed", Field: "user_agent", Value: "Mozilla/5.0"}
-		results <- FilterResult{Result: "allowed", Field: "country", Value: "US"}
-		results <- FilterResult{Result: "allowed", Field: "username", Value: "testuser"}
+		results <- FilterVerdict{FilterResult: FilterResult{Result: "allowed", Field: "ip", Value: "192.168.1.1"}}
+		results <- FilterVerdict{FilterResult: FilterResult{Result: "allowed", Field: "email", Value: "test@example.com"}}
+		results <- FilterVerdict{FilterResult: FilterResult{Result: "allowed", Field: "user_agent", Value: "Mozilla/5.0"}}
+		results <- FilterVerdict{FilterResult: FilterResult{Result: "allowed", Field: "country", Value: "US"}}
+		results <- FilterVerdict{FilterResult: FilterResult{Result: "allowed", Field: "username", Value: "testuser"}}
 	}()
 
-	result, err := collectResults(ctx, results)
+	result, _, err := collectResults(ctx, results, 5)
 	assert.NoError(t, err)
 	assert.Equal(t, "allowed", result.Result)
 }
 
 func TestCollectResults_WithWhitelisted(t *testing.T) {
 	ctx := context.Background()
-	results := make(chan FilterResult, 5)
+	results := make(chan FilterVerdict, 5)
 
 	// Send whitelisted result
 	go func() {
-		results <- FilterResult{Result: "whitelisted", Reason: "ip whitelisted", Field: "ip", Value: "192.168.1.1"}
-		results <- FilterResult{Result: "allowed", Field: "email", Value: "test@example.com"}
-		results <- FilterResult{Result: "allowed", Field: "user_agent", Value: "Mozilla/5.0"}
-		results <- FilterResult{Result: "allowed", Field: "country", Value: "US"}
-		results <- FilterResult{Result: "allowed", Field: "username", Value: "testuser"}
+		results <- FilterVerdict{FilterResult: FilterResult{Result: "whitelisted", Reason: "ip whitelisted", Field: "ip", Value: "192.168.1.1"}}
+		results <- FilterVerdict{FilterResult: FilterResult{Result: "allowed", Field: "email", Value: "test@example.com"}}
+		results <- FilterVerdict{FilterResult: FilterResult{Result: "allowed", Field: "user_agent", Value: "Mozilla/5.0"}}
+		results <- FilterVerdict{FilterResult: FilterResult{Result: "allowed", Field: "country", Value: "US"}}
+		results <- FilterVerdict{FilterResult: FilterResult{Result: "allowed", Field: "username", Value: "testuser"}}
 	}()
 
-	result, err := collectResults(ctx, results)
+	result, _, err := collectResults(ctx, results, 5)
 	assert.NoError(t, err)
 	assert.Equal(t, "whitelisted", result.Result)
 	assert.Equal(t, "ip whitelisted", result.Reason)
@@ -269,18 +273,18 @@ func TestCollectResults_WithWhitelisted(t *testing.T) {
 
 func TestCollectResults_WithDenied(t *testing.T) {
 	ctx := context.Background()
-	results := make(chan FilterResult, 5)
+	results := make(chan FilterVerdict, 5)
 
 	// Send denied result
 	go func() {
-		results <- FilterResult{Result: "denied", Reason: "ip denied", Field: "ip", Value: "192.168.1.1"}
-		results <- FilterResult{Result: "allowed", Field: "email", Value: "test@example.com"}
-		results <- FilterResult{Result: "allowed", Field: "user_agent", Value: "Mozilla/5.0"}
-		results <- FilterResult{Result: "allowed", Field: "country", Value: "US"}
-		results <- FilterResult{Result: "allowed", Field: "username", Value: "testuser"}
+		results <- FilterVerdict{FilterResult: FilterResult{Result: "denied", Reason: "ip denied", Field: "ip", Value: "192.168.1.1"}}
+		results <- FilterVerdict{FilterResult: FilterResult{Result: "allowed", Field: "email", Value: "test@example.com"}}
+		results <- FilterVerdict{FilterResult: FilterResult{Result: "allowed", Field: "user_agent", Value: "Mozilla/5.0"}}
+		results <- FilterVerdict{FilterResult: FilterResult{Result: "allowed", Field: "country", Value: "US"}}
+		results <- FilterVerdict{FilterResult: FilterResult{Result: "allowed", Field: "username", Value: "testuser"}}
 	}()
 
-	result, err := collectResults(ctx, results)
+	result, _, err := collectResults(ctx, results, 5)
 	assert.NoError(t, err)
 	assert.Equal(t, "denied", result.Result)
 	assert.Equal(t, "ip denied", result.Reason)
@@ -290,18 +294,18 @@ func TestCollectResults_WithDenied(t *testing.T) {
 
 func TestCollectResults_WithError(t *testing.T) {
 	ctx := context.Background()
-	results := make(chan FilterResult, 5)
+	results := make(chan FilterVerdict, 5)
 
 	// Send error result
 	go func() {
-		results <- FilterResult{Result: "error", Reason: "elasticsearch error", Field: "ip", Value: "192.168.1.1"}
-		results <- FilterResult{Result: "allowed", Field: "email", Value: "test@example.com"}
-		results <- FilterResult{Result: "allowed", Field: "user_agent", Value: "Mozilla/5.0"}
-		results <- FilterResult{Result: "allowed", Field: "country", Value: "US"}
-		results <- FilterResult{Result: "allowed", Field: "username", Value: "testuser"}
+		results <- FilterVerdict{FilterResult: FilterResult{Result: "error", Reason: "elasticsearch error", Field: "ip", Value: "192.168.1.1"}}
+		results <- FilterVerdict{FilterResult: FilterResult{Result: "allowed", Field: "email", Value: "test@example.com"}}
+		results <- FilterVerdict{FilterResult: FilterResult{Result: "allowed", Field: "user_agent", Value: "Mozilla/5.0"}}
+		results <- FilterVerdict{FilterResult: FilterResult{Result: "allowed", Field: "country", Value: "US"}}
+		results <- FilterVerdict{FilterResult: FilterResult{Result: "allowed", Field: "username", Value: "testuser"}}
 	}()
 
-	result, err := collectResults(ctx, results)
+	result, _, err := collectResults(ctx, results, 5)
 	assert.NoError(t, err)
 	assert.Equal(t, "allowed", result.Result) // Error should not override allowed
 }
@@ -309,10 +313,10 @@ func TestCollectResults_WithError(t *testing.T) {
 func TestCollectResults_WithTimeout(t *testing.T) {
 	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Millisecond)
 	defer cancel()
-	results := make(chan FilterResult, 5)
+	results := make(chan FilterVerdict, 5)
 
 	// Don't send any results to trigger timeout
-	result, err := collectResults(ctx, results)
+	result, _, err := collectResults(ctx, results, 5)
 
 	assert.Error(t, err)
 	assert.Equal(t, "timeout", result.Result)
@@ -327,7 +331,7 @@ func TestFilterIP_EmptyIP(t *testing.T) {
 	ctx := context.Background()
 	results := make(chan FilterResult, 1)
 
-	filterIP(ctx, "", results)
+	results <- ipFilter{}.Evaluate(ctx, &FilterInput{IP: ""})
 
 	result := <-results
 	assert.Equal(t, "allowed", result.Result)
@@ -347,7 +351,7 @@ func TestFilterIP_WithRealIP(t *testing.T) {
 		}
 	}()
 
-	filterIP(ctx, "192.168.1.1", results)
+	results <- ipFilter{}.Evaluate(ctx, &FilterInput{IP: "192.168.1.1"})
 
 	// We expect an error because there's no Elasticsearch client, but the function should not panic
 	select {
@@ -369,7 +373,7 @@ func TestFilterEmail_EmptyEmail(t *testing.T) {
 		}
 	}()
 
-	filterEmail(ctx, "", results)
+	results <- emailFilter{}.Evaluate(ctx, &FilterInput{Email: ""})
 
 	// We expect an error because there's no Elasticsearch client, but the function should not panic
 	select {
@@ -391,7 +395,7 @@ func TestFilterUserAgent_EmptyUserAgent(t *testing.T) {
 		}
 	}()
 
-	filterUserAgent(ctx, "", results)
+	results <- userAgentFilter{}.Evaluate(ctx, &FilterInput{UserAgent: ""})
 
 	// We expect an error because there's no Elasticsearch client, but the function should not panic
 	select {
@@ -413,7 +417,7 @@ func TestFilterCountry_EmptyCountry(t *testing.T) {
 		}
 	}()
 
-	filterCountry(ctx, "", results)
+	results <- countryFilter{}.Evaluate(ctx, &FilterInput{Country: ""})
 
 	// We expect an error because there's no Elasticsearch client, but the function should not panic
 	select {
@@ -435,7 +439,7 @@ func TestFilterUsername_EmptyUsername(t *testing.T) {
 		}
 	}()
 
-	filterUsername(ctx, "", results)
+	results <- usernameFilter{}.Evaluate(ctx, &FilterInput{Username: ""})
 
 	// We expect an error because there's no Elasticsearch client, but the function should not panic
 	select {
@@ -637,7 +641,7 @@ func TestFilterService_Integration(t *testing.T) {
 				}
 			}()
 
-			result, err := EvaluateFilters(ctx, tc.ip, tc.email, tc.userAgent, tc.country, tc.username)
+			result, err := EvaluateFilters(ctx, tc.ip, tc.email, tc.userAgent, tc.country, "", tc.username)
 			// We expect an error because there's no Elasticsearch client, but the function should not panic
 			if err == nil {
 				t.Log("EvaluateFilters completed without error (unexpected in test environment)")
@@ -667,7 +671,7 @@ func TestFilterService_Concurrency(t *testing.T) {
 				}
 			}()
 
-			result, err := EvaluateFilters(ctx, "192.168.1.1", "test@example.com", "Mozilla/5.0", "US", "testuser")
+			result, err := EvaluateFilters(ctx, "192.168.1.1", "test@example.com", "Mozilla/5.0", "US", "", "testuser")
 			// We expect an error because there's no Elasticsearch client, but the function should not panic
 			if err == nil {
 				t.Log("EvaluateFilters completed without error (unexpected in test environment)")
@@ -675,7 +679,7 @@ func TestFilterService_Concurrency(t *testing.T) {
 
 			// Send result to channel
 			select {
-			case results <- result:
+			case results <- result.FilterResult:
 			default:
 				t.Log("Channel full, skipping result")
 			}
@@ -723,7 +727,7 @@ func TestFilterService_ErrorHandling(t *testing.T) {
 				}
 			}()
 
-			result, err := EvaluateFilters(ctx, tc.ip, tc.email, tc.userAgent, tc.country, tc.username)
+			result, err := EvaluateFilters(ctx, tc.ip, tc.email, tc.userAgent, tc.country, "", tc.username)
 			// We expect an error because there's no Elasticsearch client, but the function should not panic
 			if err == nil {
 				t.Log("EvaluateFilters completed without error (unexpected in test environment)")
@@ -751,7 +755,7 @@ func TestFilterService_Performance(t *testing.T) {
 		}
 	}()
 
-	result, err := EvaluateFilters(ctx, "192.168.1.1", "test@example.com", "Mozilla/5.0", "US", "testuser")
+	result, err := EvaluateFilters(ctx, "192.168.1.1", "test@example.com", "Mozilla/5.0", "US", "", "testuser")
 	// We expect an error because there's no Elasticsearch client, but the function should not panic
 	if err == nil {
 		t.Log("EvaluateFilters completed without error (unexpected in test environment)")
@@ -804,7 +808,7 @@ func TestEvaluateFilters_Comprehensive(t *testing.T) {
 				}
 			}()
 
-			result, err := EvaluateFilters(ctx, tc.ip, tc.email, tc.userAgent, tc.country, tc.username)
+			result, err := EvaluateFilters(ctx, tc.ip, tc.email, tc.userAgent, tc.country, "", tc.username)
 			// We expect an error because there's no Elasticsearch client, but the function should not panic
 			if err == nil {
 				t.Log("EvaluateFilters completed without error (unexpected in test environment)")
@@ -824,7 +828,7 @@ func TestEvaluateFilters_WithCancelledContext(t *testing.T) {
 	// Cancel immediately
 	cancel()
 
-	result, err := EvaluateFilters(ctx, "192.168.1.1", "test@example.com", "Mozilla/5.0", "US", "testuser")
+	result, err := EvaluateFilters(ctx, "192.168.1.1", "test@example.com", "Mozilla/5.0", "US", "", "testuser")
 
 	// Should return timeout due to cancelled context
 	assert.Error(t, err)
@@ -856,7 +860,7 @@ func TestFilterIP_Comprehensive(t *testing.T) {
 				}
 			}()
 
-			filterIP(ctx, ip, results)
+			results <- ipFilter{}.Evaluate(ctx, &FilterInput{IP: ip})
 
 			// We expect an error because there's no Elasticsearch client, but the function should not panic
 			select {
@@ -894,7 +898,7 @@ func TestFilterEmail_Comprehensive(t *testing.T) {
 				}
 			}()
 
-			filterEmail(ctx, email, results)
+			results <- emailFilter{}.Evaluate(ctx, &FilterInput{Email: email})
 
 			// We expect an error because there's no Elasticsearch client, but the function should not panic
 			select {
@@ -931,7 +935,7 @@ func TestFilterUserAgent_Comprehensive(t *testing.T) {
 				}
 			}()
 
-			filterUserAgent(ctx, userAgent, results)
+			results <- userAgentFilter{}.Evaluate(ctx, &FilterInput{UserAgent: userAgent})
 
 			// We expect an error because there's no Elasticsearch client, but the function should not panic
 			select {
@@ -963,7 +967,7 @@ func TestFilterCountry_Comprehensive(t *testing.T) {
 				}
 			}()
 
-			filterCountry(ctx, country, results)
+			results <- countryFilter{}.Evaluate(ctx, &FilterInput{Country: country})
 
 			// We expect an error because there's no Elasticsearch client, but the function should not panic
 			select {
@@ -998,7 +1002,7 @@ func TestFilterUsername_Comprehensive(t *testing.T) {
 				}
 			}()
 
-			filterUsername(ctx, username, results)
+			results <- usernameFilter{}.Evaluate(ctx, &FilterInput{Username: username})
 
 			// We expect an error because there's no Elasticsearch client, but the function should not panic
 			select {
@@ -1030,6 +1034,13 @@ func TestIsIPInCIDR(t *testing.T) {
 		{"172.16.0.1", "172.16.0.0/12", true},
 		{"8.8.8.8", "8.8.8.0/24", true},
 		{"8.8.9.1", "8.8.8.0/24", false},
+		{"2001:db8::1", "2001:db8::/32", true},
+		{"2001:db9::1", "2001:db8::/32", false},
+		{"::ffff:10.1.2.3", "10.0.0.0/8", true},          // IPv4-mapped address
+		{"10.1.2.3", "::ffff:10.0.0.0/104", true},        // IPv4-mapped prefix
+		{"10.1.2.3", "::/0", false},                      // IPv6 prefixes never contain IPv4 addresses
+		{"2001:db8::1", "0.0.0.0/0", false},              // and vice versa
+		{"2001:db8:ffff::1", "2001:db8:8000::/33", true}, // Host bits beyond 64
 	}
 
 	for _, tc := range testCases {
@@ -1041,6 +1052,217 @@ func TestIsIPInCIDR(t *testing.T) {
 	}
 }
 
+func TestParseCIDR_AddressFamilies(t *testing.T) {
+	testCases := []struct {
+		cidr    string
+		network string
+		start   string
+		end     string
+		total   string
+		ipv6    bool
+	}{
+		{"192.0.2.7", "192.0.2.7/32", "192.0.2.7", "192.0.2.7", "1", false},
+		{"10.0.0.1/8", "10.0.0.0/8", "10.0.0.0", "10.255.255.255", "16777216", false},
+		{"0.0.0.0/0", "0.0.0.0/0", "0.0.0.0", "255.255.255.255", "4294967296", false},
+		{"::ffff:10.0.0.0/104", "10.0.0.0/8", "10.0.0.0", "10.255.255.255", "16777216", false},
+		{"2001:DB8::1", "2001:db8::1/128", "2001:db8::1", "2001:db8::1", "1", true},
+		{"2001:db8::/32", "2001:db8::/32", "2001:db8::", "2001:db8:ffff:ffff:ffff:ffff:ffff:ffff", "79228162514264337593543950336", true},
+		{"2001:db8::/127", "2001:db8::/127", "2001:db8::", "2001:db8::1", "2", true},
+		{"::/0", "::/0", "::", "ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff", "340282366920938463463374607431768211456", true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.cidr, func(t *testing.T) {
+			info, err := utils.ParseCIDR(tc.cidr)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.network, info.Network)
+			assert.Equal(t, tc.start, info.StartIP.String())
+			assert.Equal(t, tc.end, info.EndIP.String())
+			assert.Equal(t, tc.total, info.TotalIPs.String())
+			assert.Equal(t, tc.ipv6, info.IsIPv6)
+		})
+	}
+
+	_, err := utils.ParseCIDR("2001:db8::/129")
+	assert.Error(t, err)
+	_, err = utils.ParseCIDR("fe80::1%eth0")
+	assert.Error(t, err)
+}
+
+func TestAddrIntConversion(t *testing.T) {
+	addr := netip.MustParseAddr("2001:db8::ff")
+	n := utils.AddrToInt(addr)
+	back, err := utils.IntToAddr(n.Add(n, big.NewInt(1)), true)
+	assert.NoError(t, err)
+	assert.Equal(t, "2001:db8::100", back.String())
+
+	back, err = utils.IntToAddr(utils.AddrToInt(netip.MustParseAddr("10.0.0.255")), false)
+	assert.NoError(t, err)
+	assert.Equal(t, "10.0.0.255", back.String())
+
+	_, err = utils.IntToAddr(utils.AddrToInt(addr), false)
+	assert.Error(t, err)
+}
+
+func TestCheckConflicts_IPv6AndMapped(t *testing.T) {
+	statuses := map[string]string{
+		"2001:db8::/32":       "denied",
+		"::ffff:10.0.0.0/104": "denied",
+		"2001:db8::5":         "allowed",
+	}
+	cidrs := []string{"2001:db8::/32", "::ffff:10.0.0.0/104"}
+
+	// A mapped address is covered by the IPv4 range, an IPv6 address only by IPv6 ranges
+	conflicts, err := utils.CheckIPConflicts("::ffff:10.1.2.3", cidrs, statuses, "denied")
+	assert.NoError(t, err)
+	if assert.Len(t, conflicts, 1) {
+		assert.Equal(t, "::ffff:10.0.0.0/104", conflicts[0].Conflicting[0])
+		assert.Equal(t, "error", conflicts[0].Severity)
+	}
+	conflicts, err = utils.CheckIPConflicts("2001:db8:1::1", cidrs, statuses, "allowed")
+	assert.NoError(t, err)
+	if assert.Len(t, conflicts, 1) {
+		assert.Equal(t, "warning", conflicts[0].Severity)
+	}
+
+	// Equal after normalization
+	conflicts, err = utils.CheckCIDRConflicts("10.0.0.0/8", nil, cidrs, statuses, "denied")
+	assert.NoError(t, err)
+	if assert.Len(t, conflicts, 1) {
+		assert.Equal(t, "exact_match", conflicts[0].Type)
+	}
+
+	// Contained and covering IPv6 ranges, plus a covered IPv6 address
+	conflicts, err = utils.CheckCIDRConflicts("2001:db8::/48", []string{"2001:db8::5", "192.0.2.1"}, cidrs, statuses, "denied")
+	assert.NoError(t, err)
+	if assert.Len(t, conflicts, 2) {
+		assert.Equal(t, "cidr_covers_ip", conflicts[0].Type)
+		assert.Equal(t, "cidr_overlaps", conflicts[1].Type)
+		assert.Contains(t, conflicts[1].Message, "is within existing range")
+	}
+
+	// ::/0 does not overlap IPv4 ranges
+	overlap, err := utils.CheckCIDROverlap("::/0", "10.0.0.0/8")
+	assert.NoError(t, err)
+	assert.False(t, overlap)
+}
+
+func TestParseIPRange(t *testing.T) {
+	r, err := utils.ParseIPRange("203.0.113.7 - 203.0.113.90")
+	assert.NoError(t, err)
+	assert.Equal(t, "203.0.113.7-203.0.113.90", r.String())
+	assert.Equal(t, big.NewInt(84), r.Size())
+	assert.True(t, r.Contains(netip.MustParseAddr("::ffff:203.0.113.50")))
+	assert.False(t, r.Contains(netip.MustParseAddr("203.0.113.91")))
+
+	// CIDR blocks and single IPs are ranges too
+	r, err = utils.ParseIPRange("10.0.0.0/8")
+	assert.NoError(t, err)
+	assert.Equal(t, "10.0.0.0-10.255.255.255", r.String())
+	r, err = utils.ParseIPRange("2001:db8::1")
+	assert.NoError(t, err)
+	assert.Equal(t, "2001:db8::1-2001:db8::1", r.String())
+
+	for _, invalid := range []string{"203.0.113.90-203.0.113.7", "203.0.113.7-2001:db8::1", "203.0.113.7-x", "1-2-3"} {
+		_, err := utils.ParseIPRange(invalid)
+		assert.Error(t, err, invalid)
+	}
+
+	assert.True(t, utils.IsRangeNotation("10.0.0.1-10.0.0.9"))
+	assert.False(t, utils.IsRangeNotation("not-an-ip"))
+	assert.False(t, utils.IsRangeNotation("-1.2.3.4"))
+	assert.False(t, utils.IsRangeNotation("10.0.0.0/8"))
+}
+
+func TestIPRange_Prefixes(t *testing.T) {
+	testCases := []struct {
+		entry    string
+		expected []string
+		bits     int
+	}{
+		{"203.0.113.7-203.0.113.90", []string{"203.0.113.7/32", "203.0.113.8/29", "203.0.113.16/28", "203.0.113.32/27", "203.0.113.64/28", "203.0.113.80/29", "203.0.113.88/31", "203.0.113.90/32"}, 25},
+		{"10.0.0.0-10.0.255.255", []string{"10.0.0.0/16"}, 16},
+		{"0.0.0.0-255.255.255.255", []string{"0.0.0.0/0"}, 0},
+		{"192.0.2.1-192.0.2.1", []string{"192.0.2.1/32"}, 32},
+		{"2001:db8::-2001:db8::1:0", []string{"2001:db8::/112", "2001:db8::1:0/128"}, 111},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.entry, func(t *testing.T) {
+			cidrs, err := utils.RangeCIDRs(tc.entry)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, cidrs)
+
+			r, _ := utils.ParseIPRange(tc.entry)
+			assert.Equal(t, tc.bits, r.Bits())
+		})
+	}
+}
+
+func TestDistanceKm(t *testing.T) {
+	testCases := []struct {
+		name                   string
+		lat1, lon1, lat2, lon2 float64
+		km                     float64
+	}{
+		{"same point", 52.52, 13.405, 52.52, 13.405, 0},
+		{"Berlin to Paris", 52.52, 13.405, 48.8566, 2.3522, 878},
+		{"New York to London", 40.7128, -74.006, 51.5074, -0.1278, 5570},
+		{"across the date line", 0, 179.5, 0, -179.5, 111},
+		{"antipodes", 0, 0, 0, 180, utils.MaxDistanceKm},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.InDelta(t, tc.km, utils.DistanceKm(tc.lat1, tc.lon1, tc.lat2, tc.lon2), 5)
+		})
+	}
+}
+
+func TestCheckConflicts_Ranges(t *testing.T) {
+	statuses := map[string]string{
+		"203.0.113.7-203.0.113.90": "denied",
+		"10.0.0.0/8":               "denied",
+		"198.51.100.5":             "allowed",
+	}
+	existing := []string{"203.0.113.7-203.0.113.90", "10.0.0.0/8"}
+
+	conflicts, err := utils.CheckIPConflicts("203.0.113.50", existing, statuses, "denied")
+	assert.NoError(t, err)
+	if assert.Len(t, conflicts, 1) {
+		assert.Equal(t, "203.0.113.7-203.0.113.90", conflicts[0].Conflicting[0])
+		assert.Equal(t, "error", conflicts[0].Severity)
+	}
+
+	// A range equal to a CIDR block is an exact match
+	conflicts, err = utils.CheckCIDRConflicts("10.0.0.0-10.255.255.255", nil, existing, statuses, "denied")
+	assert.NoError(t, err)
+	if assert.Len(t, conflicts, 1) {
+		assert.Equal(t, "exact_match", conflicts[0].Type)
+	}
+
+	// A CIDR block overlapping a range, and a range covering an IP
+	conflicts, err = utils.CheckCIDRConflicts("203.0.113.0/27", nil, existing, statuses, "allowed")
+	assert.NoError(t, err)
+	if assert.Len(t, conflicts, 1) {
+		assert.Equal(t, "cidr_overlaps", conflicts[0].Type)
+		assert.Equal(t, "warning", conflicts[0].Severity)
+		assert.Contains(t, conflicts[0].Message, "overlaps with existing range")
+	}
+	conflicts, err = utils.CheckCIDRConflicts("198.51.100.1-198.51.100.9", []string{"198.51.100.5"}, existing, statuses, "denied")
+	assert.NoError(t, err)
+	if assert.Len(t, conflicts, 1) {
+		assert.Equal(t, "cidr_covers_ip", conflicts[0].Type)
+	}
+
+	overlap, err := utils.CheckCIDROverlap("203.0.113.90-203.0.113.100", "203.0.113.64/27")
+	assert.NoError(t, err)
+	assert.True(t, overlap)
+	overlap, err = utils.CheckCIDROverlap("203.0.113.96-203.0.113.100", "203.0.113.64/27")
+	assert.NoError(t, err)
+	assert.False(t, overlap)
+}
+
 func TestIsIPInCIDR_InvalidInput(t *testing.T) {
 	// Test invalid CIDR inputs
 	testCases := []struct {
@@ -1102,7 +1324,7 @@ func TestConcurrentFilterEvaluation(t *testing.T) {
 				}
 			}()
 
-			result, err := EvaluateFilters(ctx, tc.ip, tc.email, tc.userAgent, tc.country, tc.username)
+			result, err := EvaluateFilters(ctx, tc.ip, tc.email, tc.userAgent, tc.country, "", tc.username)
 			// We expect an error because there's no Elasticsearch client, but the function should not panic
 			if err == nil {
 				t.Log("EvaluateFilters completed without error (unexpected in test environment)")
@@ -1110,7 +1332,7 @@ func TestConcurrentFilterEvaluation(t *testing.T) {
 
 			// Send result to channel
 			select {
-			case results <- result:
+			case results <- result.FilterResult:
 			default:
 				t.Log("Channel full, skipping result")
 			}
@@ -1153,7 +1375,7 @@ func TestFilterEvaluation_StressTest(t *testing.T) {
 			email := fmt.Sprintf("test%d@example.com", id)
 			username := fmt.Sprintf("user%d", id)
 
-			result, err := EvaluateFilters(ctx, ip, email, "Mozilla/5.0", "US", username)
+			result, err := EvaluateFilters(ctx, ip, email, "Mozilla/5.0", "US", "", username)
 			// We expect an error because there's no Elasticsearch client, but the function should not panic
 			if err == nil {
 				t.Log("EvaluateFilters completed without error (unexpected in test environment)")
@@ -1161,7 +1383,7 @@ func TestFilterEvaluation_StressTest(t *testing.T) {
 
 			// Send result to channel
 			select {
-			case results <- result:
+			case results <- result.FilterResult:
 			default:
 				t.Log("Channel full, skipping result")
 			}
@@ -1194,7 +1416,7 @@ func TestEvaluateFilters_ActualExecution(t *testing.T) {
 
 	// Test that the function actually executes and returns a result
 	// Even with nil ESClient, the function should complete and return a result
-	result, err := EvaluateFilters(ctx, "192.168.1.1", "test@example.com", "Mozilla/5.0", "US", "testuser")
+	result, err := EvaluateFilters(ctx, "192.168.1.1", "test@example.com", "Mozilla/5.0", "US", "", "testuser")
 
 	// The function should complete without error, even if individual filters fail
 	assert.NoError(t, err)
@@ -1206,7 +1428,7 @@ func TestEvaluateFilters_EmptyInputs_ActualExecution(t *testing.T) {
 	ctx := context.Background()
 
 	// Test with all empty inputs - this should execute the function
-	result, err := EvaluateFilters(ctx, "", "", "", "", "")
+	result, err := EvaluateFilters(ctx, "", "", "", "", "", "")
 
 	// Should complete without error
 	assert.NoError(t, err)
@@ -1215,11 +1437,13 @@ func TestEvaluateFilters_EmptyInputs_ActualExecution(t *testing.T) {
 }
 
 func TestEvaluateFilters_WithTimeout_ActualExecution(t *testing.T) {
+	// Rule lookups are in-memory, so only an already expired context reliably times out
 	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Millisecond)
 	defer cancel()
+	<-ctx.Done()
 
 	// Test timeout scenario - this should execute the function
-	result, err := EvaluateFilters(ctx, "192.168.1.1", "test@example.com", "Mozilla/5.0", "US", "testuser")
+	result, err := EvaluateFilters(ctx, "192.168.1.1", "test@example.com", "Mozilla/5.0", "US", "", "testuser")
 
 	// Should timeout due to very short timeout
 	assert.Error(t, err)
@@ -1232,7 +1456,7 @@ func TestFilterIP_EmptyIP_ActualExecution(t *testing.T) {
 	results := make(chan FilterResult, 1)
 
 	// This should execute the filterIP function and return a result
-	filterIP(ctx, "", results)
+	results <- ipFilter{}.Evaluate(ctx, &FilterInput{IP: ""})
 
 	result := <-results
 	assert.Equal(t, "allowed", result.Result)
@@ -1247,7 +1471,7 @@ func TestFilterIP_WithRealIP_ActualExecution(t *testing.T) {
 
 	// This should execute the filterIP function
 	// Even if ESClient is nil, the function should handle the error gracefully
-	filterIP(ctx, "192.168.1.1", results)
+	results <- ipFilter{}.Evaluate(ctx, &FilterInput{IP: "192.168.1.1"})
 
 	// Wait for result with timeout
 	select {
@@ -1265,7 +1489,7 @@ func TestFilterEmail_ActualExecution(t *testing.T) {
 	results := make(chan FilterResult, 1)
 
 	// This should execute the filterEmail function
-	filterEmail(ctx, "test@example.com", results)
+	results <- emailFilter{}.Evaluate(ctx, &FilterInput{Email: "test@example.com"})
 
 	// Wait for result with timeout
 	select {
@@ -1283,7 +1507,7 @@ func TestFilterUserAgent_ActualExecution(t *testing.T) {
 	results := make(chan FilterResult, 1)
 
 	// This should execute the filterUserAgent function
-	filterUserAgent(ctx, "Mozilla/5.0", results)
+	results <- userAgentFilter{}.Evaluate(ctx, &FilterInput{UserAgent: "Mozilla/5.0"})
 
 	// Wait for result with timeout
 	select {
@@ -1301,7 +1525,7 @@ func TestFilterCountry_ActualExecution(t *testing.T) {
 	results := make(chan FilterResult, 1)
 
 	// This should execute the filterCountry function
-	filterCountry(ctx, "US", results)
+	results <- countryFilter{}.Evaluate(ctx, &FilterInput{Country: "US"})
 
 	// Wait for result with timeout
 	select {
@@ -1319,7 +1543,7 @@ func TestFilterUsername_ActualExecution(t *testing.T) {
 	results := make(chan FilterResult, 1)
 
 	// This should execute the filterUsername function
-	filterUsername(ctx, "testuser", results)
+	results <- usernameFilter{}.Evaluate(ctx, &FilterInput{Username: "testuser"})
 
 	// Wait for result with timeout
 	select {
@@ -1334,36 +1558,36 @@ func TestFilterUsername_ActualExecution(t *testing.T) {
 
 func TestCollectResults_AllAllowed_ActualExecution(t *testing.T) {
 	ctx := context.Background()
-	results := make(chan FilterResult, 5)
+	results := make(chan FilterVerdict, 5)
 
 	// Send all allowed results
 	go func() {
-		results <- FilterResult{Result: "allowed", Field: "ip", Value: "192.168.1.1"}
-		results <- FilterResult{Result: "allowed", Field: "email", Value: "test@example.com"}
-		results <- FilterResult{Result: "allowed", Field: "user_agent", Value: "Mozilla/5.0"}
-		results <- FilterResult{Result: "allowed", Field: "country", Value: "US"}
-		results <- FilterResult{Result: "allowed", Field: "username", Value: "testuser"}
+		results <- FilterVerdict{FilterResult: FilterResult{Result: "allowed", Field: "ip", Value: "192.168.1.1"}}
+		results <- FilterVerdict{FilterResult: FilterResult{Result: "allowed", Field: "email", Value: "test@example.com"}}
+		results <- FilterVerdict{FilterResult: FilterResult{Result: "allowed", Field: "user_agent", Value: "Mozilla/5.0"}}
+		results <- FilterVerdict{FilterResult: FilterResult{Result: "allowed", Field: "country", Value: "US"}}
+		results <- FilterVerdict{FilterResult: FilterResult{Result: "allowed", Field: "username", Value: "testuser"}}
 	}()
 
-	result, err := collectResults(ctx, results)
+	result, _, err := collectResults(ctx, results, 5)
 	assert.NoError(t, err)
 	assert.Equal(t, "allowed", result.Result)
 }
 
 func TestCollectResults_WithWhitelisted_ActualExecution(t *testing.T) {
 	ctx := context.Background()
-	results := make(chan FilterResult, 5)
+	results := make(chan FilterVerdict, 5)
 
 	// Send whitelisted result
 	go func() {
-		results <- FilterResult{Result: "whitelisted", Reason: "ip whitelisted", Field: "ip", Value: "192.168.1.1"}
-		results <- FilterResult{Result: "allowed", Field: "email", Value: "test@example.com"}
-		results <- FilterResult{Result: "allowed", Field: "user_agent", Value: "Mozilla/5.0"}
-		results <- FilterResult{Result: "allowed", Field: "country", Value: "US"}
-		results <- FilterResult{Result: "allowed", Field: "username", Value: "testuser"}
+		results <- FilterVerdict{FilterResult: FilterResult{Result: "whitelisted", Reason: "ip whitelisted", Field: "ip", Value: "192.168.1.1"}}
+		results <- FilterVerdict{FilterResult: FilterResult{Result: "allowed", Field: "email", Value: "test@example.com"}}
+		results <- FilterVerdict{FilterResult: FilterResult{Result: "allowed", Field: "user_agent", Value: "Mozilla/5.0"}}
+		results <- FilterVerdict{FilterResult: FilterResult{Result: "allowed", Field: "country", Value: "US"}}
+		results <- FilterVerdict{FilterResult: FilterResult{Result: "allowed", Field: "username", Value: "testuser"}}
 	}()
 
-	result, err := collectResults(ctx, results)
+	result, _, err := collectResults(ctx, results, 5)
 	assert.NoError(t, err)
 	assert.Equal(t, "whitelisted", result.Result)
 	assert.Equal(t, "ip whitelisted", result.Reason)
@@ -1373,18 +1597,18 @@ func TestCollectResults_WithWhitelisted_ActualExecution(t *testing.T) {
 
 func TestCollectResults_WithDenied_ActualExecution(t *testing.T) {
 	ctx := context.Background()
-	results := make(chan FilterResult, 5)
+	results := make(chan FilterVerdict, 5)
 
 	// Send denied result
 	go func() {
-		results <- FilterResult{Result: "denied", Reason: "ip denied", Field: "ip", Value: "192.168.1.1"}
-		results <- FilterResult{Result: "allowed", Field: "email", Value: "test@example.com"}
-		results <- FilterResult{Result: "allowed", Field: "user_agent", Value: "Mozilla/5.0"}
-		results <- FilterResult{Result: "allowed", Field: "country", Value: "US"}
-		results <- FilterResult{Result: "allowed", Field: "username", Value: "testuser"}
+		results <- FilterVerdict{FilterResult: FilterResult{Result: "denied", Reason: "ip denied", Field: "ip", Value: "192.168.1.1"}}
+		results <- FilterVerdict{FilterResult: FilterResult{Result: "allowed", Field: "email", Value: "test@example.com"}}
+		results <- FilterVerdict{FilterResult: FilterResult{Result: "allowed", Field: "user_agent", Value: "Mozilla/5.0"}}
+		results <- FilterVerdict{FilterResult: FilterResult{Result: "allowed", Field: "country", Value: "US"}}
+		results <- FilterVerdict{FilterResult: FilterResult{Result: "allowed", Field: "username", Value: "testuser"}}
 	}()
 
-	result, err := collectResults(ctx, results)
+	result, _, err := collectResults(ctx, results, 5)
 	assert.NoError(t, err)
 	assert.Equal(t, "denied", result.Result)
 	assert.Equal(t, "ip denied", result.Reason)
@@ -1394,18 +1618,18 @@ func TestCollectResults_WithDenied_ActualExecution(t *testing.T) {
 
 func TestCollectResults_WithError_ActualExecution(t *testing.T) {
 	ctx := context.Background()
-	results := make(chan FilterResult, 5)
+	results := make(chan FilterVerdict, 5)
 
 	// Send error result
 	go func() {
-		results <- FilterResult{Result: "error", Reason: "elasticsearch error", Field: "ip", Value: "192.168.1.1"}
-		results <- FilterResult{Result: "allowed", Field: "email", Value: "test@example.com"}
-		results <- FilterResult{Result: "allowed", Field: "user_agent", Value: "Mozilla/5.0"}
-		results <- FilterResult{Result: "allowed", Field: "country", Value: "US"}
-		results <- FilterResult{Result: "allowed", Field: "username", Value: "testuser"}
+		results <- FilterVerdict{FilterResult: FilterResult{Result: "error", Reason: "elasticsearch error", Field: "ip", Value: "192.168.1.1"}}
+		results <- FilterVerdict{FilterResult: FilterResult{Result: "allowed", Field: "email", Value: "test@example.com"}}
+		results <- FilterVerdict{FilterResult: FilterResult{Result: "allowed", Field: "user_agent", Value: "Mozilla/5.0"}}
+		results <- FilterVerdict{FilterResult: FilterResult{Result: "allowed", Field: "country", Value: "US"}}
+		results <- FilterVerdict{FilterResult: FilterResult{Result: "allowed", Field: "username", Value: "testuser"}}
 	}()
 
-	result, err := collectResults(ctx, results)
+	result, _, err := collectResults(ctx, results, 5)
 	assert.NoError(t, err)
 	assert.Equal(t, "allowed", result.Result) // Error should not override allowed
 }
@@ -1413,10 +1637,10 @@ func TestCollectResults_WithError_ActualExecution(t *testing.T) {
 func TestCollectResults_WithTimeout_ActualExecution(t *testing.T) {
 	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Millisecond)
 	defer cancel()
-	results := make(chan FilterResult, 5)
+	results := make(chan FilterVerdict, 5)
 
 	// Don't send any results to trigger timeout
-	result, err := collectResults(ctx, results)
+	result, _, err := collectResults(ctx, results, 5)
 
 	assert.Error(t, err)
 	assert.Equal(t, "timeout", result.Result)
@@ -1452,7 +1676,7 @@ func TestFilterEvaluation_Concurrent_ActualExecution(t *testing.T) {
 			country   string
 			username  string
 		}) {
-			result, err := EvaluateFilters(ctx, tc.ip, tc.email, tc.userAgent, tc.country, tc.username)
+			result, err := EvaluateFilters(ctx, tc.ip, tc.email, tc.userAgent, tc.country, "", tc.username)
 			// Should complete without error
 			if err != nil {
 				t.Logf("EvaluateFilters returned error: %v", err)
@@ -1460,7 +1684,7 @@ func TestFilterEvaluation_Concurrent_ActualExecution(t *testing.T) {
 
 			// Send result to channel
 			select {
-			case results <- result:
+			case results <- result.FilterResult:
 			default:
 				t.Log("Channel full, skipping result")
 			}
@@ -1487,7 +1711,7 @@ func TestFilterEvaluation_Performance_ActualExecution(t *testing.T) {
 	// Measure performance of filter evaluation
 	start := time.Now()
 
-	result, err := EvaluateFilters(ctx, "192.168.1.1", "test@example.com", "Mozilla/5.0", "US", "testuser")
+	result, err := EvaluateFilters(ctx, "192.168.1.1", "test@example.com", "Mozilla/5.0", "US", "", "testuser")
 
 	duration := time.Since(start)
 
@@ -1503,9 +1727,13 @@ func TestFilterEvaluation_Performance_ActualExecution(t *testing.T) {
 // CONSTANT TESTS
 // ============================================================================
 
-func TestNumFilters_Constant(t *testing.T) {
-	// Test that NumFilters is correctly defined
-	assert.Equal(t, 5, NumFilters)
+func TestRegisteredFilters_Defaults(t *testing.T) {
+	// The built-in filters are registered in a fixed order
+	var names []string
+	for _, f := range RegisteredFilters() {
+		names = append(names, f.Name())
+	}
+	assert.Equal(t, []string{"ip", "email", "user_agent", "country", "username", "asn", "charset", "content", "velocity", "composite", "expression"}, names)
 }
 
 // ============================================================================
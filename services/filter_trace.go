@@ -0,0 +1,87 @@
+package services
+
+import (
+	"encoding/json"
+)
+
+// FilterVerdict is the result of a single filter within a decision
+type FilterVerdict struct {
+	Filter string `json:"filter"`
+	FilterResult
+	FailurePolicy string `json:"failure_policy,omitempty"` // Policy applied because the filter failed
+	LatencyMicros int64  `json:"latency_us"`
+}
+
+// DecisionTrace records every filter verdict that led to a decision
+type DecisionTrace struct {
+	Filters         []FilterVerdict `json:"filters"`
+	ResolvedCountry string          `json:"resolved_country,omitempty"`
+	ResolvedASN     string          `json:"resolved_asn,omitempty"`
+	Monitor         []MonitorHit    `json:"monitor,omitempty"`
+	CacheHit        bool            `json:"cache_hit"`
+	LatencyMicros   int64           `json:"latency_us"`
+}
+
+// MonitorHit is a match of a rule with status "monitor"; it is recorded but never changes the result
+type MonitorHit struct {
+	Filter     string      `json:"filter"`
+	RuleID     uint        `json:"rule_id"`
+	RuleType   string      `json:"rule_type"`
+	Priority   int         `json:"priority,omitempty"`
+	Field      string      `json:"field"`
+	Value      interface{} `json:"value"`
+	WouldBlock bool        `json:"would_block"` // enforcing the rule as denied would have denied the request
+}
+
+// FilterDecision is the final result together with its trace; it is what gets cached
+type FilterDecision struct {
+	FilterResult
+	Trace *DecisionTrace `json:"trace,omitempty"`
+}
+
+// DecodeFilterDecision converts a cached value back into a FilterDecision.
+// The distributed cache returns JSON-decoded maps instead of the original struct.
+func DecodeFilterDecision(cached interface{}) (FilterDecision, bool) {
+	switch v := cached.(type) {
+	case FilterDecision:
+		return v, true
+	case *FilterDecision:
+		return *v, v != nil
+	case FilterResult:
+		return FilterDecision{FilterResult: v}, true
+	}
+
+	data, err := json.Marshal(cached)
+	if err != nil {
+		return FilterDecision{}, false
+	}
+	var decision FilterDecision
+	if err := json.Unmarshal(data, &decision); err != nil || decision.Result == "" {
+		return FilterDecision{}, false
+	}
+	return decision, true
+}
+
+// TrafficResults builds the filter_results payload stored in TrafficLog.FilterResults
+func (d FilterDecision) TrafficResults() map[string]interface{} {
+	results := map[string]interface{}{
+		"result": d.Result,
+		"reason": d.Reason,
+		"field":  d.Field,
+		"value":  d.Value,
+	}
+	if d.RuleID != 0 {
+		results["rule_id"] = d.RuleID
+		results["rule_type"] = d.RuleType
+	}
+	if d.Degraded {
+		results["degraded"] = true
+	}
+	if d.Geo != nil {
+		results["geo"] = d.Geo
+	}
+	if d.Trace != nil {
+		results["trace"] = d.Trace
+	}
+	return results
+}
@@ -0,0 +1,136 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"firewall/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEvaluateFilters_Trace(t *testing.T) {
+	engine := GetRuleEngine()
+	previous := engine.Snapshot()
+	defer engine.snapshot.Store(previous)
+
+	engine.snapshot.Store(BuildRuleSnapshot(RuleSet{
+		IPs:       []models.IP{{ID: 7, Address: "203.0.113.0/24", Status: "denied", IsCIDR: true}},
+		Emails:    []models.Email{{ID: 3, Address: ".*@spam\\.example$", Status: "denied", IsRegex: true}},
+		Countries: []models.Country{{ID: 9, Code: "US", Status: "allowed"}},
+	}))
+
+	result, err := EvaluateFilters(context.Background(), "203.0.113.7", "bob@spam.example", "", "US", "AS64500", "")
+	assert.NoError(t, err)
+	assert.Equal(t, "denied", result.Result)
+
+	trace := result.Trace
+	assert.NotNil(t, trace)
+	assert.Equal(t, "US", trace.ResolvedCountry)
+	assert.Equal(t, "AS64500", trace.ResolvedASN)
+	assert.False(t, trace.CacheHit)
+
+	// Every filter that ran is reported, in registration order
+	var names []string
+	verdicts := make(map[string]FilterVerdict)
+	for _, v := range trace.Filters {
+		names = append(names, v.Filter)
+		verdicts[v.Filter] = v
+		assert.GreaterOrEqual(t, v.LatencyMicros, int64(0))
+	}
+	assert.Equal(t, []string{"ip", "email", "country", "asn", "charset"}, names)
+
+	assert.Equal(t, uint(7), verdicts["ip"].RuleID)
+	assert.Equal(t, "cidr", verdicts["ip"].RuleType)
+	assert.Equal(t, uint(3), verdicts["email"].RuleID)
+	assert.Equal(t, "regex", verdicts["email"].RuleType)
+	assert.Equal(t, "allowed", verdicts["country"].Result)
+	assert.Equal(t, uint(9), verdicts["country"].RuleID)
+	assert.Equal(t, "exact", verdicts["country"].RuleType)
+}
+
+func TestDecodeFilterDecision(t *testing.T) {
+	decision := FilterDecision{
+		FilterResult: FilterResult{Result: "denied", Reason: "ip denied", Field: "ip", Value: "192.0.2.1", RuleID: 1, RuleType: "exact"},
+		Trace:        &DecisionTrace{Filters: []FilterVerdict{{Filter: "ip", FilterResult: FilterResult{Result: "denied"}}}},
+	}
+
+	decoded, ok := DecodeFilterDecision(decision)
+	assert.True(t, ok)
+	assert.Equal(t, decision, decoded)
+
+	// Legacy cache entries hold a plain FilterResult
+	decoded, ok = DecodeFilterDecision(decision.FilterResult)
+	assert.True(t, ok)
+	assert.Nil(t, decoded.Trace)
+
+	// The distributed cache returns JSON-decoded maps
+	data, _ := json.Marshal(decision)
+	var raw map[string]interface{}
+	assert.NoError(t, json.Unmarshal(data, &raw))
+	decoded, ok = DecodeFilterDecision(raw)
+	assert.True(t, ok)
+	assert.Equal(t, "denied", decoded.Result)
+	assert.Equal(t, uint(1), decoded.RuleID)
+	assert.Len(t, decoded.Trace.Filters, 1)
+
+	_, ok = DecodeFilterDecision("garbage")
+	assert.False(t, ok)
+}
+
+func TestFilterDecision_TrafficResults(t *testing.T) {
+	decision := FilterDecision{
+		FilterResult: FilterResult{Result: "denied", Reason: "ip denied", Field: "ip", Value: "192.0.2.1", RuleID: 1, RuleType: "exact"},
+		Trace:        &DecisionTrace{},
+	}
+
+	results := decision.TrafficResults()
+	assert.Equal(t, "denied", results["result"])
+	assert.Equal(t, uint(1), results["rule_id"])
+	assert.Equal(t, "exact", results["rule_type"])
+	assert.NotNil(t, results["trace"])
+}
+
+func TestEvaluateFilters_MonitorRules(t *testing.T) {
+	engine := GetRuleEngine()
+	previous := engine.Snapshot()
+	defer engine.snapshot.Store(previous)
+
+	snapshot := BuildRuleSnapshot(RuleSet{
+		IPs: []models.IP{{ID: 1, Address: "198.51.100.0/24", Status: "whitelisted", IsCIDR: true}},
+		Usernames: []models.UsernameRule{
+			{ID: 5, Username: "^bot", Status: "monitor", IsRegex: true, Priority: 100},
+			{ID: 6, Username: "bot42", Status: "denied"},
+		},
+		ASNs: []models.ASN{{ID: 8, ASN: "AS64500", Status: "monitor"}},
+	})
+	engine.snapshot.Store(snapshot)
+	assert.Equal(t, 2, snapshot.Stats()["monitor"])
+
+	// A monitor rule never shadows an enforced rule, whatever its priority
+	result, err := EvaluateFilters(context.Background(), "203.0.113.7", "", "", "US", "AS64500", "bot42")
+	assert.NoError(t, err)
+	assert.Equal(t, "denied", result.Result)
+	assert.Equal(t, uint(6), result.RuleID)
+	assert.Len(t, result.Trace.Monitor, 2)
+	for _, hit := range result.Trace.Monitor {
+		assert.False(t, hit.WouldBlock)
+	}
+
+	// Monitor hits never change the result, but report whether they would have
+	result, err = EvaluateFilters(context.Background(), "203.0.113.7", "", "", "US", "AS64500", "botnet")
+	assert.NoError(t, err)
+	assert.Equal(t, "allowed", result.Result)
+	assert.Equal(t, []MonitorHit{
+		{Filter: "username", RuleID: 5, RuleType: "regex", Priority: 100, Field: "username", Value: "botnet", WouldBlock: true},
+		{Filter: "asn", RuleID: 8, RuleType: "exact", Field: "asn", Value: "AS64500", WouldBlock: true},
+	}, result.Trace.Monitor)
+
+	// With allow-overrides a whitelisted request would not have been blocked
+	result, err = EvaluateFilters(context.Background(), "198.51.100.7", "", "", "US", "AS64500", "")
+	assert.NoError(t, err)
+	assert.Equal(t, "whitelisted", result.Result)
+	assert.Len(t, result.Trace.Monitor, 1)
+	assert.False(t, result.Trace.Monitor[0].WouldBlock)
+}
@@ -0,0 +1,142 @@
+package services
+
+import (
+	"firewall/models"
+	"firewall/utils"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// geoRadiusRule is a compiled geofence: a circle around a coordinate
+type geoRadiusRule struct {
+	*compiledRule
+	latitude, longitude, radiusKm float64
+}
+
+// geoMatch is a geo rule matched against a geo context
+type geoMatch struct {
+	rule  *compiledRule
+	field string // "continent", "subdivision", "city" or "location"
+	kind  string // reason prefix, "geofence" for radius rules
+	value string // the matched part of the geo context
+}
+
+// geoIndex holds the geo rules of a snapshot; they are evaluated by the country filter
+type geoIndex struct {
+	continents   map[string]*compiledRule // "EU"
+	subdivisions map[string]*compiledRule // "US-CA"
+	cities       map[string]*compiledRule // "DE:berlin"
+	radius       []*geoRadiusRule         // ordered by precedence
+}
+
+func newGeoIndex() *geoIndex {
+	return &geoIndex{
+		continents:   make(map[string]*compiledRule),
+		subdivisions: make(map[string]*compiledRule),
+		cities:       make(map[string]*compiledRule),
+	}
+}
+
+// GeoRuleKey normalizes the value of a continent, subdivision or city rule; it returns "" if the value is invalid
+func GeoRuleKey(ruleType, value string) string {
+	value = strings.TrimSpace(value)
+	switch ruleType {
+	case "continent":
+		code := strings.ToUpper(value)
+		if _, ok := utils.Continents[code]; ok {
+			return code
+		}
+	case "subdivision":
+		country, code, found := strings.Cut(strings.ToUpper(value), "-")
+		if found && len(country) == 2 && code != "" && len(code) <= 3 {
+			return country + "-" + code
+		}
+	case "city":
+		country, city, found := strings.Cut(value, ":")
+		country, city = strings.ToUpper(strings.TrimSpace(country)), strings.TrimSpace(city)
+		if found && len(country) == 2 && city != "" {
+			return country + ":" + city
+		}
+	}
+	return ""
+}
+
+// cityKey is the lookup key of a city, the city name is matched case-insensitively
+func cityKey(country, city string) string {
+	return strings.ToUpper(country) + ":" + strings.ToLower(city)
+}
+
+// add compiles a geo rule; it returns false if the rule is invalid
+func (gi *geoIndex) add(r models.GeoRule) bool {
+	if r.Type == "radius" {
+		if r.RadiusKm <= 0 || r.Latitude < -90 || r.Latitude > 90 || r.Longitude < -180 || r.Longitude > 180 {
+			return false
+		}
+		gi.radius = append(gi.radius, &geoRadiusRule{
+			compiledRule: &compiledRule{ID: r.ID, Value: r.Name, Status: r.Status, Priority: r.Priority, Type: "radius"},
+			latitude:     r.Latitude,
+			longitude:    r.Longitude,
+			radiusKm:     r.RadiusKm,
+		})
+		return true
+	}
+
+	key := GeoRuleKey(r.Type, r.Value)
+	if key == "" {
+		return false
+	}
+	rule := &compiledRule{ID: r.ID, Value: key, Status: r.Status, Priority: r.Priority, Type: r.Type}
+	switch r.Type {
+	case "continent":
+		addExact(gi.continents, key, rule)
+	case "subdivision":
+		addExact(gi.subdivisions, key, rule)
+	case "city":
+		country, city, _ := strings.Cut(key, ":")
+		addExact(gi.cities, cityKey(country, city), rule)
+	}
+	return true
+}
+
+func (gi *geoIndex) sort() {
+	sort.SliceStable(gi.radius, func(i, j int) bool {
+		return gi.radius[i].outranks(gi.radius[j].compiledRule)
+	})
+}
+
+// match returns the highest ranked geo rule for a geo context, nil if none matches
+func (gi *geoIndex) match(geo *GeoContext) *geoMatch {
+	if geo == nil {
+		return nil
+	}
+
+	var best *geoMatch
+	consider := func(rule *compiledRule, field, kind, value string) {
+		if rule != nil && (best == nil || rule.outranks(best.rule)) {
+			best = &geoMatch{rule: rule, field: field, kind: kind, value: value}
+		}
+	}
+	if geo.Continent != "" {
+		consider(gi.continents[geo.Continent], "continent", "continent", geo.Continent)
+	}
+	if geo.Subdivision != "" {
+		consider(gi.subdivisions[geo.Subdivision], "subdivision", "subdivision", geo.Subdivision)
+	}
+	if geo.City != "" && geo.Country != "" {
+		consider(gi.cities[cityKey(geo.Country, geo.City)], "city", "city", geo.Country+":"+geo.City)
+	}
+	if geo.Location != nil {
+		for _, r := range gi.radius {
+			if utils.DistanceKm(geo.Location.Latitude, geo.Location.Longitude, r.latitude, r.longitude) <= r.radiusKm {
+				consider(r.compiledRule, "location", "geofence", fmt.Sprintf("%.4f,%.4f", geo.Location.Latitude, geo.Location.Longitude))
+				break
+			}
+		}
+	}
+	return best
+}
+
+func (gi *geoIndex) len() int {
+	return len(gi.continents) + len(gi.subdivisions) + len(gi.cities) + len(gi.radius)
+}
@@ -0,0 +1,125 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"firewall/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGeoRuleKey(t *testing.T) {
+	testCases := []struct {
+		ruleType string
+		value    string
+		key      string
+	}{
+		{"continent", " eu ", "EU"},
+		{"continent", "XX", ""},
+		{"subdivision", "us-ca", "US-CA"},
+		{"subdivision", "CA", ""},
+		{"city", "de: Berlin", "DE:Berlin"},
+		{"city", "Berlin", ""},
+		{"city", "DE:", ""},
+		{"radius", "52.5,13.4", ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.ruleType+" "+tc.value, func(t *testing.T) {
+			assert.Equal(t, tc.key, GeoRuleKey(tc.ruleType, tc.value))
+		})
+	}
+}
+
+func TestGeoIndex_Match(t *testing.T) {
+	index := newGeoIndex()
+	for _, r := range []models.GeoRule{
+		{ID: 1, Name: "europe", Type: "continent", Value: "EU", Status: "denied"},
+		{ID: 2, Name: "bavaria", Type: "subdivision", Value: "DE-BY", Status: "whitelisted"},
+		{ID: 3, Name: "munich", Type: "city", Value: "DE:munich", Status: "denied"},
+		{ID: 4, Name: "berlin 25km", Type: "radius", Latitude: 52.52, Longitude: 13.405, RadiusKm: 25, Status: "denied"},
+		{ID: 5, Name: "berlin 100km", Type: "radius", Latitude: 52.52, Longitude: 13.405, RadiusKm: 100, Status: "whitelisted", Priority: 5},
+	} {
+		assert.True(t, index.add(r), r.Name)
+	}
+	index.sort()
+	assert.False(t, index.add(models.GeoRule{ID: 6, Name: "bad", Type: "radius", Latitude: 91, RadiusKm: 10}))
+	assert.False(t, index.add(models.GeoRule{ID: 7, Name: "bad", Type: "continent", Value: "XX"}))
+	assert.Equal(t, 5, index.len())
+
+	testCases := []struct {
+		name  string
+		geo   *GeoContext
+		rule  uint
+		field string
+		kind  string
+	}{
+		{"continent only", &GeoContext{Continent: "EU", Country: "FR"}, 1, "continent", "continent"},
+		{"subdivision beats continent", &GeoContext{Continent: "EU", Country: "DE", Subdivision: "DE-BY", City: "Nuremberg"}, 2, "subdivision", "subdivision"},
+		{"city beats subdivision", &GeoContext{Continent: "EU", Country: "DE", Subdivision: "DE-BY", City: "Munich"}, 3, "city", "city"},
+		{"higher priority geofence", &GeoContext{Continent: "EU", Country: "DE", Location: &GeoPoint{Latitude: 52.5, Longitude: 13.4}}, 5, "location", "geofence"},
+		{"outside the geofences", &GeoContext{Continent: "EU", Country: "PL", Location: &GeoPoint{Latitude: 52.23, Longitude: 21.01}}, 1, "continent", "continent"},
+		{"no match", &GeoContext{Continent: "NA", Country: "US"}, 0, "", ""},
+		{"no geo context", nil, 0, "", ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			match := index.match(tc.geo)
+			if tc.rule == 0 {
+				assert.Nil(t, match)
+				return
+			}
+			if assert.NotNil(t, match) {
+				assert.Equal(t, tc.rule, match.rule.ID)
+				assert.Equal(t, tc.field, match.field)
+				assert.Equal(t, tc.kind, match.kind)
+			}
+		})
+	}
+}
+
+func TestEvaluateFilterInput_Geo(t *testing.T) {
+	engine := GetRuleEngine()
+	previous := engine.Snapshot()
+	defer engine.snapshot.Store(previous)
+
+	engine.snapshot.Store(BuildRuleSnapshot(RuleSet{
+		Countries: []models.Country{{ID: 1, Code: "US", Status: "denied"}},
+		GeoRules: []models.GeoRule{
+			{ID: 1, Name: "california", Type: "subdivision", Value: "US-CA", Status: "whitelisted"},
+			{ID: 2, Name: "oceania", Type: "continent", Value: "OC", Status: "denied"},
+			{ID: 3, Name: "sydney", Type: "city", Value: "AU:Sydney", Status: "monitor"},
+		},
+	}))
+	assert.Equal(t, 2, engine.Snapshot().Stats()["geo"])
+
+	// A whitelisted subdivision in a denied country
+	california := &GeoContext{Continent: "NA", Country: "US", Subdivision: "US-CA", City: "San Francisco"}
+	result, err := EvaluateFilterInput(context.Background(), &FilterInput{Country: "US", Geo: california})
+	assert.NoError(t, err)
+	assert.Equal(t, "whitelisted", result.Result)
+	assert.Equal(t, "subdivision whitelisted", result.Reason)
+	assert.Equal(t, "subdivision", result.Field)
+	assert.Equal(t, "US-CA", result.Value)
+	assert.Equal(t, uint(1), result.RuleID)
+	assert.Same(t, california, result.Geo)
+
+	result, err = EvaluateFilterInput(context.Background(), &FilterInput{Country: "US", Geo: &GeoContext{Continent: "NA", Country: "US", Subdivision: "US-TX"}})
+	assert.NoError(t, err)
+	assert.Equal(t, "denied", result.Result)
+	assert.Equal(t, "country denied", result.Reason)
+
+	// Geo rules match without a country; the monitor hits are recorded under the geo rules
+	result, err = EvaluateFilterInput(context.Background(), &FilterInput{IP: "203.0.113.7", Geo: &GeoContext{Continent: "OC", Country: "AU", City: "Sydney"}})
+	assert.NoError(t, err)
+	assert.Equal(t, "denied", result.Result)
+	assert.Equal(t, "continent denied", result.Reason)
+	assert.Equal(t, uint(2), result.RuleID)
+	if assert.Len(t, result.Trace.Monitor, 1) {
+		assert.Equal(t, "geo", result.Trace.Monitor[0].Filter)
+		assert.Equal(t, uint(3), result.Trace.Monitor[0].RuleID)
+		assert.Equal(t, "AU:Sydney", result.Trace.Monitor[0].Value)
+	}
+}
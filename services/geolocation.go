@@ -13,6 +13,7 @@ import (
 
 var geoipReader *geoip2.Reader
 var asnReader *geoip2.Reader
+var cityReader *geoip2.Reader // optional, adds subdivision, city and location to the geo context
 
 // Cache for geolocation lookups
 var geoCache *cache.Cache
@@ -59,6 +60,26 @@ func InitASN() error {
 	return nil
 }
 
+// InitCity initializes the optional MaxMind City database reader; without it the geo context
+// only holds the continent and country
+func InitCity() error {
+	// Look for the City database file in the root directory
+	dbPath := "GeoLite2-City.mmdb"
+
+	// Check if file exists
+	if _, err := os.Stat(dbPath); os.IsNotExist(err) {
+		return fmt.Errorf("City database not found at %s. Please download GeoLite2-City.mmdb to the root directory", dbPath)
+	}
+
+	reader, err := geoip2.Open(dbPath)
+	if err != nil {
+		return fmt.Errorf("failed to open City database: %v", err)
+	}
+
+	cityReader = reader
+	return nil
+}
+
 // CloseGeoIP closes the GeoIP database reader
 func CloseGeoIP() {
 	if geoipReader != nil {
@@ -67,6 +88,9 @@ func CloseGeoIP() {
 	if asnReader != nil {
 		asnReader.Close()
 	}
+	if cityReader != nil {
+		cityReader.Close()
+	}
 }
 
 // IsPrivateIP checks if an IP address is private/local
@@ -226,6 +250,141 @@ func GetASNFromIPWithFallback(ipStr string) string {
 	return asn
 }
 
+// GetASNOrgFromIP resolves an IP address to the organization of its ASN
+func GetASNOrgFromIP(ipStr string) (string, error) {
+	if asnReader == nil {
+		return "", fmt.Errorf("ASN database not initialized")
+	}
+
+	ip := net.ParseIP(ipStr)
+	if ip == nil {
+		return "", fmt.Errorf("invalid IP address: %s", ipStr)
+	}
+	if IsPrivateIP(ip) {
+		return "", fmt.Errorf("private IP address: %s", ipStr)
+	}
+
+	record, err := asnReader.ASN(ip)
+	if err != nil {
+		return "", fmt.Errorf("failed to lookup ASN for IP %s: %v", ipStr, err)
+	}
+	if record.AutonomousSystemOrganization == "" {
+		return "", fmt.Errorf("no ASN organization found for IP: %s", ipStr)
+	}
+
+	return record.AutonomousSystemOrganization, nil
+}
+
+// GetASNOrgFromIPWithFallback resolves an IP to its ASN organization, returns empty string on error
+func GetASNOrgFromIPWithFallback(ipStr string) string {
+	if geoCache != nil {
+		if cached, found := geoCache.Get("asn_org:" + ipStr); found {
+			return cached.(string)
+		}
+	}
+
+	org, err := GetASNOrgFromIP(ipStr)
+	if err != nil {
+		fmt.Printf("ASN organization lookup failed for IP %s: %v\n", ipStr, err)
+		org = ""
+	}
+
+	// Empty results are cached too, to avoid repeated lookups for invalid IPs
+	if geoCache != nil {
+		geoCache.Set("asn_org:"+ipStr, org, cache.DefaultExpiration)
+	}
+
+	return org
+}
+
+// GeoPoint is the approximate location of an IP address
+type GeoPoint struct {
+	Latitude       float64 `json:"latitude"`
+	Longitude      float64 `json:"longitude"`
+	AccuracyRadius uint16  `json:"accuracy_radius_km,omitempty"`
+}
+
+// GeoContext is the resolved location of an IP address; parts the databases do not know are empty
+type GeoContext struct {
+	Continent   string    `json:"continent,omitempty"`   // e.g. "EU"
+	Country     string    `json:"country,omitempty"`     // ISO 3166-1 alpha-2, e.g. "DE"
+	Subdivision string    `json:"subdivision,omitempty"` // ISO 3166-2, e.g. "US-CA" (City database)
+	City        string    `json:"city,omitempty"`        // English name (City database)
+	Location    *GeoPoint `json:"location,omitempty"`    // City database
+}
+
+// GetGeoContextFromIP resolves an IP address with the City database, or with the Country
+// database (continent and country only) when the City database is not available
+func GetGeoContextFromIP(ipStr string) (*GeoContext, error) {
+	if cityReader == nil && geoipReader == nil {
+		return nil, fmt.Errorf("GeoIP database not initialized")
+	}
+
+	// Parse the IP address
+	ip := net.ParseIP(ipStr)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid IP address: %s", ipStr)
+	}
+
+	// Skip private/local IPs
+	if IsPrivateIP(ip) {
+		return nil, fmt.Errorf("private IP address: %s", ipStr)
+	}
+
+	if cityReader == nil {
+		record, err := geoipReader.Country(ip)
+		if err != nil {
+			return nil, fmt.Errorf("failed to lookup country for IP %s: %v", ipStr, err)
+		}
+		return &GeoContext{Continent: record.Continent.Code, Country: strings.ToUpper(record.Country.IsoCode)}, nil
+	}
+
+	record, err := cityReader.City(ip)
+	if err != nil {
+		return nil, fmt.Errorf("failed to lookup city for IP %s: %v", ipStr, err)
+	}
+	geo := &GeoContext{
+		Continent: record.Continent.Code,
+		Country:   strings.ToUpper(record.Country.IsoCode),
+		City:      record.City.Names["en"],
+	}
+	// The first subdivision is the largest, e.g. the state
+	if len(record.Subdivisions) > 0 && record.Subdivisions[0].IsoCode != "" && geo.Country != "" {
+		geo.Subdivision = geo.Country + "-" + strings.ToUpper(record.Subdivisions[0].IsoCode)
+	}
+	if record.Location.Latitude != 0 || record.Location.Longitude != 0 {
+		geo.Location = &GeoPoint{
+			Latitude:       record.Location.Latitude,
+			Longitude:      record.Location.Longitude,
+			AccuracyRadius: record.Location.AccuracyRadius,
+		}
+	}
+	return geo, nil
+}
+
+// GetGeoContextWithFallback resolves the geo context of an IP, returns nil on error.
+// The result is shared through the cache and must not be modified.
+func GetGeoContextWithFallback(ipStr string) *GeoContext {
+	if geoCache != nil {
+		if cached, found := geoCache.Get("geo:" + ipStr); found {
+			return cached.(*GeoContext)
+		}
+	}
+
+	geo, err := GetGeoContextFromIP(ipStr)
+	if err != nil {
+		fmt.Printf("Geo context lookup failed for IP %s: %v\n", ipStr, err)
+		geo = nil
+	}
+
+	// Failed lookups are cached too, to avoid repeated lookups for invalid IPs
+	if geoCache != nil {
+		geoCache.Set("geo:"+ipStr, geo, cache.DefaultExpiration)
+	}
+
+	return geo
+}
+
 // GetGeoCacheStats returns statistics about the geolocation cache
 func GetGeoCacheStats() map[string]interface{} {
 	if geoCache == nil {
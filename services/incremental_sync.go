@@ -66,20 +66,16 @@ func (is *IncrementalSync) SyncIncrementalIPs() error {
 		return nil
 	}
 
-	syncedCount := 0
-	for _, ip := range ips {
-		if err := IndexIPAddress(ip); err != nil {
-			log.Printf("Error syncing IP %s: %v", ip.Address, err)
-		} else {
-			syncedCount++
-		}
+	stats, err := bulkSync(IndexIPs, ips, ipDocument)
+	log.Printf("Incrementally synced %d IPs to the rule index (%d failed, queued for retry)", stats.Indexed, stats.Failed)
+	if err != nil {
+		// The sync time stays, so the next run sends the dropped documents again
+		return err
 	}
 
-	if syncedCount > 0 {
-		if err := is.updateLastSyncTime("ips"); err != nil {
-			log.Printf("Error updating IP sync time: %v", err)
-		}
-		log.Printf("Incrementally synced %d IPs to Elasticsearch", syncedCount)
+	// Failed documents are queued for retry, so the sync time moves on
+	if err := is.updateLastSyncTime("ips"); err != nil {
+		log.Printf("Error updating IP sync time: %v", err)
 	}
 
 	return nil
@@ -100,20 +96,16 @@ func (is *IncrementalSync) SyncIncrementalEmails() error {
 		return nil
 	}
 
-	syncedCount := 0
-	for _, email := range emails {
-		if err := IndexEmail(email); err != nil {
-			log.Printf("Error syncing email %s: %v", email.Address, err)
-		} else {
-			syncedCount++
-		}
+	stats, err := bulkSync(IndexEmails, emails, emailDocument)
+	log.Printf("Incrementally synced %d emails to the rule index (%d failed, queued for retry)", stats.Indexed, stats.Failed)
+	if err != nil {
+		// The sync time stays, so the next run sends the dropped documents again
+		return err
 	}
 
-	if syncedCount > 0 {
-		if err := is.updateLastSyncTime("emails"); err != nil {
-			log.Printf("Error updating email sync time: %v", err)
-		}
-		log.Printf("Incrementally synced %d emails to Elasticsearch", syncedCount)
+	// Failed documents are queued for retry, so the sync time moves on
+	if err := is.updateLastSyncTime("emails"); err != nil {
+		log.Printf("Error updating email sync time: %v", err)
 	}
 
 	return nil
@@ -134,20 +126,16 @@ func (is *IncrementalSync) SyncIncrementalUserAgents() error {
 		return nil
 	}
 
-	syncedCount := 0
-	for _, ua := range userAgents {
-		if err := IndexUserAgent(ua); err != nil {
-			log.Printf("Error syncing user agent %s: %v", ua.UserAgent, err)
-		} else {
-			syncedCount++
-		}
+	stats, err := bulkSync(IndexUserAgents, userAgents, userAgentDocument)
+	log.Printf("Incrementally synced %d user agents to the rule index (%d failed, queued for retry)", stats.Indexed, stats.Failed)
+	if err != nil {
+		// The sync time stays, so the next run sends the dropped documents again
+		return err
 	}
 
-	if syncedCount > 0 {
-		if err := is.updateLastSyncTime("user_agents"); err != nil {
-			log.Printf("Error updating user agent sync time: %v", err)
-		}
-		log.Printf("Incrementally synced %d user agents to Elasticsearch", syncedCount)
+	// Failed documents are queued for retry, so the sync time moves on
+	if err := is.updateLastSyncTime("user_agents"); err != nil {
+		log.Printf("Error updating user agent sync time: %v", err)
 	}
 
 	return nil
@@ -168,20 +156,16 @@ func (is *IncrementalSync) SyncIncrementalCountries() error {
 		return nil
 	}
 
-	syncedCount := 0
-	for _, country := range countries {
-		if err := IndexCountry(country); err != nil {
-			log.Printf("Error syncing country %s: %v", country.Code, err)
-		} else {
-			syncedCount++
-		}
+	stats, err := bulkSync(IndexCountries, countries, countryDocument)
+	log.Printf("Incrementally synced %d countries to the rule index (%d failed, queued for retry)", stats.Indexed, stats.Failed)
+	if err != nil {
+		// The sync time stays, so the next run sends the dropped documents again
+		return err
 	}
 
-	if syncedCount > 0 {
-		if err := is.updateLastSyncTime("countries"); err != nil {
-			log.Printf("Error updating country sync time: %v", err)
-		}
-		log.Printf("Incrementally synced %d countries to Elasticsearch", syncedCount)
+	// Failed documents are queued for retry, so the sync time moves on
+	if err := is.updateLastSyncTime("countries"); err != nil {
+		log.Printf("Error updating country sync time: %v", err)
 	}
 
 	return nil
@@ -202,20 +186,16 @@ func (is *IncrementalSync) SyncIncrementalCharsetRules() error {
 		return nil
 	}
 
-	syncedCount := 0
-	for _, charset := range charsets {
-		if err := IndexCharsetRule(charset); err != nil {
-			log.Printf("Error syncing charset rule %s: %v", charset.Charset, err)
-		} else {
-			syncedCount++
-		}
+	stats, err := bulkSync(IndexCharsets, charsets, charsetDocument)
+	log.Printf("Incrementally synced %d charset rules to the rule index (%d failed, queued for retry)", stats.Indexed, stats.Failed)
+	if err != nil {
+		// The sync time stays, so the next run sends the dropped documents again
+		return err
 	}
 
-	if syncedCount > 0 {
-		if err := is.updateLastSyncTime("charsets"); err != nil {
-			log.Printf("Error updating charset sync time: %v", err)
-		}
-		log.Printf("Incrementally synced %d charset rules to Elasticsearch", syncedCount)
+	// Failed documents are queued for retry, so the sync time moves on
+	if err := is.updateLastSyncTime("charsets"); err != nil {
+		log.Printf("Error updating charset sync time: %v", err)
 	}
 
 	return nil
@@ -236,20 +216,76 @@ func (is *IncrementalSync) SyncIncrementalUsernameRules() error {
 		return nil
 	}
 
-	syncedCount := 0
-	for _, username := range usernames {
-		if err := IndexUsernameRule(username); err != nil {
-			log.Printf("Error syncing username rule %s: %v", username.Username, err)
-		} else {
-			syncedCount++
-		}
+	stats, err := bulkSync(IndexUsernames, usernames, usernameDocument)
+	log.Printf("Incrementally synced %d username rules to the rule index (%d failed, queued for retry)", stats.Indexed, stats.Failed)
+	if err != nil {
+		// The sync time stays, so the next run sends the dropped documents again
+		return err
 	}
 
-	if syncedCount > 0 {
-		if err := is.updateLastSyncTime("usernames"); err != nil {
-			log.Printf("Error updating username sync time: %v", err)
-		}
-		log.Printf("Incrementally synced %d username rules to Elasticsearch", syncedCount)
+	// Failed documents are queued for retry, so the sync time moves on
+	if err := is.updateLastSyncTime("usernames"); err != nil {
+		log.Printf("Error updating username sync time: %v", err)
+	}
+
+	return nil
+}
+
+// SyncIncrementalEmailDomainRules syncs only email domain rules modified since last sync
+func (is *IncrementalSync) SyncIncrementalEmailDomainRules() error {
+	lastSync := is.getLastSyncTime("email_domains")
+
+	var domains []models.EmailDomainRule
+	query := config.DB.Where("updated_at > ? OR created_at > ?", lastSync, lastSync)
+	if err := query.Find(&domains).Error; err != nil {
+		return err
+	}
+
+	if len(domains) == 0 {
+		log.Println("No email domain rules to sync incrementally")
+		return nil
+	}
+
+	stats, err := bulkSync(IndexEmailDomains, domains, emailDomainDocument)
+	log.Printf("Incrementally synced %d email domain rules to the rule index (%d failed, queued for retry)", stats.Indexed, stats.Failed)
+	if err != nil {
+		// The sync time stays, so the next run sends the dropped documents again
+		return err
+	}
+
+	// Failed documents are queued for retry, so the sync time moves on
+	if err := is.updateLastSyncTime("email_domains"); err != nil {
+		log.Printf("Error updating email domain sync time: %v", err)
+	}
+
+	return nil
+}
+
+// SyncIncrementalContentRules syncs only content rules modified since last sync
+func (is *IncrementalSync) SyncIncrementalContentRules() error {
+	lastSync := is.getLastSyncTime("content_rules")
+
+	var contents []models.ContentRule
+	query := config.DB.Where("updated_at > ? OR created_at > ?", lastSync, lastSync)
+	if err := query.Find(&contents).Error; err != nil {
+		return err
+	}
+
+	if len(contents) == 0 {
+		log.Println("No content rules to sync incrementally")
+		return nil
+	}
+
+	stats, err := bulkSync(IndexContentRules, contents, contentDocument)
+	log.Printf("Incrementally synced %d content rules to the rule index (%d failed, queued for retry)", stats.Indexed, stats.Failed)
+	if err != nil {
+		// The sync time stays, so the next run sends the dropped documents again
+		return err
+	}
+
+	// Failed documents are queued for retry, so the sync time moves on
+	if err := is.updateLastSyncTime("content_rules"); err != nil {
+		log.Printf("Error updating content rule sync time: %v", err)
 	}
 
 	return nil
@@ -263,7 +299,7 @@ func (is *IncrementalSync) SyncIncrementalAll() error {
 		return nil
 	}
 
-	log.Println("Starting incremental sync to Elasticsearch...")
+	log.Println("Starting incremental sync to the rule index...")
 
 	if err := is.SyncIncrementalIPs(); err != nil {
 		log.Printf("Error in incremental IP sync: %v", err)
@@ -273,6 +309,10 @@ func (is *IncrementalSync) SyncIncrementalAll() error {
 		log.Printf("Error in incremental email sync: %v", err)
 	}
 
+	if err := is.SyncIncrementalEmailDomainRules(); err != nil {
+		log.Printf("Error in incremental email domain sync: %v", err)
+	}
+
 	if err := is.SyncIncrementalUserAgents(); err != nil {
 		log.Printf("Error in incremental user agent sync: %v", err)
 	}
@@ -289,13 +329,17 @@ func (is *IncrementalSync) SyncIncrementalAll() error {
 		log.Printf("Error in incremental username rule sync: %v", err)
 	}
 
+	if err := is.SyncIncrementalContentRules(); err != nil {
+		log.Printf("Error in incremental content rule sync: %v", err)
+	}
+
 	log.Println("Incremental sync completed")
 	return nil
 }
 
 // ForceFullSync performs a full sync and updates all sync timestamps
 func (is *IncrementalSync) ForceFullSync() error {
-	log.Println("Forcing full sync to Elasticsearch...")
+	log.Println("Forcing full sync to the rule index...")
 
 	// Get distributed lock service
 	distributedLock := GetDistributedLock()
@@ -327,7 +371,7 @@ func (is *IncrementalSync) ForceFullSync() error {
 	}
 
 	// Update all sync timestamps
-	dataTypes := []string{"ips", "emails", "user_agents", "countries", "charsets", "usernames"}
+	dataTypes := []string{"ips", "emails", "email_domains", "user_agents", "countries", "charsets", "usernames", "content_rules"}
 
 	for _, dataType := range dataTypes {
 		if err := is.updateLastSyncTime(dataType); err != nil {
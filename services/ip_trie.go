@@ -0,0 +1,78 @@
+package services
+
+import (
+	"firewall/utils"
+	"net/netip"
+)
+
+// ipTrieNode is a single bit position in the prefix trie
+type ipTrieNode struct {
+	children [2]*ipTrieNode
+	rule     *compiledRule
+}
+
+// ipTrie is a binary prefix trie over address bits used for CIDR lookups.
+// IPv4 and IPv6 prefixes live in separate roots so a lookup never crosses families.
+type ipTrie struct {
+	v4   *ipTrieNode
+	v6   *ipTrieNode
+	size int
+}
+
+func newIPTrie() *ipTrie {
+	return &ipTrie{v4: &ipTrieNode{}, v6: &ipTrieNode{}}
+}
+
+func (t *ipTrie) root(addr netip.Addr) *ipTrieNode {
+	if addr.Is4() {
+		return t.v4
+	}
+	return t.v6
+}
+
+// Insert stores a rule for the given prefix; on an identical prefix the higher ranked rule is kept
+func (t *ipTrie) Insert(prefix netip.Prefix, rule *compiledRule) {
+	prefix = utils.NormalizePrefix(prefix)
+	addr := prefix.Addr()
+	bytes := addr.AsSlice()
+
+	node := t.root(addr)
+	for i := 0; i < prefix.Bits(); i++ {
+		bit := (bytes[i/8] >> (7 - uint(i%8))) & 1
+		if node.children[bit] == nil {
+			node.children[bit] = &ipTrieNode{}
+		}
+		node = node.children[bit]
+	}
+	if node.rule == nil {
+		t.size++
+	}
+	if rule.outranks(node.rule) {
+		node.rule = rule
+	}
+}
+
+// Lookup returns the highest ranked rule among all prefixes containing addr, or nil
+func (t *ipTrie) Lookup(addr netip.Addr) *compiledRule {
+	addr = utils.NormalizeAddr(addr)
+	bytes := addr.AsSlice()
+
+	node := t.root(addr)
+	match := node.rule
+	for i := 0; i < addr.BitLen(); i++ {
+		bit := (bytes[i/8] >> (7 - uint(i%8))) & 1
+		node = node.children[bit]
+		if node == nil {
+			break
+		}
+		if node.rule != nil && node.rule.outranks(match) {
+			match = node.rule
+		}
+	}
+	return match
+}
+
+// Len returns the number of prefixes stored in the trie
+func (t *ipTrie) Len() int {
+	return t.size
+}
@@ -0,0 +1,89 @@
+package services
+
+import (
+	"firewall/utils"
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func cidrRule(id uint, prefix string) (netip.Prefix, *compiledRule) {
+	p := netip.MustParsePrefix(prefix)
+	return p, &compiledRule{ID: id, Value: prefix, Status: "denied", Type: "cidr", bits: p.Bits()}
+}
+
+func TestIPTrie_IPv6LongestPrefix(t *testing.T) {
+	trie := newIPTrie()
+	for id, prefix := range []string{"::/0", "2001:db8::/32", "2001:db8:1::/48", "2001:db8:1:2::/64", "2001:db8:1:2::5/128"} {
+		trie.Insert(cidrRule(uint(id+1), prefix))
+	}
+	assert.Equal(t, 5, trie.Len())
+
+	tests := []struct {
+		addr string
+		want string
+	}{
+		{"2001:db8:1:2::5", "2001:db8:1:2::5/128"},
+		{"2001:db8:1:2::6", "2001:db8:1:2::/64"},
+		{"2001:db8:1:2:ffff:ffff:ffff:ffff", "2001:db8:1:2::/64"},
+		{"2001:db8:1:3::", "2001:db8:1::/48"},
+		{"2001:db8:ffff::1", "2001:db8::/32"},
+		{"2001:db9::1", "::/0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.addr, func(t *testing.T) {
+			match := trie.Lookup(netip.MustParseAddr(tt.addr))
+			if assert.NotNil(t, match) {
+				assert.Equal(t, tt.want, match.Value)
+			}
+		})
+	}
+
+	// Priority still beats a longer prefix
+	prefix, rule := cidrRule(10, "2001:db8::/32")
+	rule.Priority = 1
+	trie.Insert(prefix, rule)
+	assert.Equal(t, uint(10), trie.Lookup(netip.MustParseAddr("2001:db8:1:2::5")).ID)
+}
+
+func TestIPTrie_IPv4MappedAddress(t *testing.T) {
+	trie := newIPTrie()
+	trie.Insert(cidrRule(1, "10.0.0.0/8"))
+	trie.Insert(cidrRule(2, "::/0"))
+	trie.Insert(cidrRule(3, "::/1"))
+
+	// A mapped address is looked up in the IPv4 root and never matches IPv6 prefixes
+	match := trie.Lookup(netip.MustParseAddr("::ffff:10.1.2.3"))
+	if assert.NotNil(t, match) {
+		assert.Equal(t, uint(1), match.ID)
+	}
+	assert.Nil(t, trie.Lookup(netip.MustParseAddr("::ffff:192.0.2.1")))
+
+	// An IPv6 address with the same low bits stays in the IPv6 root
+	assert.Equal(t, uint(3), trie.Lookup(netip.MustParseAddr("::a01:203")).ID)
+	assert.Equal(t, uint(2), trie.Lookup(netip.MustParseAddr("8000::1")).ID)
+
+	// A mapped prefix is stored as the IPv4 prefix it covers
+	trie.Insert(cidrRule(4, "::ffff:192.0.2.0/120"))
+	assert.Equal(t, uint(4), trie.Lookup(netip.MustParseAddr("192.0.2.1")).ID)
+	assert.Equal(t, uint(4), trie.Lookup(netip.MustParseAddr("::ffff:192.0.2.1")).ID)
+}
+
+func TestIPTrie_IPv6Range(t *testing.T) {
+	ipRange, err := utils.ParseIPRange("2001:db8::1-2001:db8::4")
+	assert.NoError(t, err)
+	rule := &compiledRule{ID: 1, Value: ipRange.String(), Status: "denied", Type: "range", bits: ipRange.Bits()}
+
+	trie := newIPTrie()
+	for _, prefix := range ipRange.Prefixes() {
+		trie.Insert(prefix, rule)
+	}
+	trie.Insert(cidrRule(2, "2001:db8::/126"))
+
+	// The range is less specific than its covering /125, so the /126 wins inside it
+	assert.Equal(t, uint(2), trie.Lookup(netip.MustParseAddr("2001:db8::1")).ID)
+	assert.Equal(t, uint(1), trie.Lookup(netip.MustParseAddr("2001:db8::4")).ID)
+	assert.Equal(t, uint(2), trie.Lookup(netip.MustParseAddr("2001:db8::")).ID)
+	assert.Nil(t, trie.Lookup(netip.MustParseAddr("2001:db8::5")))
+}
@@ -0,0 +1,116 @@
+package services
+
+import (
+	"firewall/models"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// MonitorRuleSummary is the number of requests a monitor rule matched in a period
+type MonitorRuleSummary struct {
+	Filter     string    `json:"filter"`
+	RuleID     uint      `json:"rule_id"`
+	Rule       string    `json:"rule,omitempty"`   // Address, pattern or code of the rule
+	Status     string    `json:"status,omitempty"` // Current status, empty if the rule was deleted
+	Hits       int64     `json:"hits"`
+	WouldBlock int64     `json:"would_block"`
+	LastHitAt  time.Time `json:"last_hit_at"`
+}
+
+// monitorRuleTables maps a filter name to its rule model and value column
+var monitorRuleTables = map[string]struct {
+	model  interface{}
+	column string
+}{
+	"ip":            {&models.IP{}, "address"},
+	"email":         {&models.Email{}, "address"},
+	"user_agent":    {&models.UserAgent{}, "user_agent"},
+	"country":       {&models.Country{}, "code"},
+	"username":      {&models.UsernameRule{}, "username"},
+	"asn":           {&models.ASN{}, "asn"},
+	"charset":       {&models.CharsetRule{}, "charset"},
+	"velocity":      {&models.VelocityRule{}, "name"},
+	"composite":     {&models.CompositeRule{}, "name"},
+	"expression":    {&models.ExpressionRule{}, "name"},
+	"geo":           {&models.GeoRule{}, "name"},
+	"country_group": {&models.CountryGroup{}, "code"},
+}
+
+// RecordMonitorHits increments the hourly counters of the matched monitor rules
+func RecordMonitorHits(db *gorm.DB, hits []MonitorHit) {
+	if db == nil {
+		return
+	}
+
+	now := time.Now()
+	bucket := now.Truncate(time.Hour)
+	for _, hit := range hits {
+		var wouldBlock int64
+		if hit.WouldBlock {
+			wouldBlock = 1
+		}
+		stat := models.MonitorRuleStat{Filter: hit.Filter, RuleID: hit.RuleID, Bucket: bucket, Hits: 1, WouldBlock: wouldBlock, LastHitAt: now}
+		err := db.Clauses(clause.OnConflict{
+			Columns: []clause.Column{{Name: "filter"}, {Name: "rule_id"}, {Name: "bucket"}},
+			DoUpdates: clause.Assignments(map[string]interface{}{
+				"hits":        gorm.Expr("hits + 1"),
+				"would_block": gorm.Expr("would_block + ?", wouldBlock),
+				"last_hit_at": now,
+			}),
+		}).Create(&stat).Error
+		if err != nil {
+			log.Printf("Error recording monitor rule hit: %v", err)
+		}
+	}
+}
+
+// GetMonitorRuleStats sums the monitor rule counters for a period, most blocking rules first
+func (as *AnalyticsService) GetMonitorRuleStats(startTime, endTime time.Time, limit int) ([]MonitorRuleSummary, error) {
+	var summaries []MonitorRuleSummary
+	if err := as.db.Model(&models.MonitorRuleStat{}).
+		Select("filter, rule_id, SUM(hits) AS hits, SUM(would_block) AS would_block, MAX(last_hit_at) AS last_hit_at").
+		Where("bucket >= ? AND bucket < ?", startTime.Truncate(time.Hour), endTime).
+		Group("filter, rule_id").
+		Order("would_block DESC, hits DESC").
+		Limit(limit).
+		Scan(&summaries).Error; err != nil {
+		return nil, err
+	}
+
+	// Attach the rule value and current status, one query per rule table
+	ids := make(map[string][]uint)
+	for _, s := range summaries {
+		ids[s.Filter] = append(ids[s.Filter], s.RuleID)
+	}
+	type ruleRow struct {
+		ID     uint
+		Value  string
+		Status string
+	}
+	rules := make(map[string]map[uint]ruleRow)
+	for filter, ruleIDs := range ids {
+		table, ok := monitorRuleTables[filter]
+		if !ok {
+			continue
+		}
+		var rows []ruleRow
+		if err := as.db.Model(table.model).Select("id, "+table.column+" AS value, status").Where("id IN ?", ruleIDs).Scan(&rows).Error; err != nil {
+			return nil, err
+		}
+		rules[filter] = make(map[uint]ruleRow, len(rows))
+		for _, row := range rows {
+			rules[filter][row.ID] = row
+		}
+	}
+	for i := range summaries {
+		if row, ok := rules[summaries[i].Filter][summaries[i].RuleID]; ok {
+			summaries[i].Rule = row.Value
+			summaries[i].Status = row.Status
+		}
+	}
+
+	return summaries, nil
+}
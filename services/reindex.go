@@ -0,0 +1,207 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"firewall/config"
+	"firewall/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Reindex job states
+const (
+	ReindexJobRunning   = "running"
+	ReindexJobCompleted = "completed"
+	ReindexJobFailed    = "failed"
+)
+
+// maxReindexJobs is the number of jobs kept for the status endpoint; older finished jobs are forgotten
+const maxReindexJobs = 50
+
+// ReindexJob reports the progress of a rule index rebuild
+type ReindexJob struct {
+	ID         string     `json:"id"`
+	Index      string     `json:"index"`
+	Status     string     `json:"status"` // running, completed, failed
+	Phase      string     `json:"phase"`  // see ReindexPhaseLoading ... ReindexPhaseDone
+	Total      int        `json:"total"`
+	Indexed    int        `json:"indexed"`
+	Target     string     `json:"target,omitempty"` // New version, e.g. ip-addresses-v3
+	Error      string     `json:"error,omitempty"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+// reindexSource loads the documents of a rule index from MySQL
+type reindexSource struct {
+	model interface{}
+	load  func(db *gorm.DB) ([]RuleDocument, error)
+}
+
+var reindexSources = map[string]reindexSource{
+	IndexIPs:          {&models.IP{}, func(db *gorm.DB) ([]RuleDocument, error) { return loadDocuments(db, ipDocument) }},
+	IndexEmails:       {&models.Email{}, func(db *gorm.DB) ([]RuleDocument, error) { return loadDocuments(db, emailDocument) }},
+	IndexUserAgents:   {&models.UserAgent{}, func(db *gorm.DB) ([]RuleDocument, error) { return loadDocuments(db, userAgentDocument) }},
+	IndexCountries:    {&models.Country{}, func(db *gorm.DB) ([]RuleDocument, error) { return loadDocuments(db, countryDocument) }},
+	IndexCharsets:     {&models.CharsetRule{}, func(db *gorm.DB) ([]RuleDocument, error) { return loadDocuments(db, charsetDocument) }},
+	IndexUsernames:    {&models.UsernameRule{}, func(db *gorm.DB) ([]RuleDocument, error) { return loadDocuments(db, usernameDocument) }},
+	IndexEmailDomains: {&models.EmailDomainRule{}, func(db *gorm.DB) ([]RuleDocument, error) { return loadDocuments(db, emailDomainDocument) }},
+	IndexContentRules: {&models.ContentRule{}, func(db *gorm.DB) ([]RuleDocument, error) { return loadDocuments(db, contentDocument) }},
+	IndexASNs:         {&models.ASN{}, func(db *gorm.DB) ([]RuleDocument, error) { return loadDocuments(db, asnDocument) }},
+}
+
+// loadDocuments reads all rows of a rule table and converts them to documents
+func loadDocuments[T any](db *gorm.DB, document func(T) RuleDocument) ([]RuleDocument, error) {
+	var rules []T
+	if err := db.Find(&rules).Error; err != nil {
+		return nil, err
+	}
+	docs := make([]RuleDocument, 0, len(rules))
+	for _, rule := range rules {
+		docs = append(docs, document(rule))
+	}
+	return docs, nil
+}
+
+// IsReindexable reports whether index names a rule index that can be rebuilt
+func IsReindexable(index string) bool {
+	_, ok := reindexSources[index]
+	return ok
+}
+
+// RebuildIndex rebuilds a rule index from MySQL; the current version keeps serving until the
+// new one is complete and verified
+func RebuildIndex(ctx context.Context, db *gorm.DB, index string, progress ReindexProgressFunc) (string, error) {
+	source, ok := reindexSources[index]
+	if !ok {
+		return "", fmt.Errorf("unknown rule index: %s", index)
+	}
+	if progress == nil {
+		progress = func(string, int, int) {}
+	}
+
+	load := func() ([]RuleDocument, error) {
+		docs, err := source.load(db)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load %s rules: %w", index, err)
+		}
+		return docs, nil
+	}
+	count := func() (int64, error) {
+		var n int64
+		err := db.Model(source.model).Count(&n).Error
+		return n, err
+	}
+	name, err := GetRuleIndex().Reindex(ctx, index, load, count, progress)
+	// The new version is created from the current template, so its mapping may differ
+	RefreshMappingStatus(ctx)
+	return name, err
+}
+
+// reindexJobs keeps the jobs of this instance in memory
+type reindexJobs struct {
+	mu      sync.RWMutex
+	jobs    map[string]*ReindexJob
+	order   []string          // job IDs, oldest first
+	running map[string]string // index -> ID of the running job
+}
+
+var reindexJobStore = &reindexJobs{jobs: make(map[string]*ReindexJob), running: make(map[string]string)}
+
+// StartReindexJob starts rebuilding a rule index in the background. Only one job per index
+// runs at a time; starting another returns the running job and false.
+func StartReindexJob(db *gorm.DB, index string) (ReindexJob, bool, error) {
+	if !IsReindexable(index) {
+		return ReindexJob{}, false, fmt.Errorf("unknown rule index: %s", index)
+	}
+	if db == nil {
+		db = config.DB
+	}
+
+	store := reindexJobStore
+	store.mu.Lock()
+	if id, ok := store.running[index]; ok {
+		job := *store.jobs[id]
+		store.mu.Unlock()
+		return job, false, nil
+	}
+	job := &ReindexJob{ID: uuid.NewString(), Index: index, Status: ReindexJobRunning, Phase: ReindexPhaseCreating, StartedAt: time.Now()}
+	store.jobs[job.ID] = job
+	store.order = append(store.order, job.ID)
+	store.running[index] = job.ID
+	store.prune()
+	started := *job
+	store.mu.Unlock()
+
+	go store.run(db, job)
+	return started, true, nil
+}
+
+// run executes a job and records its progress
+func (s *reindexJobs) run(db *gorm.DB, job *ReindexJob) {
+	target, err := RebuildIndex(context.Background(), db, job.Index, func(phase string, indexed, total int) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		job.Phase = phase
+		job.Indexed = indexed
+		job.Total = total
+	})
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	job.FinishedAt = &now
+	job.Target = target
+	if err != nil {
+		job.Status = ReindexJobFailed
+		job.Error = err.Error()
+		log.Printf("Reindex job %s for %s failed: %v", job.ID, job.Index, err)
+	} else {
+		job.Status = ReindexJobCompleted
+		log.Printf("Reindex job %s for %s completed: %s", job.ID, job.Index, target)
+	}
+	delete(s.running, job.Index)
+}
+
+// prune forgets the oldest finished jobs beyond maxReindexJobs; the caller holds the lock
+func (s *reindexJobs) prune() {
+	for i := 0; len(s.jobs) > maxReindexJobs && i < len(s.order); {
+		id := s.order[i]
+		if s.jobs[id].Status == ReindexJobRunning {
+			i++
+			continue
+		}
+		delete(s.jobs, id)
+		s.order = append(s.order[:i], s.order[i+1:]...)
+	}
+}
+
+// GetReindexJob returns a job by ID
+func GetReindexJob(id string) (ReindexJob, bool) {
+	reindexJobStore.mu.RLock()
+	defer reindexJobStore.mu.RUnlock()
+	job, ok := reindexJobStore.jobs[id]
+	if !ok {
+		return ReindexJob{}, false
+	}
+	return *job, true
+}
+
+// ListReindexJobs returns the known jobs, newest first
+func ListReindexJobs() []ReindexJob {
+	reindexJobStore.mu.RLock()
+	defer reindexJobStore.mu.RUnlock()
+	jobs := make([]ReindexJob, 0, len(reindexJobStore.jobs))
+	for _, job := range reindexJobStore.jobs {
+		jobs = append(jobs, *job)
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].StartedAt.After(jobs[j].StartedAt) })
+	return jobs
+}
@@ -0,0 +1,187 @@
+package services
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/elastic/go-elasticsearch/v8"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// loadDocs returns a Reindex loader for fixed documents
+func loadDocs(docs []RuleDocument) func() ([]RuleDocument, error) {
+	return func() ([]RuleDocument, error) { return docs, nil }
+}
+
+func TestMemoryRuleIndex_Reindex(t *testing.T) {
+	ctx := context.Background()
+	index := NewMemoryRuleIndex()
+	assert.NoError(t, index.Upsert(ctx, IndexIPs, RuleDocument{ID: "1", Source: map[string]interface{}{"address": "192.0.2.1"}}))
+
+	docs := []RuleDocument{
+		{ID: "2", Source: map[string]interface{}{"address": "198.51.100.0/24"}},
+		{ID: "3", Source: map[string]interface{}{"address": "203.0.113.7"}},
+	}
+
+	// A count mismatch keeps the current version
+	_, err := index.Reindex(ctx, IndexIPs, loadDocs(docs), func() (int64, error) { return 3, nil }, nil)
+	assert.Error(t, err)
+	assert.Len(t, indexedDocs(index, IndexIPs, "address", "192.0.2.1"), 1)
+
+	var phases []string
+	target, err := index.Reindex(ctx, IndexIPs, loadDocs(docs), func() (int64, error) { return 2, nil }, func(phase string, indexed, total int) {
+		phases = append(phases, phase)
+		if phase != ReindexPhaseLoading {
+			assert.Equal(t, 2, total)
+		}
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "ip-addresses-v1", target)
+	assert.Equal(t, ReindexPhaseLoading, phases[0])
+	assert.Equal(t, ReindexPhaseDone, phases[len(phases)-1])
+	assert.Empty(t, indexedDocs(index, IndexIPs, "address", "192.0.2.1"))
+	assert.Len(t, indexedDocs(index, IndexIPs, "address", "203.0.113.7"), 1)
+}
+
+// fakeCluster answers the requests of a rebuild of "staging-ip-addresses", whose current version is v1
+type fakeCluster struct {
+	mu       sync.Mutex
+	requests []string
+	count    string
+	aliases  string
+	bulk     string   // body of the last bulk request
+	writes   []string // path and query of the document writes
+}
+
+func (f *fakeCluster) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	f.mu.Lock()
+	f.requests = append(f.requests, r.Method+" "+r.URL.Path)
+	switch {
+	case r.URL.Path == "/_aliases":
+		f.aliases = string(body)
+	case strings.HasSuffix(r.URL.Path, "/_bulk"):
+		f.bulk = string(body)
+	case strings.Contains(r.URL.Path, "/_doc/"):
+		f.writes = append(f.writes, r.Method+" "+r.URL.Path+"?"+r.URL.RawQuery)
+	}
+	f.mu.Unlock()
+
+	w.Header().Set("X-Elastic-Product", "Elasticsearch")
+	w.Header().Set("Content-Type", "application/json")
+	switch {
+	case r.URL.Path == "/_alias/staging-ip-addresses":
+		io.WriteString(w, `{"staging-ip-addresses-v1":{"aliases":{"staging-ip-addresses":{}}}}`)
+	case r.URL.Path == "/staging-ip-addresses-v*":
+		io.WriteString(w, `{"staging-ip-addresses-v1":{}}`)
+	case strings.HasSuffix(r.URL.Path, "/_bulk"):
+		io.WriteString(w, `{"errors":false,"items":[]}`)
+	case strings.HasSuffix(r.URL.Path, "/_count"):
+		io.WriteString(w, `{"count":`+f.count+`}`)
+	default:
+		io.WriteString(w, `{"acknowledged":true}`)
+	}
+}
+
+func newFakeClusterIndex(t *testing.T, count string) (*fakeCluster, RuleIndex) {
+	cluster := &fakeCluster{count: count}
+	server := httptest.NewServer(cluster)
+	t.Cleanup(server.Close)
+	client, err := elasticsearch.NewClient(elasticsearch.Config{Addresses: []string{server.URL}})
+	require.NoError(t, err)
+	return cluster, NewElasticsearchRuleIndex(client, "staging")
+}
+
+func TestElasticsearchRuleIndex_Reindex(t *testing.T) {
+	cluster, index := newFakeClusterIndex(t, "2")
+	docs := []RuleDocument{
+		{ID: "1", Source: map[string]interface{}{"address": "192.0.2.1"}},
+		{ID: "2", Source: map[string]interface{}{"address": "198.51.100.0/24"}},
+	}
+
+	target, err := index.Reindex(context.Background(), IndexIPs, loadDocs(docs), func() (int64, error) { return 2, nil }, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "staging-ip-addresses-v2", target)
+
+	assert.Equal(t, []string{
+		"GET /_alias/staging-ip-addresses",
+		"GET /staging-ip-addresses-v*",
+		"PUT /_index_template/staging-ip-addresses-template",
+		"PUT /staging-ip-addresses-v2",
+		"POST /staging-ip-addresses-v2/_bulk",
+		"POST /staging-ip-addresses-v2/_refresh",
+		"POST /staging-ip-addresses-v2/_count",
+		"POST /_aliases",
+		"DELETE /staging-ip-addresses-v1",
+	}, cluster.requests)
+	assert.JSONEq(t, `{"actions":[
+		{"remove":{"index":"staging-ip-addresses-v1","alias":"staging-ip-addresses"}},
+		{"add":{"index":"staging-ip-addresses-v2","alias":"staging-ip-addresses"}}
+	]}`, cluster.aliases)
+}
+
+func TestElasticsearchRuleIndex_ReindexCountMismatch(t *testing.T) {
+	cluster, index := newFakeClusterIndex(t, "1")
+	docs := []RuleDocument{{ID: "1", Source: map[string]interface{}{"address": "192.0.2.1"}}}
+
+	_, err := index.Reindex(context.Background(), IndexIPs, loadDocs(docs), func() (int64, error) { return 2, nil }, nil)
+	assert.ErrorContains(t, err, "indexed 1 documents, expected 2")
+
+	// The alias is untouched and the incomplete version is dropped
+	assert.NotContains(t, cluster.requests, "POST /_aliases")
+	assert.Equal(t, "DELETE /staging-ip-addresses-v2", cluster.requests[len(cluster.requests)-1])
+	assert.Empty(t, cluster.aliases)
+}
+
+func TestElasticsearchRuleIndex_Recreate(t *testing.T) {
+	cluster, index := newFakeClusterIndex(t, "0")
+
+	assert.NoError(t, index.Recreate(context.Background(), IndexIPs))
+	assert.Contains(t, cluster.requests, "PUT /staging-ip-addresses-v2")
+	assert.Equal(t, "DELETE /staging-ip-addresses-v1", cluster.requests[len(cluster.requests)-1])
+}
+
+func TestElasticsearchRuleIndex_ReindexKeepsConcurrentWrites(t *testing.T) {
+	cluster, index := newFakeClusterIndex(t, "1")
+	ctx := context.Background()
+
+	// The rule is updated right after the rebuild read it from MySQL
+	load := func() ([]RuleDocument, error) {
+		assert.NoError(t, index.Upsert(ctx, IndexIPs, RuleDocument{ID: "1", Version: 200, Source: map[string]interface{}{"address": "192.0.2.2"}}))
+		return []RuleDocument{{ID: "1", Version: 100, Source: map[string]interface{}{"address": "192.0.2.1"}}}, nil
+	}
+	_, err := index.Reindex(ctx, IndexIPs, load, func() (int64, error) { return 1, nil }, nil)
+	assert.NoError(t, err)
+
+	// The update reaches the new version, and the stale bulk document cannot replace it
+	assert.Equal(t, []string{
+		"PUT /staging-ip-addresses/_doc/1?version=200&version_type=external",
+		"PUT /staging-ip-addresses-v2/_doc/1?version=200&version_type=external",
+	}, cluster.writes)
+	assert.Contains(t, cluster.bulk, `{"index":{"_id":"1","version":100,"version_type":"external"}}`)
+}
+
+func TestMemoryRuleIndex_UpsertVersions(t *testing.T) {
+	ctx := context.Background()
+	index := NewMemoryRuleIndex()
+
+	assert.NoError(t, index.Upsert(ctx, IndexIPs, RuleDocument{ID: "1", Version: 200, Source: map[string]interface{}{"address": "192.0.2.2"}}))
+	_, err := index.BulkUpsert(ctx, IndexIPs, []RuleDocument{{ID: "1", Version: 100, Source: map[string]interface{}{"address": "192.0.2.1"}}})
+	assert.NoError(t, err)
+
+	assert.Len(t, indexedDocs(index, IndexIPs, "address", "192.0.2.2"), 1)
+}
+
+func TestStartReindexJob_UnknownIndex(t *testing.T) {
+	_, started, err := StartReindexJob(nil, "nope")
+	assert.Error(t, err)
+	assert.False(t, started)
+	assert.False(t, IsReindexable("nope"))
+	assert.True(t, IsReindexable(IndexEmailDomains))
+}
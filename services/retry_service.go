@@ -44,8 +44,9 @@ func GetRetryQueue() *RetryQueue {
 	return retryQueue
 }
 
-// QueueForRetry adds an item to the retry queue
-func QueueForRetry(retryType string, data interface{}) {
+// QueueForRetry adds an item to the retry queue; it returns false when the queue is full and
+// the item is dropped
+func QueueForRetry(retryType string, data interface{}) bool {
 	queue := GetRetryQueue()
 	item := RetryItem{
 		Type:      retryType,
@@ -57,8 +58,10 @@ func QueueForRetry(retryType string, data interface{}) {
 	select {
 	case queue.items <- item:
 		log.Printf("Item queued for retry: %s", retryType)
+		return true
 	default:
 		log.Printf("Warning: Retry queue full, dropping item: %s", retryType)
+		return false
 	}
 }
 
@@ -126,6 +129,11 @@ func (rq *RetryQueue) processRetryItem(item RetryItem) {
 		if countryData, ok := item.Data.(models.Country); ok {
 			err = IndexCountry(countryData)
 		}
+	case "sync_bulk":
+		// The failed documents of a bulk request of a full or incremental sync
+		if batch, ok := item.Data.(*bulkRetry); ok {
+			err = batch.retry()
+		}
 	}
 
 	if err != nil {
@@ -0,0 +1,842 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"firewall/config"
+	"firewall/models"
+	"firewall/utils"
+	"fmt"
+	"log"
+	"net/netip"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// compiledRule is a rule prepared for matching inside a RuleSnapshot
+type compiledRule struct {
+	ID       uint
+	Value    string
+	Status   string
+	Priority int
+	Type     string // "exact", "cidr", "range", "regex", "charset", "keyword", "phrase", "domain", "subdomain", "group"
+	bits     int    // prefix length of CIDR rules (of the smallest covering prefix for ranges), number of labels of subdomain rules, members of country groups
+	regex    *regexp.Regexp
+}
+
+// specificity ranks rule types: exact beats CIDR and range (longer prefixes first) beats regex;
+// for emails an address beats its domain beats a parent domain (longer suffixes first) beats regex
+func (r *compiledRule) specificity() int {
+	switch r.Type {
+	case "exact", "charset", "keyword", "phrase":
+		return 1000
+	case "domain":
+		return 900
+	case "cidr", "range", "subdomain":
+		return 500 + r.bits
+	// Geo rules compete with the country rules: a city or geofence beats its subdivision,
+	// a subdivision its country, a country its continent
+	case "city", "radius":
+		return 1200
+	case "subdivision":
+		return 1100
+	case "continent":
+		return 800
+	// A country group ranks below its countries and above the continents, smaller groups first
+	case "group":
+		return 900 - min(r.bits, 99)
+	}
+	return 0
+}
+
+// outranks reports whether r takes precedence over other within the same field:
+// higher priority first, then the more specific rule, then the lower ID
+func (r *compiledRule) outranks(other *compiledRule) bool {
+	if other == nil {
+		return true
+	}
+	if r.Priority != other.Priority {
+		return r.Priority > other.Priority
+	}
+	if a, b := r.specificity(), other.specificity(); a != b {
+		return a > b
+	}
+	return r.ID < other.ID
+}
+
+// RuleSet holds the raw rules loaded from MySQL
+type RuleSet struct {
+	IPs           []models.IP
+	Emails        []models.Email
+	Domains       []models.EmailDomainRule
+	UserAgents    []models.UserAgent
+	Countries     []models.Country
+	Usernames     []models.UsernameRule
+	ASNs          []models.ASN
+	Charsets      []models.CharsetRule
+	Contents      []models.ContentRule
+	Velocities    []models.VelocityRule
+	Composites    []models.CompositeRule
+	Expressions   []models.ExpressionRule
+	GeoRules      []models.GeoRule
+	CountryGroups []models.CountryGroup
+
+	DefaultPolicies []models.DefaultPolicy // not rules, they apply when no rule of a filter matches
+}
+
+// patternIndex combines exact lookups with compiled regexes ordered by precedence
+type patternIndex struct {
+	exact   map[string]*compiledRule
+	regexes []*compiledRule
+}
+
+func newPatternIndex() *patternIndex {
+	return &patternIndex{exact: make(map[string]*compiledRule)}
+}
+
+// add registers a rule; invalid regex patterns are skipped
+func (p *patternIndex) add(id uint, value, status string, priority int, isRegex bool, key string) bool {
+	rule := &compiledRule{ID: id, Value: value, Status: status, Priority: priority, Type: "exact"}
+	if !isRegex {
+		if rule.outranks(p.exact[key]) {
+			p.exact[key] = rule
+		}
+		return true
+	}
+	re, err := regexp.Compile(value)
+	if err != nil {
+		return false
+	}
+	rule.Type = "regex"
+	rule.regex = re
+	p.regexes = append(p.regexes, rule)
+	return true
+}
+
+// sort orders the regexes by precedence so the first match is the best one
+func (p *patternIndex) sort() {
+	sort.SliceStable(p.regexes, func(i, j int) bool {
+		return p.regexes[i].outranks(p.regexes[j])
+	})
+}
+
+// match returns the highest ranked rule for key (exact) or value (regex)
+func (p *patternIndex) match(key, value string) *compiledRule {
+	best := p.exact[key]
+	for _, rule := range p.regexes {
+		// Regexes are sorted, nothing further down can outrank the current best
+		if !rule.outranks(best) {
+			break
+		}
+		if rule.regex.MatchString(value) {
+			return rule
+		}
+	}
+	return best
+}
+
+func (p *patternIndex) len() int {
+	return len(p.exact) + len(p.regexes)
+}
+
+// RuleSnapshot is an immutable, precompiled view of all filter rules
+type RuleSnapshot struct {
+	ipExact    map[netip.Addr]*compiledRule
+	ipCIDRs    *ipTrie
+	ipRanges   *ipTrie // start-end ranges, stored as their CIDR decomposition
+	rangeCount int
+	emails     *patternIndex
+	domains    *domainIndex
+	userAgents *patternIndex
+	usernames  *patternIndex
+	countries  map[string]*compiledRule
+	asns       map[string]*compiledRule
+	charsets   map[string]*compiledRule
+	contents   *contentIndex
+	velocity   *velocityIndex
+	composite  *compositeIndex
+	expression *expressionIndex
+	geo        *geoIndex // continent, subdivision, city and radius rules of the country filter
+	groups     *countryGroupIndex
+	defaults   map[string]string // default policy per filter name
+	monitor    *RuleSnapshot     // rules with status "monitor", matched separately so they never shadow enforced rules
+	skipped    int
+	inactive   int       // rules outside their validity window when the snapshot was built
+	nextChange time.Time // earliest future valid_from/expires_at, zero if there is none
+	BuiltAt    time.Time
+}
+
+// BuildRuleSnapshot compiles a RuleSet into a RuleSnapshot; monitor rules go into Monitor()
+// and rules outside their validity window are left out
+func BuildRuleSnapshot(set RuleSet) *RuleSnapshot {
+	now := time.Now()
+	active, next := activeRules(set, now)
+	enforced, monitor := splitMonitorRules(active)
+	s := buildRuleSnapshot(enforced)
+	s.monitor = buildRuleSnapshot(monitor)
+	s.skipped += s.monitor.skipped
+	s.inactive = set.len() - active.len()
+	s.nextChange = next
+	return s
+}
+
+// validityBound is implemented by all rule models through models.RuleValidity
+type validityBound interface {
+	ActiveAt(t time.Time) bool
+	NextChange(t time.Time) time.Time
+}
+
+// activeRules returns the rules that apply at now and the earliest time at which
+// one of the rules becomes valid or expires
+func activeRules(set RuleSet, now time.Time) (RuleSet, time.Time) {
+	var next time.Time
+	active := RuleSet{
+		IPs:           filterActive(set.IPs, now, &next),
+		Emails:        filterActive(set.Emails, now, &next),
+		Domains:       filterActive(set.Domains, now, &next),
+		UserAgents:    filterActive(set.UserAgents, now, &next),
+		Countries:     filterActive(set.Countries, now, &next),
+		Usernames:     filterActive(set.Usernames, now, &next),
+		ASNs:          filterActive(set.ASNs, now, &next),
+		Charsets:      filterActive(set.Charsets, now, &next),
+		Contents:      filterActive(set.Contents, now, &next),
+		Velocities:    filterActive(set.Velocities, now, &next),
+		Composites:    filterActive(set.Composites, now, &next),
+		Expressions:   filterActive(set.Expressions, now, &next),
+		GeoRules:      filterActive(set.GeoRules, now, &next),
+		CountryGroups: filterActive(set.CountryGroups, now, &next),
+
+		DefaultPolicies: set.DefaultPolicies,
+	}
+	return active, next
+}
+
+func filterActive[T validityBound](rules []T, now time.Time, next *time.Time) []T {
+	active := make([]T, 0, len(rules))
+	for _, r := range rules {
+		if change := r.NextChange(now); !change.IsZero() && (next.IsZero() || change.Before(*next)) {
+			*next = change
+		}
+		if r.ActiveAt(now) {
+			active = append(active, r)
+		}
+	}
+	return active
+}
+
+// len returns the number of rules in the set
+func (set RuleSet) len() int {
+	return len(set.IPs) + len(set.Emails) + len(set.Domains) + len(set.UserAgents) + len(set.Countries) +
+		len(set.Usernames) + len(set.ASNs) + len(set.Charsets) + len(set.Contents) +
+		len(set.Velocities) + len(set.Composites) + len(set.Expressions) + len(set.GeoRules) + len(set.CountryGroups)
+}
+
+// splitMonitorRules separates rules with status "monitor" from the enforced rules
+func splitMonitorRules(set RuleSet) (RuleSet, RuleSet) {
+	var enforced, monitor RuleSet
+	for _, r := range set.IPs {
+		if r.Status == "monitor" {
+			monitor.IPs = append(monitor.IPs, r)
+		} else {
+			enforced.IPs = append(enforced.IPs, r)
+		}
+	}
+	for _, r := range set.Emails {
+		if r.Status == "monitor" {
+			monitor.Emails = append(monitor.Emails, r)
+		} else {
+			enforced.Emails = append(enforced.Emails, r)
+		}
+	}
+	for _, r := range set.Domains {
+		if r.Status == "monitor" {
+			monitor.Domains = append(monitor.Domains, r)
+		} else {
+			enforced.Domains = append(enforced.Domains, r)
+		}
+	}
+	for _, r := range set.UserAgents {
+		if r.Status == "monitor" {
+			monitor.UserAgents = append(monitor.UserAgents, r)
+		} else {
+			enforced.UserAgents = append(enforced.UserAgents, r)
+		}
+	}
+	for _, r := range set.Countries {
+		if r.Status == "monitor" {
+			monitor.Countries = append(monitor.Countries, r)
+		} else {
+			enforced.Countries = append(enforced.Countries, r)
+		}
+	}
+	for _, r := range set.Usernames {
+		if r.Status == "monitor" {
+			monitor.Usernames = append(monitor.Usernames, r)
+		} else {
+			enforced.Usernames = append(enforced.Usernames, r)
+		}
+	}
+	for _, r := range set.ASNs {
+		if r.Status == "monitor" {
+			monitor.ASNs = append(monitor.ASNs, r)
+		} else {
+			enforced.ASNs = append(enforced.ASNs, r)
+		}
+	}
+	for _, r := range set.Charsets {
+		if r.Status == "monitor" {
+			monitor.Charsets = append(monitor.Charsets, r)
+		} else {
+			enforced.Charsets = append(enforced.Charsets, r)
+		}
+	}
+	for _, r := range set.Contents {
+		if r.Status == "monitor" {
+			monitor.Contents = append(monitor.Contents, r)
+		} else {
+			enforced.Contents = append(enforced.Contents, r)
+		}
+	}
+	for _, r := range set.Velocities {
+		if r.Status == "monitor" {
+			monitor.Velocities = append(monitor.Velocities, r)
+		} else {
+			enforced.Velocities = append(enforced.Velocities, r)
+		}
+	}
+	for _, r := range set.Composites {
+		if r.Status == "monitor" {
+			monitor.Composites = append(monitor.Composites, r)
+		} else {
+			enforced.Composites = append(enforced.Composites, r)
+		}
+	}
+	for _, r := range set.Expressions {
+		if r.Status == "monitor" {
+			monitor.Expressions = append(monitor.Expressions, r)
+		} else {
+			enforced.Expressions = append(enforced.Expressions, r)
+		}
+	}
+	for _, r := range set.GeoRules {
+		if r.Status == "monitor" {
+			monitor.GeoRules = append(monitor.GeoRules, r)
+		} else {
+			enforced.GeoRules = append(enforced.GeoRules, r)
+		}
+	}
+	for _, r := range set.CountryGroups {
+		if r.Status == "monitor" {
+			monitor.CountryGroups = append(monitor.CountryGroups, r)
+		} else {
+			enforced.CountryGroups = append(enforced.CountryGroups, r)
+		}
+	}
+	enforced.DefaultPolicies = set.DefaultPolicies
+	return enforced, monitor
+}
+
+func buildRuleSnapshot(set RuleSet) *RuleSnapshot {
+	s := &RuleSnapshot{
+		ipExact:    make(map[netip.Addr]*compiledRule, len(set.IPs)),
+		ipCIDRs:    newIPTrie(),
+		ipRanges:   newIPTrie(),
+		emails:     newPatternIndex(),
+		domains:    newDomainIndex(),
+		userAgents: newPatternIndex(),
+		usernames:  newPatternIndex(),
+		countries:  make(map[string]*compiledRule, len(set.Countries)),
+		asns:       make(map[string]*compiledRule, len(set.ASNs)),
+		charsets:   make(map[string]*compiledRule, len(set.Charsets)),
+		contents:   newContentIndex(),
+		velocity:   &velocityIndex{},
+		composite:  &compositeIndex{},
+		expression: &expressionIndex{},
+		geo:        newGeoIndex(),
+		groups:     newCountryGroupIndex(),
+		defaults:   make(map[string]string, len(set.DefaultPolicies)),
+		BuiltAt:    time.Now(),
+	}
+
+	for _, ip := range set.IPs {
+		rule := &compiledRule{ID: ip.ID, Value: ip.Address, Status: ip.Status, Priority: ip.Priority}
+		if ip.IsRange || utils.IsRangeNotation(ip.Address) {
+			ipRange, err := utils.ParseIPRange(ip.Address)
+			if err != nil {
+				s.skipped++
+				continue
+			}
+			rule.Type = "range"
+			rule.bits = ipRange.Bits()
+			for _, prefix := range ipRange.Prefixes() {
+				s.ipRanges.Insert(prefix, rule)
+			}
+			s.rangeCount++
+			continue
+		}
+		if ip.IsCIDR || strings.Contains(ip.Address, "/") {
+			prefix, err := netip.ParsePrefix(ip.Address)
+			if err != nil {
+				s.skipped++
+				continue
+			}
+			rule.Type = "cidr"
+			rule.bits = utils.NormalizePrefix(prefix).Bits()
+			s.ipCIDRs.Insert(prefix, rule)
+			continue
+		}
+		addr, err := netip.ParseAddr(ip.Address)
+		if err != nil {
+			s.skipped++
+			continue
+		}
+		rule.Type = "exact"
+		addr = utils.NormalizeAddr(addr)
+		if rule.outranks(s.ipExact[addr]) {
+			s.ipExact[addr] = rule
+		}
+	}
+
+	for _, email := range set.Emails {
+		// Exact rules are keyed by the canonical address, so they also match aliases of the mailbox
+		if !s.emails.add(email.ID, email.Address, email.Status, email.Priority, email.IsRegex, strings.ToLower(NormalizeEmail(email.Address))) {
+			s.skipped++
+		}
+	}
+	for _, domain := range set.Domains {
+		if !s.domains.add(domain.ID, domain.Domain, domain.Status, domain.Priority) {
+			s.skipped++
+		}
+	}
+	for _, ua := range set.UserAgents {
+		if !s.userAgents.add(ua.ID, ua.UserAgent, ua.Status, ua.Priority, ua.IsRegex, ua.UserAgent) {
+			s.skipped++
+		}
+	}
+	for _, username := range set.Usernames {
+		if !s.usernames.add(username.ID, username.Username, username.Status, username.Priority, username.IsRegex, username.Username) {
+			s.skipped++
+		}
+	}
+	s.emails.sort()
+	s.userAgents.sort()
+	s.usernames.sort()
+
+	for _, country := range set.Countries {
+		addExact(s.countries, strings.ToUpper(country.Code), &compiledRule{ID: country.ID, Value: country.Code, Status: country.Status, Priority: country.Priority, Type: "exact"})
+	}
+	for _, asn := range set.ASNs {
+		addExact(s.asns, strings.ToUpper(asn.ASN), &compiledRule{ID: asn.ID, Value: asn.ASN, Status: asn.Status, Priority: asn.Priority, Type: "exact"})
+	}
+	for _, charset := range set.Charsets {
+		addExact(s.charsets, charset.Charset, &compiledRule{ID: charset.ID, Value: charset.Charset, Status: charset.Status, Priority: charset.Priority, Type: "charset"})
+	}
+
+	for _, content := range set.Contents {
+		if !s.contents.add(content.ID, content.Pattern, content.MatchType, content.Status, content.Priority) {
+			s.skipped++
+		}
+	}
+	s.contents.build()
+
+	for _, v := range set.Velocities {
+		if !s.velocity.add(newVelocityRule(v.ID, v.Name, v.KeyFields, v.DistinctField, v.Threshold, v.Window, v.Status, v.Priority)) {
+			s.skipped++
+		}
+	}
+	s.velocity.sort()
+
+	for _, r := range set.Composites {
+		if !s.composite.add(newCompositeRule(r)) {
+			s.skipped++
+		}
+	}
+	s.composite.sort()
+
+	for _, r := range set.Expressions {
+		if !s.expression.add(newExpressionRule(r)) {
+			s.skipped++
+		}
+	}
+	s.expression.sort()
+
+	for _, r := range set.GeoRules {
+		if !s.geo.add(r) {
+			s.skipped++
+		}
+	}
+	s.geo.sort()
+
+	for _, g := range set.CountryGroups {
+		if !s.groups.add(g) {
+			s.skipped++
+		}
+	}
+	s.groups.sort()
+
+	for _, p := range set.DefaultPolicies {
+		switch p.Policy {
+		case PolicyAllow, PolicyDeny, PolicyFallThrough:
+			s.defaults[p.Filter] = p.Policy
+		default:
+			s.skipped++
+		}
+	}
+
+	return s
+}
+
+// addExact stores rule under key unless a higher ranked rule is already there
+func addExact(rules map[string]*compiledRule, key string, rule *compiledRule) {
+	if rule.outranks(rules[key]) {
+		rules[key] = rule
+	}
+}
+
+// Monitor returns the snapshot of monitor rules; it is empty (never nil) for snapshots built by BuildRuleSnapshot
+func (s *RuleSnapshot) Monitor() *RuleSnapshot {
+	if s.monitor == nil {
+		return &RuleSnapshot{ipCIDRs: newIPTrie(), ipRanges: newIPTrie(), emails: newPatternIndex(), domains: newDomainIndex(), userAgents: newPatternIndex(), usernames: newPatternIndex(), contents: newContentIndex(), velocity: &velocityIndex{}, composite: &compositeIndex{}, expression: &expressionIndex{}, geo: newGeoIndex(), groups: newCountryGroupIndex()}
+	}
+	return s.monitor
+}
+
+// MatchIP returns the highest ranked rule for an address: by priority, then
+// exact addresses before CIDR blocks and ranges, and longer prefixes before shorter ones
+func (s *RuleSnapshot) MatchIP(ip string) *compiledRule {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return nil
+	}
+	addr = utils.NormalizeAddr(addr)
+	best := s.ipExact[addr]
+	if rule := s.ipCIDRs.Lookup(addr); rule != nil && rule.outranks(best) {
+		best = rule
+	}
+	if rule := s.ipRanges.Lookup(addr); rule != nil && rule.outranks(best) {
+		best = rule
+	}
+	return best
+}
+
+// MatchEmail returns the highest ranked email rule: an address (exact or regex) or a domain rule
+func (s *RuleSnapshot) MatchEmail(email string) *compiledRule {
+	best := s.emails.match(strings.ToLower(email), email)
+	if rule := s.domains.match(emailDomain(email)); rule != nil && rule.outranks(best) {
+		best = rule
+	}
+	return best
+}
+
+// MatchUserAgent returns the highest ranked user agent rule (exact or regex)
+func (s *RuleSnapshot) MatchUserAgent(userAgent string) *compiledRule {
+	return s.userAgents.match(userAgent, userAgent)
+}
+
+// MatchUsername returns the highest ranked username rule (exact or regex)
+func (s *RuleSnapshot) MatchUsername(username string) *compiledRule {
+	return s.usernames.match(username, username)
+}
+
+// MatchCountry returns the rule for a country code
+func (s *RuleSnapshot) MatchCountry(country string) *compiledRule {
+	return s.countries[strings.ToUpper(country)]
+}
+
+// MatchCountryGroup returns the highest ranked group rule containing a country code
+func (s *RuleSnapshot) MatchCountryGroup(country string) *compiledRule {
+	return s.groups.match(country)
+}
+
+// MatchASN returns the rule for an ASN (e.g. "AS12345")
+func (s *RuleSnapshot) MatchASN(asn string) *compiledRule {
+	return s.asns[strings.ToUpper(asn)]
+}
+
+// MatchCharset returns the rule for a detected charset (e.g. "Cyrillic")
+func (s *RuleSnapshot) MatchCharset(charset string) *compiledRule {
+	return s.charsets[charset]
+}
+
+// MatchContent returns the highest ranked content rule and the matched term
+func (s *RuleSnapshot) MatchContent(content string) (*compiledRule, string) {
+	return s.contents.match(content)
+}
+
+// Stats returns the number of compiled rules per type
+func (s *RuleSnapshot) Stats() map[string]interface{} {
+	return map[string]interface{}{
+		"ips":              len(s.ipExact),
+		"cidrs":            s.ipCIDRs.Len(),
+		"ranges":           s.rangeCount,
+		"emails":           s.emails.len(),
+		"domains":          s.domains.len(),
+		"user_agents":      s.userAgents.len(),
+		"usernames":        s.usernames.len(),
+		"countries":        len(s.countries),
+		"asns":             len(s.asns),
+		"charsets":         len(s.charsets),
+		"contents":         s.contents.len(),
+		"velocity":         s.velocity.len(),
+		"composite":        s.composite.len(),
+		"expression":       s.expression.len(),
+		"geo":              s.geo.len(),
+		"country_groups":   s.groups.len(),
+		"default_policies": s.defaultPolicies(),
+		"monitor":          s.Monitor().len(),
+		"skipped":          s.skipped,
+		"inactive":         s.inactive,
+		"next_change":      s.nextChange,
+		"built_at":         s.BuiltAt,
+	}
+}
+
+// len returns the number of compiled rules
+func (s *RuleSnapshot) len() int {
+	return len(s.ipExact) + s.ipCIDRs.Len() + s.rangeCount + s.emails.len() + s.domains.len() + s.userAgents.len() + s.usernames.len() +
+		len(s.countries) + len(s.asns) + len(s.charsets) + s.contents.len() + s.velocity.len() + s.composite.len() + s.expression.len() + s.geo.len() + s.groups.len()
+}
+
+// LoadRuleSet reads all filter rules from MySQL
+func LoadRuleSet(db *gorm.DB) (RuleSet, error) {
+	var set RuleSet
+	if err := db.Find(&set.IPs).Error; err != nil {
+		return set, fmt.Errorf("failed to load ips: %w", err)
+	}
+	if err := db.Find(&set.Emails).Error; err != nil {
+		return set, fmt.Errorf("failed to load emails: %w", err)
+	}
+	if err := db.Find(&set.Domains).Error; err != nil {
+		return set, fmt.Errorf("failed to load email domains: %w", err)
+	}
+	if err := db.Find(&set.UserAgents).Error; err != nil {
+		return set, fmt.Errorf("failed to load user agents: %w", err)
+	}
+	if err := db.Find(&set.Countries).Error; err != nil {
+		return set, fmt.Errorf("failed to load countries: %w", err)
+	}
+	if err := db.Find(&set.Usernames).Error; err != nil {
+		return set, fmt.Errorf("failed to load usernames: %w", err)
+	}
+	if err := db.Find(&set.ASNs).Error; err != nil {
+		return set, fmt.Errorf("failed to load asns: %w", err)
+	}
+	if err := db.Find(&set.Charsets).Error; err != nil {
+		return set, fmt.Errorf("failed to load charsets: %w", err)
+	}
+	if err := db.Find(&set.Contents).Error; err != nil {
+		return set, fmt.Errorf("failed to load content rules: %w", err)
+	}
+	if err := db.Find(&set.Velocities).Error; err != nil {
+		return set, fmt.Errorf("failed to load velocity rules: %w", err)
+	}
+	if err := db.Find(&set.Composites).Error; err != nil {
+		return set, fmt.Errorf("failed to load composite rules: %w", err)
+	}
+	if err := db.Find(&set.Expressions).Error; err != nil {
+		return set, fmt.Errorf("failed to load expression rules: %w", err)
+	}
+	if err := db.Find(&set.GeoRules).Error; err != nil {
+		return set, fmt.Errorf("failed to load geo rules: %w", err)
+	}
+	if err := db.Find(&set.CountryGroups).Error; err != nil {
+		return set, fmt.Errorf("failed to load country groups: %w", err)
+	}
+	if err := db.Find(&set.DefaultPolicies).Error; err != nil {
+		return set, fmt.Errorf("failed to load default policies: %w", err)
+	}
+	return set, nil
+}
+
+// RuleEngine keeps the current RuleSnapshot and rebuilds it on rule changes
+type RuleEngine struct {
+	snapshot atomic.Pointer[RuleSnapshot]
+	reload   chan struct{}
+	expiry   *time.Timer // reloads the rules when the next rule becomes valid or expires
+	rules    [32]byte    // hash of the last loaded RuleSet, tells the periodic reload whether anything changed
+	db       func() *gorm.DB
+	mu       sync.Mutex
+	wg       sync.WaitGroup
+	ctx      context.Context
+	cancel   context.CancelFunc
+
+	refreshMu   sync.Mutex // serializes Refresh
+	lastRefresh time.Time
+	refreshErr  error
+}
+
+var (
+	ruleEngine     *RuleEngine
+	ruleEngineOnce sync.Once
+)
+
+// defaultRuleReloadInterval is used when filtering.rule_reload_interval is not set (e.g. in tests)
+const defaultRuleReloadInterval = 30 * time.Second
+
+// GetRuleEngine returns the singleton rule engine
+func GetRuleEngine() *RuleEngine {
+	ruleEngineOnce.Do(func() {
+		interval := defaultRuleReloadInterval
+		if config.AppConfig != nil && config.AppConfig.Filtering.RuleReloadInterval > 0 {
+			interval = config.AppConfig.Filtering.RuleReloadInterval
+		}
+		ruleEngine = newRuleEngine(func() *gorm.DB { return config.DB }, interval)
+	})
+	return ruleEngine
+}
+
+// newRuleEngine creates a rule engine with an empty snapshot that reloads the rules from db
+// on request and every reloadInterval
+func newRuleEngine(db func() *gorm.DB, reloadInterval time.Duration) *RuleEngine {
+	ctx, cancel := context.WithCancel(context.Background())
+	re := &RuleEngine{
+		reload: make(chan struct{}, 1),
+		db:     db,
+		ctx:    ctx,
+		cancel: cancel,
+	}
+	re.snapshot.Store(BuildRuleSnapshot(RuleSet{}))
+	re.start(reloadInterval)
+	return re
+}
+
+// Snapshot returns the current rule snapshot (never nil)
+func (re *RuleEngine) Snapshot() *RuleSnapshot {
+	return re.snapshot.Load()
+}
+
+// Load rebuilds the snapshot from the database and swaps it in
+func (re *RuleEngine) Load(db *gorm.DB) error {
+	_, err := re.load(db)
+	return err
+}
+
+// load rebuilds the snapshot and reports whether the rules differ from the previous load.
+// The snapshot is rebuilt either way, rules may have entered or left their validity window.
+func (re *RuleEngine) load(db *gorm.DB) (bool, error) {
+	re.mu.Lock()
+	defer re.mu.Unlock()
+
+	start := time.Now()
+	set, err := LoadRuleSet(db)
+	if err != nil {
+		return false, err
+	}
+	snapshot := BuildRuleSnapshot(set)
+	re.snapshot.Store(snapshot)
+
+	changed := true
+	if data, err := json.Marshal(set); err == nil {
+		hash := sha256.Sum256(data)
+		changed = hash != re.rules
+		re.rules = hash
+	}
+
+	// Rebuild as soon as a rule enters or leaves its validity window, without waiting for the janitor
+	if re.expiry != nil {
+		re.expiry.Stop()
+		re.expiry = nil
+	}
+	if !snapshot.nextChange.IsZero() && re.ctx.Err() == nil {
+		re.expiry = time.AfterFunc(time.Until(snapshot.nextChange), re.RequestReload)
+	}
+
+	log.Printf("Rule engine: compiled %d ips, %d cidrs, %d ranges, %d emails, %d email domains, %d user agents, %d usernames, %d countries, %d asns, %d charsets, %d content rules, %d velocity rules, %d composite rules, %d expression rules, %d geo rules, %d country groups, %d monitor rules in %v (skipped %d, inactive %d)",
+		len(snapshot.ipExact), snapshot.ipCIDRs.Len(), snapshot.rangeCount, snapshot.emails.len(), snapshot.domains.len(), snapshot.userAgents.len(),
+		snapshot.usernames.len(), len(snapshot.countries), len(snapshot.asns), len(snapshot.charsets), snapshot.contents.len(),
+		snapshot.velocity.len(), snapshot.composite.len(), snapshot.expression.len(), snapshot.geo.len(), snapshot.groups.len(), snapshot.Monitor().len(), time.Since(start), snapshot.skipped, snapshot.inactive)
+	return changed, nil
+}
+
+// minRefreshInterval limits how often Refresh reads the rules from MySQL
+const minRefreshInterval = 5 * time.Second
+
+// Refresh rebuilds the snapshot from the database right away; it is the MySQL fallback
+// of failed filters. Within minRefreshInterval of the last attempt the previous outcome
+// is returned, so a failing backend does not turn every request into a full reload.
+// The filter cache is only cleared when the reload found changed rules.
+func (re *RuleEngine) Refresh(db *gorm.DB) error {
+	re.refreshMu.Lock()
+	defer re.refreshMu.Unlock()
+
+	if time.Since(re.lastRefresh) < minRefreshInterval {
+		return re.refreshErr
+	}
+	re.lastRefresh = time.Now()
+	if db == nil {
+		re.refreshErr = fmt.Errorf("database not initialized")
+		return re.refreshErr
+	}
+	re.refreshErr = re.reloadFrom(db, true)
+	return re.refreshErr
+}
+
+// RequestReload schedules an asynchronous rebuild; bursts are coalesced
+func (re *RuleEngine) RequestReload() {
+	select {
+	case re.reload <- struct{}{}:
+	default:
+	}
+}
+
+// reloadFrom rebuilds the snapshot and clears the filter cache, as cached decisions may have
+// been computed against the old snapshot. With onlyChanged the cache is kept when the rules
+// did not change.
+func (re *RuleEngine) reloadFrom(db *gorm.DB, onlyChanged bool) error {
+	changed, err := re.load(db)
+	if err != nil {
+		return err
+	}
+	if changed || !onlyChanged {
+		GetCacheFactory().InvalidatePattern("filter:")
+	}
+	return nil
+}
+
+// start begins the reload worker. Besides the requested reloads, which only follow the rule
+// changes of this instance, it reloads every interval to pick up the changes made by other
+// instances (e.g. escalation bans and janitor runs) and reloads that were dropped.
+func (re *RuleEngine) start(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	re.wg.Add(1)
+	go func() {
+		defer re.wg.Done()
+		defer ticker.Stop()
+		for {
+			onlyChanged := false
+			select {
+			case <-re.reload:
+			case <-ticker.C:
+				onlyChanged = true
+			case <-re.ctx.Done():
+				return
+			}
+			db := re.db()
+			if db == nil {
+				continue
+			}
+			if err := re.reloadFrom(db, onlyChanged); err != nil {
+				log.Printf("Rule engine: reload failed, keeping previous snapshot: %v", err)
+			}
+		}
+	}()
+}
+
+// Stop gracefully stops the rule engine
+func (re *RuleEngine) Stop() {
+	re.cancel()
+	re.wg.Wait()
+	re.mu.Lock()
+	if re.expiry != nil {
+		re.expiry.Stop()
+	}
+	re.mu.Unlock()
+	log.Println("Rule engine stopped")
+}
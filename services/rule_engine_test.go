@@ -0,0 +1,471 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"firewall/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// ============================================================================
+// RULE SNAPSHOT TESTS
+// ============================================================================
+
+func TestRuleSnapshot_MatchIP(t *testing.T) {
+	snapshot := BuildRuleSnapshot(RuleSet{
+		IPs: []models.IP{
+			{ID: 1, Address: "10.0.0.0/8", Status: "denied", IsCIDR: true},
+			{ID: 2, Address: "10.1.0.0/16", Status: "whitelisted", IsCIDR: true},
+			{ID: 3, Address: "10.1.2.3", Status: "allowed"},
+			{ID: 4, Address: "2001:db8::/32", Status: "denied", IsCIDR: true},
+			{ID: 5, Address: "not-an-ip", Status: "denied"},
+		},
+	})
+
+	testCases := []struct {
+		ip       string
+		ruleID   uint
+		isCIDR   bool
+		hasMatch bool
+	}{
+		{"10.1.2.3", 3, false, true},       // exact match beats CIDR
+		{"10.1.9.9", 2, true, true},        // longest prefix wins
+		{"10.2.0.1", 1, true, true},        // outer block
+		{"::ffff:10.2.0.1", 1, true, true}, // IPv4-mapped IPv6
+		{"2001:db8:1::1", 4, true, true},   // IPv6 block
+		{"2001:db9::1", 0, false, false},   // outside IPv6 block
+		{"192.168.1.1", 0, false, false},   // no rule
+		{"invalid", 0, false, false},       // invalid input
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.ip, func(t *testing.T) {
+			rule := snapshot.MatchIP(tc.ip)
+			if !tc.hasMatch {
+				assert.Nil(t, rule)
+				return
+			}
+			assert.NotNil(t, rule)
+			assert.Equal(t, tc.ruleID, rule.ID)
+			assert.Equal(t, tc.isCIDR, rule.Type == "cidr")
+		})
+	}
+
+	assert.Equal(t, 1, snapshot.Stats()["skipped"])
+}
+
+func TestRuleSnapshot_MatchIP_ManyCIDRs(t *testing.T) {
+	// More than the 10 hits an Elasticsearch search returns by default
+	var ips []models.IP
+	for i := 0; i < 50; i++ {
+		ips = append(ips, models.IP{ID: uint(i + 1), Address: fmt.Sprintf("172.16.%d.0/24", i), Status: "denied", IsCIDR: true})
+	}
+	snapshot := BuildRuleSnapshot(RuleSet{IPs: ips})
+
+	rule := snapshot.MatchIP("172.16.49.200")
+	assert.NotNil(t, rule)
+	assert.Equal(t, "cidr", rule.Type)
+	assert.Equal(t, uint(50), rule.ID)
+}
+
+func TestRuleSnapshot_MatchIP_Ranges(t *testing.T) {
+	snapshot := BuildRuleSnapshot(RuleSet{
+		IPs: []models.IP{
+			{ID: 1, Address: "203.0.113.7-203.0.113.90", Status: "denied", IsRange: true},
+			{ID: 2, Address: "203.0.113.0/24", Status: "allowed", IsCIDR: true},
+			{ID: 3, Address: "203.0.113.64/28", Status: "whitelisted", IsCIDR: true},
+			{ID: 4, Address: "2001:db8::10-2001:db8::1f", Status: "denied", IsRange: true},
+			{ID: 5, Address: "203.0.113.90-203.0.113.7", Status: "denied", IsRange: true},
+		},
+	})
+
+	testCases := []struct {
+		ip     string
+		ruleID uint
+	}{
+		{"203.0.113.7", 1},  // first address of the range
+		{"203.0.113.90", 1}, // last address of the range
+		{"203.0.113.91", 2}, // outside the range
+		{"203.0.113.6", 2},  // outside the range
+		{"203.0.113.70", 3}, // a longer prefix beats the range's covering /25
+		{"2001:db8::1a", 4}, // IPv6 range
+		{"2001:db8::20", 0}, // outside the IPv6 range
+		{"::ffff:203.0.113.8", 1},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.ip, func(t *testing.T) {
+			rule := snapshot.MatchIP(tc.ip)
+			if tc.ruleID == 0 {
+				assert.Nil(t, rule)
+				return
+			}
+			if assert.NotNil(t, rule) {
+				assert.Equal(t, tc.ruleID, rule.ID)
+			}
+		})
+	}
+
+	stats := snapshot.Stats()
+	assert.Equal(t, 2, stats["ranges"])
+	assert.Equal(t, 1, stats["skipped"])
+
+	engine := GetRuleEngine()
+	previous := engine.Snapshot()
+	defer engine.snapshot.Store(previous)
+	engine.snapshot.Store(snapshot)
+
+	result := ipFilter{}.Evaluate(context.Background(), &FilterInput{IP: "203.0.113.20"})
+	assert.Equal(t, "denied", result.Result)
+	assert.Equal(t, "ip range denied", result.Reason)
+	assert.Equal(t, uint(1), result.RuleID)
+}
+
+func TestRuleSnapshot_MatchPatterns(t *testing.T) {
+	var emails []models.Email
+	for i := 0; i < 20; i++ {
+		emails = append(emails, models.Email{ID: uint(i + 1), Address: fmt.Sprintf(`^spam%d@.*$`, i), Status: "denied", IsRegex: true})
+	}
+	emails = append(emails,
+		models.Email{ID: 100, Address: "Exact@Example.com", Status: "whitelisted"},
+		models.Email{ID: 101, Address: "([invalid", Status: "denied", IsRegex: true},
+	)
+
+	snapshot := BuildRuleSnapshot(RuleSet{
+		Emails:     emails,
+		UserAgents: []models.UserAgent{{ID: 1, UserAgent: "(?i)curl", Status: "denied", IsRegex: true}},
+		Usernames:  []models.UsernameRule{{ID: 1, Username: "admin", Status: "denied"}},
+		Countries:  []models.Country{{ID: 1, Code: "ru", Status: "denied"}},
+		ASNs:       []models.ASN{{ID: 1, ASN: "AS12345", Status: "denied"}},
+	})
+
+	rule := snapshot.MatchEmail("spam19@example.com")
+	assert.NotNil(t, rule)
+	assert.Equal(t, "regex", rule.Type)
+	assert.Equal(t, uint(20), rule.ID)
+
+	rule = snapshot.MatchEmail("exact@example.com")
+	assert.NotNil(t, rule)
+	assert.Equal(t, "exact", rule.Type)
+	assert.Equal(t, "whitelisted", rule.Status)
+
+	rule = snapshot.MatchUserAgent("CURL/8.0")
+	assert.NotNil(t, rule)
+
+	rule = snapshot.MatchUsername("admin")
+	assert.NotNil(t, rule)
+	rule = snapshot.MatchUsername("Admin")
+	assert.Nil(t, rule)
+
+	assert.NotNil(t, snapshot.MatchCountry("RU"))
+	assert.Nil(t, snapshot.MatchCountry("DE"))
+	assert.NotNil(t, snapshot.MatchASN("as12345"))
+	assert.Equal(t, 1, snapshot.Stats()["skipped"])
+}
+
+func TestRuleSnapshot_Priority(t *testing.T) {
+	snapshot := BuildRuleSnapshot(RuleSet{
+		IPs: []models.IP{
+			{ID: 1, Address: "10.0.0.0/8", Status: "whitelisted", IsCIDR: true, Priority: 10},
+			{ID: 2, Address: "10.1.0.0/16", Status: "denied", IsCIDR: true},
+			{ID: 3, Address: "10.1.2.3", Status: "denied"},
+			{ID: 4, Address: "192.0.2.0/24", Status: "denied", IsCIDR: true},
+			{ID: 5, Address: "192.0.2.0/24", Status: "whitelisted", IsCIDR: true},
+		},
+		Emails: []models.Email{
+			{ID: 1, Address: "boss@example.com", Status: "denied"},
+			{ID: 2, Address: `.*@example\.com$`, Status: "whitelisted", IsRegex: true, Priority: 5},
+			{ID: 3, Address: `^admin@.*$`, Status: "denied", IsRegex: true},
+		},
+	})
+
+	// A shorter prefix with a higher priority beats longer prefixes and exact rules
+	assert.Equal(t, uint(1), snapshot.MatchIP("10.1.2.3").ID)
+	// Same priority on an identical prefix: the lower ID wins
+	assert.Equal(t, uint(4), snapshot.MatchIP("192.0.2.1").ID)
+
+	// A regex with a higher priority beats an exact rule
+	assert.Equal(t, uint(2), snapshot.MatchEmail("boss@example.com").ID)
+	// Lower priority regexes still match when nothing outranks them
+	assert.Equal(t, uint(3), snapshot.MatchEmail("admin@example.org").ID)
+
+	// Without priorities the most specific rule wins
+	snapshot = BuildRuleSnapshot(RuleSet{
+		IPs: []models.IP{
+			{ID: 1, Address: "10.0.0.0/8", Status: "whitelisted", IsCIDR: true},
+			{ID: 2, Address: "10.1.0.0/16", Status: "denied", IsCIDR: true},
+			{ID: 3, Address: "10.1.2.3", Status: "allowed"},
+		},
+	})
+	assert.Equal(t, uint(3), snapshot.MatchIP("10.1.2.3").ID)
+	assert.Equal(t, uint(2), snapshot.MatchIP("10.1.9.9").ID)
+}
+
+func TestRuleSnapshot_MatchEmailDomain(t *testing.T) {
+	snapshot := BuildRuleSnapshot(RuleSet{
+		Emails: []models.Email{
+			{ID: 1, Address: "ceo@mailinator.com", Status: "whitelisted"},
+			{ID: 2, Address: `^noreply@`, Status: "whitelisted", IsRegex: true},
+		},
+		Domains: []models.EmailDomainRule{
+			{ID: 1, Domain: "*.mailinator.com", Status: "denied"},
+			{ID: 2, Domain: "*.XYZ.", Status: "denied"},
+			{ID: 3, Domain: "good.xyz", Status: "allowed"},
+			{ID: 4, Domain: "*.trusted.mailinator.com", Status: "whitelisted"},
+			{ID: 5, Domain: "gmail.com", Status: "denied"},
+			{ID: 6, Domain: "*.", Status: "denied"},
+		},
+	})
+	assert.Equal(t, 5, snapshot.Stats()["domains"])
+	assert.Equal(t, 1, snapshot.Stats()["skipped"])
+
+	tests := []struct {
+		email    string
+		id       uint
+		ruleType string
+	}{
+		{"someone@mailinator.com", 1, "subdomain"},       // The wildcard includes the domain itself
+		{"someone@eu.mx.mailinator.com", 1, "subdomain"}, // and all of its subdomains
+		{"someone@a.trusted.mailinator.com", 4, "subdomain"},
+		{"ceo@mailinator.com", 1, "exact"}, // An address beats its domain
+		{"noreply@mailinator.com", 1, "subdomain"},
+		{"someone@shop.xyz", 2, "subdomain"},
+		{"someone@good.xyz", 3, "domain"},
+		{"someone@sub.good.xyz", 2, "subdomain"},
+		{"someone@gmail.com", 5, "domain"},
+		{"someone@mail.gmail.com", 0, ""}, // Domain rules without a wildcard do not match subdomains
+		{"someone@notmailinator.com", 0, ""},
+		{"not-an-address", 0, ""},
+	}
+	for _, tt := range tests {
+		rule := snapshot.MatchEmail(tt.email)
+		if tt.id == 0 {
+			assert.Nil(t, rule, tt.email)
+			continue
+		}
+		if assert.NotNil(t, rule, tt.email) {
+			assert.Equal(t, tt.ruleType, rule.Type, tt.email)
+			if tt.ruleType != "exact" {
+				assert.Equal(t, tt.id, rule.ID, tt.email)
+			}
+		}
+	}
+}
+
+func TestEvaluateFilters_EmailDomain(t *testing.T) {
+	engine := GetRuleEngine()
+	previous := engine.Snapshot()
+	defer engine.snapshot.Store(previous)
+
+	engine.snapshot.Store(BuildRuleSnapshot(RuleSet{
+		Domains: []models.EmailDomainRule{{ID: 7, Domain: "gmail.com", Status: "denied"}},
+	}))
+
+	// The filter endpoint passes addresses through the Gmail normalization first
+	result, err := EvaluateFilters(context.Background(), "", "johndoe@gmail.com", "", "US", "", "")
+	assert.NoError(t, err)
+	assert.Equal(t, "denied", result.Result)
+	assert.Equal(t, "email domain denied", result.Reason)
+	assert.Equal(t, uint(7), result.RuleID)
+	assert.Equal(t, "domain", result.RuleType)
+}
+
+func TestRuleSnapshot_ValidityWindow(t *testing.T) {
+	now := time.Now()
+	past, soon, later := now.Add(-time.Hour), now.Add(time.Hour), now.Add(2*time.Hour)
+
+	snapshot := BuildRuleSnapshot(RuleSet{
+		IPs: []models.IP{
+			{ID: 1, Address: "10.0.0.1", Status: "denied", RuleValidity: models.RuleValidity{ExpiresAt: &past}},
+			{ID: 2, Address: "10.0.0.2", Status: "denied", RuleValidity: models.RuleValidity{ExpiresAt: &later}},
+			{ID: 3, Address: "10.0.0.3", Status: "denied", RuleValidity: models.RuleValidity{ValidFrom: &soon}},
+			{ID: 4, Address: "10.0.0.4", Status: "denied", RuleValidity: models.RuleValidity{ValidFrom: &past, ExpiresAt: &later}},
+		},
+		Emails: []models.Email{
+			{ID: 5, Address: "spam@example.com", Status: "monitor", RuleValidity: models.RuleValidity{ExpiresAt: &past}},
+		},
+	})
+
+	assert.Nil(t, snapshot.MatchIP("10.0.0.1"), "expired rule")
+	assert.Equal(t, uint(2), snapshot.MatchIP("10.0.0.2").ID)
+	assert.Nil(t, snapshot.MatchIP("10.0.0.3"), "rule not yet valid")
+	assert.Equal(t, uint(4), snapshot.MatchIP("10.0.0.4").ID)
+	assert.Nil(t, snapshot.Monitor().MatchEmail("spam@example.com"), "expired monitor rule")
+
+	stats := snapshot.Stats()
+	assert.Equal(t, 3, stats["inactive"])
+	assert.Equal(t, soon, stats["next_change"]) // Rule 3 becomes valid before rules 2 and 4 expire
+}
+
+func TestRuleValidity_NextChange(t *testing.T) {
+	now := time.Now()
+	past, soon, later := now.Add(-time.Hour), now.Add(time.Hour), now.Add(2*time.Hour)
+
+	assert.True(t, models.RuleValidity{}.NextChange(now).IsZero())
+	assert.True(t, models.RuleValidity{ValidFrom: &past}.NextChange(now).IsZero())
+	assert.Equal(t, later, models.RuleValidity{ValidFrom: &past, ExpiresAt: &later}.NextChange(now))
+	assert.Equal(t, soon, models.RuleValidity{ValidFrom: &soon, ExpiresAt: &later}.NextChange(now))
+	assert.False(t, models.RuleValidity{ExpiresAt: &now}.ActiveAt(now), "expires_at is exclusive")
+	assert.True(t, models.RuleValidity{ValidFrom: &now}.ActiveAt(now), "valid_from is inclusive")
+}
+
+func TestResolveVerdicts(t *testing.T) {
+	verdicts := []FilterVerdict{
+		{Filter: "ip", FilterResult: FilterResult{Result: "denied", RuleID: 1, Priority: 1}},
+		{Filter: "email", FilterResult: FilterResult{Result: "whitelisted", RuleID: 2}},
+		{Filter: "country", FilterResult: FilterResult{Result: "allowed", RuleID: 3, Priority: 5}},
+		{Filter: "asn", FilterResult: FilterResult{Result: "allowed"}},
+	}
+
+	assert.Equal(t, uint(2), resolveVerdicts(verdicts, ResolutionAllowOverrides).RuleID)
+	assert.Equal(t, uint(1), resolveVerdicts(verdicts, ResolutionDenyOverrides).RuleID)
+	assert.Equal(t, uint(3), resolveVerdicts(verdicts, ResolutionFirstMatchByPriority).RuleID)
+
+	// Equal priorities fall back to filter order
+	verdicts[2].Priority = 1
+	assert.Equal(t, uint(1), resolveVerdicts(verdicts, ResolutionFirstMatchByPriority).RuleID)
+
+	// Unknown strategies behave like allow-overrides
+	assert.Equal(t, uint(2), resolveVerdicts(verdicts, "").RuleID)
+
+	assert.Equal(t, "allowed", resolveVerdicts(nil, ResolutionDenyOverrides).Result)
+}
+
+// ============================================================================
+// RULE ENGINE TESTS
+// ============================================================================
+
+func TestEvaluateFilters_UsesRuleSnapshot(t *testing.T) {
+	engine := GetRuleEngine()
+	previous := engine.Snapshot()
+	defer engine.snapshot.Store(previous)
+
+	engine.snapshot.Store(BuildRuleSnapshot(RuleSet{
+		IPs:       []models.IP{{ID: 1, Address: "203.0.113.0/24", Status: "denied", IsCIDR: true}},
+		Usernames: []models.UsernameRule{{ID: 1, Username: "^vip-", Status: "whitelisted", IsRegex: true}},
+	}))
+
+	ctx := context.Background()
+
+	result, err := EvaluateFilters(ctx, "203.0.113.7", "", "", "US", "AS1", "")
+	assert.NoError(t, err)
+	assert.Equal(t, "denied", result.Result)
+	assert.Equal(t, "ip cidr denied", result.Reason)
+
+	result, err = EvaluateFilters(ctx, "203.0.113.7", "", "", "US", "AS1", "vip-anna")
+	assert.NoError(t, err)
+	assert.Equal(t, "whitelisted", result.Result)
+	assert.Equal(t, "username regex whitelisted", result.Reason)
+
+	result, err = EvaluateFilters(ctx, "198.51.100.1", "", "", "US", "AS1", "")
+	assert.NoError(t, err)
+	assert.Equal(t, "allowed", result.Result)
+}
+
+func TestRuleEngine_RequestReloadCoalesces(t *testing.T) {
+	engine := GetRuleEngine()
+
+	// Must never block, even when a reload is already pending
+	for i := 0; i < 10; i++ {
+		engine.RequestReload()
+	}
+	assert.NotNil(t, engine.Snapshot())
+}
+
+// tableDB is a database/sql driver that answers "SELECT * FROM `table`" with the rows of
+// an in-memory table; every other table is empty
+type tableDB struct {
+	mu      sync.Mutex
+	columns map[string][]string
+	rows    map[string][][]driver.Value
+}
+
+func (d *tableDB) insert(table string, columns []string, values ...driver.Value) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.columns[table] = columns
+	d.rows[table] = append(d.rows[table], values)
+}
+
+func (d *tableDB) Open(string) (driver.Conn, error) { return tableConn{d}, nil }
+
+type tableConn struct{ db *tableDB }
+
+func (c tableConn) Prepare(query string) (driver.Stmt, error) { return tableStmt{c.db, query}, nil }
+func (c tableConn) Close() error                              { return nil }
+func (c tableConn) Begin() (driver.Tx, error)                 { return nil, fmt.Errorf("not supported") }
+
+type tableStmt struct {
+	db    *tableDB
+	query string
+}
+
+func (s tableStmt) Close() error  { return nil }
+func (s tableStmt) NumInput() int { return -1 }
+func (s tableStmt) Exec([]driver.Value) (driver.Result, error) {
+	return nil, fmt.Errorf("not supported")
+}
+
+func (s tableStmt) Query([]driver.Value) (driver.Rows, error) {
+	table := s.query[strings.Index(s.query, "`")+1:]
+	table = table[:strings.Index(table, "`")]
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	return &tableRows{columns: s.db.columns[table], rows: append([][]driver.Value(nil), s.db.rows[table]...)}, nil
+}
+
+type tableRows struct {
+	columns []string
+	rows    [][]driver.Value
+}
+
+func (r *tableRows) Columns() []string { return r.columns }
+func (r *tableRows) Close() error      { return nil }
+func (r *tableRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
+
+// newTableDB returns an empty tableDB and a gorm connection to it
+func newTableDB(t *testing.T) (*tableDB, *gorm.DB) {
+	db := &tableDB{columns: make(map[string][]string), rows: make(map[string][][]driver.Value)}
+	name := "tabledb-" + t.Name()
+	sql.Register(name, db)
+	conn, err := sql.Open(name, "")
+	require.NoError(t, err)
+	gormDB, err := gorm.Open(mysql.New(mysql.Config{Conn: conn, SkipInitializeWithVersion: true}), &gorm.Config{Logger: logger.Discard})
+	require.NoError(t, err)
+	return db, gormDB
+}
+
+func TestRuleEngine_PeriodicReload(t *testing.T) {
+	db, gormDB := newTableDB(t)
+	engine := newRuleEngine(func() *gorm.DB { return gormDB }, 20*time.Millisecond)
+	defer engine.Stop()
+	assert.Nil(t, engine.Snapshot().MatchIP("198.51.100.9"))
+
+	// Written by another instance: no event reaches this one
+	db.insert("ips", []string{"id", "address", "status"}, int64(1), "198.51.100.9", "denied")
+
+	assert.Eventually(t, func() bool {
+		rule := engine.Snapshot().MatchIP("198.51.100.9")
+		return rule != nil && rule.Status == "denied"
+	}, time.Second, 10*time.Millisecond)
+}
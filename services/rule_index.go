@@ -0,0 +1,200 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"firewall/config"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+)
+
+// Rule index backends, selected with search.backend
+const (
+	SearchBackendElasticsearch = "elasticsearch"
+	SearchBackendMemory        = "memory" // In-process, for single-node deployments and tests
+)
+
+// Rule index names. These are the only index names in the code base, the Elasticsearch
+// backend prepends elastic.index to them (see elasticsearchRuleIndex.indexName).
+const (
+	IndexIPs          = "ip-addresses"
+	IndexEmails       = "emails"
+	IndexUserAgents   = "user-agents"
+	IndexCountries    = "countries"
+	IndexCharsets     = "charsets"
+	IndexUsernames    = "usernames"
+	IndexEmailDomains = "email_domains"
+	IndexContentRules = "content_rules"
+	IndexASNs         = "asns"
+)
+
+// RuleDocument is a rule as stored in a RuleIndex
+type RuleDocument struct {
+	ID      string                 `json:"id"`
+	Source  map[string]interface{} `json:"source"`
+	Version int64                  `json:"version,omitempty"` // updated_at of the rule (see documentVersion), 0 if unversioned
+}
+
+// BulkFailure is a document a bulk request could not store
+type BulkFailure struct {
+	ID  string
+	Err error
+}
+
+// Reindex phases, in the order a rebuild passes through them
+const (
+	ReindexPhaseCreating  = "creating"  // Creating the new index version
+	ReindexPhaseLoading   = "loading"   // Reading the rules from MySQL
+	ReindexPhaseIndexing  = "indexing"  // Bulk loading the documents
+	ReindexPhaseVerifying = "verifying" // Comparing the document count with MySQL
+	ReindexPhaseSwapping  = "swapping"  // Switching readers to the new version
+	ReindexPhaseDone      = "done"
+)
+
+// ReindexProgressFunc receives the phase of a rebuild, the number of documents indexed so far and
+// the number of documents to index
+type ReindexProgressFunc func(phase string, indexed, total int)
+
+// RuleIndex stores searchable copies of the rules next to MySQL. MySQL stays the source of
+// truth and the filters match against the rule engine, so every backend can be rebuilt from it.
+type RuleIndex interface {
+	// Backend returns the name of the backend, "elasticsearch" or "memory"
+	Backend() string
+	// Upsert creates or replaces a document; a versioned document does not replace a newer version
+	Upsert(ctx context.Context, index string, doc RuleDocument) error
+	// BulkUpsert creates or replaces documents in one request. It returns the documents that
+	// failed, a document that is older than the stored one is skipped; an error means the
+	// request as a whole failed.
+	BulkUpsert(ctx context.Context, index string, docs []RuleDocument) ([]BulkFailure, error)
+	// Delete removes a document; a missing document is not an error
+	Delete(ctx context.Context, index, id string) error
+	// Recreate drops an index and creates it empty
+	Recreate(ctx context.Context, index string) error
+	// Reindex builds a new version of an index from the documents load returns and switches
+	// readers over once it holds as many documents as count reports; until then the current
+	// version keeps serving. load is called once the new version receives the writes as well,
+	// so no change is lost between the two. It returns the name of the new version.
+	Reindex(ctx context.Context, index string, load func() ([]RuleDocument, error), count func() (int64, error), progress ReindexProgressFunc) (string, error)
+	// Ping checks that the backend is reachable
+	Ping(ctx context.Context) error
+	// Setup prepares the backend at startup, e.g. installs the index templates
+	Setup(ctx context.Context) error
+	// CheckMappings reports indices whose mapping differs from the one the application expects
+	// as a *MappingMismatchError; other errors mean the check itself failed
+	CheckMappings(ctx context.Context) error
+}
+
+// MappingMismatchError lists the indices whose mapping differs from the expected one
+type MappingMismatchError struct {
+	Mismatches []string
+}
+
+func (e *MappingMismatchError) Error() string {
+	return strings.Join(e.Mismatches, "; ")
+}
+
+var (
+	ruleIndex   RuleIndex
+	ruleIndexMu sync.RWMutex
+)
+
+// InitRuleIndex creates the rule index configured in search.backend; the Elasticsearch
+// client is only initialized for the elasticsearch backend
+func InitRuleIndex() error {
+	backend, prefix := SearchBackendElasticsearch, ""
+	if config.AppConfig != nil {
+		if config.AppConfig.Search.Backend != "" {
+			backend = config.AppConfig.Search.Backend
+		}
+		prefix = config.AppConfig.Elastic.Index
+	}
+
+	switch backend {
+	case SearchBackendMemory:
+		SetRuleIndex(NewMemoryRuleIndex())
+	case SearchBackendElasticsearch:
+		if err := config.InitElasticsearch(); err != nil {
+			return err
+		}
+		SetRuleIndex(NewElasticsearchRuleIndex(config.ESClient, prefix))
+	default:
+		return fmt.Errorf("unknown search backend: %s", backend)
+	}
+	log.Printf("Rule index backend: %s", backend)
+
+	// Elasticsearch may not be reachable yet; the health check reports missing templates and mappings
+	if err := GetRuleIndex().Setup(context.Background()); err != nil {
+		log.Printf("Warning: rule index setup failed: %v", err)
+	}
+	if err := RefreshMappingStatus(context.Background()); err != nil {
+		log.Printf("Warning: rule index mapping check failed: %v", err)
+	}
+	return nil
+}
+
+// SetRuleIndex replaces the rule index
+func SetRuleIndex(index RuleIndex) {
+	ruleIndexMu.Lock()
+	defer ruleIndexMu.Unlock()
+	ruleIndex = index
+	resetMappingStatus()
+}
+
+// GetRuleIndex returns the rule index; without InitRuleIndex (e.g. in tests) it is an in-process index
+func GetRuleIndex() RuleIndex {
+	ruleIndexMu.RLock()
+	index := ruleIndex
+	ruleIndexMu.RUnlock()
+	if index != nil {
+		return index
+	}
+
+	ruleIndexMu.Lock()
+	defer ruleIndexMu.Unlock()
+	if ruleIndex == nil {
+		ruleIndex = NewMemoryRuleIndex()
+	}
+	return ruleIndex
+}
+
+// mappingStatus caches the outcome of CheckMappings for the health check, the check costs a
+// request per index. Mappings only change with the templates and new index versions, so it is
+// refreshed at startup and after a reindex.
+var mappingStatus struct {
+	sync.Mutex
+	checked bool
+	err     error
+}
+
+// RefreshMappingStatus checks the mappings of the rule index and caches the outcome. A check
+// that fails (e.g. Elasticsearch is unreachable) is not cached, MappingStatus runs it again.
+func RefreshMappingStatus(ctx context.Context) error {
+	err := GetRuleIndex().CheckMappings(ctx)
+	var mismatch *MappingMismatchError
+
+	mappingStatus.Lock()
+	defer mappingStatus.Unlock()
+	mappingStatus.checked = err == nil || errors.As(err, &mismatch)
+	mappingStatus.err = err
+	return err
+}
+
+// MappingStatus returns the cached outcome of the mapping check, checking first if there is none
+func MappingStatus(ctx context.Context) error {
+	mappingStatus.Lock()
+	checked, err := mappingStatus.checked, mappingStatus.err
+	mappingStatus.Unlock()
+	if checked {
+		return err
+	}
+	return RefreshMappingStatus(ctx)
+}
+
+func resetMappingStatus() {
+	mappingStatus.Lock()
+	defer mappingStatus.Unlock()
+	mappingStatus.checked = false
+	mappingStatus.err = nil
+}
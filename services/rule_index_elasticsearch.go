@@ -0,0 +1,147 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v8"
+	"github.com/elastic/go-elasticsearch/v8/esapi"
+)
+
+// elasticsearchRuleIndex stores the rule documents in Elasticsearch. Each index name is an
+// alias of a versioned index (ip-addresses -> ip-addresses-v3) so it can be rebuilt in place.
+type elasticsearchRuleIndex struct {
+	client *elasticsearch.Client
+	prefix string // elastic.index, keeps environments sharing a cluster apart
+
+	mu         sync.Mutex
+	rebuilding map[string]string // index -> version being built, receives writes as well
+}
+
+// NewElasticsearchRuleIndex returns a rule index backed by an Elasticsearch client; a non-empty
+// prefix is prepended to every index name
+func NewElasticsearchRuleIndex(client *elasticsearch.Client, prefix string) RuleIndex {
+	return &elasticsearchRuleIndex{client: client, prefix: prefix, rebuilding: make(map[string]string)}
+}
+
+// indexName resolves a rule index name (IndexIPs, ...) to the alias in the cluster
+func (e *elasticsearchRuleIndex) indexName(index string) string {
+	if e.prefix == "" {
+		return index
+	}
+	return e.prefix + "-" + index
+}
+
+func (e *elasticsearchRuleIndex) Backend() string { return SearchBackendElasticsearch }
+
+// do runs a request; status codes listed in ignore are not an error
+func (e *elasticsearchRuleIndex) do(ctx context.Context, req esapi.Request, action string, ignore ...int) (*esapi.Response, error) {
+	if e.client == nil {
+		return nil, fmt.Errorf("elasticsearch client not initialized")
+	}
+	res, err := req.Do(ctx, e.client)
+	if err != nil {
+		return nil, err
+	}
+	if res.IsError() {
+		for _, status := range ignore {
+			if res.StatusCode == status {
+				return res, nil
+			}
+		}
+		defer res.Body.Close()
+		return nil, fmt.Errorf("failed to %s: %s", action, res.String())
+	}
+	return res, nil
+}
+
+func (e *elasticsearchRuleIndex) Upsert(ctx context.Context, index string, doc RuleDocument) error {
+	body, err := json.Marshal(doc.Source)
+	if err != nil {
+		return err
+	}
+	return e.write(index, func(name string, rebuild bool) error {
+		req := esapi.IndexRequest{Index: name, DocumentID: doc.ID, Body: bytes.NewReader(body)}
+		if doc.Version > 0 {
+			version := int(doc.Version)
+			req.Version, req.VersionType = &version, "external"
+		}
+		// A version conflict means a newer version of the rule is stored already
+		res, err := e.do(ctx, req, "index "+name+"/"+doc.ID, 409)
+		if err != nil {
+			return err
+		}
+		return res.Body.Close()
+	})
+}
+
+func (e *elasticsearchRuleIndex) BulkUpsert(ctx context.Context, index string, docs []RuleDocument) ([]BulkFailure, error) {
+	failures, err := e.bulkRequest(ctx, e.indexName(index), docs)
+	if err != nil {
+		return nil, err
+	}
+	e.mu.Lock()
+	target := e.rebuilding[index]
+	e.mu.Unlock()
+	if target != "" {
+		if _, err := e.bulkRequest(ctx, target, docs); err != nil {
+			log.Printf("Failed to apply bulk request to %s during rebuild: %v", target, err)
+		}
+	}
+	return failures, nil
+}
+
+func (e *elasticsearchRuleIndex) Delete(ctx context.Context, index, id string) error {
+	version := int(time.Now().UnixNano())
+	return e.write(index, func(name string, rebuild bool) error {
+		req := esapi.DeleteRequest{Index: name, DocumentID: id}
+		if rebuild {
+			// The versioned delete leaves a tombstone, so the bulk load of the rebuild cannot
+			// bring back a document that was loaded from MySQL before it was deleted
+			req.Version, req.VersionType = &version, "external"
+		}
+		res, err := e.do(ctx, req, "delete "+name+"/"+id, 404, 409)
+		if err != nil {
+			return err
+		}
+		return res.Body.Close()
+	})
+}
+
+// write applies a change to the index and, during a rebuild, to the version being built, so
+// changes made while it is loaded are not lost by the alias swap
+func (e *elasticsearchRuleIndex) write(index string, apply func(name string, rebuild bool) error) error {
+	if err := apply(e.indexName(index), false); err != nil {
+		return err
+	}
+	e.mu.Lock()
+	target := e.rebuilding[index]
+	e.mu.Unlock()
+	if target != "" {
+		if err := apply(target, true); err != nil {
+			// The count verification fails the rebuild, the current version stays in place
+			log.Printf("Failed to apply change to %s during rebuild: %v", target, err)
+		}
+	}
+	return nil
+}
+
+// Recreate switches the index to a new, empty version
+func (e *elasticsearchRuleIndex) Recreate(ctx context.Context, index string) error {
+	empty := func() ([]RuleDocument, error) { return nil, nil }
+	_, err := e.Reindex(ctx, index, empty, func() (int64, error) { return 0, nil }, nil)
+	return err
+}
+
+func (e *elasticsearchRuleIndex) Ping(ctx context.Context) error {
+	res, err := e.do(ctx, esapi.PingRequest{}, "ping elasticsearch")
+	if err != nil {
+		return err
+	}
+	return res.Body.Close()
+}
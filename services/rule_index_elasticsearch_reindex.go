@@ -0,0 +1,270 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/elastic/go-elasticsearch/v8/esapi"
+)
+
+// Reindex creates the next version of the index (ip-addresses-v{n}) from its index template,
+// bulk loads the documents, verifies the document count and atomically moves the alias to it.
+// The old versions are dropped afterwards; on failure the new version is dropped and the alias
+// is untouched. The documents are loaded after the new version starts receiving the writes, and
+// their versions keep the bulk load from replacing a write made in between.
+func (e *elasticsearchRuleIndex) Reindex(ctx context.Context, index string, load func() ([]RuleDocument, error), count func() (int64, error), progress ReindexProgressFunc) (string, error) {
+	if progress == nil {
+		progress = func(string, int, int) {}
+	}
+	alias := e.indexName(index)
+
+	current, legacy, err := e.aliasTargets(ctx, alias)
+	if err != nil {
+		return "", err
+	}
+	version, err := e.latestVersion(ctx, alias)
+	if err != nil {
+		return "", err
+	}
+	target := fmt.Sprintf("%s-v%d", alias, version+1)
+
+	progress(ReindexPhaseCreating, 0, 0)
+	// The new version gets its mapping from the current template
+	if err := e.putTemplate(ctx, index); err != nil {
+		return "", err
+	}
+	res, err := e.do(ctx, esapi.IndicesCreateRequest{Index: target}, "create index "+target)
+	if err != nil {
+		return "", err
+	}
+	res.Body.Close()
+
+	e.mu.Lock()
+	e.rebuilding[index] = target
+	e.mu.Unlock()
+	swapped := false
+	defer func() {
+		e.mu.Lock()
+		delete(e.rebuilding, index)
+		e.mu.Unlock()
+		if !swapped {
+			e.dropIndices(ctx, []string{target})
+		}
+	}()
+
+	progress(ReindexPhaseLoading, 0, 0)
+	docs, err := load()
+	if err != nil {
+		return "", err
+	}
+
+	progress(ReindexPhaseIndexing, 0, len(docs))
+	size, _, _ := bulkSettings()
+	for start := 0; start < len(docs); start += size {
+		end := start + size
+		if end > len(docs) {
+			end = len(docs)
+		}
+		failures, err := e.bulkRequest(ctx, target, docs[start:end])
+		if err != nil {
+			return "", err
+		}
+		if len(failures) > 0 {
+			return "", fmt.Errorf("failed to index %s/%s: %w", target, failures[0].ID, failures[0].Err)
+		}
+		progress(ReindexPhaseIndexing, end, len(docs))
+	}
+
+	progress(ReindexPhaseVerifying, len(docs), len(docs))
+	expected, err := count()
+	if err != nil {
+		return "", fmt.Errorf("failed to count %s rules: %w", index, err)
+	}
+	indexed, err := e.countDocuments(ctx, target)
+	if err != nil {
+		return "", err
+	}
+	if indexed != expected {
+		return "", fmt.Errorf("%s: indexed %d documents, expected %d", target, indexed, expected)
+	}
+
+	progress(ReindexPhaseSwapping, len(docs), len(docs))
+	if err := e.swapAlias(ctx, alias, target, current, legacy); err != nil {
+		return "", err
+	}
+	swapped = true
+	e.dropIndices(ctx, current)
+
+	log.Printf("Rule index %s now points to %s (%d documents)", alias, target, indexed)
+	progress(ReindexPhaseDone, len(docs), len(docs))
+	return target, nil
+}
+
+// aliasTargets returns the indices behind an alias. legacy is true if the name is a concrete
+// index created before indices were versioned; the alias swap removes it.
+func (e *elasticsearchRuleIndex) aliasTargets(ctx context.Context, alias string) (indices []string, legacy bool, err error) {
+	res, err := e.do(ctx, esapi.IndicesGetAliasRequest{Name: []string{alias}}, "get alias "+alias, 404)
+	if err != nil {
+		return nil, false, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == 404 {
+		exists, err := e.do(ctx, esapi.IndicesExistsRequest{Index: []string{alias}}, "check index "+alias, 404)
+		if err != nil {
+			return nil, false, err
+		}
+		exists.Body.Close()
+		return nil, exists.StatusCode == 200, nil
+	}
+
+	var aliases map[string]json.RawMessage
+	if err := json.NewDecoder(res.Body).Decode(&aliases); err != nil {
+		return nil, false, fmt.Errorf("failed to decode aliases of %s: %w", alias, err)
+	}
+	for name := range aliases {
+		indices = append(indices, name)
+	}
+	sort.Strings(indices)
+	return indices, false, nil
+}
+
+// latestVersion returns the highest existing version of an index, 0 if there is none
+func (e *elasticsearchRuleIndex) latestVersion(ctx context.Context, alias string) (int, error) {
+	res, err := e.do(ctx, esapi.IndicesGetRequest{Index: []string{alias + "-v*"}}, "list versions of "+alias, 404)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode == 404 {
+		return 0, nil
+	}
+
+	var indices map[string]json.RawMessage
+	if err := json.NewDecoder(res.Body).Decode(&indices); err != nil {
+		return 0, fmt.Errorf("failed to decode versions of %s: %w", alias, err)
+	}
+	latest := 0
+	for name := range indices {
+		if version, err := strconv.Atoi(strings.TrimPrefix(name, alias+"-v")); err == nil && version > latest {
+			latest = version
+		}
+	}
+	return latest, nil
+}
+
+// bulkRequest stores documents with one _bulk request and returns the items that failed
+func (e *elasticsearchRuleIndex) bulkRequest(ctx context.Context, index string, docs []RuleDocument) ([]BulkFailure, error) {
+	if len(docs) == 0 {
+		return nil, nil
+	}
+	var body bytes.Buffer
+	encoder := json.NewEncoder(&body)
+	for _, doc := range docs {
+		meta := map[string]interface{}{"_id": doc.ID}
+		if doc.Version > 0 {
+			meta["version"], meta["version_type"] = doc.Version, "external"
+		}
+		action := map[string]interface{}{"index": meta}
+		if err := encoder.Encode(action); err != nil {
+			return nil, err
+		}
+		if err := encoder.Encode(doc.Source); err != nil {
+			return nil, err
+		}
+	}
+
+	res, err := e.do(ctx, esapi.BulkRequest{Index: index, Body: &body}, "bulk index "+index)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	var result struct {
+		Errors bool `json:"errors"`
+		Items  []map[string]struct {
+			ID     string          `json:"_id"`
+			Status int             `json:"status"`
+			Error  json.RawMessage `json:"error"`
+		} `json:"items"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode bulk response: %w", err)
+	}
+	if !result.Errors {
+		return nil, nil
+	}
+	var failures []BulkFailure
+	for _, item := range result.Items {
+		for _, op := range item {
+			// A version conflict means a newer version of the rule is stored already
+			if op.Status >= 300 && op.Status != 409 {
+				failures = append(failures, BulkFailure{ID: op.ID, Err: fmt.Errorf("status %d: %s", op.Status, op.Error)})
+			}
+		}
+	}
+	return failures, nil
+}
+
+// countDocuments refreshes an index and returns its document count
+func (e *elasticsearchRuleIndex) countDocuments(ctx context.Context, index string) (int64, error) {
+	res, err := e.do(ctx, esapi.IndicesRefreshRequest{Index: []string{index}}, "refresh "+index)
+	if err != nil {
+		return 0, err
+	}
+	res.Body.Close()
+
+	res, err = e.do(ctx, esapi.CountRequest{Index: []string{index}}, "count "+index)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+	var result struct {
+		Count int64 `json:"count"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&result); err != nil {
+		return 0, fmt.Errorf("failed to decode count response: %w", err)
+	}
+	return result.Count, nil
+}
+
+// swapAlias points the alias to target in one atomic _aliases request
+func (e *elasticsearchRuleIndex) swapAlias(ctx context.Context, alias, target string, current []string, legacy bool) error {
+	var actions []map[string]interface{}
+	for _, index := range current {
+		actions = append(actions, map[string]interface{}{"remove": map[string]interface{}{"index": index, "alias": alias}})
+	}
+	if legacy {
+		actions = append(actions, map[string]interface{}{"remove_index": map[string]interface{}{"index": alias}})
+	}
+	actions = append(actions, map[string]interface{}{"add": map[string]interface{}{"index": target, "alias": alias}})
+
+	body, err := json.Marshal(map[string]interface{}{"actions": actions})
+	if err != nil {
+		return err
+	}
+	res, err := e.do(ctx, esapi.IndicesUpdateAliasesRequest{Body: bytes.NewReader(body)}, "move alias "+alias+" to "+target)
+	if err != nil {
+		return err
+	}
+	return res.Body.Close()
+}
+
+// dropIndices deletes indices that are no longer served; failures only leave unused indices behind
+func (e *elasticsearchRuleIndex) dropIndices(ctx context.Context, indices []string) {
+	if len(indices) == 0 {
+		return
+	}
+	res, err := e.do(ctx, esapi.IndicesDeleteRequest{Index: indices}, "delete "+strings.Join(indices, ","), 404)
+	if err != nil {
+		log.Printf("Failed to drop old rule index versions: %v", err)
+		return
+	}
+	res.Body.Close()
+}
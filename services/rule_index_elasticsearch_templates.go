@@ -0,0 +1,220 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/elastic/go-elasticsearch/v8/esapi"
+)
+
+// esTemplateVersion is stored in the index templates and in the _meta of the indices created from
+// them; raise it whenever esIndexProperties change, then rebuild the indices
+const esTemplateVersion = 1
+
+// Field mappings of the rule indices. Normalized keywords match case-insensitively, exact
+// lookups do not depend on dynamic ".keyword" sub-fields.
+var (
+	esKeyword    = map[string]interface{}{"type": "keyword"}
+	esNormalized = map[string]interface{}{"type": "keyword", "normalizer": "lowercase"}
+	esBoolean    = map[string]interface{}{"type": "boolean"}
+	esLong       = map[string]interface{}{"type": "long"}
+	esInteger    = map[string]interface{}{"type": "integer"}
+	esText       = map[string]interface{}{"type": "text"}
+)
+
+// esIndexProperties are the mapped fields of every rule index
+var esIndexProperties = map[string]map[string]interface{}{
+	IndexIPs: {
+		"address":  esKeyword,
+		"range":    map[string]interface{}{"type": "ip_range"}, // Single IPs, CIDRs and ranges, for containment queries
+		"status":   esKeyword,
+		"is_cidr":  esBoolean,
+		"is_range": esBoolean,
+	},
+	IndexEmails: {
+		"email":    esNormalized,
+		"status":   esKeyword,
+		"is_regex": esBoolean,
+	},
+	IndexUserAgents: {
+		"user_agent": map[string]interface{}{"type": "keyword", "normalizer": "lowercase", "ignore_above": 4096},
+		"status":     esKeyword,
+		"is_regex":   esBoolean,
+	},
+	IndexCountries: {
+		"country": esNormalized,
+		"status":  esKeyword,
+	},
+	IndexCharsets: {
+		"id":      esLong,
+		"charset": esNormalized,
+		"status":  esKeyword,
+	},
+	IndexUsernames: {
+		"id":       esLong,
+		"username": esNormalized,
+		"status":   esKeyword,
+		"is_regex": esBoolean,
+	},
+	IndexEmailDomains: {
+		"domain":   esNormalized,
+		"status":   esKeyword,
+		"priority": esInteger,
+	},
+	IndexContentRules: {
+		"pattern":    map[string]interface{}{"type": "text", "fields": map[string]interface{}{"keyword": map[string]interface{}{"type": "keyword", "ignore_above": 256}}},
+		"match_type": esKeyword,
+		"status":     esKeyword,
+		"priority":   esInteger,
+	},
+	IndexASNs: {
+		"asn":    esNormalized,
+		"rir":    esKeyword,
+		"domain": esNormalized,
+		"cc":     esNormalized,
+		"asname": esText,
+		"status": esKeyword,
+		"source": esKeyword,
+	},
+}
+
+// templateName returns the name of the index template of a rule index
+func (e *elasticsearchRuleIndex) templateName(index string) string {
+	return e.indexName(index) + "-template"
+}
+
+// indexTemplate returns the index template applied to all versions of a rule index
+func (e *elasticsearchRuleIndex) indexTemplate(index string) map[string]interface{} {
+	return map[string]interface{}{
+		"index_patterns": []string{e.indexName(index) + "-v*"},
+		"priority":       100,
+		"version":        esTemplateVersion,
+		"template": map[string]interface{}{
+			"settings": map[string]interface{}{
+				"analysis": map[string]interface{}{
+					"normalizer": map[string]interface{}{
+						"lowercase": map[string]interface{}{"type": "custom", "filter": []string{"lowercase"}},
+					},
+				},
+			},
+			"mappings": map[string]interface{}{
+				"_meta":      map[string]interface{}{"template_version": esTemplateVersion},
+				"properties": esIndexProperties[index],
+			},
+		},
+	}
+}
+
+// putTemplate installs or updates the index template of a rule index
+func (e *elasticsearchRuleIndex) putTemplate(ctx context.Context, index string) error {
+	body, err := json.Marshal(e.indexTemplate(index))
+	if err != nil {
+		return err
+	}
+	name := e.templateName(index)
+	res, err := e.do(ctx, esapi.IndicesPutIndexTemplateRequest{Name: name, Body: bytes.NewReader(body)}, "install index template "+name)
+	if err != nil {
+		return err
+	}
+	return res.Body.Close()
+}
+
+// Setup installs the index templates and creates the first version of missing indices, so
+// writes never auto-create an index with dynamic mappings
+func (e *elasticsearchRuleIndex) Setup(ctx context.Context) error {
+	for _, index := range sortedRuleIndices() {
+		if err := e.putTemplate(ctx, index); err != nil {
+			return err
+		}
+
+		alias := e.indexName(index)
+		current, legacy, err := e.aliasTargets(ctx, alias)
+		if err != nil {
+			return err
+		}
+		if len(current) > 0 || legacy {
+			continue
+		}
+		version, err := e.latestVersion(ctx, alias)
+		if err != nil {
+			return err
+		}
+		body, err := json.Marshal(map[string]interface{}{"aliases": map[string]interface{}{alias: map[string]interface{}{}}})
+		if err != nil {
+			return err
+		}
+		target := fmt.Sprintf("%s-v%d", alias, version+1)
+		res, err := e.do(ctx, esapi.IndicesCreateRequest{Index: target, Body: bytes.NewReader(body)}, "create index "+target)
+		if err != nil {
+			return err
+		}
+		res.Body.Close()
+	}
+	return nil
+}
+
+// CheckMappings compares the mappings of the indices behind every alias with esIndexProperties
+func (e *elasticsearchRuleIndex) CheckMappings(ctx context.Context) error {
+	var mismatches []string
+	for _, index := range sortedRuleIndices() {
+		alias := e.indexName(index)
+		res, err := e.do(ctx, esapi.IndicesGetMappingRequest{Index: []string{alias}}, "get mapping of "+alias, 404)
+		if err != nil {
+			return err
+		}
+		if res.StatusCode == 404 {
+			res.Body.Close()
+			mismatches = append(mismatches, alias+": index missing")
+			continue
+		}
+
+		var indices map[string]struct {
+			Mappings struct {
+				Meta       map[string]interface{}            `json:"_meta"`
+				Properties map[string]map[string]interface{} `json:"properties"`
+			} `json:"mappings"`
+		}
+		err = json.NewDecoder(res.Body).Decode(&indices)
+		res.Body.Close()
+		if err != nil {
+			return fmt.Errorf("failed to decode mapping of %s: %w", alias, err)
+		}
+
+		for name, mapping := range indices {
+			if fmt.Sprint(mapping.Mappings.Meta["template_version"]) != fmt.Sprint(esTemplateVersion) {
+				mismatches = append(mismatches, fmt.Sprintf("%s: template version %v, expected %d", name, mapping.Mappings.Meta["template_version"], esTemplateVersion))
+			}
+			for _, field := range sortedKeys(esIndexProperties[index]) {
+				expected := esIndexProperties[index][field].(map[string]interface{})
+				actual := mapping.Mappings.Properties[field]
+				for _, key := range []string{"type", "normalizer"} {
+					if fmt.Sprint(expected[key]) != fmt.Sprint(actual[key]) {
+						mismatches = append(mismatches, fmt.Sprintf("%s: field %s has %s %v, expected %v", name, field, key, actual[key], expected[key]))
+					}
+				}
+			}
+		}
+	}
+	if len(mismatches) > 0 {
+		sort.Strings(mismatches)
+		return &MappingMismatchError{Mismatches: mismatches}
+	}
+	return nil
+}
+
+// sortedRuleIndices returns the names of all rule indices in a stable order
+func sortedRuleIndices() []string {
+	return sortedKeys(esIndexProperties)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,122 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"firewall/models"
+
+	"github.com/elastic/go-elasticsearch/v8"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIndexTemplate(t *testing.T) {
+	index := NewElasticsearchRuleIndex(nil, "staging").(*elasticsearchRuleIndex)
+	template := index.indexTemplate(IndexIPs)
+
+	assert.Equal(t, []string{"staging-ip-addresses-v*"}, template["index_patterns"])
+	assert.Equal(t, esTemplateVersion, template["version"])
+	mappings := template["template"].(map[string]interface{})["mappings"].(map[string]interface{})
+	properties := mappings["properties"].(map[string]interface{})
+	assert.Equal(t, "ip_range", properties["range"].(map[string]interface{})["type"])
+	assert.Equal(t, "staging-ip-addresses-template", index.templateName(IndexIPs))
+
+	// Every rule index has a template
+	for _, name := range []string{IndexIPs, IndexEmails, IndexUserAgents, IndexCountries, IndexCharsets, IndexUsernames, IndexEmailDomains, IndexContentRules, IndexASNs} {
+		assert.Contains(t, esIndexProperties, name)
+	}
+	assert.Equal(t, "lowercase", esIndexProperties[IndexCountries]["country"].(map[string]interface{})["normalizer"])
+}
+
+func TestIPDocument_Range(t *testing.T) {
+	doc := ipDocument(models.IP{ID: 1, Address: "198.51.100.0/24", IsCIDR: true})
+	assert.Equal(t, map[string]interface{}{"gte": "198.51.100.0", "lte": "198.51.100.255"}, doc.Source["range"])
+
+	doc = ipDocument(models.IP{ID: 2, Address: "203.0.113.7"})
+	assert.Equal(t, map[string]interface{}{"gte": "203.0.113.7", "lte": "203.0.113.7"}, doc.Source["range"])
+
+	doc = ipDocument(models.IP{ID: 3, Address: "not an ip"})
+	assert.NotContains(t, doc.Source, "range")
+}
+
+// newMappingCluster serves the mappings of the templates, with overrides per field of the IP index
+func newMappingCluster(t *testing.T, ipOverrides map[string]interface{}) RuleIndex {
+	templates := NewElasticsearchRuleIndex(nil, "").(*elasticsearchRuleIndex)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Elastic-Product", "Elasticsearch")
+		w.Header().Set("Content-Type", "application/json")
+		alias := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/"), "/_mapping")
+		mappings := templates.indexTemplate(alias)["template"].(map[string]interface{})["mappings"].(map[string]interface{})
+		if alias == IndexIPs && ipOverrides != nil {
+			properties := map[string]interface{}{}
+			for k, v := range esIndexProperties[IndexIPs] {
+				properties[k] = v
+			}
+			for k, v := range ipOverrides {
+				properties[k] = v
+			}
+			mappings = map[string]interface{}{"properties": properties}
+		}
+		body, _ := json.Marshal(map[string]interface{}{alias + "-v1": map[string]interface{}{"mappings": mappings}})
+		io.WriteString(w, string(body))
+	}))
+	t.Cleanup(server.Close)
+	client, err := elasticsearch.NewClient(elasticsearch.Config{Addresses: []string{server.URL}})
+	require.NoError(t, err)
+	return NewElasticsearchRuleIndex(client, "")
+}
+
+func TestElasticsearchRuleIndex_CheckMappings(t *testing.T) {
+	assert.NoError(t, newMappingCluster(t, nil).CheckMappings(context.Background()))
+
+	// A dynamically mapped index: no template version and text instead of keyword
+	err := newMappingCluster(t, map[string]interface{}{
+		"address": map[string]interface{}{"type": "text"},
+	}).CheckMappings(context.Background())
+	assert.ErrorContains(t, err, "ip-addresses-v1: field address has type text, expected keyword")
+	assert.ErrorContains(t, err, "ip-addresses-v1: template version <nil>, expected 1")
+
+	assert.NoError(t, NewMemoryRuleIndex().CheckMappings(context.Background()))
+}
+
+// mappingChecker is a memory rule index whose mapping check returns err and counts the calls
+type mappingChecker struct {
+	RuleIndex
+	checks int
+	err    error
+}
+
+func (m *mappingChecker) CheckMappings(ctx context.Context) error {
+	m.checks++
+	return m.err
+}
+
+func TestMappingStatus(t *testing.T) {
+	ctx := context.Background()
+	checker := &mappingChecker{RuleIndex: NewMemoryRuleIndex(), err: &MappingMismatchError{Mismatches: []string{"ip-addresses: index missing"}}}
+	useRuleIndex(t, checker)
+
+	// A mismatch is checked once and then served from the cache
+	assert.ErrorContains(t, MappingStatus(ctx), "ip-addresses: index missing")
+	assert.ErrorContains(t, MappingStatus(ctx), "ip-addresses: index missing")
+	assert.Equal(t, 1, checker.checks)
+
+	// A reindex refreshes it
+	checker.err = nil
+	assert.NoError(t, RefreshMappingStatus(ctx))
+	assert.NoError(t, MappingStatus(ctx))
+	assert.Equal(t, 2, checker.checks)
+
+	// A check that could not reach the backend is not cached
+	checker.err = errors.New("connection refused")
+	assert.Error(t, RefreshMappingStatus(ctx))
+	assert.Error(t, MappingStatus(ctx))
+	assert.Equal(t, 4, checker.checks)
+}
@@ -0,0 +1,124 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// memoryRuleIndex keeps the rule documents in process; nothing survives a restart,
+// the initial sync fills it from MySQL
+type memoryRuleIndex struct {
+	mu          sync.RWMutex
+	indices     map[string]map[string]map[string]interface{} // index -> document ID -> source
+	docVersions map[string]map[string]int64                  // index -> document ID -> RuleDocument.Version
+	versions    map[string]int                               // index -> number of rebuilds
+}
+
+// NewMemoryRuleIndex returns an empty in-process rule index
+func NewMemoryRuleIndex() RuleIndex {
+	return &memoryRuleIndex{
+		indices:     make(map[string]map[string]map[string]interface{}),
+		docVersions: make(map[string]map[string]int64),
+		versions:    make(map[string]int),
+	}
+}
+
+func (m *memoryRuleIndex) Backend() string { return SearchBackendMemory }
+
+func (m *memoryRuleIndex) Upsert(ctx context.Context, index string, doc RuleDocument) error {
+	// Copy the document, callers may reuse their map
+	source := make(map[string]interface{}, len(doc.Source))
+	for k, v := range doc.Source {
+		source[k] = v
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if doc.Version > 0 && doc.Version <= m.docVersions[index][doc.ID] {
+		return nil // The stored document is as new or newer
+	}
+	if m.indices[index] == nil {
+		m.indices[index] = make(map[string]map[string]interface{})
+		m.docVersions[index] = make(map[string]int64)
+	}
+	m.indices[index][doc.ID] = source
+	m.docVersions[index][doc.ID] = doc.Version
+	return nil
+}
+
+func (m *memoryRuleIndex) BulkUpsert(ctx context.Context, index string, docs []RuleDocument) ([]BulkFailure, error) {
+	for _, doc := range docs {
+		if err := m.Upsert(ctx, index, doc); err != nil {
+			return nil, err
+		}
+	}
+	return nil, nil
+}
+
+func (m *memoryRuleIndex) Delete(ctx context.Context, index, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.indices[index], id)
+	delete(m.docVersions[index], id)
+	return nil
+}
+
+func (m *memoryRuleIndex) Recreate(ctx context.Context, index string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.indices[index] = make(map[string]map[string]interface{})
+	m.docVersions[index] = make(map[string]int64)
+	return nil
+}
+
+func (m *memoryRuleIndex) Reindex(ctx context.Context, index string, load func() ([]RuleDocument, error), count func() (int64, error), progress ReindexProgressFunc) (string, error) {
+	if progress == nil {
+		progress = func(string, int, int) {}
+	}
+
+	progress(ReindexPhaseLoading, 0, 0)
+	docs, err := load()
+	if err != nil {
+		return "", err
+	}
+
+	progress(ReindexPhaseIndexing, 0, len(docs))
+	built := make(map[string]map[string]interface{}, len(docs))
+	builtVersions := make(map[string]int64, len(docs))
+	for _, doc := range docs {
+		source := make(map[string]interface{}, len(doc.Source))
+		for k, v := range doc.Source {
+			source[k] = v
+		}
+		built[doc.ID] = source
+		builtVersions[doc.ID] = doc.Version
+	}
+	progress(ReindexPhaseIndexing, len(docs), len(docs))
+
+	progress(ReindexPhaseVerifying, len(docs), len(docs))
+	expected, err := count()
+	if err != nil {
+		return "", fmt.Errorf("failed to count %s rules: %w", index, err)
+	}
+	if int64(len(built)) != expected {
+		return "", fmt.Errorf("%s: indexed %d documents, expected %d", index, len(built), expected)
+	}
+
+	progress(ReindexPhaseSwapping, len(docs), len(docs))
+	m.mu.Lock()
+	m.indices[index] = built
+	m.docVersions[index] = builtVersions
+	m.versions[index]++
+	version := m.versions[index]
+	m.mu.Unlock()
+	progress(ReindexPhaseDone, len(docs), len(docs))
+	return fmt.Sprintf("%s-v%d", index, version), nil
+}
+
+func (m *memoryRuleIndex) Ping(ctx context.Context) error { return nil }
+
+func (m *memoryRuleIndex) Setup(ctx context.Context) error { return nil }
+
+// CheckMappings always succeeds, the in-process index has no mappings
+func (m *memoryRuleIndex) CheckMappings(ctx context.Context) error { return nil }
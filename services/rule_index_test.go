@@ -0,0 +1,105 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"testing"
+
+	"firewall/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// indexedDocs returns the documents of an in-process index whose field has the given value,
+// ordered by ID
+func indexedDocs(index RuleIndex, name, field string, value interface{}) []RuleDocument {
+	m := index.(*memoryRuleIndex)
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var docs []RuleDocument
+	for id, source := range m.indices[name] {
+		if fmt.Sprint(source[field]) != fmt.Sprint(value) {
+			continue
+		}
+		copied := make(map[string]interface{}, len(source))
+		for k, v := range source {
+			copied[k] = v
+		}
+		docs = append(docs, RuleDocument{ID: id, Source: copied})
+	}
+	sort.Slice(docs, func(i, j int) bool { return docs[i].ID < docs[j].ID })
+	return docs
+}
+
+func TestMemoryRuleIndex(t *testing.T) {
+	ctx := context.Background()
+	index := NewMemoryRuleIndex()
+	assert.Equal(t, SearchBackendMemory, index.Backend())
+	assert.NoError(t, index.Ping(ctx))
+
+	doc := map[string]interface{}{"id": uint(1), "username": "admin", "status": "denied", "is_regex": false}
+	assert.NoError(t, index.Upsert(ctx, "usernames", RuleDocument{ID: "1", Source: doc}))
+	assert.NoError(t, index.Upsert(ctx, "usernames", RuleDocument{ID: "2", Source: map[string]interface{}{"id": uint(2), "username": "^bot.*", "status": "denied", "is_regex": true}}))
+
+	// The index keeps its own copy of the document
+	doc["username"] = "changed"
+	docs := indexedDocs(index, "usernames", "username", "admin")
+	if assert.Len(t, docs, 1) {
+		assert.Equal(t, "1", docs[0].ID)
+		docs[0].Source["status"] = "allowed"
+	}
+	docs = indexedDocs(index, "usernames", "id", 1)
+	if assert.Len(t, docs, 1) {
+		assert.Equal(t, "denied", docs[0].Source["status"])
+	}
+
+	patterns := indexedDocs(index, "usernames", "is_regex", true)
+	if assert.Len(t, patterns, 1) {
+		assert.Equal(t, "2", patterns[0].ID)
+	}
+
+	// Upsert replaces, Delete tolerates missing documents and indices
+	assert.NoError(t, index.Upsert(ctx, "usernames", RuleDocument{ID: "1", Source: map[string]interface{}{"username": "root"}}))
+	docs = indexedDocs(index, "usernames", "username", "admin")
+	assert.Empty(t, docs)
+	assert.NoError(t, index.Delete(ctx, "usernames", "1"))
+	assert.NoError(t, index.Delete(ctx, "usernames", "1"))
+	assert.NoError(t, index.Delete(ctx, "missing", "1"))
+
+	assert.NoError(t, index.Recreate(ctx, "usernames"))
+	patterns = indexedDocs(index, "usernames", "is_regex", true)
+	assert.Empty(t, patterns)
+}
+
+func TestElasticsearchRuleIndex_NoClient(t *testing.T) {
+	ctx := context.Background()
+	index := NewElasticsearchRuleIndex(nil, "")
+	assert.Equal(t, SearchBackendElasticsearch, index.Backend())
+	assert.Error(t, index.Ping(ctx))
+	assert.Error(t, index.Upsert(ctx, "ips", RuleDocument{ID: "1", Source: map[string]interface{}{"id": 1}}))
+	assert.Error(t, index.Delete(ctx, "ips", "1"))
+}
+
+func TestRuleIndexSync_Memory(t *testing.T) {
+	previous := GetRuleIndex()
+	defer SetRuleIndex(previous)
+	index := NewMemoryRuleIndex()
+	SetRuleIndex(index)
+
+	assert.NoError(t, SyncCharsetToES(models.CharsetRule{ID: 7, Charset: "UTF-8", Status: "allowed"}))
+	docs := indexedDocs(index, "charsets", "charset", "UTF-8")
+	if assert.Len(t, docs, 1) {
+		assert.Equal(t, "7", docs[0].ID)
+	}
+
+	assert.NoError(t, DeleteCharsetFromES(7))
+	docs = indexedDocs(index, "charsets", "charset", "UTF-8")
+	assert.Empty(t, docs)
+}
+
+func TestElasticsearchRuleIndex_IndexName(t *testing.T) {
+	assert.Equal(t, "ip-addresses", NewElasticsearchRuleIndex(nil, "").(*elasticsearchRuleIndex).indexName(IndexIPs))
+	assert.Equal(t, "staging-ip-addresses", NewElasticsearchRuleIndex(nil, "staging").(*elasticsearchRuleIndex).indexName(IndexIPs))
+}
@@ -0,0 +1,192 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"firewall/config"
+	"firewall/models"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// RuleJanitor periodically removes rules whose expires_at has passed. The rule engine
+// already ignores expired rules; the janitor keeps MySQL, Elasticsearch and the caches tidy
+type RuleJanitor struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+var (
+	ruleJanitor     *RuleJanitor
+	ruleJanitorOnce sync.Once
+)
+
+// GetRuleJanitor returns the singleton rule janitor
+func GetRuleJanitor() *RuleJanitor {
+	ruleJanitorOnce.Do(func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		ruleJanitor = &RuleJanitor{
+			ctx:    ctx,
+			cancel: cancel,
+		}
+		ruleJanitor.start()
+	})
+	return ruleJanitor
+}
+
+// start begins the periodic sweep
+func (rj *RuleJanitor) start() {
+	interval := config.AppConfig.Filtering.RuleJanitorInterval
+	rj.wg.Add(1)
+	go rj.run(interval)
+	log.Printf("Rule janitor started (interval: %v, expired rules: %s)", interval, config.AppConfig.Filtering.ExpiredRuleAction)
+}
+
+func (rj *RuleJanitor) run(interval time.Duration) {
+	defer rj.wg.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	// Get distributed lock service
+	distributedLock := GetDistributedLock()
+
+	for {
+		select {
+		case <-ticker.C:
+			// Only one instance sweeps at a time, the others would publish duplicate events
+			lockName := "rule_janitor"
+			acquired, _ := distributedLock.TryAcquireLock(lockName, config.AppConfig.Locking.LockTTL)
+			if !acquired {
+				continue
+			}
+
+			archive := config.AppConfig.Filtering.ExpiredRuleAction == "archive"
+			count, err := ExpireRules(config.DB, time.Now(), archive)
+			if err != nil {
+				log.Printf("Rule janitor: %v", err)
+			} else if count > 0 {
+				log.Printf("Rule janitor: removed %d expired rules", count)
+			}
+
+			distributedLock.ReleaseLock(lockName)
+		case <-rj.ctx.Done():
+			return
+		}
+	}
+}
+
+// Stop gracefully stops the rule janitor
+func (rj *RuleJanitor) Stop() {
+	rj.cancel()
+	rj.wg.Wait()
+	log.Println("Rule janitor stopped")
+}
+
+// ExpireRules deletes all rules that expired at or before now, archiving them first if
+// archive is set, and publishes a "deleted" event for each. It returns the number of removed rules
+func ExpireRules(db *gorm.DB, now time.Time, archive bool) (int, error) {
+	count := 0
+	expirers := []func() (int, error){
+		func() (int, error) {
+			return expireRules(db, "ip", now, archive, func(r models.IP) (uint, *time.Time) { return r.ID, r.ExpiresAt })
+		},
+		func() (int, error) {
+			return expireRules(db, "email", now, archive, func(r models.Email) (uint, *time.Time) { return r.ID, r.ExpiresAt })
+		},
+		func() (int, error) {
+			return expireRules(db, "email_domain", now, archive, func(r models.EmailDomainRule) (uint, *time.Time) { return r.ID, r.ExpiresAt })
+		},
+		func() (int, error) {
+			return expireRules(db, "user_agent", now, archive, func(r models.UserAgent) (uint, *time.Time) { return r.ID, r.ExpiresAt })
+		},
+		func() (int, error) {
+			return expireRules(db, "country", now, archive, func(r models.Country) (uint, *time.Time) { return r.ID, r.ExpiresAt })
+		},
+		func() (int, error) {
+			return expireRules(db, "charset", now, archive, func(r models.CharsetRule) (uint, *time.Time) { return r.ID, r.ExpiresAt })
+		},
+		func() (int, error) {
+			return expireRules(db, "username", now, archive, func(r models.UsernameRule) (uint, *time.Time) { return r.ID, r.ExpiresAt })
+		},
+		func() (int, error) {
+			return expireRules(db, "content", now, archive, func(r models.ContentRule) (uint, *time.Time) { return r.ID, r.ExpiresAt })
+		},
+		func() (int, error) {
+			return expireRules(db, "velocity", now, archive, func(r models.VelocityRule) (uint, *time.Time) { return r.ID, r.ExpiresAt })
+		},
+		func() (int, error) {
+			return expireRules(db, "composite", now, archive, func(r models.CompositeRule) (uint, *time.Time) { return r.ID, r.ExpiresAt })
+		},
+		func() (int, error) {
+			return expireRules(db, "expression", now, archive, func(r models.ExpressionRule) (uint, *time.Time) { return r.ID, r.ExpiresAt })
+		},
+		func() (int, error) {
+			return expireRules(db, "geo", now, archive, func(r models.GeoRule) (uint, *time.Time) { return r.ID, r.ExpiresAt })
+		},
+		func() (int, error) {
+			return expireRules(db, "country_group", now, archive, func(r models.CountryGroup) (uint, *time.Time) { return r.ID, r.ExpiresAt })
+		},
+		func() (int, error) {
+			return expireRules(db, "asn", now, archive, func(r models.ASN) (uint, *time.Time) { return r.ID, r.ExpiresAt })
+		},
+	}
+	for _, expire := range expirers {
+		n, err := expire()
+		count += n
+		if err != nil {
+			return count, err
+		}
+	}
+	return count, nil
+}
+
+// expireRules removes the expired rules of one model in a single transaction and
+// publishes the deleted events once it is committed
+func expireRules[T any](db *gorm.DB, eventType string, now time.Time, archive bool, key func(T) (uint, *time.Time)) (int, error) {
+	var rules []T
+	if err := db.Where("expires_at IS NOT NULL AND expires_at <= ?", now).Find(&rules).Error; err != nil {
+		return 0, fmt.Errorf("failed to load expired %s rules: %w", eventType, err)
+	}
+	if len(rules) == 0 {
+		return 0, nil
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		for i := range rules {
+			if archive {
+				data, err := json.Marshal(rules[i])
+				if err != nil {
+					return err
+				}
+				id, expiresAt := key(rules[i])
+				archived := models.ArchivedRule{RuleType: eventType, RuleID: id, Data: string(data), ExpiresAt: expiresAt}
+				if err := tx.Create(&archived).Error; err != nil {
+					return err
+				}
+			}
+			if err := tx.Delete(&rules[i]).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to remove expired %s rules: %w", eventType, err)
+	}
+
+	for _, rule := range rules {
+		PublishEvent(eventType, "deleted", rule)
+		// ASN documents are synced by the callers, not by the event processor
+		if asn, ok := any(rule).(models.ASN); ok {
+			if err := DeleteASNFromES(asn.ID); err != nil {
+				log.Printf("Error deleting ASN from ES: %v", err)
+			}
+		}
+	}
+	return len(rules), nil
+}
@@ -142,6 +142,11 @@ func ImportSpamhausASNDrop() error {
 		return fmt.Errorf("failed to commit transaction: %w", err)
 	}
 
+	PublishEvent("asn", "imported", map[string]interface{}{
+		"source": "spamhaus",
+		"count":  importedCount,
+	})
+
 	// Sync to Elasticsearch
 	if err := SyncAllASNs(); err != nil {
 		return fmt.Errorf("failed to sync ASNs to Elasticsearch: %w", err)
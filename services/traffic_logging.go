@@ -20,14 +20,18 @@ type TrafficLoggingService struct {
 
 // FilterRequest represents a filter request
 type FilterRequest struct {
-	IPAddress string `json:"ip_address"`
-	Email     string `json:"email"`
-	UserAgent string `json:"user_agent"`
-	Username  string `json:"username"`
-	Country   string `json:"country"`
-	ASN       string `json:"asn"`
-	Charset   string `json:"charset"`
-	Content   string `json:"content"`
+	IPAddress      string `json:"ip_address"`
+	Email          string `json:"email"`           // As sent by the client
+	CanonicalEmail string `json:"canonical_email"` // Normalized address the rules were matched against
+	UserAgent      string `json:"user_agent"`
+	Username       string `json:"username"`
+	Country        string `json:"country"`
+	ASN            string `json:"asn"`
+	Continent      string `json:"continent"`
+	Subdivision    string `json:"subdivision"`
+	City           string `json:"city"`
+	Charset        string `json:"charset"`
+	Content        string `json:"content"`
 }
 
 // TrafficFilterResult represents the result of a filter operation for traffic logging
@@ -62,10 +66,14 @@ func (tls *TrafficLoggingService) LogFilterRequest(req FilterRequest, result Tra
 		RequestID:      uuid.New().String(),
 		IPAddress:      req.IPAddress,
 		Email:          req.Email,
+		CanonicalEmail: req.CanonicalEmail,
 		UserAgent:      req.UserAgent,
 		Username:       req.Username,
 		Country:        req.Country,
 		ASN:            req.ASN,
+		Continent:      req.Continent,
+		Subdivision:    req.Subdivision,
+		City:           req.City,
 		Charset:        req.Charset,
 		Content:        req.Content,
 		FinalResult:    result.FinalResult,
@@ -345,6 +353,11 @@ func (tls *TrafficLoggingService) CleanupOldLogs(retentionDays int) error {
 		return fmt.Errorf("failed to cleanup data relationships: %v", err)
 	}
 
+	// Delete old monitor rule counters
+	if err := tls.db.Where("bucket < ?", cutoffDate).Delete(&models.MonitorRuleStat{}).Error; err != nil {
+		return fmt.Errorf("failed to cleanup monitor rule stats: %v", err)
+	}
+
 	log.Printf("Cleaned up traffic logs older than %d days", retentionDays)
 	return nil
 }
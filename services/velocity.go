@@ -0,0 +1,333 @@
+package services
+
+import (
+	"context"
+	"firewall/config"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+)
+
+// velocityCounter records events in sliding windows
+type velocityCounter interface {
+	// Add records an event for key at now and returns the number of events within window.
+	// With a member, only distinct members are counted (e.g. distinct IPs per email).
+	Add(ctx context.Context, key, member string, now time.Time, window time.Duration) (int64, error)
+}
+
+var (
+	velocityCounterInstance velocityCounter
+	velocityCounterOnce     sync.Once
+)
+
+// getVelocityCounter returns the Redis counter when caching.distributed is enabled, otherwise the in-memory one
+func getVelocityCounter() velocityCounter {
+	velocityCounterOnce.Do(func() {
+		if config.AppConfig != nil && config.AppConfig.Caching.Distributed {
+			if dc := GetDistributedCache(); dc != nil {
+				velocityCounterInstance = &redisVelocityCounter{client: dc.client}
+				return
+			}
+		}
+		velocityCounterInstance = newMemoryVelocityCounter()
+	})
+	return velocityCounterInstance
+}
+
+// velocityWindow holds the events of one key: timestamps when counting requests, last seen per member when counting distinct values
+type velocityWindow struct {
+	times    []time.Time
+	members  map[string]time.Time
+	window   time.Duration
+	lastSeen time.Time
+}
+
+// memoryVelocityCounter keeps the windows of a single instance
+type memoryVelocityCounter struct {
+	mu      sync.Mutex
+	windows map[string]*velocityWindow
+	adds    int
+}
+
+func newMemoryVelocityCounter() *memoryVelocityCounter {
+	return &memoryVelocityCounter{windows: make(map[string]*velocityWindow)}
+}
+
+func (m *memoryVelocityCounter) Add(ctx context.Context, key, member string, now time.Time, window time.Duration) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// Drop idle keys now and then so the map does not grow without bound
+	m.adds++
+	if m.adds%1024 == 0 {
+		for k, w := range m.windows {
+			if now.Sub(w.lastSeen) > w.window {
+				delete(m.windows, k)
+			}
+		}
+	}
+
+	w := m.windows[key]
+	if w == nil {
+		w = &velocityWindow{}
+		m.windows[key] = w
+	}
+	w.window = window
+	if now.After(w.lastSeen) {
+		w.lastSeen = now
+	}
+	start := now.Add(-window)
+
+	if member == "" {
+		// The times are kept sorted: now is taken before the lock, so concurrent requests
+		// can arrive slightly out of order. Expired ones are at the front.
+		expired := sort.Search(len(w.times), func(i int) bool { return w.times[i].After(start) })
+		w.times = w.times[expired:]
+		i := sort.Search(len(w.times), func(i int) bool { return w.times[i].After(now) })
+		w.times = append(w.times, time.Time{})
+		copy(w.times[i+1:], w.times[i:])
+		w.times[i] = now
+		return int64(len(w.times)), nil
+	}
+
+	if w.members == nil {
+		w.members = make(map[string]time.Time)
+	}
+	if now.After(w.members[member]) {
+		w.members[member] = now
+	}
+	for m, seen := range w.members {
+		if !seen.After(start) {
+			delete(w.members, m)
+		}
+	}
+	return int64(len(w.members)), nil
+}
+
+// redisVelocityCounter shares the windows between instances using one sorted set per key
+type redisVelocityCounter struct {
+	client *redis.Client
+}
+
+func (r *redisVelocityCounter) Add(ctx context.Context, key, member string, now time.Time, window time.Duration) (int64, error) {
+	if member == "" {
+		member = uuid.New().String() // Every request is its own member
+	}
+	redisKey := "velocity:" + key
+	start := now.Add(-window).UnixMicro()
+
+	pipe := r.client.TxPipeline()
+	pipe.ZRemRangeByScore(ctx, redisKey, "-inf", strconv.FormatInt(start, 10))
+	pipe.ZAdd(ctx, redisKey, &redis.Z{Score: float64(now.UnixMicro()), Member: member})
+	count := pipe.ZCard(ctx, redisKey)
+	pipe.PExpire(ctx, redisKey, window)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, err
+	}
+	return count.Val(), nil
+}
+
+// velocityRule is a velocity rule prepared for counting inside a RuleSnapshot
+type velocityRule struct {
+	*compiledRule
+	keyFields []string
+	distinct  string
+	threshold int64
+	window    time.Duration
+}
+
+// VelocityHit is the value of a velocity result: the observed count of a key within the window
+type VelocityHit struct {
+	Key       string `json:"key"`
+	Count     int64  `json:"count"`
+	Threshold int64  `json:"threshold"`
+	Window    string `json:"window"`
+}
+
+// newVelocityRule compiles a velocity rule; rules with an invalid window or threshold are skipped
+func newVelocityRule(id uint, name, keyFields, distinct string, threshold int, window, status string, priority int) *velocityRule {
+	duration, err := time.ParseDuration(window)
+	if err != nil || duration <= 0 || threshold < 1 {
+		return nil
+	}
+	var fields []string
+	for _, field := range strings.Split(keyFields, ",") {
+		if field = strings.TrimSpace(field); field != "" {
+			fields = append(fields, field)
+		}
+	}
+	if len(fields) == 0 {
+		return nil
+	}
+	return &velocityRule{
+		compiledRule: &compiledRule{ID: id, Value: name, Status: status, Priority: priority, Type: "velocity"},
+		keyFields:    fields,
+		distinct:     strings.TrimSpace(distinct),
+		threshold:    int64(threshold),
+		window:       duration,
+	}
+}
+
+// key returns the counter key for the input, or false if one of the fields is missing
+func (v *velocityRule) key(input *FilterInput) (string, string, bool) {
+	values := make([]string, len(v.keyFields))
+	for i, field := range v.keyFields {
+		if values[i] = input.Value(field); values[i] == "" {
+			return "", "", false
+		}
+	}
+	member := ""
+	if v.distinct != "" {
+		if member = input.Value(v.distinct); member == "" {
+			return "", "", false
+		}
+	}
+	return strconv.FormatUint(uint64(v.ID), 10) + ":" + strings.Join(values, "\x1f"), member, true
+}
+
+// field returns the result field of the rule, e.g. "ip" or "email,ip"
+func (v *velocityRule) field() string {
+	return strings.Join(v.keyFields, ",")
+}
+
+// velocityIndex holds the velocity rules of a snapshot, ordered by precedence
+type velocityIndex struct {
+	rules []*velocityRule
+}
+
+func (vi *velocityIndex) add(rule *velocityRule) bool {
+	if rule == nil {
+		return false
+	}
+	vi.rules = append(vi.rules, rule)
+	return true
+}
+
+func (vi *velocityIndex) sort() {
+	sort.SliceStable(vi.rules, func(i, j int) bool {
+		return vi.rules[i].outranks(vi.rules[j].compiledRule)
+	})
+}
+
+// fields returns the request fields used by the rules
+func (vi *velocityIndex) fields() []string {
+	seen := make(map[string]bool)
+	var fields []string
+	for _, rule := range vi.rules {
+		for _, field := range append(rule.keyFields, rule.distinct) {
+			if field != "" && !seen[field] {
+				seen[field] = true
+				fields = append(fields, field)
+			}
+		}
+	}
+	return fields
+}
+
+// counts reports whether any rule may count the input; country and asn are
+// resolved from the IP during evaluation, so an IP is enough for them
+func (vi *velocityIndex) counts(input *FilterInput) bool {
+	present := func(field string) bool {
+		if field == "country" || field == "asn" {
+			return input.IP != "" || input.Value(field) != ""
+		}
+		return input.Value(field) != ""
+	}
+	for _, rule := range vi.rules {
+		ok := rule.distinct == "" || present(rule.distinct)
+		for _, field := range rule.keyFields {
+			ok = ok && present(field)
+		}
+		if ok {
+			return true
+		}
+	}
+	return false
+}
+
+// match records the input in the window of every applicable rule and returns the
+// highest ranked rule whose count exceeds its threshold. Every rule counts the request,
+// so a hit does not stop the remaining rules from recording it.
+func (vi *velocityIndex) match(ctx context.Context, counter velocityCounter, input *FilterInput, now time.Time) (*velocityRule, VelocityHit, error) {
+	var best *velocityRule
+	var bestHit VelocityHit
+	var firstErr error
+	for _, rule := range vi.rules {
+		key, member, ok := rule.key(input)
+		if !ok {
+			continue
+		}
+		count, err := counter.Add(ctx, key, member, now, rule.window)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		if count > rule.threshold && (best == nil || rule.outranks(best.compiledRule)) {
+			best = rule
+			bestHit = VelocityHit{Key: strings.ReplaceAll(key[strings.IndexByte(key, ':')+1:], "\x1f", ","), Count: count, Threshold: rule.threshold, Window: rule.window.String()}
+		}
+	}
+	return best, bestHit, firstErr
+}
+
+func (vi *velocityIndex) len() int {
+	return len(vi.rules)
+}
+
+// velocityFallbackCounter counts on this instance while the shared counter fails (mysql-fallback)
+var velocityFallbackCounter = newMemoryVelocityCounter()
+
+// velocityFilter counts requests per key with the velocity rules
+type velocityFilter struct{}
+
+func (velocityFilter) Name() string { return "velocity" }
+
+// Fields returns the fields used by the current velocity rules; without rules the filter does not run
+func (velocityFilter) Fields() []string {
+	snapshot := GetRuleEngine().Snapshot()
+	return append(snapshot.velocity.fields(), snapshot.Monitor().velocity.fields()...)
+}
+
+func (velocityFilter) Evaluate(ctx context.Context, input *FilterInput) FilterResult {
+	snapshot := GetRuleEngine().Snapshot()
+	counter := getVelocityCounter()
+	now := time.Now()
+
+	rule, hit, err := snapshot.velocity.match(ctx, counter, input, now)
+	monitor, monitorHit, monitorErr := snapshot.Monitor().velocity.match(ctx, counter, input, now)
+	if monitorErr != nil {
+		log.Printf("Velocity: failed to count monitor rules: %v", monitorErr)
+	}
+	if err != nil && rule == nil {
+		return FilterResult{Result: "error", Reason: "velocity counter unavailable", Field: "velocity"}
+	}
+
+	result := FilterResult{Result: "allowed", Field: "velocity"}
+	if rule != nil {
+		result = ruleResult(rule.compiledRule, rule.field(), "velocity", hit)
+	}
+	if monitor != nil {
+		result = withMonitorHit(result, monitor.compiledRule, monitor.field(), monitorHit)
+	}
+	return result
+}
+
+// Fallback counts the request with the in-memory counter of this instance instead of
+// running again, so the windows of the shared counter are not counted twice. The local
+// windows only see the requests made while the shared counter is failing.
+func (velocityFilter) Fallback(ctx context.Context, input *FilterInput) FilterResult {
+	snapshot := GetRuleEngine().Snapshot()
+	rule, hit, _ := snapshot.velocity.match(ctx, velocityFallbackCounter, input, time.Now())
+	if rule == nil {
+		return FilterResult{Result: "allowed", Field: "velocity"}
+	}
+	return ruleResult(rule.compiledRule, rule.field(), "velocity", hit)
+}
@@ -0,0 +1,156 @@
+package services
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"firewall/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryVelocityCounter_Count(t *testing.T) {
+	counter := newMemoryVelocityCounter()
+	ctx := context.Background()
+	start := time.Now()
+
+	for i := 1; i <= 3; i++ {
+		count, err := counter.Add(ctx, "1:203.0.113.7", "", start.Add(time.Duration(i)*10*time.Second), time.Minute)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(i), count)
+	}
+
+	// Other keys have their own window
+	count, _ := counter.Add(ctx, "1:198.51.100.1", "", start, time.Minute)
+	assert.Equal(t, int64(1), count)
+
+	// The first two events have left the window
+	count, _ = counter.Add(ctx, "1:203.0.113.7", "", start.Add(85*time.Second), time.Minute)
+	assert.Equal(t, int64(2), count)
+}
+
+func TestMemoryVelocityCounter_OutOfOrder(t *testing.T) {
+	counter := newMemoryVelocityCounter()
+	ctx := context.Background()
+	start := time.Now()
+
+	// The event at 50s is stored after the one at 70s, but still expires first
+	counter.Add(ctx, "1:203.0.113.7", "", start.Add(70*time.Second), time.Minute)
+	counter.Add(ctx, "1:203.0.113.7", "", start.Add(50*time.Second), time.Minute)
+	count, _ := counter.Add(ctx, "1:203.0.113.7", "", start.Add(115*time.Second), time.Minute)
+	assert.Equal(t, int64(2), count)
+}
+
+func TestMemoryVelocityCounter_Concurrent(t *testing.T) {
+	counter := newMemoryVelocityCounter()
+	ctx := context.Background()
+	start := time.Now()
+
+	var wg sync.WaitGroup
+	for i := 49; i >= 0; i-- {
+		wg.Add(1)
+		go func(offset time.Duration) {
+			defer wg.Done()
+			_, err := counter.Add(ctx, "1:203.0.113.7", "", start.Add(offset), time.Minute)
+			assert.NoError(t, err)
+		}(time.Duration(i) * time.Second)
+	}
+	wg.Wait()
+
+	w := counter.windows["1:203.0.113.7"]
+	assert.Len(t, w.times, 50)
+	assert.True(t, sort.SliceIsSorted(w.times, func(i, j int) bool { return w.times[i].Before(w.times[j]) }))
+
+	// The events at 0s to 20s have left the window, 21s to 49s remain
+	count, _ := counter.Add(ctx, "1:203.0.113.7", "", start.Add(80*time.Second), time.Minute)
+	assert.Equal(t, int64(30), count)
+}
+
+func TestMemoryVelocityCounter_Distinct(t *testing.T) {
+	counter := newMemoryVelocityCounter()
+	ctx := context.Background()
+	start := time.Now()
+
+	add := func(ip string, offset time.Duration) int64 {
+		count, err := counter.Add(ctx, "2:anna@example.com", ip, start.Add(offset), time.Hour)
+		assert.NoError(t, err)
+		return count
+	}
+
+	assert.Equal(t, int64(1), add("203.0.113.1", 0))
+	assert.Equal(t, int64(1), add("203.0.113.1", time.Minute)) // Repeated members count once
+	assert.Equal(t, int64(2), add("203.0.113.2", 2*time.Minute))
+	assert.Equal(t, int64(3), add("203.0.113.3", 3*time.Minute))
+
+	// 203.0.113.1 and 203.0.113.2 were last seen an hour or more ago
+	assert.Equal(t, int64(2), add("203.0.113.4", 62*time.Minute))
+}
+
+func TestNewVelocityRule(t *testing.T) {
+	rule := newVelocityRule(1, "signups", "ip, action", "", 5, "1m", "denied", 0)
+	assert.NotNil(t, rule)
+	assert.Equal(t, []string{"ip", "action"}, rule.keyFields)
+	assert.Equal(t, time.Minute, rule.window)
+	assert.Equal(t, "velocity", rule.Type)
+
+	assert.Nil(t, newVelocityRule(2, "bad window", "ip", "", 5, "soon", "denied", 0))
+	assert.Nil(t, newVelocityRule(3, "no threshold", "ip", "", 0, "1m", "denied", 0))
+	assert.Nil(t, newVelocityRule(4, "no fields", " , ", "", 5, "1m", "denied", 0))
+
+	input := &FilterInput{IP: "203.0.113.7", Fields: map[string]string{"action": "signup"}}
+	key, member, ok := rule.key(input)
+	assert.True(t, ok)
+	assert.Equal(t, "1:203.0.113.7\x1fsignup", key)
+	assert.Empty(t, member)
+
+	_, _, ok = rule.key(&FilterInput{IP: "203.0.113.7"})
+	assert.False(t, ok)
+}
+
+func TestEvaluateFilterInput_Velocity(t *testing.T) {
+	engine := GetRuleEngine()
+	previous := engine.Snapshot()
+	defer engine.snapshot.Store(previous)
+
+	engine.snapshot.Store(BuildRuleSnapshot(RuleSet{
+		Velocities: []models.VelocityRule{
+			{ID: 9001, Name: "signups per ip", KeyFields: "ip,action", Threshold: 2, Window: "1m", Status: "denied"},
+			{ID: 9002, Name: "ips per email", KeyFields: "email", DistinctField: "ip", Threshold: 1, Window: "1h", Status: "monitor"},
+		},
+	}))
+
+	evaluate := func(ip, email string) FilterResultWithResolvedData {
+		input := NewFilterInput(map[string]interface{}{"ip": ip, "email": email, "action": "signup", "country": "US", "asn": "AS1"})
+		assert.False(t, input.Cacheable())
+		result, err := EvaluateFilterInput(context.Background(), input)
+		assert.NoError(t, err)
+		return result
+	}
+
+	assert.Equal(t, "allowed", evaluate("192.0.2.10", "velocity@example.com").Result)
+	assert.Equal(t, "allowed", evaluate("192.0.2.10", "velocity@example.com").Result)
+
+	result := evaluate("192.0.2.10", "velocity@example.com").FilterResult
+	assert.Equal(t, "denied", result.Result)
+	assert.Equal(t, "velocity denied", result.Reason)
+	assert.Equal(t, uint(9001), result.RuleID)
+	hit, ok := result.Value.(VelocityHit)
+	assert.True(t, ok)
+	assert.Equal(t, int64(3), hit.Count)
+	assert.Equal(t, "1m0s", hit.Window)
+	assert.Equal(t, "192.0.2.10,signup", hit.Key)
+
+	// A second IP for the email only trips the monitor rule
+	resolved := evaluate("192.0.2.11", "velocity@example.com")
+	assert.Equal(t, "allowed", resolved.Result)
+	if assert.Len(t, resolved.Trace.Monitor, 1) {
+		assert.Equal(t, uint(9002), resolved.Trace.Monitor[0].RuleID)
+		assert.Equal(t, "velocity", resolved.Trace.Monitor[0].Filter)
+	}
+
+	// Inputs without the key fields are not counted and may be cached
+	assert.True(t, NewFilterInput(map[string]interface{}{"ip": "192.0.2.10"}).Cacheable())
+}
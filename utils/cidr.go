@@ -2,96 +2,177 @@ package utils
 
 import (
 	"fmt"
-	"net"
+	"math/big"
+	"net/netip"
 	"strings"
 )
 
 // CIDRInfo contains information about a CIDR block
 type CIDRInfo struct {
-	Network  string
-	Mask     int
-	StartIP  net.IP
-	EndIP    net.IP
-	TotalIPs uint64
+	Network  string       // Canonical prefix, single IPs as /32 (IPv4) or /128 (IPv6)
+	Mask     int          // Prefix length
+	Prefix   netip.Prefix // Normalized prefix, see NormalizePrefix
+	StartIP  netip.Addr
+	EndIP    netip.Addr
+	TotalIPs *big.Int // Number of addresses; IPv6 blocks exceed uint64
+	IsIPv6   bool
 	IsValid  bool
 }
 
-// ParseCIDR parses a CIDR string and returns CIDRInfo
-func ParseCIDR(cidr string) (*CIDRInfo, error) {
-	// Handle single IP addresses (not CIDR)
+// NormalizeAddr strips zones and unmaps IPv4-mapped IPv6 addresses (::ffff:1.2.3.4 -> 1.2.3.4),
+// so an address has one form in rules, conflict checks and the IP filter
+func NormalizeAddr(addr netip.Addr) netip.Addr {
+	return addr.WithZone("").Unmap()
+}
+
+// NormalizePrefix masks the prefix and maps ::ffff:0:0/96 sub-prefixes onto IPv4
+// (::ffff:10.0.0.0/104 -> 10.0.0.0/8). Shorter IPv6 prefixes stay IPv6 and never contain IPv4 addresses
+func NormalizePrefix(prefix netip.Prefix) netip.Prefix {
+	addr := prefix.Addr().WithZone("")
+	bits := prefix.Bits()
+	if addr.Is4In6() && bits >= 96 {
+		return netip.PrefixFrom(addr.Unmap(), bits-96).Masked()
+	}
+	return netip.PrefixFrom(addr, bits).Masked()
+}
+
+// ParseAddr parses and normalizes a single IP address; zones are rejected
+func ParseAddr(ip string) (netip.Addr, error) {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil || addr.Zone() != "" {
+		return netip.Addr{}, fmt.Errorf("invalid IP address: %s", ip)
+	}
+	return NormalizeAddr(addr), nil
+}
+
+// ParsePrefix parses and normalizes a CIDR block; a single IP becomes a /32 or /128 prefix
+func ParsePrefix(cidr string) (netip.Prefix, error) {
 	if !strings.Contains(cidr, "/") {
-		ip := net.ParseIP(cidr)
-		if ip == nil {
-			return nil, fmt.Errorf("invalid IP address: %s", cidr)
+		addr, err := ParseAddr(cidr)
+		if err != nil {
+			return netip.Prefix{}, err
 		}
-		return &CIDRInfo{
-			Network:  cidr + "/32", // Single IP as /32
-			Mask:     32,
-			StartIP:  ip,
-			EndIP:    ip,
-			TotalIPs: 1,
-			IsValid:  true,
-		}, nil
+		return netip.PrefixFrom(addr, addr.BitLen()), nil
 	}
-
-	// Parse CIDR notation
-	_, ipNet, err := net.ParseCIDR(cidr)
+	prefix, err := netip.ParsePrefix(cidr)
 	if err != nil {
-		return nil, fmt.Errorf("invalid CIDR notation: %s", err)
+		return netip.Prefix{}, fmt.Errorf("invalid CIDR notation: %s", err)
 	}
+	return NormalizePrefix(prefix), nil
+}
 
-	// Calculate network information
-	mask, _ := ipNet.Mask.Size()
-	startIP := ipNet.IP
-	endIP := make(net.IP, len(startIP))
-	copy(endIP, startIP)
-
-	// Calculate end IP
-	for i := range endIP {
-		endIP[i] = startIP[i] | ^ipNet.Mask[i]
+// CanonicalIP returns the canonical form of an IP address, CIDR block or range (lower-case and
+// compressed IPv6, unmapped IPv4, masked prefix, "start-end"), or the input unchanged if it cannot be parsed
+func CanonicalIP(ip string) string {
+	if IsRangeNotation(ip) {
+		if r, err := ParseIPRange(ip); err == nil {
+			return r.String()
+		}
+		return ip
 	}
+	if strings.Contains(ip, "/") {
+		if prefix, err := ParsePrefix(ip); err == nil {
+			return prefix.String()
+		}
+		return ip
+	}
+	if addr, err := ParseAddr(ip); err == nil {
+		return addr.String()
+	}
+	return ip
+}
 
-	// Calculate total IPs in range
-	totalIPs := uint64(1) << (32 - mask)
+// ParseCIDR parses a CIDR string (or a single IP) and returns CIDRInfo
+func ParseCIDR(cidr string) (*CIDRInfo, error) {
+	prefix, err := ParsePrefix(cidr)
+	if err != nil {
+		return nil, err
+	}
+	start, end := PrefixRange(prefix)
 
 	return &CIDRInfo{
-		Network:  cidr,
-		Mask:     mask,
-		StartIP:  startIP,
-		EndIP:    endIP,
-		TotalIPs: totalIPs,
+		Network:  prefix.String(),
+		Mask:     prefix.Bits(),
+		Prefix:   prefix,
+		StartIP:  start,
+		EndIP:    end,
+		TotalIPs: PrefixSize(prefix),
+		IsIPv6:   prefix.Addr().Is6(),
 		IsValid:  true,
 	}, nil
 }
 
+// PrefixRange returns the first and the last address of a prefix
+func PrefixRange(prefix netip.Prefix) (netip.Addr, netip.Addr) {
+	prefix = prefix.Masked()
+	start := prefix.Addr()
+	bytes := start.AsSlice()
+	hostBits := start.BitLen() - prefix.Bits()
+	for i := len(bytes) - 1; hostBits > 0; i-- {
+		if hostBits >= 8 {
+			bytes[i] = 0xff
+			hostBits -= 8
+			continue
+		}
+		bytes[i] |= byte(1<<hostBits - 1)
+		hostBits = 0
+	}
+	end, _ := netip.AddrFromSlice(bytes)
+	return start, end
+}
+
+// PrefixSize returns the number of addresses in a prefix (2^(32-bits) or 2^(128-bits))
+func PrefixSize(prefix netip.Prefix) *big.Int {
+	return new(big.Int).Lsh(big.NewInt(1), uint(prefix.Addr().BitLen()-prefix.Bits()))
+}
+
+// AddrToInt converts an address to an integer for range math; IPv4 and IPv6 use separate
+// number spaces, so only compare addresses of one family
+func AddrToInt(addr netip.Addr) *big.Int {
+	return new(big.Int).SetBytes(addr.AsSlice())
+}
+
+// IntToAddr converts an integer back to an IPv4 (ipv6 false) or IPv6 address
+func IntToAddr(n *big.Int, ipv6 bool) (netip.Addr, error) {
+	size := 4
+	if ipv6 {
+		size = 16
+	}
+	if n.Sign() < 0 || n.BitLen() > size*8 {
+		return netip.Addr{}, fmt.Errorf("%s is out of range for a %d-bit address", n, size*8)
+	}
+	addr, _ := netip.AddrFromSlice(n.FillBytes(make([]byte, size)))
+	return addr, nil
+}
+
 // IsIPInCIDR checks if an IP address falls within a CIDR block
 func IsIPInCIDR(ipStr, cidrStr string) (bool, error) {
 	// Parse the IP to check
-	ip := net.ParseIP(ipStr)
-	if ip == nil {
-		return false, fmt.Errorf("invalid IP address: %s", ipStr)
+	addr, err := ParseAddr(ipStr)
+	if err != nil {
+		return false, err
 	}
 
 	// Parse the CIDR block
-	_, ipNet, err := net.ParseCIDR(cidrStr)
-	if err != nil {
-		return false, fmt.Errorf("invalid CIDR notation: %s", err)
+	prefix, err := ParsePrefix(cidrStr)
+	if err != nil || !strings.Contains(cidrStr, "/") {
+		return false, fmt.Errorf("invalid CIDR notation: %s", cidrStr)
 	}
 
 	// Check if IP is in the network
-	return ipNet.Contains(ip), nil
+	return prefix.Contains(addr), nil
 }
 
 // ValidateCIDR checks if a string is valid CIDR notation
 func ValidateCIDR(cidr string) bool {
-	_, _, err := net.ParseCIDR(cidr)
+	_, err := netip.ParsePrefix(cidr)
 	return err == nil
 }
 
 // IsSingleIP checks if a string represents a single IP (not CIDR)
 func IsSingleIP(ipStr string) bool {
-	ip := net.ParseIP(ipStr)
-	return ip != nil && !strings.Contains(ipStr, "/")
+	_, err := ParseAddr(ipStr)
+	return err == nil
 }
 
 // IsCIDRNotation checks if a string is CIDR notation
@@ -100,10 +181,10 @@ func IsCIDRNotation(ipStr string) bool {
 }
 
 // GetCIDRRange returns the start and end IPs of a CIDR block
-func GetCIDRRange(cidr string) (net.IP, net.IP, error) {
+func GetCIDRRange(cidr string) (netip.Addr, netip.Addr, error) {
 	info, err := ParseCIDR(cidr)
 	if err != nil {
-		return nil, nil, err
+		return netip.Addr{}, netip.Addr{}, err
 	}
 	return info.StartIP, info.EndIP, nil
 }
@@ -115,57 +196,44 @@ func FormatCIDRInfo(cidr string) (string, error) {
 		return "", err
 	}
 
-	if info.TotalIPs == 1 {
+	if info.StartIP == info.EndIP {
 		return fmt.Sprintf("Single IP: %s", info.StartIP.String()), nil
 	}
 
-	return fmt.Sprintf("Range: %s to %s (%d IPs)",
+	return fmt.Sprintf("Range: %s to %s (%s IPs)",
 		info.StartIP.String(),
 		info.EndIP.String(),
-		info.TotalIPs), nil
-}
-
-// IPToUint32 converts an IP address to uint32 for comparison
-func IPToUint32(ip net.IP) uint32 {
-	ip = ip.To4()
-	if ip == nil {
-		return 0
-	}
-	return uint32(ip[0])<<24 + uint32(ip[1])<<16 + uint32(ip[2])<<8 + uint32(ip[3])
-}
-
-// Uint32ToIP converts uint32 back to IP address
-func Uint32ToIP(ipInt uint32) net.IP {
-	return net.IPv4(byte(ipInt>>24), byte(ipInt>>16), byte(ipInt>>8), byte(ipInt))
+		info.TotalIPs.String()), nil
 }
 
 // ConflictInfo contains information about IP/CIDR conflicts
 type ConflictInfo struct {
-	Type        string   `json:"type"`        // "ip_in_cidr", "cidr_overlaps", "exact_match"
+	Type        string   `json:"type"`        // "ip_in_cidr", "cidr_covers_ip", "cidr_overlaps", "exact_match"
 	Message     string   `json:"message"`     // Human-readable message
 	Conflicting []string `json:"conflicting"` // List of conflicting entries
 	Severity    string   `json:"severity"`    // "warning", "error", "info"
 	Status      string   `json:"status"`      // Status of conflicting entry
 }
 
-// CheckIPConflicts checks if an IP address conflicts with existing CIDR ranges
+// CheckIPConflicts checks if an IP address conflicts with existing CIDR blocks or start-end ranges.
+// IPv4-mapped IPv6 addresses and prefixes are compared as IPv4, like the IP filter does
 func CheckIPConflicts(ip string, existingCIDRs []string, existingStatuses map[string]string, newStatus string) ([]ConflictInfo, error) {
 	var conflicts []ConflictInfo
 
 	// Parse the IP to check
-	ipAddr := net.ParseIP(ip)
-	if ipAddr == nil {
-		return nil, fmt.Errorf("invalid IP address: %s", ip)
+	addr, err := ParseAddr(ip)
+	if err != nil {
+		return nil, err
 	}
 
 	for _, cidr := range existingCIDRs {
 		// Check if IP is within this CIDR range
-		_, ipNet, err := net.ParseCIDR(cidr)
+		span, err := ParseIPRange(cidr)
 		if err != nil {
 			continue // Skip invalid CIDR
 		}
 
-		if ipNet.Contains(ipAddr) {
+		if span.Contains(addr) {
 			cidrStatus := existingStatuses[cidr]
 			severity := "warning"
 
@@ -187,30 +255,27 @@ func CheckIPConflicts(ip string, existingCIDRs []string, existingStatuses map[st
 	return conflicts, nil
 }
 
-// CheckCIDRConflicts checks if a CIDR range conflicts with existing IPs or CIDR ranges
+// CheckCIDRConflicts checks if a CIDR block or start-end range conflicts with existing IPs, CIDR blocks
+// or ranges (both passed in existingCIDRs). Entries are compared by the addresses they cover, so
+// 10.0.0.1/8, ::ffff:10.0.0.0/104 and 10.0.0.0-10.255.255.255 all equal 10.0.0.0/8
 func CheckCIDRConflicts(newCIDR string, existingIPs []string, existingCIDRs []string, existingStatuses map[string]string, newStatus string) ([]ConflictInfo, error) {
 	var conflicts []ConflictInfo
 
 	// Parse the new CIDR
-	_, err := ParseCIDR(newCIDR)
+	newRange, err := ParseIPRange(newCIDR)
 	if err != nil {
 		return nil, fmt.Errorf("invalid CIDR: %s", err)
 	}
 
 	// Check conflicts with existing individual IPs
 	for _, ip := range existingIPs {
-		ipAddr := net.ParseIP(ip)
-		if ipAddr == nil {
+		addr, err := ParseAddr(ip)
+		if err != nil {
 			continue // Skip invalid IPs
 		}
 
 		// Check if this IP is within the new CIDR range
-		_, ipNet, err := net.ParseCIDR(newCIDR)
-		if err != nil {
-			continue
-		}
-
-		if ipNet.Contains(ipAddr) {
+		if newRange.Contains(addr) {
 			ipStatus := existingStatuses[ip]
 			severity := "warning"
 
@@ -231,7 +296,12 @@ func CheckCIDRConflicts(newCIDR string, existingIPs []string, existingCIDRs []st
 
 	// Check conflicts with existing CIDR ranges
 	for _, existingCIDR := range existingCIDRs {
-		if existingCIDR == newCIDR {
+		existingRange, err := ParseIPRange(existingCIDR)
+		if err != nil {
+			continue // Skip invalid CIDR
+		}
+
+		if existingRange == newRange {
 			// Exact match
 			cidrStatus := existingStatuses[existingCIDR]
 			conflicts = append(conflicts, ConflictInfo{
@@ -245,12 +315,7 @@ func CheckCIDRConflicts(newCIDR string, existingIPs []string, existingCIDRs []st
 		}
 
 		// Check for overlap
-		overlap, err := CheckCIDROverlap(newCIDR, existingCIDR)
-		if err != nil {
-			continue // Skip invalid CIDR
-		}
-
-		if overlap {
+		if newRange.Overlaps(existingRange) {
 			cidrStatus := existingStatuses[existingCIDR]
 			severity := "error"
 
@@ -261,9 +326,16 @@ func CheckCIDRConflicts(newCIDR string, existingIPs []string, existingCIDRs []st
 				severity = "warning" // Different status, allow with warning
 			}
 
+			message := fmt.Sprintf("CIDR range %s overlaps with existing range %s (status: %s)", newCIDR, existingCIDR, cidrStatus)
+			if existingRange.ContainsRange(newRange) {
+				message = fmt.Sprintf("CIDR range %s is within existing range %s (status: %s)", newCIDR, existingCIDR, cidrStatus)
+			} else if newRange.ContainsRange(existingRange) {
+				message = fmt.Sprintf("CIDR range %s would cover existing range %s (status: %s)", newCIDR, existingCIDR, cidrStatus)
+			}
+
 			conflicts = append(conflicts, ConflictInfo{
 				Type:        "cidr_overlaps",
-				Message:     fmt.Sprintf("CIDR range %s overlaps with existing range %s (status: %s)", newCIDR, existingCIDR, cidrStatus),
+				Message:     message,
 				Conflicting: []string{existingCIDR},
 				Severity:    severity,
 				Status:      cidrStatus,
@@ -274,70 +346,43 @@ func CheckCIDRConflicts(newCIDR string, existingIPs []string, existingCIDRs []st
 	return conflicts, nil
 }
 
-// CheckCIDROverlap checks if two CIDR ranges overlap
+// CheckCIDROverlap checks if two CIDR blocks or ranges overlap
 func CheckCIDROverlap(cidr1, cidr2 string) (bool, error) {
 	// Parse both CIDR ranges
-	_, ipNet1, err := net.ParseCIDR(cidr1)
+	range1, err := ParseIPRange(cidr1)
 	if err != nil {
 		return false, fmt.Errorf("invalid CIDR 1: %s", err)
 	}
 
-	_, ipNet2, err := net.ParseCIDR(cidr2)
+	range2, err := ParseIPRange(cidr2)
 	if err != nil {
 		return false, fmt.Errorf("invalid CIDR 2: %s", err)
 	}
 
-	// Check if either network contains the other's start IP
-	return ipNet1.Contains(ipNet2.IP) || ipNet2.Contains(ipNet1.IP), nil
+	return range1.Overlaps(range2), nil
 }
 
-// GetConflictingEntries returns all entries that would conflict with a new IP or CIDR
+// GetConflictingEntries returns all entries that would conflict with a new IP, CIDR or range
 func GetConflictingEntries(newEntry string, existingEntries []string) ([]string, error) {
 	var conflicts []string
 
-	// Determine if new entry is IP or CIDR
-	if IsSingleIP(newEntry) {
-		// Check if IP conflicts with existing CIDR ranges
-		for _, existing := range existingEntries {
-			if IsCIDRNotation(existing) {
-				_, ipNet, err := net.ParseCIDR(existing)
-				if err != nil {
-					continue
-				}
-
-				ip := net.ParseIP(newEntry)
-				if ip != nil && ipNet.Contains(ip) {
-					conflicts = append(conflicts, existing)
-				}
-			}
-		}
-	} else if IsCIDRNotation(newEntry) {
-		// Check if CIDR conflicts with existing entries
-		for _, existing := range existingEntries {
-			if existing == newEntry {
-				// Exact match
-				conflicts = append(conflicts, existing)
-				continue
-			}
+	newRange, err := ParseIPRange(newEntry)
+	if err != nil {
+		return conflicts, nil
+	}
 
-			if IsCIDRNotation(existing) {
-				// Check CIDR overlap
-				overlap, err := CheckCIDROverlap(newEntry, existing)
-				if err == nil && overlap {
-					conflicts = append(conflicts, existing)
-				}
-			} else {
-				// Check if existing IP is within new CIDR
-				_, ipNet, err := net.ParseCIDR(newEntry)
-				if err != nil {
-					continue
-				}
-
-				ip := net.ParseIP(existing)
-				if ip != nil && ipNet.Contains(ip) {
-					conflicts = append(conflicts, existing)
-				}
-			}
+	// IPs are one-address ranges: an IP conflicts with the CIDR blocks and ranges that contain it,
+	// a CIDR block or range with equal, overlapping and covered entries
+	for _, existing := range existingEntries {
+		existingRange, err := ParseIPRange(existing)
+		if err != nil {
+			continue
+		}
+		if IsSingleIP(newEntry) && IsSingleIP(existing) {
+			continue
+		}
+		if newRange.Overlaps(existingRange) {
+			conflicts = append(conflicts, existing)
 		}
 	}
 
@@ -0,0 +1,159 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCanonicalIP(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"192.0.2.1", "192.0.2.1"},
+		{"2001:DB8:0:0::1", "2001:db8::1"},
+		{"::ffff:192.0.2.1", "192.0.2.1"},
+		{"::FFFF:C000:0201", "192.0.2.1"},
+		{"10.1.2.3/8", "10.0.0.0/8"},
+		{"2001:db8::1/32", "2001:db8::/32"},
+		{"::ffff:10.0.0.0/104", "10.0.0.0/8"},
+		{"::ffff:0:0/96", "0.0.0.0/0"},
+		{"0.0.0.0/0", "0.0.0.0/0"},
+		{"::/0", "::/0"},
+		{"::ffff:10.0.0.1 - ::ffff:10.0.0.9", "10.0.0.1-10.0.0.9"},
+		{"2001:DB8::1-2001:DB8::FF", "2001:db8::1-2001:db8::ff"},
+		// Unparseable input is returned unchanged
+		{"10.0.0.9-10.0.0.1", "10.0.0.9-10.0.0.1"},
+		{"10.0.0.1-2001:db8::1", "10.0.0.1-2001:db8::1"},
+		{"fe80::1%eth0", "fe80::1%eth0"},
+		{"10.0.0.0/33", "10.0.0.0/33"},
+		{"not an ip", "not an ip"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			assert.Equal(t, tt.want, CanonicalIP(tt.input))
+		})
+	}
+}
+
+func TestParseCIDR(t *testing.T) {
+	info, err := ParseCIDR("2001:db8::/126")
+	require.NoError(t, err)
+	assert.True(t, info.IsIPv6)
+	assert.Equal(t, "2001:db8::3", info.EndIP.String())
+	assert.Equal(t, "4", info.TotalIPs.String())
+
+	info, err = ParseCIDR("::/0")
+	require.NoError(t, err)
+	assert.Equal(t, "ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff", info.EndIP.String())
+	assert.Equal(t, "340282366920938463463374607431768211456", info.TotalIPs.String())
+
+	info, err = ParseCIDR("::ffff:192.0.2.0/120")
+	require.NoError(t, err)
+	assert.False(t, info.IsIPv6)
+	assert.Equal(t, "192.0.2.0/24", info.Network)
+}
+
+func TestCheckIPConflicts(t *testing.T) {
+	statuses := map[string]string{"10.0.0.0/8": "denied", "2001:db8::/32": "allowed", "2001:db8::10-2001:db8::20": "denied"}
+	existing := []string{"10.0.0.0/8", "2001:db8::/32", "2001:db8::10-2001:db8::20"}
+
+	tests := []struct {
+		name      string
+		ip        string
+		want      []string
+		severity  string
+		newStatus string
+	}{
+		{"ipv4 in cidr", "10.1.2.3", []string{"10.0.0.0/8"}, "error", "denied"},
+		{"ipv4-mapped ipv6 is compared as ipv4", "::ffff:10.1.2.3", []string{"10.0.0.0/8"}, "error", "denied"},
+		{"ipv6 in cidr and range", "2001:db8::10", []string{"2001:db8::/32", "2001:db8::10-2001:db8::20"}, "warning", "denied"},
+		{"ipv6 outside the range", "2001:db8::21", []string{"2001:db8::/32"}, "warning", "denied"},
+		{"ipv4 never matches ipv6", "192.0.2.1", nil, "", "denied"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conflicts, err := CheckIPConflicts(tt.ip, existing, statuses, tt.newStatus)
+			require.NoError(t, err)
+			var got []string
+			for _, c := range conflicts {
+				assert.Equal(t, "ip_in_cidr", c.Type)
+				got = append(got, c.Conflicting[0])
+			}
+			assert.Equal(t, tt.want, got)
+			if tt.severity != "" {
+				assert.Equal(t, tt.severity, conflicts[0].Severity)
+			}
+		})
+	}
+}
+
+func TestCheckCIDRConflicts(t *testing.T) {
+	tests := []struct {
+		name     string
+		newCIDR  string
+		ips      []string
+		cidrs    []string
+		wantType string
+		message  string
+	}{
+		{"mapped prefix equals ipv4", "10.0.0.0/8", nil, []string{"::ffff:10.0.0.0/104"}, "exact_match", "already exists"},
+		{"range equals cidr", "10.0.0.0-10.255.255.255", nil, []string{"10.0.0.0/8"}, "exact_match", "already exists"},
+		{"ipv6 within", "2001:db8:1::/48", nil, []string{"2001:db8::/32"}, "cidr_overlaps", "is within existing range"},
+		{"ipv6 covers", "2001:db8::/32", nil, []string{"2001:db8:1::/48"}, "cidr_overlaps", "would cover existing range"},
+		{"ipv6 shares a boundary address", "2001:db8::/127", nil, []string{"2001:db8::1-2001:db8::5"}, "cidr_overlaps", "overlaps with existing range"},
+		{"ipv6 adjacent", "2001:db8::/127", nil, []string{"2001:db8::2-2001:db8::5"}, "", ""},
+		{"all ipv6 and ipv4", "::/0", nil, []string{"10.0.0.0/8"}, "", ""},
+		{"all ipv4 and ipv6", "0.0.0.0/0", nil, []string{"2001:db8::/32"}, "", ""},
+		{"covers an ipv4-mapped ip", "0.0.0.0/0", []string{"::ffff:192.0.2.1"}, nil, "cidr_covers_ip", "would cover existing IP"},
+		{"all ipv6 does not cover an ipv4-mapped ip", "::/0", []string{"::ffff:192.0.2.1"}, nil, "", ""},
+		{"ipv6 covers ip", "2001:db8::/64", []string{"2001:db8::1"}, nil, "cidr_covers_ip", "would cover existing IP"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conflicts, err := CheckCIDRConflicts(tt.newCIDR, tt.ips, tt.cidrs, map[string]string{}, "denied")
+			require.NoError(t, err)
+			if tt.wantType == "" {
+				assert.Empty(t, conflicts)
+				return
+			}
+			require.Len(t, conflicts, 1)
+			assert.Equal(t, tt.wantType, conflicts[0].Type)
+			assert.Contains(t, conflicts[0].Message, tt.message)
+		})
+	}
+
+	// The severity depends on the status of the existing entry
+	statuses := map[string]string{"2001:db8::/32": "denied"}
+	conflicts, err := CheckCIDRConflicts("2001:db8:1::/48", nil, []string{"2001:db8::/32"}, statuses, "denied")
+	require.NoError(t, err)
+	assert.Equal(t, "error", conflicts[0].Severity)
+	conflicts, err = CheckCIDRConflicts("2001:db8:1::/48", nil, []string{"2001:db8::/32"}, statuses, "allowed")
+	require.NoError(t, err)
+	assert.Equal(t, "warning", conflicts[0].Severity)
+
+	_, err = CheckCIDRConflicts("2001:db8::ff-2001:db8::1", nil, nil, statuses, "denied")
+	assert.Error(t, err)
+}
+
+func TestGetConflictingEntries(t *testing.T) {
+	existing := []string{"10.0.0.0/8", "10.0.0.1", "2001:db8::/32", "2001:db8::1", "::ffff:192.0.2.0/120"}
+
+	conflicts, err := GetConflictingEntries("2001:db8::/64", existing)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"2001:db8::/32", "2001:db8::1"}, conflicts)
+
+	// Two single IPs never conflict with each other
+	conflicts, err = GetConflictingEntries("10.0.0.1", existing)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"10.0.0.0/8"}, conflicts)
+
+	conflicts, err = GetConflictingEntries("192.0.2.5", existing)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"::ffff:192.0.2.0/120"}, conflicts)
+}
@@ -0,0 +1,29 @@
+package utils
+
+import "math"
+
+// EarthRadiusKm is the mean radius of the earth
+const EarthRadiusKm = 6371.0
+
+// MaxDistanceKm is half the circumference of the earth, the largest possible distance between two points
+const MaxDistanceKm = math.Pi * EarthRadiusKm
+
+// DistanceKm returns the great-circle distance between two coordinates in kilometers (haversine formula)
+func DistanceKm(lat1, lon1, lat2, lon2 float64) float64 {
+	toRad := func(deg float64) float64 { return deg * math.Pi / 180 }
+	dLat := toRad(lat2 - lat1)
+	dLon := toRad(lon2 - lon1)
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(toRad(lat1))*math.Cos(toRad(lat2))*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * EarthRadiusKm * math.Asin(math.Min(1, math.Sqrt(a)))
+}
+
+// Continents are the continent codes of the MaxMind databases
+var Continents = map[string]string{
+	"AF": "Africa",
+	"AN": "Antarctica",
+	"AS": "Asia",
+	"EU": "Europe",
+	"NA": "North America",
+	"OC": "Oceania",
+	"SA": "South America",
+}
@@ -0,0 +1,139 @@
+package utils
+
+import (
+	"fmt"
+	"math/big"
+	"net/netip"
+	"strings"
+)
+
+// IPRange is an inclusive range of addresses of one family
+type IPRange struct {
+	Start netip.Addr
+	End   netip.Addr
+}
+
+// IsRangeNotation checks if a string is start-end range notation (e.g. "203.0.113.7-203.0.113.90"):
+// two non-empty parts around a single dash and no prefix length
+func IsRangeNotation(ipStr string) bool {
+	if strings.Contains(ipStr, "/") {
+		return false
+	}
+	start, end, found := strings.Cut(ipStr, "-")
+	return found && !strings.Contains(end, "-") && strings.TrimSpace(start) != "" && strings.TrimSpace(end) != ""
+}
+
+// ParseIPRange parses range notation ("start-end", spaces around the dash are allowed),
+// a CIDR block or a single IP into a normalized IPRange
+func ParseIPRange(entry string) (IPRange, error) {
+	if !IsRangeNotation(entry) {
+		prefix, err := ParsePrefix(entry)
+		if err != nil {
+			return IPRange{}, err
+		}
+		start, end := PrefixRange(prefix)
+		return IPRange{Start: start, End: end}, nil
+	}
+
+	startStr, endStr, _ := strings.Cut(entry, "-")
+	startStr, endStr = strings.TrimSpace(startStr), strings.TrimSpace(endStr)
+	start, err := ParseAddr(startStr)
+	if err != nil {
+		return IPRange{}, fmt.Errorf("invalid range start: %s", startStr)
+	}
+	end, err := ParseAddr(endStr)
+	if err != nil {
+		return IPRange{}, fmt.Errorf("invalid range end: %s", endStr)
+	}
+	if start.Is4() != end.Is4() {
+		return IPRange{}, fmt.Errorf("IP range mixes IPv4 and IPv6: %s", entry)
+	}
+	if end.Less(start) {
+		return IPRange{}, fmt.Errorf("IP range start is after its end: %s", entry)
+	}
+	return IPRange{Start: start, End: end}, nil
+}
+
+// String returns the canonical range notation
+func (r IPRange) String() string {
+	return r.Start.String() + "-" + r.End.String()
+}
+
+// Contains reports whether addr lies within the range
+func (r IPRange) Contains(addr netip.Addr) bool {
+	addr = NormalizeAddr(addr)
+	return addr.Is4() == r.Start.Is4() && !addr.Less(r.Start) && !r.End.Less(addr)
+}
+
+// Overlaps reports whether two ranges share an address; ranges of different families never do
+func (r IPRange) Overlaps(o IPRange) bool {
+	return r.Start.Is4() == o.Start.Is4() && !r.End.Less(o.Start) && !o.End.Less(r.Start)
+}
+
+// ContainsRange reports whether o lies completely within r
+func (r IPRange) ContainsRange(o IPRange) bool {
+	return r.Start.Is4() == o.Start.Is4() && !o.Start.Less(r.Start) && !r.End.Less(o.End)
+}
+
+// Size returns the number of addresses in the range
+func (r IPRange) Size() *big.Int {
+	size := new(big.Int).Sub(AddrToInt(r.End), AddrToInt(r.Start))
+	return size.Add(size, big.NewInt(1))
+}
+
+// Bits returns the length of the smallest prefix containing the whole range
+func (r IPRange) Bits() int {
+	start, end := r.Start.AsSlice(), r.End.AsSlice()
+	for i := range start {
+		if diff := start[i] ^ end[i]; diff != 0 {
+			bits := i * 8
+			for diff&0x80 == 0 {
+				diff <<= 1
+				bits++
+			}
+			return bits
+		}
+	}
+	return r.Start.BitLen()
+}
+
+// Prefixes returns the minimal list of CIDR blocks that exactly cover the range, in address order
+func (r IPRange) Prefixes() []netip.Prefix {
+	var prefixes []netip.Prefix
+	bitLen := r.Start.BitLen()
+	start, end := AddrToInt(r.Start), AddrToInt(r.End)
+	one := big.NewInt(1)
+
+	for start.Cmp(end) <= 0 {
+		// The largest block aligned at start that does not run past end
+		hostBits := 0
+		if start.Sign() == 0 {
+			hostBits = bitLen
+		} else {
+			hostBits = int(start.TrailingZeroBits())
+		}
+		remaining := new(big.Int).Sub(end, start)
+		remaining.Add(remaining, one)
+		for hostBits > 0 && new(big.Int).Lsh(one, uint(hostBits)).Cmp(remaining) > 0 {
+			hostBits--
+		}
+
+		addr, _ := IntToAddr(start, bitLen == 128)
+		prefixes = append(prefixes, netip.PrefixFrom(addr, bitLen-hostBits))
+		start.Add(start, new(big.Int).Lsh(one, uint(hostBits)))
+	}
+	return prefixes
+}
+
+// RangeCIDRs returns the minimal CIDR decomposition of a range in string form
+func RangeCIDRs(entry string) ([]string, error) {
+	r, err := ParseIPRange(entry)
+	if err != nil {
+		return nil, err
+	}
+	var cidrs []string
+	for _, prefix := range r.Prefixes() {
+		cidrs = append(cidrs, prefix.String())
+	}
+	return cidrs, nil
+}
@@ -0,0 +1,169 @@
+package utils
+
+import (
+	"math/big"
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseIPRange(t *testing.T) {
+	tests := []struct {
+		name    string
+		entry   string
+		want    string
+		wantErr bool
+	}{
+		{"range", "10.0.0.5-10.0.0.20", "10.0.0.5-10.0.0.20", false},
+		{"spaces around the dash", " 10.0.0.5 - 10.0.0.20 ", "10.0.0.5-10.0.0.20", false},
+		{"single address", "192.0.2.1-192.0.2.1", "192.0.2.1-192.0.2.1", false},
+		{"ipv6 range", "2001:DB8::1-2001:db8::ff", "2001:db8::1-2001:db8::ff", false},
+		{"ipv4-mapped range is unmapped", "::ffff:10.0.0.1-::ffff:10.0.0.9", "10.0.0.1-10.0.0.9", false},
+		{"cidr", "10.1.2.3/8", "10.0.0.0-10.255.255.255", false},
+		{"all ipv4", "0.0.0.0/0", "0.0.0.0-255.255.255.255", false},
+		{"all ipv6", "::/0", "::-ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff", false},
+		{"ipv4-mapped cidr is unmapped", "::ffff:10.0.0.0/104", "10.0.0.0-10.255.255.255", false},
+		{"single ip", "2001:db8::1", "2001:db8::1-2001:db8::1", false},
+		{"reversed", "10.0.0.20-10.0.0.5", "", true},
+		{"reversed ipv6", "2001:db8::ff-2001:db8::1", "", true},
+		{"mixed families", "10.0.0.1-2001:db8::1", "", true},
+		{"mapped start with ipv6 end", "::ffff:10.0.0.1-2001:db8::1", "", true},
+		{"invalid start", "10.0.0-10.0.0.5", "", true},
+		{"zone", "fe80::1%eth0-fe80::2", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := ParseIPRange(tt.entry)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, r.String())
+		})
+	}
+}
+
+func TestIPRange_Prefixes(t *testing.T) {
+	tests := []struct {
+		name  string
+		entry string
+		want  []string
+	}{
+		{"non-aligned ipv4", "10.0.0.5-10.0.0.20", []string{"10.0.0.5/32", "10.0.0.6/31", "10.0.0.8/29", "10.0.0.16/30", "10.0.0.20/32"}},
+		{"aligned block", "192.0.2.0-192.0.2.255", []string{"192.0.2.0/24"}},
+		{"single address", "192.0.2.1-192.0.2.1", []string{"192.0.2.1/32"}},
+		{"all ipv4", "0.0.0.0-255.255.255.255", []string{"0.0.0.0/0"}},
+		{"top of ipv4", "255.255.255.254-255.255.255.255", []string{"255.255.255.254/31"}},
+		{"first address", "0.0.0.0-0.0.0.0", []string{"0.0.0.0/32"}},
+		{"non-aligned ipv6", "2001:db8::1-2001:db8::4", []string{"2001:db8::1/128", "2001:db8::2/127", "2001:db8::4/128"}},
+		{"ipv6 across a /64 boundary", "2001:db8:0:0:ffff:ffff:ffff:ffff-2001:db8:0:1::", []string{"2001:db8::ffff:ffff:ffff:ffff/128", "2001:db8:0:1::/128"}},
+		{"all ipv6", "::-ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff", []string{"::/0"}},
+		{"top of ipv6", "ffff:ffff:ffff:ffff:ffff:ffff:ffff:fffe-ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff", []string{"ffff:ffff:ffff:ffff:ffff:ffff:ffff:fffe/127"}},
+		{"upper half of ipv6", "8000::-ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff", []string{"8000::/1"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cidrs, err := RangeCIDRs(tt.entry)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, cidrs)
+
+			// The prefixes cover exactly the addresses of the range
+			r, _ := ParseIPRange(tt.entry)
+			total := new(big.Int)
+			for _, prefix := range r.Prefixes() {
+				total.Add(total, PrefixSize(prefix))
+			}
+			assert.Equal(t, r.Size().String(), total.String())
+		})
+	}
+}
+
+func TestIPRange_Bits(t *testing.T) {
+	tests := []struct {
+		entry string
+		want  int
+	}{
+		{"10.0.0.5-10.0.0.20", 27},
+		{"10.0.0.0/8", 8},
+		{"192.0.2.1", 32},
+		{"0.0.0.0/0", 0},
+		{"0.0.0.0-128.0.0.0", 0},
+		{"2001:db8::/32", 32},
+		{"2001:db8::1-2001:db8::4", 125},
+		{"2001:db8::1", 128},
+		{"::/0", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.entry, func(t *testing.T) {
+			r, err := ParseIPRange(tt.entry)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, r.Bits())
+		})
+	}
+}
+
+func TestIPRange_Size(t *testing.T) {
+	all6, _ := ParseIPRange("::/0")
+	assert.Equal(t, new(big.Int).Lsh(big.NewInt(1), 128).String(), all6.Size().String())
+
+	all4, _ := ParseIPRange("0.0.0.0/0")
+	assert.Equal(t, "4294967296", all4.Size().String())
+}
+
+func TestIPRange_OverlapsAndContainsRange(t *testing.T) {
+	tests := []struct {
+		name     string
+		a, b     string
+		overlaps bool
+		contains bool // a contains b
+	}{
+		{"equal", "10.0.0.0-10.0.0.9", "10.0.0.0-10.0.0.9", true, true},
+		{"shared last address", "10.0.0.0-10.0.0.9", "10.0.0.9-10.0.0.20", true, false},
+		{"adjacent", "10.0.0.0-10.0.0.9", "10.0.0.10-10.0.0.20", false, false},
+		{"inside at the start", "10.0.0.0-10.0.0.9", "10.0.0.0-10.0.0.5", true, true},
+		{"inside at the end", "10.0.0.0-10.0.0.9", "10.0.0.5-10.0.0.9", true, true},
+		{"one past the end", "10.0.0.0-10.0.0.9", "10.0.0.5-10.0.0.10", true, false},
+		{"covers", "10.0.0.5-10.0.0.6", "10.0.0.0/24", true, false},
+		{"ipv6 shared address", "2001:db8::/127", "2001:db8::1-2001:db8::5", true, false},
+		{"ipv6 adjacent", "2001:db8::/127", "2001:db8::2-2001:db8::5", false, false},
+		{"ipv6 nested", "2001:db8::/32", "2001:db8:1::/48", true, true},
+		{"all ipv6 and all ipv4", "::/0", "0.0.0.0/0", false, false},
+		{"all ipv4 and all ipv6", "0.0.0.0/0", "::/0", false, false},
+		{"all ipv6 and an ipv4-mapped prefix", "::/0", "::ffff:10.0.0.0/104", false, false},
+		{"ipv4 and the matching mapped prefix", "10.0.0.0/8", "::ffff:10.0.0.0/104", true, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, err := ParseIPRange(tt.a)
+			require.NoError(t, err)
+			b, err := ParseIPRange(tt.b)
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.overlaps, a.Overlaps(b))
+			assert.Equal(t, tt.overlaps, b.Overlaps(a))
+			assert.Equal(t, tt.contains, a.ContainsRange(b))
+		})
+	}
+}
+
+func TestIPRange_Contains(t *testing.T) {
+	r, err := ParseIPRange("10.0.0.0/8")
+	require.NoError(t, err)
+
+	assert.True(t, r.Contains(netip.MustParseAddr("10.0.0.0")))
+	assert.True(t, r.Contains(netip.MustParseAddr("10.255.255.255")))
+	assert.True(t, r.Contains(netip.MustParseAddr("::ffff:10.1.2.3")))
+	assert.False(t, r.Contains(netip.MustParseAddr("11.0.0.0")))
+	assert.False(t, r.Contains(netip.MustParseAddr("::a01:203")))
+
+	all6, _ := ParseIPRange("::/0")
+	assert.True(t, all6.Contains(netip.MustParseAddr("2001:db8::1")))
+	assert.False(t, all6.Contains(netip.MustParseAddr("::ffff:10.1.2.3")))
+}
@@ -2,14 +2,22 @@ package validation
 
 import (
 	"fmt"
-	"net"
 	"regexp"
 	"strings"
+	"time"
 	"unicode/utf8"
 
 	"firewall/utils"
 )
 
+var (
+	domainLabelRegex = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9-]{0,61}[A-Za-z0-9])?$`)
+	fieldNameRegex   = regexp.MustCompile(`^[a-z0-9_]{1,50}$`)
+	countryCodeRegex = regexp.MustCompile(`^[A-Za-z]{2}$`)
+	subdivisionRegex = regexp.MustCompile(`^[A-Za-z]{2}-[A-Za-z0-9]{1,3}$`)
+	groupCodeRegex   = regexp.MustCompile(`^[A-Z0-9_]{2,20}$`)
+)
+
 // ValidationError represents a validation error
 type ValidationError struct {
 	Field   string `json:"field"`
@@ -41,7 +49,7 @@ func (vr *ValidationResult) AddError(field, message, value string) {
 	})
 }
 
-// ValidateIP validates an IP address or CIDR block
+// ValidateIP validates an IP address, CIDR block or start-end range
 func ValidateIP(ip string) *ValidationResult {
 	result := NewValidationResult()
 
@@ -50,6 +58,18 @@ func ValidateIP(ip string) *ValidationResult {
 		return result
 	}
 
+	// Check if it's a start-end range
+	if utils.IsRangeNotation(ip) {
+		if _, err := utils.ParseIPRange(ip); err != nil {
+			result.AddError("ip", "Invalid IP range", ip)
+			return result
+		}
+		if len(ip) > 100 {
+			result.AddError("ip", "IP range too long (max 100 characters)", ip)
+		}
+		return result
+	}
+
 	// Check if it's a CIDR block
 	if strings.Contains(ip, "/") {
 		if !utils.ValidateCIDR(ip) {
@@ -57,8 +77,8 @@ func ValidateIP(ip string) *ValidationResult {
 			return result
 		}
 	} else {
-		// Check if it's a valid IP address
-		if net.ParseIP(ip) == nil {
+		// Check if it's a valid IPv4 or IPv6 address
+		if !utils.IsSingleIP(ip) {
 			result.AddError("ip", "Invalid IP address format", ip)
 			return result
 		}
@@ -151,7 +171,7 @@ func ValidateCountry(country string) *ValidationResult {
 	}
 
 	// Check if it's alphabetic
-	if !regexp.MustCompile(`^[A-Za-z]{2}$`).MatchString(country) {
+	if !countryCodeRegex.MatchString(country) {
 		result.AddError("country", "Country code must be alphabetic", country)
 		return result
 	}
@@ -246,10 +266,11 @@ func ValidateStatus(status string) *ValidationResult {
 		"allowed":     true,
 		"denied":      true,
 		"whitelisted": true,
+		"monitor":     true,
 	}
 
 	if !validStatuses[status] {
-		result.AddError("status", "Invalid status (must be 'allowed', 'denied', or 'whitelisted')", status)
+		result.AddError("status", "Invalid status (must be 'allowed', 'denied', 'whitelisted', or 'monitor')", status)
 		return result
 	}
 
@@ -281,6 +302,252 @@ func ValidateRegex(pattern string) *ValidationResult {
 	return result
 }
 
+// ValidateContentRule validates a content rule pattern for its match type (keyword, phrase or regex)
+func ValidateContentRule(pattern, matchType string) *ValidationResult {
+	result := NewValidationResult()
+
+	if strings.TrimSpace(pattern) == "" {
+		result.AddError("pattern", "Pattern cannot be empty", "")
+		return result
+	}
+
+	// Check length
+	if len(pattern) > 500 {
+		result.AddError("pattern", "Pattern too long (max 500 characters)", pattern)
+		return result
+	}
+
+	switch matchType {
+	case "keyword":
+		if len(strings.Fields(pattern)) != 1 {
+			result.AddError("pattern", "Keyword must be a single word (use match type 'phrase' for several words)", pattern)
+		}
+	case "phrase":
+		// Any text is a valid phrase
+	case "regex":
+		return ValidateRegex(pattern)
+	default:
+		result.AddError("match_type", "Invalid match type (must be 'keyword', 'phrase', or 'regex')", matchType)
+	}
+
+	return result
+}
+
+// ValidateEmailDomain validates an email domain rule: "example.com" (the domain only),
+// "*.example.com" (the domain and all of its subdomains) or "*.xyz" (a whole TLD)
+func ValidateEmailDomain(domain string) *ValidationResult {
+	result := NewValidationResult()
+
+	if domain == "" {
+		result.AddError("domain", "Domain cannot be empty", "")
+		return result
+	}
+
+	// Check length
+	if len(domain) > 255 {
+		result.AddError("domain", "Domain too long (max 255 characters)", domain)
+		return result
+	}
+
+	name, wildcard := strings.CutPrefix(strings.TrimSuffix(domain, "."), "*.")
+	labels := strings.Split(name, ".")
+	if !wildcard && len(labels) < 2 {
+		result.AddError("domain", "Domain must contain a dot (use '*.tld' to match a whole TLD)", domain)
+		return result
+	}
+
+	for _, label := range labels {
+		if !domainLabelRegex.MatchString(label) {
+			result.AddError("domain", "Invalid domain format", domain)
+			return result
+		}
+	}
+
+	return result
+}
+
+// ValidateVelocityRule validates the key fields ("ip" or a pair like "email,ip"), the optional
+// distinct field and the window (a duration of at most 24h) of a velocity rule
+func ValidateVelocityRule(keyFields, distinctField, window string) *ValidationResult {
+	result := NewValidationResult()
+
+	fields := strings.Split(keyFields, ",")
+	if len(fields) > 2 {
+		result.AddError("key_fields", "At most two key fields are allowed", keyFields)
+	}
+	seen := make(map[string]bool)
+	for _, field := range fields {
+		field = strings.TrimSpace(field)
+		if !fieldNameRegex.MatchString(field) {
+			result.AddError("key_fields", "Invalid field name", field)
+			continue
+		}
+		if seen[field] {
+			result.AddError("key_fields", "Duplicate field", field)
+		}
+		seen[field] = true
+	}
+
+	if distinctField != "" {
+		if !fieldNameRegex.MatchString(distinctField) {
+			result.AddError("distinct_field", "Invalid field name", distinctField)
+		} else if seen[distinctField] {
+			result.AddError("distinct_field", "Distinct field cannot be one of the key fields", distinctField)
+		}
+	}
+
+	duration, err := time.ParseDuration(window)
+	if err != nil || duration <= 0 {
+		result.AddError("window", "Invalid duration (e.g. '1m', '1h')", window)
+	} else if duration > 24*time.Hour {
+		result.AddError("window", "Window too long (max 24h)", window)
+	}
+
+	return result
+}
+
+// ValidateCompositeCondition validates a single condition of a composite rule: the field name,
+// the match type and the value (exact, regex, cidr) or the list of values (in) it needs
+func ValidateCompositeCondition(field, match, value string, values []string) *ValidationResult {
+	result := NewValidationResult()
+
+	if !fieldNameRegex.MatchString(field) {
+		result.AddError("field", "Invalid field name", field)
+	}
+
+	switch match {
+	case "exact":
+		if strings.TrimSpace(value) == "" {
+			result.AddError("value", "Value cannot be empty", "")
+		} else if len(value) > 500 {
+			result.AddError("value", "Value too long (max 500 characters)", value)
+		}
+	case "regex":
+		for _, err := range ValidateRegex(value).Errors {
+			result.AddError("value", err.Message, err.Value)
+		}
+	case "cidr":
+		if !utils.IsCIDRNotation(value) && !utils.IsRangeNotation(value) {
+			result.AddError("value", "Value must be a CIDR block or a start-end range", value)
+		} else if _, err := utils.ParseIPRange(value); err != nil {
+			result.AddError("value", "Invalid CIDR block or range", value)
+		}
+	case "in":
+		if len(values) == 0 {
+			result.AddError("values", "At least one value is required", "")
+		} else if len(values) > 1000 {
+			result.AddError("values", "Too many values (max 1000)", "")
+		}
+		for _, v := range values {
+			if strings.TrimSpace(v) == "" {
+				result.AddError("values", "Value cannot be empty", "")
+				break
+			}
+		}
+	default:
+		result.AddError("match", "Invalid match type (must be 'exact', 'regex', 'cidr', or 'in')", match)
+	}
+
+	return result
+}
+
+// ValidateGeoRule validates a geo rule: a continent code ("EU"), an ISO 3166-2 subdivision ("US-CA"),
+// a city as "country:city" ("DE:Berlin") or, for radius rules, the center and a radius in kilometers
+func ValidateGeoRule(ruleType, value string, latitude, longitude, radiusKm float64) *ValidationResult {
+	result := NewValidationResult()
+	value = strings.TrimSpace(value)
+
+	switch ruleType {
+	case "continent":
+		if _, ok := utils.Continents[strings.ToUpper(value)]; !ok {
+			result.AddError("value", "Invalid continent code (must be one of AF, AN, AS, EU, NA, OC, SA)", value)
+		}
+	case "subdivision":
+		if !subdivisionRegex.MatchString(value) {
+			result.AddError("value", "Invalid subdivision (ISO 3166-2 code, e.g. 'US-CA')", value)
+		}
+	case "city":
+		country, city, found := strings.Cut(value, ":")
+		if !found || !countryCodeRegex.MatchString(strings.TrimSpace(country)) || strings.TrimSpace(city) == "" {
+			result.AddError("value", "Invalid city (must be 'country:city', e.g. 'DE:Berlin')", value)
+		} else if len(value) > 150 {
+			result.AddError("value", "City too long (max 150 characters)", value)
+		}
+	case "radius":
+		if latitude < -90 || latitude > 90 {
+			result.AddError("latitude", "Latitude must be between -90 and 90", fmt.Sprint(latitude))
+		}
+		if longitude < -180 || longitude > 180 {
+			result.AddError("longitude", "Longitude must be between -180 and 180", fmt.Sprint(longitude))
+		}
+		if radiusKm <= 0 || radiusKm > utils.MaxDistanceKm {
+			result.AddError("radius_km", fmt.Sprintf("Radius must be positive and at most %.0f km", utils.MaxDistanceKm), fmt.Sprint(radiusKm))
+		}
+	default:
+		result.AddError("type", "Invalid geo rule type (must be 'continent', 'subdivision', 'city', or 'radius')", ruleType)
+	}
+
+	return result
+}
+
+// ValidateCountryGroup validates a country group: an upper case code ("EU", "NORTH_AMERICA")
+// and at least one ISO 3166-1 alpha-2 country code
+func ValidateCountryGroup(code string, countries []string) *ValidationResult {
+	result := NewValidationResult()
+
+	if !groupCodeRegex.MatchString(code) {
+		result.AddError("code", "Invalid group code (2-20 upper case letters, digits or underscores)", code)
+	}
+	if len(countries) == 0 {
+		result.AddError("countries", "At least one country is required", "")
+	} else if len(countries) > 300 {
+		result.AddError("countries", "Too many countries (max 300)", fmt.Sprint(len(countries)))
+	}
+	for _, country := range countries {
+		if !countryCodeRegex.MatchString(strings.TrimSpace(country)) {
+			result.AddError("countries", "Invalid country code (must be 2 letters)", country)
+		}
+	}
+
+	return result
+}
+
+// ValidateRuleValidity validates the validity window of a rule: ttl must be a positive
+// duration ("24h", "90m") and cannot be combined with expires_at, which must lie in the
+// future and after valid_from
+func ValidateRuleValidity(ttl string, validFrom, expiresAt *time.Time) *ValidationResult {
+	result := NewValidationResult()
+
+	if ttl != "" {
+		if expiresAt != nil {
+			result.AddError("ttl", "Specify either ttl or expires_at, not both", ttl)
+			return result
+		}
+		duration, err := time.ParseDuration(ttl)
+		if err != nil {
+			result.AddError("ttl", "Invalid duration (e.g. '30m', '24h')", ttl)
+			return result
+		}
+		if duration <= 0 {
+			result.AddError("ttl", "Duration must be positive", ttl)
+		}
+		return result
+	}
+
+	if expiresAt == nil {
+		return result
+	}
+	if !expiresAt.After(time.Now()) {
+		result.AddError("expires_at", "Expiry must be in the future", expiresAt.Format(time.RFC3339))
+		return result
+	}
+	if validFrom != nil && !expiresAt.After(*validFrom) {
+		result.AddError("expires_at", "Expiry must be after valid_from", expiresAt.Format(time.RFC3339))
+	}
+
+	return result
+}
+
 // ValidatePagination validates pagination parameters
 func ValidatePagination(page, limit string) *ValidationResult {
 	result := NewValidationResult()
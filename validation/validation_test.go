@@ -3,6 +3,7 @@ package validation
 import (
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestValidateIP(t *testing.T) {
@@ -158,6 +159,36 @@ func TestValidateIP(t *testing.T) {
 			errors:   []string{"Invalid CIDR notation"},
 		},
 
+		// IP ranges
+		{
+			name:     "valid range - IPv4",
+			input:    "203.0.113.7-203.0.113.90",
+			expected: true,
+		},
+		{
+			name:     "valid range - IPv6 with spaces",
+			input:    "2001:db8::1 - 2001:db8::ff",
+			expected: true,
+		},
+		{
+			name:     "invalid range - start after end",
+			input:    "203.0.113.90-203.0.113.7",
+			expected: false,
+			errors:   []string{"Invalid IP range"},
+		},
+		{
+			name:     "invalid range - mixed families",
+			input:    "203.0.113.7-2001:db8::1",
+			expected: false,
+			errors:   []string{"Invalid IP range"},
+		},
+		{
+			name:     "invalid range - invalid end",
+			input:    "203.0.113.7-203.0.113.256",
+			expected: false,
+			errors:   []string{"Invalid IP range"},
+		},
+
 		// Length validation
 		{
 			name:     "valid - IPv6 CIDR under limit",
@@ -736,6 +767,11 @@ func TestValidateStatus(t *testing.T) {
 			input:    "whitelisted",
 			expected: true,
 		},
+		{
+			name:     "valid - monitor",
+			input:    "monitor",
+			expected: true,
+		},
 
 		// Invalid statuses
 		{
@@ -748,25 +784,25 @@ func TestValidateStatus(t *testing.T) {
 			name:     "invalid - uppercase",
 			input:    "ALLOWED",
 			expected: false,
-			errors:   []string{"Invalid status (must be 'allowed', 'denied', or 'whitelisted')"},
+			errors:   []string{"Invalid status (must be 'allowed', 'denied', 'whitelisted', or 'monitor')"},
 		},
 		{
 			name:     "invalid - mixed case",
 			input:    "Allowed",
 			expected: false,
-			errors:   []string{"Invalid status (must be 'allowed', 'denied', or 'whitelisted')"},
+			errors:   []string{"Invalid status (must be 'allowed', 'denied', 'whitelisted', or 'monitor')"},
 		},
 		{
 			name:     "invalid - wrong value",
 			input:    "blocked",
 			expected: false,
-			errors:   []string{"Invalid status (must be 'allowed', 'denied', or 'whitelisted')"},
+			errors:   []string{"Invalid status (must be 'allowed', 'denied', 'whitelisted', or 'monitor')"},
 		},
 		{
 			name:     "invalid - partial match",
 			input:    "allow",
 			expected: false,
-			errors:   []string{"Invalid status (must be 'allowed', 'denied', or 'whitelisted')"},
+			errors:   []string{"Invalid status (must be 'allowed', 'denied', 'whitelisted', or 'monitor')"},
 		},
 	}
 
@@ -1215,7 +1251,7 @@ func TestValidateCreateRequest(t *testing.T) {
 				"status":  "invalid",
 			},
 			expected: false,
-			errors:   []string{"Invalid status (must be 'allowed', 'denied', or 'whitelisted')"},
+			errors:   []string{"Invalid status (must be 'allowed', 'denied', 'whitelisted', or 'monitor')"},
 		},
 		{
 			name:       "invalid - email with invalid address",
@@ -1277,7 +1313,7 @@ func TestValidateCreateRequest(t *testing.T) {
 				"status":  "invalid",
 			},
 			expected: false,
-			errors:   []string{"Invalid IP address format", "Invalid status (must be 'allowed', 'denied', or 'whitelisted')"},
+			errors:   []string{"Invalid IP address format", "Invalid status (must be 'allowed', 'denied', 'whitelisted', or 'monitor')"},
 		},
 
 		// Unknown entity type
@@ -2851,3 +2887,233 @@ func TestValidateID(t *testing.T) {
 		})
 	}
 }
+
+func TestValidateContentRule(t *testing.T) {
+	tests := []struct {
+		name      string
+		pattern   string
+		matchType string
+		expected  bool
+	}{
+		{"valid keyword", "viagra", "keyword", true},
+		{"valid phrase", "free money now", "phrase", true},
+		{"valid regex", `bit\.ly/\w+`, "regex", true},
+		{"keyword with spaces", "free money", "keyword", false},
+		{"empty pattern", "  ", "phrase", false},
+		{"invalid regex", "([a-z", "regex", false},
+		{"unknown match type", "spam", "contains", false},
+		{"too long", strings.Repeat("a", 501), "keyword", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := ValidateContentRule(tt.pattern, tt.matchType)
+			if result.IsValid != tt.expected {
+				t.Errorf("ValidateContentRule(%q, %q) = %v, want %v", tt.pattern, tt.matchType, result.IsValid, tt.expected)
+			}
+		})
+	}
+}
+
+func TestValidateEmailDomain(t *testing.T) {
+	tests := []struct {
+		name     string
+		domain   string
+		expected bool
+	}{
+		{"valid domain", "example.com", true},
+		{"valid subdomain wildcard", "*.mailinator.com", true},
+		{"valid tld wildcard", "*.xyz", true},
+		{"trailing dot", "example.com.", true},
+		{"single label", "localhost", false},
+		{"wildcard in the middle", "mail.*.com", false},
+		{"empty label", "example..com", false},
+		{"leading hyphen", "-example.com", false},
+		{"contains at sign", "user@example.com", false},
+		{"empty", "", false},
+		{"too long", strings.Repeat("a.", 128) + "com", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := ValidateEmailDomain(tt.domain)
+			if result.IsValid != tt.expected {
+				t.Errorf("ValidateEmailDomain(%q) = %v, want %v", tt.domain, result.IsValid, tt.expected)
+			}
+		})
+	}
+}
+
+func TestValidateRuleValidity(t *testing.T) {
+	now := time.Now()
+	past := now.Add(-time.Hour)
+	future := now.Add(time.Hour)
+	later := now.Add(2 * time.Hour)
+
+	tests := []struct {
+		name      string
+		ttl       string
+		validFrom *time.Time
+		expiresAt *time.Time
+		expected  bool
+	}{
+		{"no bounds", "", nil, nil, true},
+		{"valid ttl", "24h", nil, nil, true},
+		{"ttl with valid_from", "90m", &future, nil, true},
+		{"expires in the future", "", nil, &future, true},
+		{"window in the future", "", &future, &later, true},
+		{"invalid ttl", "tomorrow", nil, nil, false},
+		{"negative ttl", "-1h", nil, nil, false},
+		{"zero ttl", "0s", nil, nil, false},
+		{"ttl and expires_at", "1h", nil, &future, false},
+		{"expired", "", nil, &past, false},
+		{"expires before valid_from", "", &later, &future, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := ValidateRuleValidity(tt.ttl, tt.validFrom, tt.expiresAt)
+			if result.IsValid != tt.expected {
+				t.Errorf("ValidateRuleValidity(%q) = %v, want %v", tt.ttl, result.IsValid, tt.expected)
+			}
+		})
+	}
+}
+
+func TestValidateVelocityRule(t *testing.T) {
+	tests := []struct {
+		name          string
+		keyFields     string
+		distinctField string
+		window        string
+		expected      bool
+	}{
+		{"single field", "ip", "", "1m", true},
+		{"field pair", "ip,action", "", "10m", true},
+		{"pair with spaces", "email, ip", "", "1h", true},
+		{"distinct field", "email", "ip", "1h", true},
+		{"three fields", "ip,email,username", "", "1m", false},
+		{"duplicate field", "ip,ip", "", "1m", false},
+		{"empty field", "ip,", "", "1m", false},
+		{"invalid field name", "IP Address", "", "1m", false},
+		{"distinct is key field", "email", "email", "1h", false},
+		{"invalid window", "ip", "", "a minute", false},
+		{"zero window", "ip", "", "0s", false},
+		{"window too long", "ip", "", "48h", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := ValidateVelocityRule(tt.keyFields, tt.distinctField, tt.window)
+			if result.IsValid != tt.expected {
+				t.Errorf("ValidateVelocityRule(%q, %q, %q) = %v, want %v", tt.keyFields, tt.distinctField, tt.window, result.IsValid, tt.expected)
+			}
+		})
+	}
+}
+
+func TestValidateCompositeCondition(t *testing.T) {
+	tests := []struct {
+		name     string
+		field    string
+		match    string
+		value    string
+		values   []string
+		expected bool
+	}{
+		{"exact", "country", "exact", "XX", nil, true},
+		{"regex", "user_agent", "regex", "(?i)curl", nil, true},
+		{"cidr", "ip", "cidr", "10.0.0.0/8", nil, true},
+		{"range", "ip", "cidr", "203.0.113.7-203.0.113.90", nil, true},
+		{"in", "asn", "in", "", []string{"AS16509", "AS14061"}, true},
+		{"custom field", "signup_source", "exact", "bot", nil, true},
+		{"invalid field name", "User Agent", "exact", "curl", nil, false},
+		{"empty exact value", "country", "exact", " ", nil, false},
+		{"invalid regex", "user_agent", "regex", "([invalid", nil, false},
+		{"single ip as cidr", "ip", "cidr", "10.0.0.1", nil, false},
+		{"invalid cidr", "ip", "cidr", "10.0.0.0/33", nil, false},
+		{"empty in list", "asn", "in", "", nil, false},
+		{"empty in value", "asn", "in", "", []string{"AS1", ""}, false},
+		{"unknown match type", "country", "prefix", "X", nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := ValidateCompositeCondition(tt.field, tt.match, tt.value, tt.values)
+			if result.IsValid != tt.expected {
+				t.Errorf("ValidateCompositeCondition(%q, %q, %q, %v) = %v, want %v", tt.field, tt.match, tt.value, tt.values, result.IsValid, tt.expected)
+			}
+		})
+	}
+}
+
+func TestValidateGeoRule(t *testing.T) {
+	tests := []struct {
+		name      string
+		ruleType  string
+		value     string
+		latitude  float64
+		longitude float64
+		radiusKm  float64
+		expected  bool
+	}{
+		{"continent", "continent", "EU", 0, 0, 0, true},
+		{"continent lower case", "continent", "na", 0, 0, 0, true},
+		{"unknown continent", "continent", "XX", 0, 0, 0, false},
+		{"subdivision", "subdivision", "US-CA", 0, 0, 0, true},
+		{"numeric subdivision", "subdivision", "FR-75", 0, 0, 0, true},
+		{"subdivision without country", "subdivision", "CA", 0, 0, 0, false},
+		{"city", "city", "DE:Berlin", 0, 0, 0, true},
+		{"city with spaces", "city", "US: San Francisco", 0, 0, 0, true},
+		{"city without country", "city", "Berlin", 0, 0, 0, false},
+		{"city without name", "city", "DE:", 0, 0, 0, false},
+		{"radius", "radius", "", 52.52, 13.405, 25, true},
+		{"radius without radius", "radius", "", 52.52, 13.405, 0, false},
+		{"radius latitude out of range", "radius", "", 95, 13.405, 25, false},
+		{"radius longitude out of range", "radius", "", 52.52, -181, 25, false},
+		{"radius too large", "radius", "", 52.52, 13.405, 30000, false},
+		{"unknown type", "region", "EU", 0, 0, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := ValidateGeoRule(tt.ruleType, tt.value, tt.latitude, tt.longitude, tt.radiusKm)
+			if result.IsValid != tt.expected {
+				t.Errorf("ValidateGeoRule(%q, %q, %v, %v, %v) = %v, want %v", tt.ruleType, tt.value, tt.latitude, tt.longitude, tt.radiusKm, result.IsValid, tt.expected)
+			}
+		})
+	}
+}
+
+func TestValidateCountryGroup(t *testing.T) {
+	tooMany := make([]string, 301)
+	for i := range tooMany {
+		tooMany[i] = "DE"
+	}
+
+	tests := []struct {
+		name      string
+		code      string
+		countries []string
+		expected  bool
+	}{
+		{"group", "EU", []string{"AT", "BE", "DE"}, true},
+		{"underscore and digits", "NORTH_AMERICA_2", []string{"US", "CA"}, true},
+		{"lower case countries", "DACH", []string{"de", "at", "ch"}, true},
+		{"lower case code", "eu", []string{"DE"}, false},
+		{"code too short", "E", []string{"DE"}, false},
+		{"code with dash", "EU-27", []string{"DE"}, false},
+		{"no countries", "EU", nil, false},
+		{"invalid country", "EU", []string{"DE", "DEU"}, false},
+		{"too many countries", "ALL", tooMany, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := ValidateCountryGroup(tt.code, tt.countries)
+			if result.IsValid != tt.expected {
+				t.Errorf("ValidateCountryGroup(%q, %v) = %v, want %v", tt.code, tt.countries, result.IsValid, tt.expected)
+			}
+		})
+	}
+}